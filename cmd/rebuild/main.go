@@ -0,0 +1,61 @@
+// Package main 是Redis排序数据重建工具的入口包
+// Redis数据丢失后，根据MySQL中的帖子表和投票表重建帖子的排序数据
+//
+// 用法：
+//
+//	go run ./cmd/rebuild [-dry-run] [-batch 500] conf/config.yaml
+//
+// 建议先使用 -dry-run 查看差异，确认无误后再实际写入
+// 投票记录通过队列异步写入MySQL，服务运行期间执行重建可能会用稍旧的投票数据覆盖Redis
+package main
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/logger"
+	"bluebell/logic"
+	"bluebell/setting"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "只对比差异，不写入Redis")
+	batch := flag.Int64("batch", 500, "每批处理的帖子数量")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Println("need config file.eg: rebuild [-dry-run] conf/config.yaml")
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *dryRun, *batch); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(configFile string, dryRun bool, batch int64) error {
+	if err := setting.Init(configFile); err != nil {
+		return fmt.Errorf("load config failed, err:%v", err)
+	}
+	if err := logger.Init(setting.Conf.LogConfig, setting.Conf.Mode); err != nil {
+		return fmt.Errorf("init logger failed, err:%v", err)
+	}
+	if err := mysql.Init(setting.Conf.MySQLConfig); err != nil {
+		return fmt.Errorf("init mysql failed, err:%v", err)
+	}
+	defer mysql.Close()
+	if err := redis.Init(setting.Conf.RedisConfig); err != nil {
+		return fmt.Errorf("init redis failed, err:%v", err)
+	}
+	defer redis.Close()
+
+	report, err := logic.RebuildRedis(dryRun, batch)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		return fmt.Errorf("rebuild redis failed, err:%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package controller 提供管理员相关的HTTP请求处理功能
+// 包括查看和触发MySQL与Redis的一致性对账、管理用户角色
+package controller
+
+import (
+	"bluebell/dao/mysql" // 导入MySQL数据访问层，用于错误类型判断
+	"bluebell/logic"     // 导入业务逻辑层，执行对账和管理角色
+	"bluebell/models"    // 导入数据模型，定义角色相关的数据结构
+	"bluebell/setting"   // 导入配置包，读取对账参数
+	"errors"             // 导入错误处理包
+	"strconv"            // 导入字符串转换包，用于解析用户id
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// GetReconcileReportHandler 获取最近一次对账结果的处理函数
+// 还没有执行过对账时返回的data为空
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetReconcileReportHandler(c *gin.Context) {
+	ResponseSuccess(c, logic.GetLastReconcileReport())
+}
+
+// ReconcileHandler 立即执行一次对账的处理函数
+// 使用配置文件中的对账参数，请求会等待对账完成后返回结果
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ReconcileHandler(c *gin.Context) {
+	cfg := setting.Conf.ReconcileConfig
+	report, err := logic.Reconcile(cfg.ReconcileBatchSize, cfg.ReconcileRepair)
+	if errors.Is(err, logic.ErrorReconcileRunning) {
+		ResponseErrorWithMsg(c, CodeServerBusy, err.Error())
+		return
+	}
+	if err != nil {
+		zap.L().Error("logic.Reconcile failed", zap.Error(err))
+		if report == nil {
+			ResponseError(c, CodeServerBusy)
+			return
+		}
+		// 对账中途失败时报告中记录了错误信息和已经检查的部分，一并返回
+		ResponseErrorWithMsg(c, CodeServerBusy, report)
+		return
+	}
+	ResponseSuccess(c, report)
+}
+
+// GetUserRolesHandler 获取用户角色列表的处理函数
+// 返回用户当前在MySQL中的角色以及配置文件指定的管理员角色，普通用户返回空列表
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetUserRolesHandler(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	roles, err := logic.GetUserRoles(uid)
+	if err != nil {
+		zap.L().Error("logic.GetUserRoles failed", zap.Int64("userID", uid), zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, roles)
+}
+
+// GrantRoleHandler 授予用户角色的处理函数
+// 用户下一次刷新token后生效
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GrantRoleHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p, ok := bindUserRoleParam(c)
+	if !ok {
+		return
+	}
+
+	// ==================== 第二步：授予角色 ====================
+	if err := logic.GrantRole(p); err != nil {
+		zap.L().Error("logic.GrantRole failed", zap.Any("param", p), zap.Error(err))
+		responseRoleError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// RevokeRoleHandler 收回用户角色的处理函数
+// 用户下一次刷新token后生效，已经签发的access token在过期前仍然带有该角色
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func RevokeRoleHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p, ok := bindUserRoleParam(c)
+	if !ok {
+		return
+	}
+
+	// ==================== 第二步：收回角色 ====================
+	found, err := logic.RevokeRole(p)
+	if err != nil {
+		zap.L().Error("logic.RevokeRole failed", zap.Any("param", p), zap.Error(err))
+		responseRoleError(c, err)
+		return
+	}
+	if !found {
+		ResponseErrorWithMsg(c, CodeInvalidParam, "用户没有该角色")
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// bindUserRoleParam 绑定授予或收回角色的请求参数，失败时已经返回了错误响应
+func bindUserRoleParam(c *gin.Context) (*models.ParamUserRole, bool) {
+	p := new(models.ParamUserRole)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("user role with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return nil, false
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return nil, false
+	}
+	return p, true
+}
+
+// responseRoleError 根据授予或收回角色返回的错误类型返回对应的错误码
+func responseRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ErrorInvalidRole):
+		ResponseErrorWithMsg(c, CodeInvalidParam, "moderator必须指定社区，admin不能指定社区")
+	case errors.Is(err, mysql.ErrorInvalidID):
+		ResponseErrorWithMsg(c, CodeInvalidParam, "社区不存在")
+	case errors.Is(err, mysql.ErrorUserNotExist):
+		ResponseError(c, CodeUserNotExist)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
@@ -0,0 +1,109 @@
+// Package controller 提供个人API key相关的HTTP请求处理功能
+// 包括创建、查看和吊销API key，这些接口只接受JWT认证
+package controller
+
+import (
+	"bluebell/logic"  // 导入业务逻辑层，处理API key的业务规则
+	"bluebell/models" // 导入数据模型，定义请求参数结构
+	"errors"          // 导入错误处理包
+	"strconv"         // 导入字符串转换包，用于解析路径参数
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// CreateAPIKeyHandler 创建API key的处理函数
+// 完整的key只在创建时返回一次，需要提示用户妥善保存
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func CreateAPIKeyHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamCreateAPIKey)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("CreateAPIKey with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：创建API key ====================
+	key, err := logic.CreateAPIKey(userID, p)
+	if err != nil {
+		zap.L().Error("logic.CreateAPIKey failed", zap.Int64("userID", userID), zap.Error(err))
+		responseAPIKeyError(c, err)
+		return
+	}
+	ResponseSuccess(c, key)
+}
+
+// GetAPIKeyListHandler 获取当前用户的API key列表，不包含完整的key
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetAPIKeyListHandler(c *gin.Context) {
+	// ==================== 第一步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第二步：查询列表 ====================
+	keys, err := logic.GetAPIKeyList(userID)
+	if err != nil {
+		zap.L().Error("logic.GetAPIKeyList failed", zap.Int64("userID", userID), zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, keys)
+}
+
+// RevokeAPIKeyHandler 吊销API key的处理函数，吊销后立即失效
+// 参数 c: Gin上下文，路径参数id为API key的id
+func RevokeAPIKeyHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：吊销 ====================
+	if err := logic.RevokeAPIKey(userID, keyID); err != nil {
+		zap.L().Error("logic.RevokeAPIKey failed",
+			zap.Int64("userID", userID),
+			zap.Int64("keyID", keyID),
+			zap.Error(err))
+		responseAPIKeyError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// responseAPIKeyError 将API key相关的业务错误转换为对应的响应码
+func responseAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ErrorAPIKeyLimit):
+		ResponseError(c, CodeAPIKeyLimit)
+	case errors.Is(err, logic.ErrorAPIKeyNotExist):
+		ResponseError(c, CodeAPIKeyNotExist)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
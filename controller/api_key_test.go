@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/pkg/snowflake"
+	"bluebell/setting"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// savedArg 记录写入数据库的参数
+type savedArg struct {
+	value driver.Value
+}
+
+func (a *savedArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := testutil.MySQL(t)
+	if err := snowflake.Init("2020-07-01", 1); err != nil {
+		t.Fatalf("snowflake.Init failed, err:%v", err)
+	}
+	old := setting.Conf.APIKeyConfig
+	setting.Conf.APIKeyConfig = &setting.APIKeyConfig{APIKeyMaxPerUser: 2}
+	t.Cleanup(func() { setting.Conf.APIKeyConfig = old })
+
+	r := gin.New()
+	r.POST("/api/v1/apikeys", asUser(100), CreateAPIKeyHandler)
+	r.GET("/api/v1/apikeys", asUser(100), GetAPIKeyListHandler)
+	r.DELETE("/api/v1/apikeys/:id", asUser(100), RevokeAPIKeyHandler)
+	body := `{"name": "bot", "scopes": ["vote", "post", "vote"], "expire_days": 30}`
+
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/apikeys", `{"name": "bot", "scopes": ["post", "admin"]}`, ""))
+	assert.Equal(t, CodeInvalidParam, res.Code)
+
+	// 有效的key达到上限
+	mock.ExpectQuery("from api_key").WithArgs(int64(100)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/apikeys", body, ""))
+	assert.Equal(t, CodeAPIKeyLimit, res.Code)
+
+	// 创建成功时返回完整的key，数据库中只保存它的sha256，权限范围去重并排序
+	mock.ExpectQuery("from api_key").WithArgs(int64(100)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	hash := new(savedArg)
+	mock.ExpectExec("insert into api_key").
+		WithArgs(sqlmock.AnyArg(), int64(100), "bot", sqlmock.AnyArg(), hash, "post,vote", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/apikeys", body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	data, _ := res.Data.(map[string]interface{})
+	key, _ := data["key"].(string)
+	assert.True(t, strings.HasPrefix(key, "bb_"), key)
+	assert.Equal(t, key[:11], data["key_prefix"])
+	assert.Equal(t, []interface{}{"post", "vote"}, data["scopes"])
+	assert.NotNil(t, data["expire_time"])
+	sum := sha256.Sum256([]byte(key))
+	assert.Equal(t, hex.EncodeToString(sum[:]), hash.value)
+	assert.NotContains(t, data, "key_hash")
+
+	// 列表中不返回完整的key
+	mock.ExpectQuery("from api_key").WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "user_id", "name", "key_prefix", "scopes"}).
+			AddRow(123, 100, "bot", key[:11], "post,vote"))
+	_, res = doRequest(t, r, newRequest(http.MethodGet, "/api/v1/apikeys", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	list, _ := res.Data.([]interface{})
+	if assert.Len(t, list, 1) {
+		item := list[0].(map[string]interface{})
+		assert.Equal(t, "123", item["key_id"])
+		assert.NotContains(t, item, "key")
+	}
+
+	// 只能吊销自己未吊销的key
+	mock.ExpectExec("update api_key set revoke_time").WithArgs(int64(123), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, res = doRequest(t, r, newRequest(http.MethodDelete, "/api/v1/apikeys/123", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	mock.ExpectExec("update api_key set revoke_time").WithArgs(int64(123), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	_, res = doRequest(t, r, newRequest(http.MethodDelete, "/api/v1/apikeys/123", "", ""))
+	assert.Equal(t, CodeAPIKeyNotExist, res.Code)
+}
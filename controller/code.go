@@ -18,6 +18,43 @@ const (
 
 	CodeNeedLogin    // 需要登录：1006
 	CodeInvalidToken // 无效token：1007
+
+	CodePostNotExist // 帖子不存在：1008
+	CodeNoPermission // 没有权限：1009
+
+	CodeCommentNotExist // 评论不存在：1010
+
+	CodeLoggedInElsewhere // 账号已在其他设备登录：1011
+
+	CodeBannedInCommunity // 被禁止在社区发帖：1012
+	CodePostLocked        // 帖子已锁定：1013
+	CodePinLimit          // 置顶数量已达上限：1014
+
+	CodeReportRepeated // 重复举报：1015
+	CodeReportNotExist // 举报不存在或已处理：1016
+
+	CodeSensitiveWord // 内容包含敏感词：1017
+
+	CodeTooManyRequests // 请求过于频繁：1018
+	CodeLoginLocked     // 登录失败次数过多：1019
+
+	CodeTwoFactorEnabled          // 已开启两步验证：1020
+	CodeTwoFactorNotSetup         // 未开启两步验证：1021
+	CodeInvalidTwoFactorCode      // 两步验证的验证码错误：1022
+	CodeTwoFactorChallengeExpired // 两步验证已过期：1023
+
+	CodeEmailExist        // 邮箱已被使用：1024
+	CodeInvalidEmailToken // 邮件中的链接无效或已过期：1025
+	CodeEmailNotSet       // 未设置邮箱：1026
+	CodeEmailVerified     // 邮箱已验证：1027
+
+	CodeOIDCProviderNotFound // 不支持的第三方登录方式：1028
+	CodeInvalidOIDCState     // 第三方登录请求无效或已过期：1029
+	CodeOIDCLoginFailed      // 第三方登录失败：1030
+	CodeIdentityLinked       // 第三方账号已绑定其他用户：1031
+
+	CodeAPIKeyLimit    // API key数量已达上限：1032
+	CodeAPIKeyNotExist // API key不存在：1033
 )
 
 // codeMsgMap 错误码与错误信息的映射表
@@ -32,6 +69,43 @@ var codeMsgMap = map[ResCode]string{
 
 	CodeNeedLogin:    "需要登录",     // 访问需要认证的接口时未提供有效token
 	CodeInvalidToken: "无效的token", // JWT token格式错误或已过期
+
+	CodePostNotExist: "帖子不存在",  // 帖子不存在或已被删除
+	CodeNoPermission: "没有操作权限", // 当前用户无权执行该操作，如编辑他人的帖子
+
+	CodeCommentNotExist: "评论不存在", // 回复的评论不存在或不属于该帖子
+
+	CodeLoggedInElsewhere: "账号已在其他设备登录", // 单会话模式下，token所属的会话已被新的登录顶替
+
+	CodeBannedInCommunity: "你已被禁止在该社区发帖", // 被版主禁言期间不能在该社区发帖和评论
+	CodePostLocked:        "帖子已锁定，不能投票",  // 帖子被版主锁定
+	CodePinLimit:          "置顶帖子数量已达上限",  // 社区置顶帖子数超过moderation.max_pinned
+
+	CodeReportRepeated: "你已经举报过该内容", // 同一用户对同一对象只能举报一次
+	CodeReportNotExist: "举报不存在或已处理", // 处理举报时对象不存在或已被其他管理员处理
+
+	CodeSensitiveWord: "内容包含敏感词", // sensitive.action为reject时，帖子标题或内容命中敏感词
+
+	CodeTooManyRequests: "请求过于频繁，请稍后再试",   // 触发限流，HTTP状态码为429，Retry-After响应头为需要等待的秒数
+	CodeLoginLocked:     "登录失败次数过多，请稍后再试", // 用户名或IP连续登录失败被临时锁定，HTTP状态码为429
+
+	CodeTwoFactorEnabled:          "已开启两步验证",       // 已开启时不能重新生成密钥，需要先关闭
+	CodeTwoFactorNotSetup:         "未开启两步验证",       // 确认或关闭两步验证时还没有生成密钥
+	CodeInvalidTwoFactorCode:      "验证码错误",         // 验证码错误、已过期或已使用，恢复码不存在或已使用
+	CodeTwoFactorChallengeExpired: "两步验证已过期，请重新登录", // challenge token过期、尝试次数用尽或已使用
+
+	CodeEmailExist:        "邮箱已被使用",   // 验证邮箱时该邮箱已被其他用户验证
+	CodeInvalidEmailToken: "链接无效或已过期", // 邮箱验证或重置密码的token已使用、已过期或邮箱已修改
+	CodeEmailNotSet:       "未设置邮箱",    // 重新发送验证邮件时用户没有设置邮箱
+	CodeEmailVerified:     "邮箱已验证",    // 重新发送验证邮件时邮箱已经验证过
+
+	CodeOIDCProviderNotFound: "不支持的登录方式",         // 配置中没有该身份提供方
+	CodeInvalidOIDCState:     "登录请求无效或已过期，请重新登录", // state不存在、已使用、已过期或与cookie不一致
+	CodeOIDCLoginFailed:      "第三方登录失败",          // 用户拒绝授权、换取或校验ID token失败
+	CodeIdentityLinked:       "该第三方账号已绑定其他用户",    // 绑定时该账号已关联其他用户，或已绑定同一身份提供方的其他账号
+
+	CodeAPIKeyLimit:    "API key数量已达上限", // 有效的API key数量达到api_key.max_per_user，需要先吊销不用的key
+	CodeAPIKeyNotExist: "API key不存在",    // 吊销时key不存在、不属于当前用户或已吊销
 }
 
 // Msg 获取错误码对应的错误信息
@@ -0,0 +1,92 @@
+// Package controller 提供评论相关的HTTP请求处理功能
+// 包括发表评论、获取帖子评论列表等操作
+package controller
+
+import (
+	"bluebell/logic"  // 导入业务逻辑层，处理评论相关的业务规则
+	"bluebell/models" // 导入数据模型，定义评论相关的数据结构
+	"errors"          // 导入错误处理包
+	"strconv"         // 导入字符串转换包，用于类型转换
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// CreateCommentHandler 发表评论的处理函数
+// 对帖子发表评论，或者通过parent_id回复帖子下的某条评论
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func CreateCommentHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	// 从URL路径参数中获取帖子ID
+	pid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("create comment with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// 将JSON请求体绑定到评论参数结构体
+	p := new(models.ParamComment)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("create comment with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：发表评论 ====================
+	comment, err := logic.CreateComment(userID, pid, p)
+	if err != nil {
+		zap.L().Error("logic.CreateComment failed",
+			zap.Int64("pid", pid),
+			zap.Int64("userID", userID),
+			zap.Error(err))
+		if errors.Is(err, logic.ErrorCommentNotExist) {
+			ResponseError(c, CodeCommentNotExist)
+			return
+		}
+		responsePostError(c, err)
+		return
+	}
+
+	// ==================== 第四步：返回新评论 ====================
+	ResponseSuccess(c, comment)
+}
+
+// GetCommentListHandler 获取帖子评论列表的处理函数
+// 返回按parent_id组织好的树形评论列表
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetCommentListHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	pid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("get comment list with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取评论数据 ====================
+	data, err := logic.GetCommentTree(pid)
+	if err != nil {
+		zap.L().Error("logic.GetCommentTree failed",
+			zap.Int64("pid", pid),
+			zap.Error(err))
+		responsePostError(c, err)
+		return
+	}
+
+	// ==================== 第三步：返回评论数据 ====================
+	ResponseSuccess(c, data)
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/pkg/snowflake"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var commentColumns = []string{"comment_id", "post_id", "parent_id", "author_id", "content", "create_time"}
+
+func TestCreateCommentHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := testutil.MySQL(t)
+	if err := snowflake.Init("2020-07-01", 1); err != nil {
+		t.Fatalf("snowflake.Init failed, err:%v", err)
+	}
+	r := gin.New()
+	r.POST("/api/v1/post/:id/comments", asUser(3), CreateCommentHandler)
+	expectNotBanned := func() {
+		mock.ExpectQuery("from community_ban").WithArgs(int64(1), int64(3)).
+			WillReturnRows(sqlmock.NewRows([]string{"community_id", "user_id"}))
+	}
+
+	// 回复的评论属于另一篇帖子
+	expectNormalPost(mock)
+	expectNotBanned()
+	mock.ExpectQuery("where comment_id = ").WithArgs(int64(500)).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(500, 11, 0, 2, "other post", time.Now()))
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/post/10/comments", `{"parent_id": "500", "content": "reply"}`, ""))
+	assert.Equal(t, CodeCommentNotExist, res.Code)
+
+	// 回复同一篇帖子下的评论，返回的评论带有评论时间
+	before := time.Now().Truncate(time.Second)
+	expectNormalPost(mock)
+	expectNotBanned()
+	mock.ExpectQuery("where comment_id = ").WithArgs(int64(501)).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(501, 10, 0, 2, "first", time.Now()))
+	mock.ExpectExec("insert into comment").
+		WithArgs(sqlmock.AnyArg(), int64(10), int64(501), int64(3), "reply", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/post/10/comments", `{"parent_id": "501", "content": "reply"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.Equal(t, "501", dataString(res, "parent_id"))
+	assert.NotEmpty(t, dataString(res, "id"))
+	created, err := time.Parse(time.RFC3339, dataString(res, "create_time"))
+	assert.NoError(t, err)
+	assert.False(t, created.Before(before), "create_time %v before %v", created, before)
+}
+
+func TestGetCommentListHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := testutil.MySQL(t)
+	r := gin.New()
+	r.GET("/api/v1/post/:id/comments", GetCommentListHandler)
+
+	// 按时间正序返回：1和4直接评论帖子，2回复1，3回复2，5的父评论已经不存在，放到第一层
+	now := time.Now()
+	expectNormalPost(mock)
+	mock.ExpectQuery("from comment").WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow(1, 10, 0, 2, "c1", now).
+			AddRow(2, 10, 1, 3, "c2", now).
+			AddRow(3, 10, 2, 2, "c3", now).
+			AddRow(4, 10, 0, 3, "c4", now).
+			AddRow(5, 10, 99, 3, "c5", now))
+	mock.ExpectQuery("from user where user_id in").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(2, "alice").AddRow(3, "bob"))
+	_, res := doRequest(t, r, newRequest(http.MethodGet, "/api/v1/post/10/comments", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+
+	roots, _ := res.Data.([]interface{})
+	ids := func(nodes []interface{}) []string {
+		out := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			out = append(out, n.(map[string]interface{})["id"].(string))
+		}
+		return out
+	}
+	replies := func(node interface{}) []interface{} {
+		r, _ := node.(map[string]interface{})["replies"].([]interface{})
+		return r
+	}
+	assert.Equal(t, []string{"1", "4", "5"}, ids(roots))
+	c1 := roots[0].(map[string]interface{})
+	assert.Equal(t, "alice", c1["author_name"])
+	assert.Equal(t, []string{"2"}, ids(replies(c1)))
+	assert.Equal(t, []string{"3"}, ids(replies(replies(c1)[0])))
+	assert.Empty(t, replies(roots[1]))
+
+	// 已删除的帖子不能查看评论
+	mock.ExpectQuery("from post").WithArgs(int64(11)).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "author_id", "status"}).AddRow(11, 2, models.PostStatusDeleted))
+	_, res = doRequest(t, r, newRequest(http.MethodGet, "/api/v1/post/11/comments", "", ""))
+	assert.Equal(t, CodePostNotExist, res.Code)
+}
@@ -0,0 +1,119 @@
+// Package controller 提供邮箱验证和找回密码相关的HTTP请求处理功能
+// 包括验证邮箱、重新发送验证邮件、忘记密码和重置密码
+package controller
+
+import (
+	"bluebell/dao/mysql" // 导入MySQL数据访问层，判断邮箱已被使用的错误
+	"bluebell/logic"     // 导入业务逻辑层，处理邮箱验证和重置密码
+	"bluebell/models"    // 导入数据模型，定义请求参数结构
+	"errors"             // 导入错误处理包
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// VerifyEmailHandler 验证邮箱的处理函数，对应验证邮件中的链接
+// 参数 c: Gin上下文，查询参数token为验证邮件中的token
+func VerifyEmailHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	token := c.Query("token")
+	if token == "" {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：完成验证 ====================
+	if err := logic.VerifyEmail(token); err != nil {
+		zap.L().Error("logic.VerifyEmail failed", zap.Error(err))
+		responseEmailError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// ResendVerifyEmailHandler 重新发送验证邮件的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ResendVerifyEmailHandler(c *gin.Context) {
+	// ==================== 第一步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第二步：发送验证邮件 ====================
+	if err := logic.ResendVerifyEmail(userID); err != nil {
+		zap.L().Error("logic.ResendVerifyEmail failed", zap.Int64("userID", userID), zap.Error(err))
+		responseEmailError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// ForgotPasswordHandler 忘记密码的处理函数，向已验证的邮箱发送重置密码的链接
+// 不论邮箱是否注册过都返回成功，避免被用来探测邮箱
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ForgotPasswordHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamForgotPassword)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("ForgotPassword with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：发送重置密码邮件 ====================
+	if err := logic.ForgotPassword(p); err != nil {
+		zap.L().Error("logic.ForgotPassword failed", zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// ResetPasswordHandler 重置密码的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ResetPasswordHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamResetPassword)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("ResetPassword with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：设置新密码 ====================
+	if err := logic.ResetPassword(p); err != nil {
+		zap.L().Error("logic.ResetPassword failed", zap.Error(err))
+		responseEmailError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// responseEmailError 将邮箱相关的业务错误转换为对应的响应码
+func responseEmailError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ErrorInvalidEmailToken):
+		ResponseError(c, CodeInvalidEmailToken)
+	case errors.Is(err, logic.ErrorEmailNotSet):
+		ResponseError(c, CodeEmailNotSet)
+	case errors.Is(err, logic.ErrorEmailVerified):
+		ResponseError(c, CodeEmailVerified)
+	case errors.Is(err, mysql.ErrorEmailExist):
+		ResponseError(c, CodeEmailExist)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
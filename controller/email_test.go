@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/pkg/mailer"
+	"bluebell/pkg/snowflake"
+	"bluebell/setting"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// chanMailer 把发送的邮件交给测试读取
+type chanMailer chan *mailer.Message
+
+func (m chanMailer) Send(msg *mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// setupMailer 使用chanMailer发送邮件，邮件中的链接为 https://bluebell.local/<类型>?token=<token>
+func setupMailer(t *testing.T) chanMailer {
+	m := make(chanMailer, 1)
+	mailer.SetMailer(m)
+	old := setting.Conf.MailConfig
+	setting.Conf.MailConfig = &setting.MailConfig{
+		EmailVerifyURL:   "https://bluebell.local/verify?token={token}",
+		PasswordResetURL: "https://bluebell.local/reset?token={token}",
+	}
+	t.Cleanup(func() {
+		mailer.SetMailer(mailer.LogMailer{})
+		setting.Conf.MailConfig = old
+	})
+	return m
+}
+
+// mailToken 等待下一封邮件并取出链接中的token
+func (m chanMailer) mailToken(t *testing.T, to string) string {
+	select {
+	case msg := <-m:
+		assert.Equal(t, to, msg.To)
+		i := strings.Index(msg.Body, "?token=")
+		if i < 0 {
+			t.Fatalf("no token in mail body: %s", msg.Body)
+		}
+		return strings.Fields(msg.Body[i+len("?token="):])[0]
+	case <-time.After(time.Second):
+		t.Fatalf("no mail sent to %s", to)
+	}
+	return ""
+}
+
+// expectUserEmail 预期一次查询用户1的邮箱
+func expectUserEmail(mock sqlmock.Sqlmock, verified bool) {
+	mock.ExpectQuery("from user where user_id").WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "email", "email_verified"}).
+			AddRow(1, "alice", "alice@example.com", verified))
+}
+
+func TestVerifyEmailHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	mails := setupMailer(t)
+
+	r := gin.New()
+	r.GET("/api/v1/email/verify", VerifyEmailHandler)
+	r.POST("/api/v1/email/verify/resend", asUser(1), ResendVerifyEmailHandler)
+
+	// 已经验证过的邮箱不再发送
+	expectUserEmail(mock, true)
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/email/verify/resend", "", ""))
+	assert.Equal(t, CodeEmailVerified, res.Code)
+
+	expectUserEmail(mock, false)
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/email/verify/resend", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	token := mails.mailToken(t, "alice@example.com")
+
+	// 验证的是发送邮件时的邮箱，验证后清空其他用户未验证的同一邮箱
+	mock.ExpectBegin()
+	mock.ExpectQuery("from user where verified_email").WithArgs("alice@example.com", int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("update user set email_verified = 1").WithArgs(int64(1), "alice@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update user set email = NULL").WithArgs("alice@example.com", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	_, res = doRequest(t, r, newRequest(http.MethodGet, "/api/v1/email/verify?token="+token, "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+
+	// 链接只能使用一次
+	_, res = doRequest(t, r, newRequest(http.MethodGet, "/api/v1/email/verify?token="+token, "", ""))
+	assert.Equal(t, CodeInvalidEmailToken, res.Code)
+}
+
+func TestSignUpWithTakenEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	mails := setupMailer(t)
+	if err := snowflake.Init("2020-07-01", 1); err != nil {
+		t.Fatalf("snowflake.Init failed, err:%v", err)
+	}
+
+	r := gin.New()
+	r.POST("/api/v1/signup", SignUpHandler)
+	r.GET("/api/v1/email/verify", VerifyEmailHandler)
+
+	// 注册时不查询邮箱是否已被使用，响应和邮箱没有注册过时一样
+	mock.ExpectQuery("from user where username").WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("insert into user").
+		WithArgs(sqlmock.AnyArg(), "bob", sqlmock.AnyArg(), "alice@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	body := `{"username": "bob", "password": "123456", "confirm_password": "123456", "email": "alice@example.com"}`
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/signup", body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	token := mails.mailToken(t, "alice@example.com")
+
+	// 邮箱已被其他用户验证，点击链接时才提示邮箱已被使用
+	mock.ExpectBegin()
+	mock.ExpectQuery("from user where verified_email").WithArgs("alice@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+	_, res = doRequest(t, r, newRequest(http.MethodGet, "/api/v1/email/verify?token="+token, "", ""))
+	assert.Equal(t, CodeEmailExist, res.Code)
+}
+
+func TestResetPasswordHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	mails := setupMailer(t)
+
+	r := gin.New()
+	r.POST("/api/v1/login", LoginHandler)
+	r.POST("/api/v1/refresh_token", RefreshTokenHandler)
+	r.POST("/api/v1/password/forgot", ForgotPasswordHandler)
+	r.POST("/api/v1/password/reset", ResetPasswordHandler)
+	reset := func(token string) *ResponseData {
+		body := `{"token": "` + token + `", "password": "654321", "confirm_password": "654321"}`
+		_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/password/reset", body, ""))
+		return res
+	}
+
+	// 未注册或未验证的邮箱同样返回成功，但不发送邮件
+	mock.ExpectQuery("from user where email").WithArgs("bob@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "email", "email_verified"}))
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/password/forgot", `{"email": "bob@example.com"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.Empty(t, mails)
+
+	// 重置前已经登录的会话
+	testutil.ExpectLogin(mock, 1, "alice", "123456")
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login", `{"username": "alice", "password": "123456"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	refreshToken := dataString(res, "refresh_token")
+
+	mock.ExpectQuery("from user where email").WithArgs("alice@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "email", "email_verified"}).
+			AddRow(1, "alice", "alice@example.com", true))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/password/forgot", `{"email": "alice@example.com"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	token := mails.mailToken(t, "alice@example.com")
+
+	// 设置新密码后之前的会话全部失效
+	expectUserEmail(mock, true)
+	mock.ExpectExec("update user set password").WithArgs(sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Equal(t, CodeSuccess, reset(token).Code)
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/refresh_token", `{"refresh_token": "`+refreshToken+`"}`, ""))
+	assert.Equal(t, CodeInvalidToken, res.Code)
+
+	// 链接只能使用一次
+	assert.Equal(t, CodeInvalidEmailToken, reset(token).Code)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"bluebell/pkg/jwt"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withToken 代替middlewares.JWTAuthMiddleware（middlewares依赖controller，这里不能导入）
+// 请求中带有有效的token时把用户和token信息保存到上下文，没有token时交给处理函数返回需要登录
+func withToken(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if mc, err := jwt.ParseToken(token); err == nil {
+		c.Set(CtxUserIDKey, mc.UserID)
+		c.Set(CtxTokenIDKey, mc.Id)
+		c.Set(CtxTokenExpireKey, time.Unix(mc.ExpiresAt, 0))
+		c.Set(CtxSessionIDKey, mc.SessionID)
+	}
+	c.Next()
+}
+
+// asUser 模拟已经登录的用户
+func asUser(userID int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(CtxUserIDKey, userID)
+		c.Next()
+	}
+}
+
+// doRequest 发送请求，响应是JSON时按统一格式解析，data解析到map中
+func doRequest(t *testing.T, r http.Handler, req *http.Request) (*httptest.ResponseRecorder, *ResponseData) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	res := new(ResponseData)
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+			t.Fatalf("json.Unmarshal w.Body failed, err:%v\n", err)
+		}
+	}
+	return w, res
+}
+
+// newRequest 创建请求，body为空时不带请求体
+func newRequest(method, url, body, token string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// dataString 取出响应data中的字符串字段
+func dataString(res *ResponseData, key string) string {
+	data, _ := res.Data.(map[string]interface{})
+	s, _ := data[key].(string)
+	return s
+}
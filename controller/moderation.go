@@ -0,0 +1,236 @@
+// Package controller 提供社区管理相关的HTTP请求处理功能
+// 包括版主移除、锁定、置顶帖子，禁止用户发帖以及查看管理日志
+package controller
+
+import (
+	"bluebell/dao/mysql" // 导入MySQL数据访问层，用于错误类型判断
+	"bluebell/logic"     // 导入业务逻辑层，处理社区管理的业务规则
+	"bluebell/models"    // 导入数据模型，定义社区管理相关的数据结构
+	"errors"             // 导入错误处理包
+	"io"                 // 导入io包，用于判断请求体是否为空
+	"strconv"            // 导入字符串转换包，用于解析路径参数
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// 以下处理函数的路由都带有社区id路径参数:id，并且已经由RequirePermission中间件校验过操作人的权限
+
+// RemovePostHandler 版主移除帖子的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func RemovePostHandler(c *gin.Context) {
+	moderatePost(c, "logic.RemovePost", logic.RemovePost)
+}
+
+// LockPostHandler 版主锁定帖子的处理函数，锁定后不允许投票
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func LockPostHandler(c *gin.Context) {
+	moderatePost(c, "logic.LockPost", func(operatorID, communityID, pid int64, p *models.ParamModeration) error {
+		return logic.LockPost(operatorID, communityID, pid, true, p)
+	})
+}
+
+// UnlockPostHandler 版主解锁帖子的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func UnlockPostHandler(c *gin.Context) {
+	moderatePost(c, "logic.LockPost", func(operatorID, communityID, pid int64, p *models.ParamModeration) error {
+		return logic.LockPost(operatorID, communityID, pid, false, p)
+	})
+}
+
+// PinPostHandler 版主置顶帖子的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func PinPostHandler(c *gin.Context) {
+	moderatePost(c, "logic.PinPost", logic.PinPost)
+}
+
+// UnpinPostHandler 版主取消置顶的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func UnpinPostHandler(c *gin.Context) {
+	moderatePost(c, "logic.UnpinPost", logic.UnpinPost)
+}
+
+// moderatePost 版主操作帖子的通用流程：解析参数、获取操作人、执行操作、返回结果
+// 参数 name: 业务逻辑函数名，用于记录日志
+// 参数 fn: 执行操作的业务逻辑函数
+func moderatePost(c *gin.Context, name string, fn func(operatorID, communityID, pid int64, p *models.ParamModeration) error) {
+	// ==================== 第一步：参数获取和验证 ====================
+	communityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	pid, err := strconv.ParseInt(c.Param("pid"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	p := new(models.ParamModeration)
+	if !bindModerationParam(c, p) {
+		return
+	}
+
+	// ==================== 第二步：获取操作人 ====================
+	operatorID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：执行操作 ====================
+	if err := fn(operatorID, communityID, pid, p); err != nil {
+		zap.L().Error(name+" failed",
+			zap.Int64("communityID", communityID),
+			zap.Int64("pid", pid),
+			zap.Int64("operatorID", operatorID),
+			zap.Error(err))
+		if errors.Is(err, mysql.ErrorPinLimit) {
+			ResponseError(c, CodePinLimit)
+			return
+		}
+		responsePostError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// BanUserHandler 禁止用户在社区发帖的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func BanUserHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	communityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	p := new(models.ParamBanUser)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("ban user with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：获取操作人 ====================
+	operatorID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：禁止用户发帖 ====================
+	if err := logic.BanUser(operatorID, communityID, p); err != nil {
+		zap.L().Error("logic.BanUser failed",
+			zap.Int64("communityID", communityID),
+			zap.Int64("userID", p.UserID),
+			zap.Error(err))
+		if errors.Is(err, mysql.ErrorUserNotExist) {
+			ResponseError(c, CodeUserNotExist)
+			return
+		}
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// UnbanUserHandler 解除用户在社区禁言的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func UnbanUserHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	communityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("uid"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	p := new(models.ParamModeration)
+	if !bindModerationParam(c, p) {
+		return
+	}
+
+	// ==================== 第二步：获取操作人 ====================
+	operatorID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：解除禁言 ====================
+	ok, err := logic.UnbanUser(operatorID, communityID, userID, p)
+	if err != nil {
+		zap.L().Error("logic.UnbanUser failed",
+			zap.Int64("communityID", communityID),
+			zap.Int64("userID", userID),
+			zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	if !ok {
+		ResponseErrorWithMsg(c, CodeInvalidParam, "该用户没有被禁言")
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// GetCommunityBanListHandler 获取社区禁言列表的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetCommunityBanListHandler(c *gin.Context) {
+	communityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	data, err := logic.GetCommunityBanList(communityID)
+	if err != nil {
+		zap.L().Error("logic.GetCommunityBanList failed", zap.Int64("communityID", communityID), zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, data)
+}
+
+// GetModLogListHandler 获取社区管理日志的处理函数
+// 支持page和size分页参数，新的日志在前
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetModLogListHandler(c *gin.Context) {
+	communityID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	page, size := getPageInfo(c)
+	data, err := logic.GetModLogList(communityID, page, size)
+	if err != nil {
+		zap.L().Error("logic.GetModLogList failed", zap.Int64("communityID", communityID), zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, data)
+}
+
+// bindModerationParam 绑定版主操作的请求参数，请求体可以为空
+// 返回值: 绑定失败时已经返回了错误响应，返回false
+func bindModerationParam(c *gin.Context, p *models.ParamModeration) bool {
+	err := c.ShouldBindJSON(p)
+	if err == nil || errors.Is(err, io.EOF) {
+		return true
+	}
+	zap.L().Error("moderation with invalid param", zap.Error(err))
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		ResponseError(c, CodeInvalidParam)
+		return false
+	}
+	ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+	return false
+}
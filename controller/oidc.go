@@ -0,0 +1,142 @@
+// Package controller 提供第三方登录（OIDC）相关的HTTP请求处理功能
+// 包括跳转到身份提供方登录、处理登录后的回调以及绑定第三方账号
+package controller
+
+import (
+	"bluebell/logic"  // 导入业务逻辑层，处理第三方登录的业务规则
+	"bluebell/models" // 导入数据模型，定义请求参数结构
+	"crypto/subtle"   // 导入常量时间比较，用于校验state
+	"errors"          // 导入错误处理包
+	"fmt"             // 导入格式化输出包
+	"net/http"        // 导入HTTP包，提供重定向状态码
+
+	"github.com/gin-gonic/gin" // 导入Gin Web框架
+	"go.uber.org/zap"          // 导入结构化日志包
+)
+
+// oidcStateCookie 保存state的cookie，跳转回来时校验是发起登录的同一个浏览器，防止登录CSRF
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/oidc"
+)
+
+// OIDCAuthorizeHandler 第三方登录的入口，重定向到身份提供方的登录页面
+// 参数 c: Gin上下文，路径参数provider为身份提供方名称
+func OIDCAuthorizeHandler(c *gin.Context) {
+	// ==================== 第一步：生成登录地址 ====================
+	provider := c.Param("provider")
+	authURL, state, err := logic.OIDCAuthURL(provider, 0)
+	if err != nil {
+		zap.L().Error("logic.OIDCAuthURL failed", zap.String("provider", provider), zap.Error(err))
+		responseOIDCError(c, err)
+		return
+	}
+
+	// ==================== 第二步：重定向到身份提供方 ====================
+	setOIDCStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCLinkHandler 已登录的用户绑定第三方账号，返回身份提供方的登录地址
+// 前端跳转到该地址，登录后身份提供方跳转回回调接口完成绑定
+// 参数 c: Gin上下文，路径参数provider为身份提供方名称
+func OIDCLinkHandler(c *gin.Context) {
+	// ==================== 第一步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第二步：生成登录地址 ====================
+	provider := c.Param("provider")
+	authURL, state, err := logic.OIDCAuthURL(provider, userID)
+	if err != nil {
+		zap.L().Error("logic.OIDCAuthURL failed",
+			zap.String("provider", provider),
+			zap.Int64("userID", userID),
+			zap.Error(err))
+		responseOIDCError(c, err)
+		return
+	}
+	setOIDCStateCookie(c, state)
+	ResponseSuccess(c, gin.H{
+		"auth_url": authURL,
+	})
+}
+
+// OIDCCallbackHandler 身份提供方登录后跳转回来的处理函数
+// 登录时返回与普通登录相同的token，开启了两步验证的用户返回challenge token；绑定时返回绑定结果
+// 参数 c: Gin上下文，路径参数provider为身份提供方名称
+func OIDCCallbackHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamOIDCCallback)
+	if err := c.ShouldBindQuery(p); err != nil {
+		zap.L().Error("OIDCCallback with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	// state必须与发起登录时写入cookie的一致
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(p.State)) != 1 {
+		ResponseError(c, CodeInvalidOIDCState)
+		return
+	}
+	setOIDCStateCookie(c, "")
+
+	// ==================== 第二步：校验ID token，登录或绑定 ====================
+	provider := c.Param("provider")
+	user, linked, err := logic.OIDCCallback(provider, p)
+	if err != nil {
+		zap.L().Error("logic.OIDCCallback failed", zap.String("provider", provider), zap.Error(err))
+		responseOIDCError(c, err)
+		return
+	}
+
+	// ==================== 第三步：返回成功响应 ====================
+	if linked {
+		ResponseSuccess(c, gin.H{
+			"linked":   true,
+			"provider": provider,
+		})
+		return
+	}
+	if user.ChallengeToken != "" {
+		ResponseSuccess(c, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     user.ChallengeToken,
+		})
+		return
+	}
+	ResponseSuccess(c, gin.H{
+		"user_id":       fmt.Sprintf("%d", user.UserID),
+		"user_name":     user.Username,
+		"token":         user.Token,
+		"refresh_token": user.RefreshToken,
+	})
+}
+
+// setOIDCStateCookie 写入state的cookie，state为空时删除cookie
+func setOIDCStateCookie(c *gin.Context, state string) {
+	maxAge := int(logic.OIDCStateExpire().Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+	c.SetCookie(oidcStateCookie, state, maxAge, oidcStateCookiePath, "", c.Request.TLS != nil, true)
+}
+
+// responseOIDCError 将第三方登录相关的业务错误转换为对应的响应码
+func responseOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ErrorOIDCProviderNotFound):
+		ResponseError(c, CodeOIDCProviderNotFound)
+	case errors.Is(err, logic.ErrorInvalidOIDCState):
+		ResponseError(c, CodeInvalidOIDCState)
+	case errors.Is(err, logic.ErrorOIDCLoginFailed):
+		ResponseError(c, CodeOIDCLoginFailed)
+	case errors.Is(err, logic.ErrorIdentityLinked):
+		ResponseError(c, CodeIdentityLinked)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/pkg/oidc"
+	"bluebell/pkg/snowflake"
+	"bluebell/setting"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// testIdP 本地的OIDC身份提供方，授权地址上的登录由测试调用login模拟，用户的sub固定为10001
+type testIdP struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> 授权请求的参数
+}
+
+// setupOIDC 启动身份提供方并注册为mock
+func setupOIDC(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed, err:%v", err)
+	}
+	idp := &testIdP{key: key, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		idp.mu.Unlock()
+		if !ok || oidc.S256Challenge(r.PostFormValue("code_verifier")) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &oidc.Claims{
+			Email:         "q1mi@example.com",
+			EmailVerified: true,
+			Nonce:         auth.Get("nonce"),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    idp.URL,
+				Subject:   "10001",
+				Audience:  jwt.ClaimStrings{"bluebell"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = "k1"
+		idToken, _ := token.SignedString(key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	p, err := oidc.NewProvider("mock", &setting.OIDCProviderConfig{
+		Issuer:       idp.URL,
+		ClientID:     "bluebell",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://127.0.0.1:8084/api/v1/oidc/mock/callback",
+		Scopes:       []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("oidc.NewProvider failed, err:%v", err)
+	}
+	oidc.SetProviders(map[string]*oidc.Provider{"mock": p})
+	t.Cleanup(func() { oidc.SetProviders(map[string]*oidc.Provider{}) })
+	return idp
+}
+
+// login 模拟用户在授权地址登录成功，返回跳转回bluebell时的回调地址
+func (idp *testIdP) login(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("url.Parse failed, err:%v", err)
+	}
+	q := u.Query()
+	code := "code-" + q.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = q
+	idp.mu.Unlock()
+	return "/api/v1/oidc/mock/callback?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+}
+
+// stateKey Redis中保存登录请求的key
+func stateKey(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return redis.Prefix + redis.KeyOIDCStatePF + hex.EncodeToString(sum[:])
+}
+
+// withStateCookie 带上发起登录时写入的state cookie
+func withStateCookie(req *http.Request, state string) *http.Request {
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+	return req
+}
+
+func TestOIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	idp := setupOIDC(t)
+	if err := snowflake.Init("2020-07-01", 1); err != nil {
+		t.Fatalf("snowflake.Init failed, err:%v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/v1/oidc/:provider/authorize", OIDCAuthorizeHandler)
+	r.GET("/api/v1/oidc/:provider/callback", OIDCCallbackHandler)
+
+	_, res := doRequest(t, r, newRequest(http.MethodGet, "/api/v1/oidc/unknown/authorize", "", ""))
+	assert.Equal(t, CodeOIDCProviderNotFound, res.Code)
+
+	// 重定向到身份提供方，state写入cookie，登录请求保存在Redis中
+	w, _ := doRequest(t, r, newRequest(http.MethodGet, "/api/v1/oidc/mock/authorize", "", ""))
+	assert.Equal(t, http.StatusFound, w.Code)
+	authURL := w.Header().Get("Location")
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	state := u.Query().Get("state")
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, oidcStateCookie, cookies[0].Name)
+		assert.Equal(t, state, cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+	assert.True(t, m.Exists(stateKey(state)))
+	callback := idp.login(t, authURL)
+
+	// 其他浏览器带着回调地址访问时cookie不一致，登录请求不受影响
+	_, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), "other"))
+	assert.Equal(t, CodeInvalidOIDCState, res.Code)
+	assert.True(t, m.Exists(stateKey(state)))
+
+	// 第一次登录时按邮箱的用户名部分自动注册，保存身份提供方验证过的邮箱
+	mock.ExpectQuery("from user_identity").WithArgs("mock", "10001").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}))
+	mock.ExpectQuery("from user where username").WithArgs("q1mi").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("from user where verified_email").WithArgs("q1mi@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into user").
+		WithArgs(sqlmock.AnyArg(), "q1mi", sqlmock.AnyArg(), "q1mi@example.com", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update user set email = NULL").WithArgs("q1mi@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into user_identity").
+		WithArgs(sqlmock.AnyArg(), "mock", "10001", "q1mi@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("from user_totp").WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_counter"}))
+	mock.ExpectQuery("from user_role").WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "community_id"}))
+	w, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), state))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.Equal(t, "q1mi", dataString(res, "user_name"))
+	assert.NotEmpty(t, dataString(res, "token"))
+	assert.NotEmpty(t, dataString(res, "refresh_token"))
+	// 登录完成后删除state cookie
+	cookies = w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, -1, cookies[0].MaxAge)
+	}
+
+	// state只能使用一次
+	assert.False(t, m.Exists(stateKey(state)))
+	_, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), state))
+	assert.Equal(t, CodeInvalidOIDCState, res.Code)
+}
+
+func TestOIDCLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	idp := setupOIDC(t)
+
+	r := gin.New()
+	r.POST("/api/v1/oidc/:provider/link", asUser(5), OIDCLinkHandler)
+	r.GET("/api/v1/oidc/:provider/callback", OIDCCallbackHandler)
+	link := func() (callback, state string) {
+		_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/oidc/mock/link", "", ""))
+		assert.Equal(t, CodeSuccess, res.Code)
+		authURL := dataString(res, "auth_url")
+		u, _ := url.Parse(authURL)
+		return idp.login(t, authURL), u.Query().Get("state")
+	}
+
+	// 用户在身份提供方拒绝授权
+	callback, state := link()
+	denied := "/api/v1/oidc/mock/callback?" + url.Values{"state": {state}, "error": {"access_denied"}}.Encode()
+	_, res := doRequest(t, r, withStateCookie(newRequest(http.MethodGet, denied, "", ""), state))
+	assert.Equal(t, CodeOIDCLoginFailed, res.Code)
+	// 被拒绝的请求也消耗了state
+	_, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), state))
+	assert.Equal(t, CodeInvalidOIDCState, res.Code)
+
+	// 绑定到发起请求的用户
+	callback, state = link()
+	mock.ExpectExec("insert ignore into user_identity").
+		WithArgs(int64(5), "mock", "10001", "q1mi@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	_, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), state))
+	assert.Equal(t, CodeSuccess, res.Code)
+	data, _ := res.Data.(map[string]interface{})
+	assert.Equal(t, true, data["linked"])
+
+	// 身份提供方账号已经绑定了其他用户
+	callback, state = link()
+	mock.ExpectExec("insert ignore into user_identity").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("from user_identity").WithArgs("mock", "10001").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(6, "bob"))
+	_, res = doRequest(t, r, withStateCookie(newRequest(http.MethodGet, callback, "", ""), state))
+	assert.Equal(t, CodeIdentityLinked, res.Code)
+}
@@ -5,6 +5,7 @@ package controller
 import (
 	"bluebell/logic"  // 导入业务逻辑层，处理帖子相关的业务规则
 	"bluebell/models" // 导入数据模型，定义帖子相关的数据结构
+	"errors"          // 导入错误处理包
 	"strconv"         // 导入字符串转换包，用于类型转换
 
 	"github.com/gin-gonic/gin" // 导入Gin Web框架
@@ -45,7 +46,7 @@ func CreatePostHandler(c *gin.Context) {
 	if err := logic.CreatePost(p); err != nil {
 		// 创建失败，记录错误日志
 		zap.L().Error("logic.CreatePost(p) failed", zap.Error(err))
-		ResponseError(c, CodeServerBusy)
+		responsePostError(c, err)
 		return
 	}
 
@@ -76,6 +77,11 @@ func GetPostDetailHandler(c *gin.Context) {
 	if err != nil {
 		// 获取失败，记录错误日志
 		zap.L().Error("logic.GetPostById(pid) failed", zap.Error(err))
+		if errors.Is(err, logic.ErrorPostNotExist) {
+			// 帖子不存在或已被删除
+			ResponseError(c, CodePostNotExist)
+			return
+		}
 		ResponseError(c, CodeServerBusy)
 		return
 	}
@@ -84,6 +90,97 @@ func GetPostDetailHandler(c *gin.Context) {
 	ResponseSuccess(c, data)
 }
 
+// UpdatePostHandler 编辑帖子的处理函数
+// 只有帖子作者本人可以修改帖子的标题和内容
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func UpdatePostHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	// 从URL路径参数中获取帖子ID
+	pid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("update post with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// 将JSON请求体绑定到编辑参数结构体
+	p := new(models.ParamUpdatePost)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("update post with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：编辑帖子 ====================
+	if err := logic.UpdatePost(userID, pid, p); err != nil {
+		zap.L().Error("logic.UpdatePost failed",
+			zap.Int64("pid", pid),
+			zap.Int64("userID", userID),
+			zap.Error(err))
+		responsePostError(c, err)
+		return
+	}
+
+	// ==================== 第四步：返回成功响应 ====================
+	ResponseSuccess(c, nil)
+}
+
+// DeletePostHandler 删除帖子的处理函数
+// 只有帖子作者本人可以删除帖子，删除为软删除
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func DeletePostHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	pid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		zap.L().Error("delete post with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：删除帖子 ====================
+	if err := logic.DeletePost(userID, pid); err != nil {
+		zap.L().Error("logic.DeletePost failed",
+			zap.Int64("pid", pid),
+			zap.Int64("userID", userID),
+			zap.Error(err))
+		responsePostError(c, err)
+		return
+	}
+
+	// ==================== 第四步：返回成功响应 ====================
+	ResponseSuccess(c, nil)
+}
+
+// responsePostError 将帖子相关的业务错误转换为对应的响应码
+func responsePostError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, logic.ErrorPostNotExist):
+		ResponseError(c, CodePostNotExist)
+	case errors.Is(err, logic.ErrorNoPermission):
+		ResponseError(c, CodeNoPermission)
+	case errors.Is(err, logic.ErrorBannedInCommunity):
+		ResponseError(c, CodeBannedInCommunity)
+	case errors.Is(err, logic.ErrorSensitiveWord):
+		ResponseError(c, CodeSensitiveWord)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
+
 // GetPostListHandler 获取帖子列表的处理函数（基础版本）
 // 获取分页的帖子列表，按默认排序方式
 // 参数 c: Gin上下文，包含HTTP请求和响应信息
@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -43,3 +47,73 @@ func TestCreatePostHandler(t *testing.T) {
 	}
 	assert.Equal(t, res.Code, CodeNeedLogin)
 }
+
+// expectNormalPost 预期一次查询作者为2的正常帖子10
+func expectNormalPost(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("from post").WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "title", "content", "author_id", "community_id", "status"}).
+			AddRow(10, "old", "old content", 2, 1, models.PostStatusNormal))
+}
+
+func TestUpdatePostHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := testutil.MySQL(t)
+	r := gin.New()
+	r.PUT("/api/v1/post/:id", asUser(2), UpdatePostHandler)
+	r.PUT("/anonymous/:id", UpdatePostHandler)
+	body := `{"title": "test", "content": "just a test"}`
+
+	_, res := doRequest(t, r, newRequest(http.MethodPut, "/anonymous/10", body, ""))
+	assert.Equal(t, CodeNeedLogin, res.Code)
+	_, res = doRequest(t, r, newRequest(http.MethodPut, "/api/v1/post/abc", body, ""))
+	assert.Equal(t, CodeInvalidParam, res.Code)
+
+	// 作者本人编辑
+	expectNormalPost(mock)
+	mock.ExpectExec("update post set title").WithArgs("test", "just a test", int64(10), models.PostStatusNormal).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, res = doRequest(t, r, newRequest(http.MethodPut, "/api/v1/post/10", body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+
+	// 其他用户不能编辑
+	r2 := gin.New()
+	r2.PUT("/api/v1/post/:id", asUser(3), UpdatePostHandler)
+	expectNormalPost(mock)
+	_, res = doRequest(t, r2, newRequest(http.MethodPut, "/api/v1/post/10", body, ""))
+	assert.Equal(t, CodeNoPermission, res.Code)
+
+	// 已删除的帖子不能编辑
+	mock.ExpectQuery("from post").WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "author_id", "status"}).AddRow(10, 2, models.PostStatusDeleted))
+	_, res = doRequest(t, r, newRequest(http.MethodPut, "/api/v1/post/10", body, ""))
+	assert.Equal(t, CodePostNotExist, res.Code)
+}
+
+func TestDeletePostHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	r := gin.New()
+	r.DELETE("/api/v1/post/:id", asUser(2), DeletePostHandler)
+	r2 := gin.New()
+	r2.DELETE("/api/v1/post/:id", asUser(3), DeletePostHandler)
+	_, _ = m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, 1, "10")
+	_, _ = m.SAdd(redis.Prefix+redis.KeyCommunitySetPF+"1", "10")
+
+	// 其他用户不能删除
+	expectNormalPost(mock)
+	_, res := doRequest(t, r2, newRequest(http.MethodDelete, "/api/v1/post/10", "", ""))
+	assert.Equal(t, CodeNoPermission, res.Code)
+
+	// 作者删除时软删除并取消置顶，同时从Redis中移除
+	expectNormalPost(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("update post set status").WithArgs(models.PostStatusDeleted, int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("delete from community_pin").WithArgs(int64(10)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	_, res = doRequest(t, r, newRequest(http.MethodDelete, "/api/v1/post/10", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.False(t, m.Exists(redis.Prefix+redis.KeyPostTimeZSet))
+	assert.False(t, m.Exists(redis.Prefix+redis.KeyCommunitySetPF+"1"))
+}
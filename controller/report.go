@@ -0,0 +1,129 @@
+// Package controller 提供用户举报相关的HTTP请求处理功能
+// 包括举报内容、管理员查看和处理举报
+package controller
+
+import (
+	"bluebell/logic"  // 导入业务逻辑层，处理举报相关的业务规则
+	"bluebell/models" // 导入数据模型，定义举报相关的数据结构
+	"errors"          // 导入错误处理包
+	"strconv"         // 导入字符串转换包，用于解析路径参数
+
+	"github.com/gin-gonic/gin"               // 导入Gin Web框架
+	"github.com/go-playground/validator/v10" // 导入参数验证器
+	"go.uber.org/zap"                        // 导入结构化日志包
+)
+
+// CreateReportHandler 举报内容的处理函数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func CreateReportHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamReport)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("create report with invalid param", zap.Error(err))
+		errs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+		ResponseErrorWithMsg(c, CodeInvalidParam, removeTopStruct(errs.Translate(trans)))
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：保存举报 ====================
+	if err := logic.CreateReport(userID, p); err != nil {
+		zap.L().Error("logic.CreateReport failed",
+			zap.Int64("userID", userID),
+			zap.Int64("targetID", p.TargetID),
+			zap.Error(err))
+		if errors.Is(err, logic.ErrorReportRepeated) {
+			ResponseError(c, CodeReportRepeated)
+			return
+		}
+		responsePostError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// GetReportListHandler 获取被举报对象列表的处理函数
+// 默认返回待处理的对象，按未处理的举报数从多到少排序，并附带按原因统计的举报数
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func GetReportListHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := &models.ParamReportList{
+		Status: models.ReportStatusOpen,
+		Page:   1,
+		Size:   10,
+	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		zap.L().Error("GetReportListHandler with invalid params", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取列表 ====================
+	data, err := logic.GetReportList(p)
+	if err != nil {
+		zap.L().Error("logic.GetReportList failed", zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, data)
+}
+
+// ResolveReportHandler 举报成立的处理函数，移除被举报的内容
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ResolveReportHandler(c *gin.Context) {
+	handleReport(c, "logic.ResolveReport", logic.ResolveReport)
+}
+
+// DismissReportHandler 举报不成立的处理函数，自动隐藏的内容恢复正常
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func DismissReportHandler(c *gin.Context) {
+	handleReport(c, "logic.DismissReport", logic.DismissReport)
+}
+
+// handleReport 处理举报的通用流程
+// 参数 name: 业务逻辑函数名，用于记录日志
+// 参数 fn: 执行处理的业务逻辑函数
+func handleReport(c *gin.Context, name string, fn func(handlerID, id int64, p *models.ParamModeration) error) {
+	// ==================== 第一步：参数获取和验证 ====================
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+	p := new(models.ParamModeration)
+	if !bindModerationParam(c, p) {
+		return
+	}
+
+	// ==================== 第二步：获取处理人 ====================
+	handlerID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：处理举报 ====================
+	if err := fn(handlerID, id, p); err != nil {
+		zap.L().Error(name+" failed",
+			zap.Int64("id", id),
+			zap.Int64("handlerID", handlerID),
+			zap.Error(err))
+		if errors.Is(err, logic.ErrorReportNotExist) {
+			ResponseError(c, CodeReportNotExist)
+			return
+		}
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/setting"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setReportConfig 替换举报配置，测试结束后恢复
+func setReportConfig(t *testing.T, cfg *setting.ReportConfig) {
+	old := setting.Conf.ReportConfig
+	setting.Conf.ReportConfig = cfg
+	t.Cleanup(func() { setting.Conf.ReportConfig = old })
+}
+
+// expectReport 预期一次对帖子10的举报，举报后帖子的未处理举报数为count，inserted为false时表示重复举报
+func expectReport(mock sqlmock.Sqlmock, userID, count int64, inserted bool) {
+	mock.ExpectQuery("from post").WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "title", "content", "author_id", "community_id", "status"}).
+			AddRow(10, "t", "c", 2, 1, models.PostStatusNormal))
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into report_target").
+		WithArgs(models.ReportTargetPost, int64(10), int64(1), models.ReportStatusOpen).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("from report_target").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "target_type", "target_id", "community_id", "report_count", "status"}).
+			AddRow(5, models.ReportTargetPost, 10, 1, count, models.ReportStatusOpen))
+	if !inserted {
+		mock.ExpectExec("insert ignore into report").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectExec("insert ignore into report").WithArgs(int64(5), userID, "spam", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestCreateReportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	setReportConfig(t, &setting.ReportConfig{HideThreshold: 2})
+
+	r := gin.New()
+	url := "/api/v1/report"
+	r.POST(url, asUser(100), CreateReportHandler)
+	r.POST("/anonymous", CreateReportHandler)
+	body := `{"target_type": 1, "target_id": "10", "reason": "spam"}`
+
+	// 参数错误和未登录时不查询数据库
+	_, res := doRequest(t, r, newRequest(http.MethodPost, url, `{"target_type": 1, "target_id": "10", "reason": "dislike"}`, ""))
+	assert.Equal(t, CodeInvalidParam, res.Code)
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/anonymous", body, ""))
+	assert.Equal(t, CodeNeedLogin, res.Code)
+
+	// 帖子加入Redis的排序集合，自动隐藏后应当被移除
+	_, _ = m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, 1, "10")
+	_, _ = m.ZAdd(redis.Prefix+redis.KeyPostScoreZSet, 1, "10")
+	_, _ = m.SAdd(redis.Prefix+redis.KeyCommunitySetPF+"1", "10")
+
+	// 第一次举报，未达到阈值，帖子保持正常
+	expectReport(mock, 100, 1, true)
+	_, res = doRequest(t, r, newRequest(http.MethodPost, url, body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	members, _ := m.ZMembers(redis.Prefix + redis.KeyPostTimeZSet)
+	assert.Equal(t, []string{"10"}, members)
+
+	// 同一用户重复举报，回滚对汇总记录的累加
+	expectReport(mock, 100, 2, false)
+	_, res = doRequest(t, r, newRequest(http.MethodPost, url, body, ""))
+	assert.Equal(t, CodeReportRepeated, res.Code)
+
+	// 另一个用户举报后达到阈值，帖子被隐藏并写入管理日志，同时从Redis中移除
+	r2 := gin.New()
+	r2.POST(url, asUser(101), CreateReportHandler)
+	expectReport(mock, 101, 2, true)
+	mock.ExpectBegin()
+	mock.ExpectExec("update post set status").
+		WithArgs(models.PostStatusHidden, int64(10), models.PostStatusNormal).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("insert into mod_log").
+		WithArgs(int64(1), int64(0), models.ModActionHidePost, int64(10), "被举报2次").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	_, res = doRequest(t, r2, newRequest(http.MethodPost, url, body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.False(t, m.Exists(redis.Prefix+redis.KeyPostTimeZSet))
+	assert.False(t, m.Exists(redis.Prefix+redis.KeyPostScoreZSet))
+	assert.False(t, m.Exists(redis.Prefix+redis.KeyCommunitySetPF+"1"))
+
+	// 已经隐藏的帖子不能再举报
+	mock.ExpectQuery("from post").WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "community_id", "status"}).
+			AddRow(10, 1, models.PostStatusHidden))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, url, body, ""))
+	assert.Equal(t, CodePostNotExist, res.Code)
+}
@@ -3,11 +3,19 @@ package controller
 import (
 	"errors"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-const CtxUserIDKey = "userID"
+const (
+	CtxUserIDKey      = "userID"
+	CtxTokenIDKey     = "tokenID"     // 当前access token的jti
+	CtxTokenExpireKey = "tokenExpire" // 当前access token的过期时间，time.Time类型
+	CtxSessionIDKey   = "sessionID"   // 当前access token所属的登录会话id
+	CtxUserRolesKey   = "userRoles"   // 当前用户的角色，models.Roles类型
+	CtxAPIKeyIDKey    = "apiKeyID"    // 使用API key访问时为API key的id，使用JWT访问时不存在
+)
 
 var ErrorUserNotLogin = errors.New("用户未登录")
 
@@ -26,6 +34,17 @@ func getCurrentUserID(c *gin.Context) (userID int64, err error) {
 	return
 }
 
+// getCurrentToken 获取当前请求使用的access token的id、所属会话和过期时间
+func getCurrentToken(c *gin.Context) (jti, sessionID string, expiresAt time.Time, err error) {
+	jti = c.GetString(CtxTokenIDKey)
+	sessionID = c.GetString(CtxSessionIDKey)
+	expiresAt = c.GetTime(CtxTokenExpireKey)
+	if jti == "" || expiresAt.IsZero() {
+		err = ErrorUserNotLogin
+	}
+	return
+}
+
 // getPageInfo 获取分页参数
 // 从URL查询参数中获取页码(page)和每页大小(size)
 // 如果参数无效或缺失，使用默认值
@@ -3,7 +3,10 @@
 package controller
 
 import (
+	"math"     // 导入数学包，用于把等待时间向上取整为秒
 	"net/http" // 导入HTTP包，提供HTTP状态码等常量
+	"strconv"  // 导入字符串转换包，用于生成Retry-After响应头
+	"time"     // 导入时间包，表示需要等待的时间
 
 	"github.com/gin-gonic/gin" // 导入Gin Web框架
 )
@@ -62,3 +65,22 @@ func ResponseSuccess(c *gin.Context, data interface{}) {
 		Data: data,              // 返回具体的数据内容
 	})
 }
+
+// ResponseTooManyRequests 返回限流响应
+// 与其他业务错误不同，限流使用HTTP 429状态码，方便客户端和网关识别，
+// 并通过Retry-After响应头告诉客户端多少秒后可以重试（至少1秒）
+// 参数 c: Gin上下文
+// 参数 code: 错误码，如CodeTooManyRequests、CodeLoginLocked
+// 参数 retryAfter: 需要等待的时间
+func ResponseTooManyRequests(c *gin.Context, code ResCode, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusTooManyRequests, &ResponseData{
+		Code: code,
+		Msg:  code.Msg(),
+		Data: nil,
+	})
+}
@@ -0,0 +1,143 @@
+// Package controller 提供两步验证相关的HTTP请求处理功能
+// 包括开启、确认、关闭两步验证以及两步验证登录
+package controller
+
+import (
+	"bluebell/logic"  // 导入业务逻辑层，处理两步验证的业务规则
+	"bluebell/models" // 导入数据模型，定义请求参数结构
+	"errors"          // 导入错误处理包
+	"fmt"             // 导入格式化输出包
+
+	"github.com/gin-gonic/gin" // 导入Gin Web框架
+	"go.uber.org/zap"          // 导入结构化日志包
+)
+
+// SetupTwoFactorHandler 开启两步验证的处理函数，生成密钥并返回otpauth URI
+// 此时两步验证还未生效，需要调用ConfirmTwoFactorHandler提交验证码确认
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func SetupTwoFactorHandler(c *gin.Context) {
+	// ==================== 第一步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第二步：生成密钥 ====================
+	data, err := logic.SetupTwoFactor(userID)
+	if err != nil {
+		zap.L().Error("logic.SetupTwoFactor failed", zap.Int64("userID", userID), zap.Error(err))
+		responseTwoFactorError(c, err)
+		return
+	}
+	ResponseSuccess(c, data)
+}
+
+// ConfirmTwoFactorHandler 确认开启两步验证的处理函数，返回一次性恢复码
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func ConfirmTwoFactorHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamTwoFactorCode)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("ConfirmTwoFactor with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：校验验证码并开启 ====================
+	codes, err := logic.ConfirmTwoFactor(userID, p)
+	if err != nil {
+		zap.L().Error("logic.ConfirmTwoFactor failed", zap.Int64("userID", userID), zap.Error(err))
+		responseTwoFactorError(c, err)
+		return
+	}
+	// 恢复码只在这里返回一次，需要提示用户妥善保存
+	ResponseSuccess(c, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactorHandler 关闭两步验证的处理函数，需要提交验证码或恢复码
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func DisableTwoFactorHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamTwoFactorCode)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("DisableTwoFactor with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：获取当前用户信息 ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第三步：校验验证码并关闭 ====================
+	if err := logic.DisableTwoFactor(userID, p, c.ClientIP()); err != nil {
+		zap.L().Error("logic.DisableTwoFactor failed", zap.Int64("userID", userID), zap.Error(err))
+		responseTwoFactorError(c, err)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// LoginTwoFactorHandler 两步验证登录的处理函数
+// 提交登录时返回的challenge token和验证码（或恢复码），成功后返回与普通登录相同的token
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func LoginTwoFactorHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamLoginTwoFactor)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("LoginTwoFactor with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：校验验证码并签发token ====================
+	user, err := logic.LoginTwoFactor(p, c.ClientIP())
+	if err != nil {
+		zap.L().Error("logic.LoginTwoFactor failed", zap.Error(err))
+		responseTwoFactorError(c, err)
+		return
+	}
+
+	// ==================== 第三步：返回成功响应 ====================
+	ResponseSuccess(c, gin.H{
+		"user_id":       fmt.Sprintf("%d", user.UserID),
+		"user_name":     user.Username,
+		"token":         user.Token,
+		"refresh_token": user.RefreshToken,
+	})
+}
+
+// responseTwoFactorError 将两步验证相关的业务错误转换为对应的响应码
+func responseTwoFactorError(c *gin.Context, err error) {
+	// 验证码错误次数过多被临时锁定
+	var locked *logic.LoginLockedError
+	if errors.As(err, &locked) {
+		ResponseTooManyRequests(c, CodeLoginLocked, locked.RetryAfter)
+		return
+	}
+	switch {
+	case errors.Is(err, logic.ErrorTwoFactorEnabled):
+		ResponseError(c, CodeTwoFactorEnabled)
+	case errors.Is(err, logic.ErrorTwoFactorNotSetup):
+		ResponseError(c, CodeTwoFactorNotSetup)
+	case errors.Is(err, logic.ErrorInvalidTwoFactorCode):
+		ResponseError(c, CodeInvalidTwoFactorCode)
+	case errors.Is(err, logic.ErrorTwoFactorChallenge):
+		ResponseError(c, CodeTwoFactorChallengeExpired)
+	default:
+		ResponseError(c, CodeServerBusy)
+	}
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/pkg/password"
+	"bluebell/pkg/totp"
+	"bluebell/setting"
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// savedSecret 记录SetupTwoFactor生成并写入数据库的密钥
+// 匹配到密钥时把它加入之后回查user_totp的结果中，模拟写入成功
+type savedSecret struct {
+	rows   *sqlmock.Rows
+	secret string
+}
+
+func (s *savedSecret) Match(v driver.Value) bool {
+	secret, ok := v.(string)
+	if ok && s.secret == "" {
+		s.secret = secret
+		s.rows.AddRow(100, secret, false, 0)
+	}
+	return ok
+}
+
+// totpRows 用户100已经开启两步验证的user_totp查询结果
+func totpRows(secret string, enabled bool) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_counter"}).AddRow(100, secret, enabled, 0)
+}
+
+func TestTwoFactorHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	old := setting.Conf.TwoFactorConfig
+	setting.Conf.TwoFactorConfig = &setting.TwoFactorConfig{RecoveryCodes: 2}
+	t.Cleanup(func() { setting.Conf.TwoFactorConfig = old })
+
+	r := gin.New()
+	r.POST("/api/v1/2fa/setup", asUser(100), SetupTwoFactorHandler)
+	r.POST("/api/v1/2fa/confirm", asUser(100), ConfirmTwoFactorHandler)
+	r.POST("/api/v1/login", LoginHandler)
+	r.POST("/api/v1/login/2fa", LoginTwoFactorHandler)
+
+	// ==================== 生成密钥 ====================
+	mock.ExpectQuery("from user where user_id").WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(100, "alice"))
+	saved := &savedSecret{rows: sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_counter"})}
+	mock.ExpectExec("insert into user_totp").WithArgs(int64(100), saved).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(saved.rows)
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/2fa/setup", "", ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	secret := dataString(res, "secret")
+	assert.Equal(t, saved.secret, secret)
+	assert.Contains(t, dataString(res, "otpauth_uri"), "secret="+secret)
+
+	// ==================== 确认开启 ====================
+	// 错误的验证码不开启
+	code, _ := totp.Code(secret, time.Now())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, false))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/2fa/confirm", `{"code": "`+wrong+`"}`, ""))
+	assert.Equal(t, CodeInvalidTwoFactorCode, res.Code)
+
+	// 正确的验证码开启两步验证，并返回配置数量的恢复码
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, false))
+	mock.ExpectBegin()
+	mock.ExpectExec("update user_totp set enabled = 1").WithArgs(sqlmock.AnyArg(), int64(100), secret).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("delete from user_recovery_code").WithArgs(int64(100)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into user_recovery_code").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into user_recovery_code").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/2fa/confirm", `{"code": "`+code+`"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	codes, _ := res.Data.(map[string]interface{})["recovery_codes"].([]interface{})
+	assert.Len(t, codes, 2)
+
+	// ==================== 登录 ====================
+	// 密码正确后只返回challenge token，不签发身份令牌
+	hash, _ := password.Hash("secret123")
+	mock.ExpectQuery("from user where username").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "password"}).AddRow(100, "alice", hash))
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login", `{"username": "alice", "password": "secret123"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	challenge := dataString(res, "challenge_token")
+	assert.NotEmpty(t, challenge)
+	assert.Empty(t, dataString(res, "token"))
+
+	// 不存在的恢复码
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+	mock.ExpectExec("update user_recovery_code").WithArgs(int64(100), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	body := `{"challenge_token": "` + challenge + `", "code": "aaaaa-bbbbb"}`
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, CodeInvalidTwoFactorCode, res.Code)
+
+	// 已经使用过的验证码
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+	mock.ExpectExec("update user_totp set last_counter").WillReturnResult(sqlmock.NewResult(0, 0))
+	body = `{"challenge_token": "` + challenge + `", "code": "` + code + `"}`
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, CodeInvalidTwoFactorCode, res.Code)
+
+	// 验证码正确，签发身份令牌
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+	mock.ExpectExec("update user_totp set last_counter").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("from user_role").WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "community_id"}))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	assert.Equal(t, "100", dataString(res, "user_id"))
+	assert.NotEmpty(t, dataString(res, "token"))
+	assert.NotEmpty(t, dataString(res, "refresh_token"))
+
+	// challenge token只能完成一次登录
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, CodeTwoFactorChallengeExpired, res.Code)
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	old := setting.Conf.LoginGuardConfig
+	setting.Conf.LoginGuardConfig = &setting.LoginGuardConfig{UserMaxAttempts: 1, BaseLockout: 60, MaxLockout: 60}
+	t.Cleanup(func() { setting.Conf.LoginGuardConfig = old })
+
+	r := gin.New()
+	r.POST("/api/v1/login", LoginHandler)
+	r.POST("/api/v1/login/2fa", LoginTwoFactorHandler)
+	r.POST("/api/v1/2fa/disable", asUser(100), DisableTwoFactorHandler)
+
+	secret := "JBSWY3DPEHPK3PXP"
+	code, _ := totp.Code(secret, time.Now())
+	hash, _ := password.Hash("secret123")
+	expectUser := func() {
+		mock.ExpectQuery("from user where username").WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "password"}).AddRow(100, "alice", hash))
+	}
+	wrongRecoveryCode := func() {
+		mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+		mock.ExpectExec("update user_recovery_code").WithArgs(int64(100), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	// ==================== 登录 ====================
+	// 密码错误一次
+	expectUser()
+	_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login", `{"username": "alice", "password": "wrong"}`, ""))
+	assert.Equal(t, CodeInvalidPassword, res.Code)
+
+	// 密码正确但还没有通过两步验证，不清除失败次数
+	expectUser()
+	mock.ExpectQuery("from user_totp").WithArgs(int64(100)).WillReturnRows(totpRows(secret, true))
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login", `{"username": "alice", "password": "secret123"}`, ""))
+	assert.Equal(t, CodeSuccess, res.Code)
+	challenge := dataString(res, "challenge_token")
+
+	// 恢复码错误同样计入失败次数，超过上限后锁定
+	wrongRecoveryCode()
+	body := `{"challenge_token": "` + challenge + `", "code": "aaaaa-bbbbb"}`
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, CodeInvalidTwoFactorCode, res.Code)
+
+	// 锁定期间正确的验证码也不再校验
+	body = `{"challenge_token": "` + challenge + `", "code": "` + code + `"}`
+	w, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login/2fa", body, ""))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, CodeLoginLocked, res.Code)
+
+	// ==================== 关闭两步验证 ====================
+	m.FlushAll()
+	expectUserByID := func() {
+		mock.ExpectQuery("from user where user_id").WithArgs(int64(100)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(100, "alice"))
+	}
+	for i := 0; i < 2; i++ {
+		expectUserByID()
+		wrongRecoveryCode()
+		_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/2fa/disable", `{"code": "aaaaa-bbbbb"}`, ""))
+		assert.Equal(t, CodeInvalidTwoFactorCode, res.Code)
+	}
+	expectUserByID()
+	w, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/2fa/disable", `{"code": "`+code+`"}`, ""))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, CodeLoginLocked, res.Code)
+}
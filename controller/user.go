@@ -6,8 +6,10 @@ import (
 	"bluebell/dao/mysql" // 导入MySQL数据访问层，用于错误类型判断
 	"bluebell/logic"     // 导入业务逻辑层，处理具体的业务规则
 	"bluebell/models"    // 导入数据模型，定义请求参数结构
+	"bluebell/pkg/jwt"   // 导入JWT工具包，用于返回签名公钥
 	"errors"             // 导入错误处理包
 	"fmt"                // 导入格式化输出包
+	"net/http"           // 导入HTTP包，提供HTTP状态码等常量
 
 	"github.com/go-playground/validator/v10" // 导入参数验证器
 	"go.uber.org/zap"                        // 导入结构化日志包
@@ -88,27 +90,125 @@ func LoginHandler(c *gin.Context) {
 
 	// ==================== 第二步：业务逻辑处理 ====================
 	// 调用业务逻辑层进行用户登录验证
-	user, err := logic.Login(p)
+	user, err := logic.Login(p, c.ClientIP())
 	if err != nil {
 		// 登录失败，记录错误日志（包含用户名信息）
 		zap.L().Error("logic.Login failed", zap.String("username", p.Username), zap.Error(err))
 
 		// 判断具体错误类型，返回相应的错误码
+		// 开启login_guard.uniform_error时，用户名不存在也返回密码错误
+		var locked *logic.LoginLockedError
+		if errors.As(err, &locked) {
+			// 失败次数过多被临时锁定
+			ResponseTooManyRequests(c, CodeLoginLocked, locked.RetryAfter)
+			return
+		}
 		if errors.Is(err, mysql.ErrorUserNotExist) {
 			// 用户不存在错误
 			ResponseError(c, CodeUserNotExist)
 			return
 		}
-		// 密码错误
-		ResponseError(c, CodeInvalidPassword)
+		if errors.Is(err, mysql.ErrorInvalidPassword) {
+			// 密码错误
+			ResponseError(c, CodeInvalidPassword)
+			return
+		}
+		// 数据库或Redis异常
+		ResponseError(c, CodeServerBusy)
 		return
 	}
 
 	// ==================== 第三步：返回成功响应 ====================
+	// 开启了两步验证的用户只返回challenge token，客户端提交验证码到 /login/2fa 完成登录
+	if user.ChallengeToken != "" {
+		ResponseSuccess(c, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     user.ChallengeToken,
+		})
+		return
+	}
 	// 登录成功，返回用户信息和JWT token
 	ResponseSuccess(c, gin.H{
-		"user_id":   fmt.Sprintf("%d", user.UserID), // 将int64类型的用户ID转换为字符串返回，避免前端精度丢失
-		"user_name": user.Username,                  // 返回用户名
-		"token":     user.Token,                     // 返回JWT token，用于后续接口认证
+		"user_id":       fmt.Sprintf("%d", user.UserID), // 将int64类型的用户ID转换为字符串返回，避免前端精度丢失
+		"user_name":     user.Username,                  // 返回用户名
+		"token":         user.Token,                     // 返回JWT token（access token），用于后续接口认证
+		"refresh_token": user.RefreshToken,              // 返回refresh token，access token过期后用于换取新的token
 	})
 }
+
+// RefreshTokenHandler 处理刷新token请求
+// 使用refresh token换取新的access token和refresh token，旧的refresh token随即失效
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func RefreshTokenHandler(c *gin.Context) {
+	// ==================== 第一步：参数获取和验证 ====================
+	p := new(models.ParamRefreshToken)
+	if err := c.ShouldBindJSON(p); err != nil {
+		zap.L().Error("RefreshToken with invalid param", zap.Error(err))
+		ResponseError(c, CodeInvalidParam)
+		return
+	}
+
+	// ==================== 第二步：业务逻辑处理 ====================
+	user, err := logic.RefreshToken(p)
+	if err != nil {
+		zap.L().Error("logic.RefreshToken failed", zap.Error(err))
+		if errors.Is(err, logic.ErrorInvalidRefreshToken) {
+			ResponseError(c, CodeInvalidToken)
+			return
+		}
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+
+	// ==================== 第三步：返回新的token ====================
+	ResponseSuccess(c, gin.H{
+		"user_id":       fmt.Sprintf("%d", user.UserID),
+		"user_name":     user.Username,
+		"token":         user.Token,
+		"refresh_token": user.RefreshToken,
+	})
+}
+
+// LogoutHandler 处理退出登录请求
+// 吊销当前使用的access token和它所属的会话；请求体中带有refresh_token时，同时吊销refresh token所属的会话
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func LogoutHandler(c *gin.Context) {
+	// ==================== 第一步：获取当前用户和token ====================
+	userID, err := getCurrentUserID(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+	jti, sessionID, expiresAt, err := getCurrentToken(c)
+	if err != nil {
+		ResponseError(c, CodeNeedLogin)
+		return
+	}
+
+	// ==================== 第二步：参数获取 ====================
+	// 请求体可以为空
+	p := new(models.ParamLogout)
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(p); err != nil {
+			zap.L().Error("Logout with invalid param", zap.Error(err))
+			ResponseError(c, CodeInvalidParam)
+			return
+		}
+	}
+
+	// ==================== 第三步：吊销token ====================
+	if err := logic.Logout(userID, jti, sessionID, expiresAt, p); err != nil {
+		zap.L().Error("logic.Logout failed", zap.Int64("userID", userID), zap.Error(err))
+		ResponseError(c, CodeServerBusy)
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// JWKSHandler 返回token签名公钥列表（JWKS）
+// 按RFC 7517的格式直接返回，不使用统一响应格式，便于其他服务的JWT库直接读取
+// 只包含RS256和EdDSA密钥的公钥，HS256密钥不公开
+// 参数 c: Gin上下文，包含HTTP请求和响应信息
+func JWKSHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jwt.PublicKeys())
+}
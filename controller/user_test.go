@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/logic"
+	"bluebell/pkg/jwt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenHandlers(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/login", LoginHandler)
+	r.POST("/api/v1/refresh_token", RefreshTokenHandler)
+	r.POST("/api/v1/logout", withToken, LogoutHandler)
+
+	login := func() (token, refreshToken string) {
+		testutil.ExpectLogin(mock, 1, "alice", "123456")
+		_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/login", `{"username": "alice", "password": "123456"}`, ""))
+		assert.Equal(t, CodeSuccess, res.Code)
+		return dataString(res, "token"), dataString(res, "refresh_token")
+	}
+	refresh := func(refreshToken string) *ResponseData {
+		_, res := doRequest(t, r, newRequest(http.MethodPost, "/api/v1/refresh_token", `{"refresh_token": "`+refreshToken+`"}`, ""))
+		return res
+	}
+
+	// refresh token使用一次后更换
+	_, rt1 := login()
+	mock.ExpectQuery("from user_role").WithArgs(1).WillReturnRows(mock.NewRows([]string{"user_id", "role", "community_id"}))
+	res := refresh(rt1)
+	assert.Equal(t, CodeSuccess, res.Code)
+	rt2 := dataString(res, "refresh_token")
+	assert.NotEqual(t, rt1, rt2)
+	assert.NotEmpty(t, dataString(res, "token"))
+
+	// 旧的refresh token再次出现，整个会话被吊销，新的refresh token也不能再使用
+	assert.Equal(t, CodeInvalidToken, refresh(rt1).Code)
+	assert.Equal(t, CodeInvalidToken, refresh(rt2).Code)
+
+	// 未登录不能退出登录
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/logout", "", ""))
+	assert.Equal(t, CodeNeedLogin, res.Code)
+
+	// 不带refresh token退出登录，access token和同一会话的refresh token都失效
+	token, rt3 := login()
+	_, res = doRequest(t, r, newRequest(http.MethodPost, "/api/v1/logout", "", token))
+	assert.Equal(t, CodeSuccess, res.Code)
+	mc, _ := jwt.ParseToken(token)
+	revoked, err := logic.IsTokenRevoked(mc.Id, mc.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	assert.Equal(t, CodeInvalidToken, refresh(rt3).Code)
+}
@@ -5,6 +5,7 @@ package controller
 import (
 	"bluebell/logic"  // 导入业务逻辑层，处理投票相关的业务规则
 	"bluebell/models" // 导入数据模型，定义投票相关的数据结构
+	"errors"          // 导入错误处理包
 
 	"go.uber.org/zap" // 导入结构化日志包
 
@@ -61,6 +62,10 @@ func PostVoteController(c *gin.Context) {
 	if err := logic.VoteForPost(userID, p); err != nil {
 		// 投票失败，记录错误日志
 		zap.L().Error("logic.VoteForPost() failed", zap.Error(err))
+		if errors.Is(err, logic.ErrorPostLocked) {
+			ResponseError(c, CodePostLocked)
+			return
+		}
 		ResponseError(c, CodeServerBusy)
 		return
 	}
@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"bluebell/models"
+)
+
+// CountAPIKeys 统计用户未吊销且未过期的API key数量
+func CountAPIKeys(uid int64) (count int64, err error) {
+	sqlStr := `select count(*) from api_key
+	where user_id = ? and revoke_time is null and (expire_time is null or expire_time > now())
+	`
+	err = db.Get(&count, sqlStr, uid)
+	return
+}
+
+// InsertAPIKey 保存新创建的API key
+func InsertAPIKey(k *models.APIKey) (err error) {
+	sqlStr := `insert into api_key(key_id, user_id, name, key_prefix, key_hash, scopes, expire_time)
+	values(?,?,?,?,?,?,?)
+	`
+	_, err = db.Exec(sqlStr, k.KeyID, k.UserID, k.Name, k.KeyPrefix, k.KeyHash, k.Scopes, k.ExpireTime)
+	return
+}
+
+// GetAPIKeyList 查询用户未吊销的API key，包括已过期的，按创建时间从新到旧排序
+func GetAPIKeyList(uid int64) (keys []*models.APIKey, err error) {
+	keys = make([]*models.APIKey, 0)
+	sqlStr := `select key_id, user_id, name, key_prefix, scopes, expire_time, last_used_time, last_used_ip, create_time
+	from api_key
+	where user_id = ? and revoke_time is null
+	order by id desc
+	`
+	err = db.Select(&keys, sqlStr, uid)
+	return
+}
+
+// GetAPIKeyByHash 根据key的sha256查询未吊销的API key，不存在时返回sql.ErrNoRows
+func GetAPIKeyByHash(keyHash string) (k *models.APIKey, err error) {
+	k = new(models.APIKey)
+	sqlStr := `select key_id, user_id, name, key_prefix, scopes, expire_time, last_used_time, last_used_ip, create_time
+	from api_key
+	where key_hash = ? and revoke_time is null
+	`
+	err = db.Get(k, sqlStr, keyHash)
+	return
+}
+
+// RevokeAPIKey 吊销用户的API key
+// 返回值 ok: key不存在、不属于该用户或已吊销时为false
+func RevokeAPIKey(uid, keyID int64) (ok bool, err error) {
+	sqlStr := `update api_key set revoke_time = now() where key_id = ? and user_id = ? and revoke_time is null`
+	ret, err := db.Exec(sqlStr, keyID, uid)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateAPIKeyLastUsed 记录API key最近一次使用的时间和IP
+func UpdateAPIKeyLastUsed(keyID int64, ip string) (err error) {
+	sqlStr := `update api_key set last_used_time = now(), last_used_ip = ? where key_id = ?`
+	_, err = db.Exec(sqlStr, ip, keyID)
+	return
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"bluebell/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateComment 创建评论
+// 评论时间由这里指定而不是使用数据库默认值，保证返回给调用方的评论带有与comment表一致的时间
+func CreateComment(c *models.Comment) (err error) {
+	if c.CreateTime.IsZero() {
+		// create_time字段精度为秒
+		c.CreateTime = time.Now().Truncate(time.Second)
+	}
+	sqlStr := `insert into comment(
+	comment_id, post_id, parent_id, author_id, content, create_time)
+	values (?, ?, ?, ?, ?, ?)
+	`
+	_, err = db.Exec(sqlStr, c.ID, c.PostID, c.ParentID, c.AuthorID, c.Content, c.CreateTime)
+	return
+}
+
+// GetCommentById 根据id查询单条评论
+func GetCommentById(cid int64) (comment *models.Comment, err error) {
+	comment = new(models.Comment)
+	sqlStr := `select
+	comment_id, post_id, parent_id, author_id, content, create_time
+	from comment
+	where comment_id = ?
+	`
+	err = db.Get(comment, sqlStr, cid)
+	return
+}
+
+// GetCommentListByPostID 查询帖子下的全部评论，按评论时间正序排列
+func GetCommentListByPostID(pid int64) (comments []*models.Comment, err error) {
+	sqlStr := `select
+	comment_id, post_id, parent_id, author_id, content, create_time
+	from comment
+	where post_id = ?
+	order by create_time, id
+	`
+	comments = make([]*models.Comment, 0)
+	err = db.Select(&comments, sqlStr, pid)
+	return
+}
+
+// GetCommentCountByPostIDs 批量统计帖子的评论数
+// 返回值: 帖子id到评论数的映射，没有评论的帖子不会出现在结果中
+func GetCommentCountByPostIDs(pids []int64) (counts map[int64]int64, err error) {
+	counts = make(map[int64]int64, len(pids))
+	if len(pids) == 0 {
+		return
+	}
+	sqlStr := `select post_id, count(*) as num
+	from comment
+	where post_id in (?)
+	group by post_id
+	`
+	query, args, err := sqlx.In(sqlStr, pids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		PostID int64 `db:"post_id"`
+		Num    int64 `db:"num"`
+	}
+	if err = db.Select(&rows, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.PostID] = row.Num
+	}
+	return
+}
@@ -33,3 +33,16 @@ func GetCommunityDetailByID(id int64) (community *models.CommunityDetail, err er
 	}
 	return community, err
 }
+
+// CheckCommunityExist 检查指定id的社区是否存在
+func CheckCommunityExist(id int64) (err error) {
+	sqlStr := `select count(community_id) from community where community_id = ?`
+	var count int64
+	if err = db.Get(&count, sqlStr, id); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrorInvalidID
+	}
+	return nil
+}
@@ -1,10 +1,47 @@
 package mysql
 
-import "errors"
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
 
 var (
 	ErrorUserExist       = errors.New("用户已存在")
 	ErrorUserNotExist    = errors.New("用户不存在")
+	ErrorEmailExist      = errors.New("邮箱已被使用")
 	ErrorInvalidPassword = errors.New("用户名或密码错误")
 	ErrorInvalidID       = errors.New("无效的ID")
+	ErrorPinLimit        = errors.New("置顶帖子数量已达上限")
+	ErrorReportExist     = errors.New("已经举报过")
+	ErrorIdentityExist   = errors.New("第三方账号已被绑定")
 )
+
+// MySQL中表示服务不可用的错误码
+const (
+	errTooManyConnections = 1040 // 连接数已满
+	errServerShutdown     = 1053 // 服务正在关闭
+)
+
+// IsUnavailable 是否为连接失败、连接断开等数据库不可用的错误
+// 这类错误与写入的数据无关，应该等数据库恢复后重试，而不是当作数据有问题
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == errTooManyConnections || myErr.Number == errServerShutdown
+	}
+	return false
+}
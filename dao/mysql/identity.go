@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"bluebell/models"
+	"bluebell/pkg/password"
+)
+
+// GetUserByIdentity 根据身份提供方账号查询关联的用户，没有关联时返回sql.ErrNoRows
+func GetUserByIdentity(provider, subject string) (user *models.User, err error) {
+	user = new(models.User)
+	sqlStr := `select u.user_id, u.username from user_identity i
+	join user u on u.user_id = i.user_id
+	where i.provider = ? and i.subject = ?
+	`
+	err = db.Get(user, sqlStr, provider, subject)
+	return
+}
+
+// InsertUserWithIdentity 第一次通过身份提供方登录时创建用户并关联身份提供方账号
+// 参数 user: 新用户，Password为随机密码，Email为身份提供方验证过的邮箱，可以为空
+// 保存了已验证的邮箱时，其他用户未验证的同一邮箱被清空
+func InsertUserWithIdentity(user *models.User, identity *models.UserIdentity) (err error) {
+	hash, err := password.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	var email interface{}
+	if user.Email != "" {
+		email = user.Email
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	sqlStr := `insert into user(user_id, username, password, email, email_verified) values(?,?,?,?,?)`
+	if _, err = tx.Exec(sqlStr, user.UserID, user.Username, hash, email, user.EmailVerified); err != nil {
+		return err
+	}
+	if user.Email != "" && user.EmailVerified {
+		if err = reclaimEmail(tx, user.UserID, user.Email); err != nil {
+			return err
+		}
+	}
+	sqlStr = `insert into user_identity(user_id, provider, subject, email) values(?,?,?,?)`
+	if _, err = tx.Exec(sqlStr, user.UserID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LinkUserIdentity 已有用户绑定身份提供方账号
+// 身份提供方账号已关联其他用户、或用户已绑定过该身份提供方的其他账号时返回ErrorIdentityExist
+func LinkUserIdentity(identity *models.UserIdentity) (err error) {
+	sqlStr := `insert ignore into user_identity(user_id, provider, subject, email) values(?,?,?,?)`
+	ret, err := db.Exec(sqlStr, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return err
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrorIdentityExist
+	}
+	return nil
+}
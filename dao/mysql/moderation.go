@@ -0,0 +1,231 @@
+package mysql
+
+import (
+	"bluebell/models"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// insertModLog 在事务中写入一条管理日志
+func insertModLog(tx *sqlx.Tx, l *models.ModLog) error {
+	sqlStr := `insert into mod_log(community_id, operator_id, action, target_id, reason) values(?,?,?,?,?)`
+	_, err := tx.Exec(sqlStr, l.CommunityID, l.OperatorID, l.Action, l.TargetID, l.Reason)
+	return err
+}
+
+// GetModLogList 按社区分页查询管理日志，新的在前
+func GetModLogList(communityID, page, size int64) (logs []*models.ModLog, err error) {
+	sqlStr := `select id, community_id, operator_id, action, target_id, reason, create_time
+	from mod_log
+	where community_id = ?
+	order by id desc
+	limit ?,?
+	`
+	logs = make([]*models.ModLog, 0, size)
+	err = db.Select(&logs, sqlStr, communityID, (page-1)*size, size)
+	return
+}
+
+// withModLog 在一个事务中执行管理操作并写入管理日志
+// fn返回ok为false时表示操作没有改动任何数据，回滚事务且不写日志
+func withModLog(l *models.ModLog, fn func(tx *sqlx.Tx) (ok bool, err error)) (ok bool, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || !ok {
+			_ = tx.Rollback()
+		}
+	}()
+	if ok, err = fn(tx); err != nil || !ok {
+		return ok, err
+	}
+	if err = insertModLog(tx, l); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RemovePost 版主移除帖子，同时取消置顶
+// 返回值 ok: 帖子原本是否为正常状态
+func RemovePost(pid int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		sqlStr := `update post set status = ? where post_id = ? and status = ?`
+		ret, err := tx.Exec(sqlStr, models.PostStatusRemoved, pid, models.PostStatusNormal)
+		if err != nil {
+			return false, err
+		}
+		if n, err := ret.RowsAffected(); err != nil || n == 0 {
+			return false, err
+		}
+		_, err = tx.Exec(`delete from community_pin where post_id = ?`, pid)
+		return true, err
+	})
+}
+
+// PinPost 置顶帖子
+// 锁定社区行后再统计已置顶的数量，避免并发置顶超过上限
+// 被举报自动隐藏的帖子保留置顶记录，恢复正常后继续置顶，隐藏期间不占用置顶数量
+// 参数 max: 每个社区最多置顶的帖子数
+// 返回值 ok: 帖子原本是否未置顶
+func PinPost(communityID, pid, operatorID int64, max int, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		var cid int64
+		err := tx.Get(&cid, `select community_id from community where community_id = ? for update`, communityID)
+		if err == sql.ErrNoRows {
+			return false, ErrorInvalidID
+		}
+		if err != nil {
+			return false, err
+		}
+		var pinned []int64
+		sqlStr := `select post_id from community_pin where community_id = ?
+		and post_id in (select post_id from post where status = ?)`
+		if err = tx.Select(&pinned, sqlStr, communityID, models.PostStatusNormal); err != nil {
+			return false, err
+		}
+		for _, id := range pinned {
+			if id == pid {
+				return false, nil
+			}
+		}
+		if len(pinned) >= max {
+			return false, ErrorPinLimit
+		}
+		sqlStr = `insert into community_pin(community_id, post_id, operator_id) values(?,?,?)`
+		_, err = tx.Exec(sqlStr, communityID, pid, operatorID)
+		return err == nil, err
+	})
+}
+
+// LockPost 锁定帖子
+// 返回值 ok: 帖子原本是否未锁定
+func LockPost(communityID, pid, operatorID int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		sqlStr := `insert ignore into post_lock(community_id, post_id, operator_id) values(?,?,?)`
+		ret, err := tx.Exec(sqlStr, communityID, pid, operatorID)
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		return n > 0, err
+	})
+}
+
+// UnlockPost 解锁帖子
+// 返回值 ok: 帖子原本是否已锁定
+func UnlockPost(pid int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		ret, err := tx.Exec(`delete from post_lock where post_id = ?`, pid)
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		return n > 0, err
+	})
+}
+
+// GetLockedPostIDs 查询一批帖子中已锁定的帖子
+// 返回值: 已锁定的帖子id集合
+func GetLockedPostIDs(ids []int64) (locked map[int64]bool, err error) {
+	locked = make(map[int64]bool)
+	if len(ids) == 0 {
+		return
+	}
+	query, args, err := sqlx.In(`select post_id from post_lock where post_id in (?)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int64
+	if err = db.Select(&pids, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, id := range pids {
+		locked[id] = true
+	}
+	return
+}
+
+// UnpinPost 取消置顶
+// 返回值 ok: 帖子原本是否已置顶
+func UnpinPost(pid int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		ret, err := tx.Exec(`delete from community_pin where post_id = ?`, pid)
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		return n > 0, err
+	})
+}
+
+// GetPinnedPostIDs 查询社区中状态正常的置顶帖子id，后置顶的在前
+// 自动隐藏的帖子不在帖子列表中，也不返回，否则置顶帖子会占用列表的位置而不显示
+func GetPinnedPostIDs(communityID int64) (ids []string, err error) {
+	sqlStr := `select post_id from community_pin where community_id = ?
+	and post_id in (select post_id from post where status = ?)
+	order by id desc`
+	ids = make([]string, 0)
+	err = db.Select(&ids, sqlStr, communityID, models.PostStatusNormal)
+	return
+}
+
+// BanUser 禁止用户在社区发帖，已经被禁止时覆盖原来的到期时间和原因
+func BanUser(b *models.CommunityBan, l *models.ModLog) (err error) {
+	_, err = withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		sqlStr := `insert into community_ban(community_id, user_id, operator_id, reason, expire_time)
+		values(?,?,?,?,?)
+		on duplicate key update operator_id = values(operator_id), reason = values(reason),
+		expire_time = values(expire_time), create_time = CURRENT_TIMESTAMP
+		`
+		_, err := tx.Exec(sqlStr, b.CommunityID, b.UserID, b.OperatorID, b.Reason, b.ExpireTime)
+		return err == nil, err
+	})
+	return
+}
+
+// UnbanUser 解除用户在社区的禁言
+// 返回值 ok: 用户原本是否处于禁言中
+func UnbanUser(communityID, userID int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		sqlStr := `delete from community_ban
+		where community_id = ? and user_id = ? and (expire_time is null or expire_time > ?)
+		`
+		ret, err := tx.Exec(sqlStr, communityID, userID, time.Now())
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		return n > 0, err
+	})
+}
+
+// GetCommunityBan 查询用户在社区的禁言记录，没有记录时返回nil
+// 返回的记录可能已经过期，需要调用方用Active判断
+func GetCommunityBan(communityID, userID int64) (ban *models.CommunityBan, err error) {
+	ban = new(models.CommunityBan)
+	sqlStr := `select community_id, user_id, operator_id, reason, expire_time, create_time
+	from community_ban
+	where community_id = ? and user_id = ?
+	`
+	err = db.Get(ban, sqlStr, communityID, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return
+}
+
+// GetCommunityBanList 查询社区中仍然有效的禁言记录
+func GetCommunityBanList(communityID int64) (bans []*models.CommunityBan, err error) {
+	sqlStr := `select community_id, user_id, operator_id, reason, expire_time, create_time
+	from community_ban
+	where community_id = ? and (expire_time is null or expire_time > ?)
+	order by id desc
+	`
+	bans = make([]*models.CommunityBan, 0)
+	err = db.Select(&bans, sqlStr, communityID, time.Now())
+	return
+}
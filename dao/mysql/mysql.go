@@ -3,8 +3,10 @@
 package mysql
 
 import (
+	"bluebell/models"  // 导入数据模型，定义投票对象类型
 	"bluebell/setting" // 导入配置包，获取数据库连接配置
 	"fmt"              // 导入格式化输出包，用于构建连接字符串
+	"strings"          // 导入字符串包，用于拼接批量写入的SQL
 
 	_ "github.com/go-sql-driver/mysql" // 导入MySQL驱动，下划线表示只执行init函数
 	"github.com/jmoiron/sqlx"          // 导入sqlx包，提供更便捷的数据库操作接口
@@ -43,6 +45,11 @@ func Init(cfg *setting.MySQLConfig) (err error) {
 	return
 }
 
+// SetDB 使用已经建立的数据库连接，测试中用于替换为sqlmock的连接
+func SetDB(d *sqlx.DB) {
+	db = d
+}
+
 // Close 关闭MySQL数据库连接
 // 程序退出时调用，确保数据库连接正确释放
 func Close() {
@@ -51,14 +58,43 @@ func Close() {
 }
 
 // SaveVoteData 保存投票数据到MySQL
-// 参数 postID: 帖子ID
+// 参数 targetType: 投票对象类型（如帖子）
+// 参数 targetID: 投票对象ID
 // 参数 userID: 用户ID
-// 参数 voteValue: 投票值（1=赞成，-1=反对）
+// 参数 voteValue: 投票值（1=赞成，-1=反对，0=取消投票）
+// 参数 voteTime: 投票发生的毫秒时间戳
 // 返回值: 错误信息，成功时返回nil
-func SaveVoteData(postID, userID int64, voteValue int8) error {
-	// 使用REPLACE INTO实现插入或更新
-	// 适配现有表结构：post_vote表，字段为post_id, user_id, vote_type
-	sqlStr := `REPLACE INTO post_vote(post_id, user_id, vote_type) VALUES(?, ?, ?)`
-	_, err := db.Exec(sqlStr, postID, userID, voteValue)
+func SaveVoteData(targetType models.VoteTargetType, targetID, userID int64, voteValue int8, voteTime int64) error {
+	return BatchSaveVoteData([]*models.Vote{{
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserID:     userID,
+		VoteType:   voteValue,
+		VoteTime:   voteTime,
+	}})
+}
+
+// BatchSaveVoteData 批量保存投票数据到MySQL
+// 使用一条多行INSERT语句写入整批数据，减少数据库连接的占用
+// vote表以(target_type, target_id, user_id)作为唯一索引，每个用户对每个对象只保留一条记录，
+// 只有投票时间不早于已有记录时才覆盖，重新投递的旧投票不会覆盖已经写入的新投票；
+// 同一批次中同一用户对同一对象投票时间相同的多次投票，以最后一条为准
+func BatchSaveVoteData(votes []*models.Vote) error {
+	if len(votes) == 0 {
+		return nil
+	}
+	placeholders := make([]string, 0, len(votes))
+	args := make([]interface{}, 0, len(votes)*5)
+	for _, v := range votes {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		args = append(args, v.TargetType, v.TargetID, v.UserID, v.VoteType, v.VoteTime)
+	}
+	// 先更新vote_type再更新vote_time，比较时使用的是已有记录的vote_time
+	sqlStr := `INSERT INTO vote(target_type, target_id, user_id, vote_type, vote_time) VALUES ` +
+		strings.Join(placeholders, ", ") + `
+	ON DUPLICATE KEY UPDATE
+		vote_type = IF(VALUES(vote_time) >= vote_time, VALUES(vote_type), vote_type),
+		vote_time = GREATEST(vote_time, VALUES(vote_time))`
+	_, err := db.Exec(sqlStr, args...)
 	return err
 }
@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"bluebell/models"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const maxOutboxErrorLen = 512 // last_error字段的最大长度
+
+// insertOutboxEvent 在事务中写入一条待处理事件
+func insertOutboxEvent(tx *sqlx.Tx, eventType models.OutboxEventType, aggregateID int64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	sqlStr := `insert into outbox(event_type, aggregate_id, payload, status, next_retry_time)
+	values (?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(sqlStr, eventType, aggregateID, string(data), models.OutboxStatusPending, time.Now())
+	return err
+}
+
+// GetPendingOutboxEvents 按id顺序查询已经到处理时间的待处理事件
+func GetPendingOutboxEvents(limit int64) (events []*models.OutboxEvent, err error) {
+	sqlStr := `select
+	id, event_type, aggregate_id, payload, status, retry_count, next_retry_time, last_error, create_time
+	from outbox
+	where status = ? and next_retry_time <= ?
+	order by id
+	limit ?
+	`
+	events = make([]*models.OutboxEvent, 0, limit)
+	err = db.Select(&events, sqlStr, models.OutboxStatusPending, time.Now(), limit)
+	return
+}
+
+// ClaimOutboxEvent 认领一个待处理事件
+// 把next_retry_time推迟lease，租约期内其他实例查询不到这个事件；处理进程崩溃时租约到期后会被重新认领
+// 返回值 ok: 是否认领成功，事件已被其他实例认领或处理时为false
+func ClaimOutboxEvent(e *models.OutboxEvent, lease time.Duration) (ok bool, err error) {
+	sqlStr := `update outbox set next_retry_time = ?
+	where id = ? and status = ? and next_retry_time = ?
+	`
+	ret, err := db.Exec(sqlStr, time.Now().Add(lease), e.ID, models.OutboxStatusPending, e.NextRetryTime)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	return n == 1, err
+}
+
+// MarkOutboxEventDone 标记事件已处理
+func MarkOutboxEventDone(id int64) (err error) {
+	sqlStr := `update outbox set status = ?, last_error = '' where id = ?`
+	_, err = db.Exec(sqlStr, models.OutboxStatusDone, id)
+	return
+}
+
+// MarkOutboxEventRetry 记录事件处理失败
+// 参数 failed: 为true时事件不再重试，状态改为失败
+func MarkOutboxEventRetry(id, retryCount int64, nextRetryTime time.Time, lastErr string, failed bool) (err error) {
+	status := models.OutboxStatusPending
+	if failed {
+		status = models.OutboxStatusFailed
+	}
+	if len(lastErr) > maxOutboxErrorLen {
+		lastErr = lastErr[:maxOutboxErrorLen]
+	}
+	sqlStr := `update outbox set status = ?, retry_count = ?, next_retry_time = ?, last_error = ?
+	where id = ?
+	`
+	_, err = db.Exec(sqlStr, status, retryCount, nextRetryTime, lastErr, id)
+	return
+}
+
+// DeleteDoneOutboxEvents 删除创建时间早于before的已处理事件
+// 返回值: 删除的事件数量
+func DeleteDoneOutboxEvents(before time.Time) (n int64, err error) {
+	sqlStr := `delete from outbox where status = ? and create_time < ?`
+	ret, err := db.Exec(sqlStr, models.OutboxStatusDone, before)
+	if err != nil {
+		return 0, err
+	}
+	return ret.RowsAffected()
+}
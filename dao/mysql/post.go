@@ -3,25 +3,53 @@ package mysql
 import (
 	"bluebell/models"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
 // CreatePost 创建帖子
+// 帖子和post.created事件在同一个事务中写入，由outbox转发任务把帖子写入Redis
+// 发帖时间由这里指定而不是使用数据库默认值，保证事件中的时间与post表一致
 func CreatePost(p *models.Post) (err error) {
+	if p.CreateTime.IsZero() {
+		// create_time字段精度为秒
+		p.CreateTime = time.Now().Truncate(time.Second)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
 	sqlStr := `insert into post(
-	post_id, title, content, author_id, community_id)
-	values (?, ?, ?, ?, ?)
+	post_id, title, content, author_id, community_id, create_time)
+	values (?, ?, ?, ?, ?, ?)
 	`
-	_, err = db.Exec(sqlStr, p.ID, p.Title, p.Content, p.AuthorID, p.CommunityID)
-	return
+	if _, err = tx.Exec(sqlStr, p.ID, p.Title, p.Content, p.AuthorID, p.CommunityID, p.CreateTime); err != nil {
+		return err
+	}
+	err = insertOutboxEvent(tx, models.OutboxEventPostCreated, p.ID, &models.PostCreatedEvent{
+		PostID:      p.ID,
+		CommunityID: p.CommunityID,
+		CreateTime:  p.CreateTime.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetPostById 根据id查询单个贴子数据
 func GetPostById(pid int64) (post *models.Post, err error) {
 	post = new(models.Post)
 	sqlStr := `select
-	post_id, title, content, author_id, community_id, create_time
+	post_id, title, content, author_id, community_id, status, create_time
 	from post
 	where post_id = ?
 	`
@@ -29,6 +57,37 @@ func GetPostById(pid int64) (post *models.Post, err error) {
 	return
 }
 
+// UpdatePost 更新帖子的标题和内容
+// 只更新状态正常的帖子，已删除的帖子不允许再编辑
+func UpdatePost(p *models.Post) (err error) {
+	sqlStr := `update post set title = ?, content = ?
+	where post_id = ? and status = ?
+	`
+	_, err = db.Exec(sqlStr, p.Title, p.Content, p.ID, models.PostStatusNormal)
+	return
+}
+
+// DeletePost 软删除帖子，将status置为已删除，同时取消置顶
+func DeletePost(pid int64) (err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	sqlStr := `update post set status = ? where post_id = ?`
+	if _, err = tx.Exec(sqlStr, models.PostStatusDeleted, pid); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`delete from community_pin where post_id = ?`, pid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // GetPostList 查询帖子列表函数
 // 根据分页参数从数据库获取帖子列表，按创建时间倒序排列
 // 参数 page: 页码，从1开始
@@ -38,8 +97,9 @@ func GetPostList(page, size int64) (posts []*models.Post, err error) {
 	// ==================== 第一步：构建SQL查询语句 ====================
 	// 使用反引号定义多行SQL字符串，保持格式清晰
 	sqlStr := `select 
-	post_id, title, content, author_id, community_id, create_time
+	post_id, title, content, author_id, community_id, status, create_time
 	from post
+	where status = ?
 	ORDER BY create_time
 	DESC
 	limit ?,?
@@ -47,6 +107,7 @@ func GetPostList(page, size int64) (posts []*models.Post, err error) {
 	// SQL语句说明：
 	// - select: 选择指定字段
 	// - from post: 从post表查询
+	// - where status = ?: 只查询状态正常的帖子，过滤掉已删除的帖子
 	// - ORDER BY create_time DESC: 按创建时间倒序排列（最新的在前）
 	// - limit ?,?: 分页限制，第一个?是偏移量，第二个?是限制数量
 
@@ -72,7 +133,7 @@ func GetPostList(page, size int64) (posts []*models.Post, err error) {
 	// page=1, size=10: 偏移量=(1-1)*10=0，返回前10条
 	// page=2, size=10: 偏移量=(2-1)*10=10，返回第11-20条
 	// page=3, size=10: 偏移量=(3-1)*10=20，返回第21-30条
-	err = db.Select(&posts, sqlStr, (page-1)*size, size)
+	err = db.Select(&posts, sqlStr, models.PostStatusNormal, (page-1)*size, size)
 
 	// ==================== 第四步：返回结果 ====================
 	return
@@ -80,7 +141,7 @@ func GetPostList(page, size int64) (posts []*models.Post, err error) {
 
 // GetPostListByIDs 根据给定的id列表查询帖子数据
 func GetPostListByIDs(ids []string) (postList []*models.Post, err error) {
-	sqlStr := `select post_id, title, content, author_id, community_id, create_time
+	sqlStr := `select post_id, title, content, author_id, community_id, status, create_time
 	from post
 	where post_id in (?)
 	order by FIND_IN_SET(post_id, ?)
@@ -94,3 +155,19 @@ func GetPostListByIDs(ids []string) (postList []*models.Post, err error) {
 	err = db.Select(&postList, query, args...) // !!!!!!
 	return
 }
+
+// GetPostListAfterID 按post_id顺序分批查询状态正常的帖子
+// 参数 afterID: 上一批最后一个帖子的id，第一批传0
+// 参数 limit: 每批数量
+func GetPostListAfterID(afterID, limit int64) (posts []*models.Post, err error) {
+	sqlStr := `select
+	post_id, title, content, author_id, community_id, status, create_time
+	from post
+	where post_id > ? and status = ?
+	order by post_id
+	limit ?
+	`
+	posts = make([]*models.Post, 0, limit)
+	err = db.Select(&posts, sqlStr, afterID, models.PostStatusNormal, limit)
+	return
+}
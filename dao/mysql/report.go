@@ -0,0 +1,193 @@
+package mysql
+
+import (
+	"bluebell/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateReport 保存一条举报，并累加被举报对象的未处理举报数
+// 已经处理过的对象被再次举报时重新打开
+// 参数 t: 被举报对象，只需要TargetType、TargetID和CommunityID
+// 返回值 target: 累加后的被举报对象
+// 同一用户对同一对象重复举报时返回ErrorReportExist
+func CreateReport(t *models.ReportTarget, r *models.Report) (target *models.ReportTarget, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// 先更新汇总记录，事务结束前这一行被锁定，同一对象的举报串行累加
+	sqlStr := `insert into report_target(target_type, target_id, community_id, report_count, status)
+	values(?,?,?,1,?)
+	on duplicate key update report_count = report_count + 1, status = values(status)
+	`
+	if _, err = tx.Exec(sqlStr, t.TargetType, t.TargetID, t.CommunityID, models.ReportStatusOpen); err != nil {
+		return nil, err
+	}
+	target = new(models.ReportTarget)
+	sqlStr = `select id, target_type, target_id, community_id, report_count, status, handler_id, handle_time, update_time
+	from report_target
+	where target_type = ? and target_id = ?
+	`
+	if err = tx.Get(target, sqlStr, t.TargetType, t.TargetID); err != nil {
+		return nil, err
+	}
+
+	sqlStr = `insert ignore into report(report_target_id, reporter_id, reason, detail) values(?,?,?,?)`
+	ret, err := tx.Exec(sqlStr, target.ID, r.ReporterID, r.Reason, r.Detail)
+	if err != nil {
+		return nil, err
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// 重复举报，回滚对汇总记录的累加
+		err = ErrorReportExist
+		return nil, err
+	}
+	r.ReportTargetID = target.ID
+	return target, tx.Commit()
+}
+
+// GetReportTargetByID 根据id查询被举报对象
+func GetReportTargetByID(id int64) (target *models.ReportTarget, err error) {
+	target = new(models.ReportTarget)
+	sqlStr := `select id, target_type, target_id, community_id, report_count, status, handler_id, handle_time, update_time
+	from report_target
+	where id = ?
+	`
+	err = db.Get(target, sqlStr, id)
+	return
+}
+
+// GetReportTargetList 按状态分页查询被举报对象，未处理的举报数多的在前
+func GetReportTargetList(status int8, page, size int64) (targets []*models.ReportTarget, err error) {
+	sqlStr := `select id, target_type, target_id, community_id, report_count, status, handler_id, handle_time, update_time
+	from report_target
+	where status = ?
+	order by report_count desc, update_time desc
+	limit ?,?
+	`
+	targets = make([]*models.ReportTarget, 0, size)
+	err = db.Select(&targets, sqlStr, status, (page-1)*size, size)
+	return
+}
+
+// GetReportReasonCounts 按原因统计被举报对象未处理的举报数
+// 返回值: 被举报对象id -> 举报原因 -> 数量
+func GetReportReasonCounts(ids []int64) (counts map[int64]map[string]int64, err error) {
+	counts = make(map[int64]map[string]int64, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	sqlStr := `select report_target_id, reason, count(*) as cnt
+	from report
+	where handled = 0 and report_target_id in (?)
+	group by report_target_id, reason
+	`
+	query, args, err := sqlx.In(sqlStr, ids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ReportTargetID int64  `db:"report_target_id"`
+		Reason         string `db:"reason"`
+		Count          int64  `db:"cnt"`
+	}
+	if err = db.Select(&rows, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if counts[r.ReportTargetID] == nil {
+			counts[r.ReportTargetID] = make(map[string]int64)
+		}
+		counts[r.ReportTargetID][r.Reason] = r.Count
+	}
+	return
+}
+
+// HidePost 被举报次数过多时自动隐藏帖子
+// 置顶记录保留，举报不成立恢复正常后继续置顶，见GetPinnedPostIDs
+// 返回值 ok: 帖子原本是否为正常状态
+func HidePost(pid int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		sqlStr := `update post set status = ? where post_id = ? and status = ?`
+		ret, err := tx.Exec(sqlStr, models.PostStatusHidden, pid, models.PostStatusNormal)
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		return n > 0, err
+	})
+}
+
+// ResolvePostReport 举报成立，移除被举报的帖子
+// 正常和自动隐藏的帖子都会被移除，同时取消置顶
+// 返回值 ok: 被举报对象原本是否为待处理状态
+func ResolvePostReport(t *models.ReportTarget, handlerID int64, l *models.ModLog) (ok bool, err error) {
+	return withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		if ok, err := closeReportTarget(tx, t.ID, models.ReportStatusResolved, handlerID); err != nil || !ok {
+			return false, err
+		}
+		sqlStr := `update post set status = ? where post_id = ? and status in (?, ?)`
+		_, err := tx.Exec(sqlStr, models.PostStatusRemoved, t.TargetID, models.PostStatusNormal, models.PostStatusHidden)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`delete from community_pin where post_id = ?`, t.TargetID)
+		return true, err
+	})
+}
+
+// DismissPostReport 举报不成立，自动隐藏的帖子恢复正常
+// 恢复了帖子时管理日志记录为post.restore，否则为report.dismiss
+// 返回值 ok: 被举报对象原本是否为待处理状态
+// 返回值 restored: 是否恢复了自动隐藏的帖子
+func DismissPostReport(t *models.ReportTarget, handlerID int64, l *models.ModLog) (ok, restored bool, err error) {
+	l.Action = models.ModActionDismissReport
+	ok, err = withModLog(l, func(tx *sqlx.Tx) (bool, error) {
+		if ok, err := closeReportTarget(tx, t.ID, models.ReportStatusDismissed, handlerID); err != nil || !ok {
+			return false, err
+		}
+		sqlStr := `update post set status = ? where post_id = ? and status = ?`
+		ret, err := tx.Exec(sqlStr, models.PostStatusNormal, t.TargetID, models.PostStatusHidden)
+		if err != nil {
+			return false, err
+		}
+		n, err := ret.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if restored = n > 0; restored {
+			l.Action = models.ModActionRestorePost
+		}
+		return true, nil
+	})
+	return ok, restored && ok, err
+}
+
+// closeReportTarget 把待处理的被举报对象改为已处理，未处理的举报数清零，之前的举报都标记为已处理
+// 返回值 ok: 被举报对象原本是否为待处理状态
+func closeReportTarget(tx *sqlx.Tx, id int64, status int8, handlerID int64) (ok bool, err error) {
+	sqlStr := `update report_target set status = ?, report_count = 0, handler_id = ?, handle_time = ?
+	where id = ? and status = ?
+	`
+	ret, err := tx.Exec(sqlStr, status, handlerID, time.Now(), id, models.ReportStatusOpen)
+	if err != nil {
+		return false, err
+	}
+	if n, err := ret.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.Exec(`update report set handled = 1 where report_target_id = ? and handled = 0`, id)
+	return err == nil, err
+}
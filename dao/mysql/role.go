@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"bluebell/models"
+)
+
+// GetUserRoles 获取用户的所有角色，普通用户返回空列表
+func GetUserRoles(uid int64) (roles models.Roles, err error) {
+	sqlStr := `select user_id, role, community_id from user_role where user_id = ? order by id`
+	err = db.Select(&roles, sqlStr, uid)
+	return
+}
+
+// AddUserRole 授予用户角色，已经拥有该角色时忽略
+func AddUserRole(r *models.UserRole) (err error) {
+	sqlStr := `insert ignore into user_role(user_id, role, community_id) values(?,?,?)`
+	_, err = db.Exec(sqlStr, r.UserID, r.Role, r.CommunityID)
+	return
+}
+
+// RemoveUserRole 收回用户角色
+// 返回值 ok: 用户原本是否拥有该角色
+func RemoveUserRole(r *models.UserRole) (ok bool, err error) {
+	sqlStr := `delete from user_role where user_id = ? and role = ? and community_id = ?`
+	ret, err := db.Exec(sqlStr, r.UserID, r.Role, r.CommunityID)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	return n > 0, err
+}
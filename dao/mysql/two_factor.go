@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"bluebell/models"
+)
+
+// GetUserTOTP 查询用户的TOTP密钥，没有生成过密钥时返回sql.ErrNoRows
+func GetUserTOTP(uid int64) (t *models.UserTOTP, err error) {
+	t = new(models.UserTOTP)
+	sqlStr := `select user_id, secret, enabled, last_counter from user_totp where user_id = ?`
+	err = db.Get(t, sqlStr, uid)
+	return
+}
+
+// SaveTOTPSecret 保存新生成的密钥，等待用户确认
+// 已经开启两步验证时不覆盖原来的密钥
+// 返回值 ok: 是否保存成功
+func SaveTOTPSecret(uid int64, secret string) (ok bool, err error) {
+	sqlStr := `insert into user_totp(user_id, secret, enabled, last_counter) values(?,?,0,0)
+	on duplicate key update
+		secret = if(enabled = 1, secret, values(secret)),
+		last_counter = if(enabled = 1, last_counter, 0)
+	`
+	if _, err = db.Exec(sqlStr, uid, secret); err != nil {
+		return false, err
+	}
+	t, err := GetUserTOTP(uid)
+	if err != nil {
+		return false, err
+	}
+	return !t.Enabled && t.Secret == secret, nil
+}
+
+// EnableTOTP 确认开启两步验证，同时替换用户的恢复码
+// 参数 counter: 确认时使用的验证码所在的时间步
+// 参数 secret: 确认时校验的密钥，期间重新生成过密钥时不开启
+// 参数 codeHashes: 新恢复码的sha256
+// 返回值 ok: 是否开启成功
+func EnableTOTP(uid int64, secret string, counter int64, codeHashes []string) (ok bool, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || !ok {
+			_ = tx.Rollback()
+		}
+	}()
+
+	sqlStr := `update user_totp set enabled = 1, last_counter = ?
+	where user_id = ? and secret = ? and enabled = 0
+	`
+	ret, err := tx.Exec(sqlStr, counter, uid, secret)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err = tx.Exec(`delete from user_recovery_code where user_id = ?`, uid); err != nil {
+		return false, err
+	}
+	sqlStr = `insert into user_recovery_code(user_id, code_hash) values(?,?)`
+	for _, h := range codeHashes {
+		if _, err = tx.Exec(sqlStr, uid, h); err != nil {
+			return false, err
+		}
+	}
+	ok = true
+	return ok, tx.Commit()
+}
+
+// UseTOTPCounter 记录使用过的验证码所在的时间步
+// 时间步不大于上次使用的时间步时返回false，同一个验证码只能使用一次
+func UseTOTPCounter(uid, counter int64) (ok bool, err error) {
+	sqlStr := `update user_totp set last_counter = ? where user_id = ? and enabled = 1 and last_counter < ?`
+	ret, err := db.Exec(sqlStr, counter, uid, counter)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode 使用恢复码，恢复码不存在或已使用时返回false
+func UseRecoveryCode(uid int64, codeHash string) (ok bool, err error) {
+	sqlStr := `update user_recovery_code set used_time = now()
+	where user_id = ? and code_hash = ? and used_time is null
+	`
+	ret, err := db.Exec(sqlStr, uid, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	return n > 0, err
+}
+
+// DisableTOTP 关闭两步验证，删除密钥和所有恢复码
+func DisableTOTP(uid int64) (err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.Exec(`delete from user_totp where user_id = ?`, uid); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`delete from user_recovery_code where user_id = ?`, uid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
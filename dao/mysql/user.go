@@ -2,16 +2,16 @@ package mysql
 
 import (
 	"bluebell/models"
-	"crypto/md5"
+	"bluebell/pkg/password"
 	"database/sql"
-	"encoding/hex"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
 )
 
 // 把每一步数据库操作封装成函数
 // 待logic层根据业务需求调用
 
-const secret = "liwenzhou.com"
-
 // CheckUserExist 检查指定用户名的用户是否存在
 func CheckUserExist(username string) (err error) {
 	sqlStr := `select count(user_id) from user where username = ?`
@@ -28,19 +28,106 @@ func CheckUserExist(username string) (err error) {
 // InsertUser 想数据库中插入一条新的用户记录
 func InsertUser(user *models.User) (err error) {
 	// 对密码进行加密
-	user.Password = encryptPassword(user.Password)
-	// 执行SQL语句入库
-	sqlStr := `insert into user(user_id, username, password) values(?,?,?)`
-	_, err = db.Exec(sqlStr, user.UserID, user.Username, user.Password)
+	user.Password, err = password.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+	// 执行SQL语句入库，没有填写邮箱时保存为NULL，不占用邮箱的唯一索引
+	var email interface{}
+	if user.Email != "" {
+		email = user.Email
+	}
+	sqlStr := `insert into user(user_id, username, password, email) values(?,?,?,?)`
+	_, err = db.Exec(sqlStr, user.UserID, user.Username, user.Password, email)
+	return
+}
+
+// CheckEmailExist 检查邮箱是否已被其他用户验证
+// 只有验证过的邮箱唯一，未验证的邮箱可以被多个用户填写，谁先完成验证归谁
+func CheckEmailExist(email string) (err error) {
+	sqlStr := `select count(user_id) from user where verified_email = ?`
+	var count int64
+	if err := db.Get(&count, sqlStr, email); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrorEmailExist
+	}
+	return
+}
+
+// GetUserEmail 查询用户的邮箱和验证状态，没有设置邮箱时Email为空字符串
+func GetUserEmail(uid int64) (user *models.User, err error) {
+	user = new(models.User)
+	sqlStr := `select user_id, username, ifnull(email, '') as email, email_verified from user where user_id = ?`
+	err = db.Get(user, sqlStr, uid)
+	return
+}
+
+// GetUserByVerifiedEmail 根据已验证的邮箱查询用户，邮箱不存在或未验证时返回sql.ErrNoRows
+func GetUserByVerifiedEmail(email string) (user *models.User, err error) {
+	user = new(models.User)
+	sqlStr := `select user_id, username, email, email_verified from user where email = ? and email_verified = 1`
+	err = db.Get(user, sqlStr, email)
 	return
 }
 
-// encryptPassword 密码加密
-func encryptPassword(oPassword string) string {
-	h := md5.New()
-	h.Write([]byte(secret))
-	h.Write([]byte(oPassword))
-	return hex.EncodeToString(h.Sum(nil))
+// VerifyUserEmail 标记用户的邮箱已验证
+// 只在用户当前的邮箱仍然是email时更新，避免旧邮件中的链接验证了修改后的邮箱
+// 邮箱已被其他用户验证时返回ErrorEmailExist；验证成功后其他用户未验证的同一邮箱被清空
+// 返回值 ok: 是否更新成功
+func VerifyUserEmail(uid int64, email string) (ok bool, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || !ok {
+			_ = tx.Rollback()
+		}
+	}()
+	var count int64
+	sqlStr := `select count(user_id) from user where verified_email = ? and user_id != ? for update`
+	if err = tx.Get(&count, sqlStr, email, uid); err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, ErrorEmailExist
+	}
+	sqlStr = `update user set email_verified = 1 where user_id = ? and email = ?`
+	ret, err := tx.Exec(sqlStr, uid, email)
+	if err != nil {
+		return false, err
+	}
+	n, err := ret.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if err = reclaimEmail(tx, uid, email); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reclaimEmail 清空其他用户未验证的同一邮箱，这些用户之前收到的验证链接随之失效
+func reclaimEmail(tx *sqlx.Tx, uid int64, email string) error {
+	sqlStr := `update user set email = NULL where email = ? and email_verified = 0 and user_id != ?`
+	_, err := tx.Exec(sqlStr, email, uid)
+	return err
+}
+
+// UpdatePassword 用当前的哈希算法保存新密码
+func UpdatePassword(uid int64, newPassword string) (err error) {
+	hash, err := password.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	sqlStr := `update user set password = ? where user_id = ?`
+	_, err = db.Exec(sqlStr, hash, uid)
+	return
 }
 
 func Login(user *models.User) (err error) {
@@ -54,12 +141,37 @@ func Login(user *models.User) (err error) {
 		// 查询数据库失败
 		return err
 	}
-	// 判断密码是否正确
-	password := encryptPassword(oPassword)
-	if password != user.Password {
+	// 判断密码是否正确，哈希字符串中带有算法标识，旧版本的md5哈希也能校验
+	ok, rehash, err := password.Verify(oPassword, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return ErrorInvalidPassword
 	}
-	return
+	// 旧算法或旧参数生成的哈希，登录成功后用当前算法重新哈希，逐步完成迁移
+	if rehash {
+		if err := rehashPassword(user, oPassword); err != nil {
+			// 重新哈希失败不影响本次登录，下次登录时再试
+			zap.L().Error("rehash password failed", zap.Int64("userID", user.UserID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// rehashPassword 用当前算法重新生成密码哈希并保存
+// 只在密码未被修改时更新，避免覆盖并发修改的新密码
+func rehashPassword(user *models.User, oPassword string) error {
+	hash, err := password.Hash(oPassword)
+	if err != nil {
+		return err
+	}
+	sqlStr := `update user set password = ? where user_id = ? and password = ?`
+	if _, err = db.Exec(sqlStr, hash, user.UserID, user.Password); err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
 }
 
 // GetUserById 根据id获取用户信息
@@ -69,3 +181,17 @@ func GetUserById(uid int64) (user *models.User, err error) {
 	err = db.Get(user, sqlStr, uid)
 	return
 }
+
+// GetUserListByIDs 根据id列表批量获取用户信息
+func GetUserListByIDs(uids []int64) (users []*models.User, err error) {
+	if len(uids) == 0 {
+		return
+	}
+	sqlStr := `select user_id, username from user where user_id in (?)`
+	query, args, err := sqlx.In(sqlStr, uids)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Select(&users, db.Rebind(query), args...)
+	return
+}
@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"bluebell/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveVoteArchive 保存投票对象的最终投票数
+func SaveVoteArchive(a *models.VoteArchive) (err error) {
+	sqlStr := `REPLACE INTO vote_archive(target_type, target_id, up_votes, down_votes)
+	VALUES(?, ?, ?, ?)
+	`
+	_, err = db.Exec(sqlStr, a.TargetType, a.TargetID, a.UpVotes, a.DownVotes)
+	return
+}
+
+// GetVoteArchiveByIDs 批量查询投票对象的归档投票数
+// 返回值: 对象id到归档数据的映射，未归档的对象不会出现在结果中
+func GetVoteArchiveByIDs(tt models.VoteTargetType, ids []int64) (data map[int64]*models.VoteArchive, err error) {
+	data = make(map[int64]*models.VoteArchive, len(ids))
+	if len(ids) == 0 {
+		return
+	}
+	sqlStr := `select target_type, target_id, up_votes, down_votes
+	from vote_archive
+	where target_type = ? and target_id in (?)
+	`
+	query, args, err := sqlx.In(sqlStr, tt, ids)
+	if err != nil {
+		return nil, err
+	}
+	var archives []*models.VoteArchive
+	if err = db.Select(&archives, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, a := range archives {
+		data[a.TargetID] = a
+	}
+	return
+}
+
+// GetVoteListByTargetIDs 查询一批对象的有效投票记录（不包含已取消的投票）
+func GetVoteListByTargetIDs(tt models.VoteTargetType, ids []int64) (votes []*models.Vote, err error) {
+	if len(ids) == 0 {
+		return
+	}
+	sqlStr := `select target_type, target_id, user_id, vote_type
+	from vote
+	where target_type = ? and target_id in (?) and vote_type != 0
+	`
+	query, args, err := sqlx.In(sqlStr, tt, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Select(&votes, db.Rebind(query), args...)
+	return
+}
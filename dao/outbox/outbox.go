@@ -0,0 +1,234 @@
+package outbox
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/setting"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 事务发件箱转发任务
+// 业务数据和事件在同一个MySQL事务中写入outbox表（见mysql.CreatePost），
+// 转发任务按id顺序读取待处理的事件，依次调用该事件类型注册的处理函数，全部成功后标记为已处理。
+// 处理失败的事件按指数退避重试，重试次数用尽后状态改为失败，不再自动处理。
+// 同一事件可能被处理多次（如处理成功但标记失败），处理函数必须是幂等的。
+// 写Redis、搜索索引、通知等副作用都可以注册为处理函数，发帖流程只需要写MySQL。
+
+const (
+	defaultPollInterval = time.Second     // 轮询待处理事件的间隔
+	defaultBatchSize    = 100             // 每次读取的事件数量
+	defaultMaxRetries   = 10              // 最多失败次数
+	defaultRetryBackoff = time.Second     // 第一次重试的等待时间，之后每次翻倍
+	defaultMaxBackoff   = 5 * time.Minute // 重试等待时间的上限
+	claimLease          = time.Minute     // 认领租约，处理进程崩溃时租约到期后事件会被重新认领
+	cleanupInterval     = time.Hour       // 清理已处理事件的间隔
+	defaultRetention    = 7 * 24 * time.Hour
+)
+
+// Handler 事件处理函数，返回错误时事件会被重试
+type Handler func(event *models.OutboxEvent) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[models.OutboxEventType][]Handler)
+
+	// notify 有新事件写入时唤醒转发任务，不必等到下一次轮询
+	notify = make(chan struct{}, 1)
+)
+
+// RegisterHandler 注册事件处理函数，同一事件类型可以注册多个处理函数
+// 一般在init函数中调用
+func RegisterHandler(eventType models.OutboxEventType, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[eventType] = append(handlers[eventType], h)
+}
+
+// Notify 通知转发任务立即处理新写入的事件
+// 事务提交后调用，转发任务未启动或正忙时直接返回
+func Notify() {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// Relay 事务发件箱转发任务
+type Relay struct {
+	pollInterval time.Duration
+	batchSize    int64
+	maxRetries   int64
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+	retention    time.Duration
+}
+
+// NewRelay 根据配置创建转发任务，未配置的参数使用默认值
+func NewRelay(cfg *setting.OutboxConfig) *Relay {
+	r := &Relay{
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		retention:    defaultRetention,
+	}
+	if cfg == nil {
+		return r
+	}
+	if cfg.PollInterval > 0 {
+		r.pollInterval = time.Duration(cfg.PollInterval) * time.Second
+	}
+	if cfg.OutboxBatchSize > 0 {
+		r.batchSize = cfg.OutboxBatchSize
+	}
+	if cfg.OutboxMaxRetries > 0 {
+		r.maxRetries = cfg.OutboxMaxRetries
+	}
+	if cfg.RetryBackoff > 0 {
+		r.retryBackoff = time.Duration(cfg.RetryBackoff) * time.Second
+	}
+	if cfg.MaxBackoff > 0 {
+		r.maxBackoff = time.Duration(cfg.MaxBackoff) * time.Second
+	}
+	if cfg.RetentionDays > 0 {
+		r.retention = time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	}
+	return r
+}
+
+// Start 启动转发任务
+// 返回值: 停止转发任务的函数，会等待正在处理的事件完成
+func (r *Relay) Start() (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		lastCleanup := time.Time{}
+		for {
+			// 一批处理满时说明还有积压，不等待直接处理下一批
+			for r.RunOnce() >= int(r.batchSize) {
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+			if time.Since(lastCleanup) >= cleanupInterval {
+				r.cleanup()
+				lastCleanup = time.Now()
+			}
+			select {
+			case <-ticker.C:
+			case <-notify:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// RunOnce 处理一批待处理事件
+// 返回值: 本批读取到的事件数量
+func (r *Relay) RunOnce() int {
+	events, err := mysql.GetPendingOutboxEvents(r.batchSize)
+	if err != nil {
+		zap.L().Error("mysql.GetPendingOutboxEvents failed", zap.Error(err))
+		return 0
+	}
+	for _, e := range events {
+		ok, err := mysql.ClaimOutboxEvent(e, claimLease)
+		if err != nil {
+			zap.L().Error("mysql.ClaimOutboxEvent failed", zap.Int64("id", e.ID), zap.Error(err))
+			continue
+		}
+		if !ok {
+			// 已被其他实例认领
+			continue
+		}
+		r.handle(e)
+	}
+	return len(events)
+}
+
+// handle 调用事件的处理函数，并记录处理结果
+func (r *Relay) handle(e *models.OutboxEvent) {
+	err := dispatch(e)
+	if err == nil {
+		if err = mysql.MarkOutboxEventDone(e.ID); err != nil {
+			// 标记失败时租约到期后事件会被再次处理，处理函数是幂等的
+			zap.L().Error("mysql.MarkOutboxEventDone failed", zap.Int64("id", e.ID), zap.Error(err))
+		}
+		return
+	}
+
+	retryCount := e.RetryCount + 1
+	failed := retryCount >= r.maxRetries
+	next := time.Now().Add(r.backoff(retryCount))
+	fields := []zap.Field{
+		zap.Int64("id", e.ID),
+		zap.String("eventType", string(e.EventType)),
+		zap.Int64("aggregateID", e.AggregateID),
+		zap.Int64("retryCount", retryCount),
+		zap.Error(err),
+	}
+	if failed {
+		zap.L().Error("outbox event failed, give up retrying", fields...)
+	} else {
+		zap.L().Warn("outbox event failed, will retry", append(fields, zap.Time("nextRetry", next))...)
+	}
+	if err := mysql.MarkOutboxEventRetry(e.ID, retryCount, next, err.Error(), failed); err != nil {
+		zap.L().Error("mysql.MarkOutboxEventRetry failed", zap.Int64("id", e.ID), zap.Error(err))
+	}
+}
+
+// backoff 计算第retryCount次失败后的重试等待时间
+func (r *Relay) backoff(retryCount int64) time.Duration {
+	d := r.retryBackoff
+	for i := int64(1); i < retryCount; i++ {
+		d *= 2
+		if d >= r.maxBackoff {
+			return r.maxBackoff
+		}
+	}
+	return d
+}
+
+// cleanup 删除超过保留时间的已处理事件
+func (r *Relay) cleanup() {
+	n, err := mysql.DeleteDoneOutboxEvents(time.Now().Add(-r.retention))
+	if err != nil {
+		zap.L().Error("mysql.DeleteDoneOutboxEvents failed", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Info("cleanup outbox events", zap.Int64("deleted", n))
+	}
+}
+
+// dispatch 依次调用事件类型注册的处理函数
+// 没有注册处理函数的事件类型视为错误，避免事件被静默丢弃
+func dispatch(e *models.OutboxEvent) error {
+	handlersMu.RLock()
+	hs := handlers[e.EventType]
+	handlersMu.RUnlock()
+	if len(hs) == 0 {
+		return fmt.Errorf("no handler registered for outbox event type: %s", e.EventType)
+	}
+	for _, h := range hs {
+		if err := h(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
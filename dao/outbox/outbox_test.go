@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/setting"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testEvent models.OutboxEventType = "test.event"
+
+func TestRelayRunOnce(t *testing.T) {
+	mock := testutil.MySQL(t)
+
+	// 1号事件处理成功；2号事件被其他实例认领；3号事件第一次失败；4号事件最后一次失败
+	handled := make(map[int64]int)
+	RegisterHandler(testEvent, func(e *models.OutboxEvent) error {
+		handled[e.AggregateID]++
+		if e.AggregateID >= 3 {
+			return errors.New("redis is down")
+		}
+		return nil
+	})
+	t.Cleanup(func() { delete(handlers, testEvent) })
+
+	due := time.Now().Add(-time.Second)
+	rows := sqlmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "status", "retry_count", "next_retry_time", "last_error", "create_time"})
+	for id, retries := range []int64{0, 0, 0, 2} {
+		rows.AddRow(id+1, testEvent, id+1, "{}", models.OutboxStatusPending, retries, due, "", due)
+	}
+	mock.ExpectQuery("from outbox").WithArgs(models.OutboxStatusPending, sqlmock.AnyArg(), 10).WillReturnRows(rows)
+
+	mock.ExpectExec("update outbox set next_retry_time").WithArgs(sqlmock.AnyArg(), 1, models.OutboxStatusPending, due).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update outbox set status").WithArgs(models.OutboxStatusDone, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec("update outbox set next_retry_time").WithArgs(sqlmock.AnyArg(), 2, models.OutboxStatusPending, due).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec("update outbox set next_retry_time").WithArgs(sqlmock.AnyArg(), 3, models.OutboxStatusPending, due).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update outbox set status").
+		WithArgs(models.OutboxStatusPending, 1, sqlmock.AnyArg(), "redis is down", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec("update outbox set next_retry_time").WithArgs(sqlmock.AnyArg(), 4, models.OutboxStatusPending, due).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("update outbox set status").
+		WithArgs(models.OutboxStatusFailed, 3, sqlmock.AnyArg(), "redis is down", 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	r := NewRelay(&setting.OutboxConfig{OutboxBatchSize: 10, OutboxMaxRetries: 3})
+	if n := r.RunOnce(); n != 4 {
+		t.Fatalf("RunOnce got %d events, want 4", n)
+	}
+	if handled[1] != 1 || handled[2] != 0 || handled[3] != 1 || handled[4] != 1 {
+		t.Fatalf("unexpected handler calls: %v", handled)
+	}
+}
+
+func TestDispatchWithoutHandler(t *testing.T) {
+	// 没有处理函数的事件不能被当作处理成功
+	if err := dispatch(&models.OutboxEvent{EventType: "unknown"}); err == nil {
+		t.Fatal("dispatch without handler got nil error")
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	r := NewRelay(&setting.OutboxConfig{RetryBackoff: 1, MaxBackoff: 10})
+	cases := []struct {
+		retryCount int64
+		want       time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := r.backoff(tc.retryCount); got != tc.want {
+			t.Errorf("backoff(%d) got %v, want %v", tc.retryCount, got, tc.want)
+		}
+	}
+}
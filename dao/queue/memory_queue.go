@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const memoryQueueSize = 10000 // 缓冲区1万条消息
+
+// MemoryQueue 基于进程内通道的投票消息队列
+type MemoryQueue struct {
+	messages      chan VoteMessage
+	batchSize     int
+	flushInterval time.Duration
+	wg            sync.WaitGroup
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// NewMemoryQueue 创建内存投票队列并启动工作协程
+func NewMemoryQueue(batchSize int64, flushInterval time.Duration) *MemoryQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	mq := &MemoryQueue{
+		messages:      make(chan VoteMessage, memoryQueueSize),
+		batchSize:     int(batchSize),
+		flushInterval: flushInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	mq.startWorker()
+	return mq
+}
+
+// Enqueue 入队投票消息，队列已满时丢弃消息
+func (mq *MemoryQueue) Enqueue(msg VoteMessage) error {
+	select {
+	case mq.messages <- msg:
+		// 消息入队成功
+		return nil
+	default:
+		zap.L().Error("投票队列已满，丢弃消息", zap.Any("msg", msg))
+		return ErrQueueFull
+	}
+}
+
+// startWorker 启动工作协程
+func (mq *MemoryQueue) startWorker() {
+	mq.wg.Add(1)
+	go func() {
+		defer mq.wg.Done()
+		ticker := time.NewTicker(mq.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]VoteMessage, 0, mq.batchSize)
+
+		for {
+			select {
+			case msg := <-mq.messages:
+				batch = append(batch, msg)
+				if len(batch) >= mq.batchSize {
+					_ = saveBatch(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				if len(batch) > 0 {
+					_ = saveBatch(batch)
+					batch = batch[:0]
+				}
+			case <-mq.ctx.Done():
+				// 退出前把通道中剩余的消息处理完
+				mq.drain(batch)
+				return
+			}
+		}
+	}()
+}
+
+// drain 处理通道中剩余的全部消息
+func (mq *MemoryQueue) drain(batch []VoteMessage) {
+	for {
+		select {
+		case msg := <-mq.messages:
+			batch = append(batch, msg)
+			if len(batch) >= mq.batchSize {
+				_ = saveBatch(batch)
+				batch = batch[:0]
+			}
+		default:
+			_ = saveBatch(batch)
+			return
+		}
+	}
+}
+
+// Close 关闭队列
+func (mq *MemoryQueue) Close() {
+	if mq.cancel != nil {
+		mq.cancel()
+	}
+	mq.wg.Wait()
+}
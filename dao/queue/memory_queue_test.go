@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	mock := testutil.MySQL(t)
+
+	msgs := []VoteMessage{
+		{TargetType: models.VoteTargetPost, TargetID: 1, UserID: 100, VoteValue: 1, Timestamp: 1000},
+		{TargetType: models.VoteTargetPost, TargetID: 1, UserID: 101, VoteValue: -1, Timestamp: 1001},
+		{TargetType: models.VoteTargetPost, TargetID: 2, UserID: 100, VoteValue: 0, Timestamp: 1002},
+	}
+	// 凑满一批立即写入
+	mock.ExpectExec(`INSERT INTO vote\(target_type, target_id, user_id, vote_type, vote_time\) VALUES \(\?, \?, \?, \?, \?\), \(\?, \?, \?, \?, \?\)\s+ON DUPLICATE KEY UPDATE`).
+		WithArgs(models.VoteTargetPost, 1, 100, 1, 1000, models.VoteTargetPost, 1, 101, -1, 1001).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	// 不满一批的消息在关闭队列时写入
+	mock.ExpectExec(`INSERT INTO vote\(.*\) VALUES \(\?, \?, \?, \?, \?\)\s+ON DUPLICATE KEY UPDATE`).
+		WithArgs(models.VoteTargetPost, 2, 100, 0, 1002).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 刷新间隔足够长，只有凑满一批和关闭队列时才会写入
+	mq := NewMemoryQueue(2, time.Hour)
+	for _, msg := range msgs {
+		if err := mq.Enqueue(msg); err != nil {
+			t.Fatalf("Enqueue failed, err:%v", err)
+		}
+	}
+	mq.Close()
+}
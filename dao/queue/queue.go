@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/setting"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 投票消息队列
+// 投票先写Redis，再把投票记录放入队列，由队列批量写入MySQL。
+// 队列有两种实现，通过配置文件的vote_queue.backend选择：
+//   memory: 进程内的带缓冲通道，性能最好，但队列满时会丢弃消息，进程崩溃会丢失未写入的消息
+//   stream: 基于Redis Streams的消费者组，消息持久化在Redis中，处理失败可以重试，多次失败转入死信stream
+
+const (
+	BackendMemory = "memory"
+	BackendStream = "stream"
+)
+
+const (
+	defaultBatchSize     = 100             // 批量处理100条
+	defaultFlushInterval = 5 * time.Second // 每5秒批量处理
+)
+
+var (
+	ErrQueueNotInit = errors.New("投票队列未初始化")
+	ErrQueueFull    = errors.New("投票队列已满")
+)
+
+// VoteMessage 投票消息结构
+type VoteMessage struct {
+	TargetType models.VoteTargetType `json:"target_type"`
+	TargetID   int64                 `json:"target_id"`
+	UserID     int64                 `json:"user_id"`
+	VoteValue  int8                  `json:"vote_value"`
+	Timestamp  int64                 `json:"timestamp"` // 投票时间，毫秒时间戳，写入MySQL时用于丢弃过期的消息
+}
+
+// Queue 投票队列接口
+type Queue interface {
+	// Enqueue 投票消息入队
+	Enqueue(msg VoteMessage) error
+	// Close 关闭队列，返回前会处理完已经取出的消息
+	Close()
+}
+
+var (
+	voteQueue Queue
+	once      sync.Once
+)
+
+// InitVoteQueue 根据配置初始化投票队列
+func InitVoteQueue(cfg *setting.VoteQueueConfig) (err error) {
+	once.Do(func() {
+		batchSize := cfg.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBatchSize
+		}
+		flushInterval := time.Duration(cfg.FlushInterval) * time.Second
+		if flushInterval <= 0 {
+			flushInterval = defaultFlushInterval
+		}
+
+		switch cfg.Backend {
+		case BackendMemory, "":
+			voteQueue = NewMemoryQueue(batchSize, flushInterval)
+		case BackendStream:
+			voteQueue, err = NewStreamQueue(cfg, batchSize, flushInterval)
+		default:
+			err = fmt.Errorf("unknown vote queue backend: %s", cfg.Backend)
+		}
+	})
+	return
+}
+
+// CloseVoteQueue 关闭投票队列
+// 程序退出前调用，确保已经取出的消息写入MySQL
+func CloseVoteQueue() {
+	if voteQueue != nil {
+		voteQueue.Close()
+	}
+}
+
+// EnqueueVote 入队投票消息
+func EnqueueVote(targetType models.VoteTargetType, targetID, userID int64, voteValue int8) error {
+	if voteQueue == nil {
+		return ErrQueueNotInit
+	}
+	return voteQueue.Enqueue(VoteMessage{
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserID:     userID,
+		VoteValue:  voteValue,
+		Timestamp:  time.Now().UnixMilli(),
+	})
+}
+
+// saveBatch 将一批投票消息写入MySQL
+func saveBatch(batch []VoteMessage) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	votes := make([]*models.Vote, 0, len(batch))
+	for _, msg := range batch {
+		votes = append(votes, &models.Vote{
+			TargetType: msg.TargetType,
+			TargetID:   msg.TargetID,
+			UserID:     msg.UserID,
+			VoteType:   msg.VoteValue,
+			VoteTime:   msg.Timestamp,
+		})
+	}
+
+	// 一条多行INSERT批量写入MySQL，比已有记录更早的投票不会覆盖已有记录
+	if err := mysql.BatchSaveVoteData(votes); err != nil {
+		zap.L().Error("批量写入投票数据失败",
+			zap.Int("count", len(batch)),
+			zap.Any("messages", batch),
+			zap.Error(err))
+		return err
+	}
+
+	zap.L().Debug("批量处理投票消息", zap.Int("count", len(batch)))
+	return nil
+}
@@ -0,0 +1,279 @@
+package queue
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/setting"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const streamDataField = "data" // 消息内容在stream中的字段名，值为VoteMessage的JSON
+
+const (
+	defaultStreamGroup = "bluebell"       // 默认的消费者组名称
+	defaultReclaimIdle = 30 * time.Second // 未确认的消息默认空闲30秒后重新认领，也是允许配置的最小值
+	defaultMaxRetries  = 5                // 消息默认最多投递5次，也是允许配置的最小值
+	pendingWarnRatio   = 0.8              // 未确认的消息数量达到stream上限的80%时告警
+)
+
+// StreamQueue 基于Redis Streams的投票消息队列
+// 消息在写入MySQL成功后才确认，进程崩溃时未确认的消息会在空闲超过ReclaimIdle后被重新认领，
+// 单独写入仍然失败、投递次数达到MaxRetries的消息转入死信stream，不再重试；
+// MySQL不可用导致的失败不计入投递次数，MySQL恢复之前消息一直留在待处理列表中
+type StreamQueue struct {
+	group       string
+	consumer    string
+	batchSize   int64
+	block       time.Duration
+	maxLen      int64
+	reclaimIdle time.Duration
+	maxRetries  int64
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// NewStreamQueue 创建Redis Streams投票队列并启动消费协程
+// stream_group、reclaim_idle、max_retries没有配置时使用默认值，配置的值小于默认值时返回错误：
+// 认领间隔太短会把正在处理的消息反复认领，投递次数很快用完，正常的投票被转入死信stream
+func NewStreamQueue(cfg *setting.VoteQueueConfig, batchSize int64, flushInterval time.Duration) (*StreamQueue, error) {
+	group := cfg.StreamGroup
+	if group == "" {
+		group = defaultStreamGroup
+	}
+	reclaimIdle := time.Duration(cfg.ReclaimIdle) * time.Second
+	if cfg.ReclaimIdle == 0 {
+		reclaimIdle = defaultReclaimIdle
+	}
+	if reclaimIdle < defaultReclaimIdle {
+		return nil, fmt.Errorf("vote_queue.reclaim_idle must be at least %d seconds", int(defaultReclaimIdle.Seconds()))
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	if maxRetries < defaultMaxRetries {
+		return nil, fmt.Errorf("vote_queue.max_retries must be at least %d", defaultMaxRetries)
+	}
+	if cfg.StreamMaxLen < 0 {
+		return nil, fmt.Errorf("vote_queue.stream_max_len must not be negative")
+	}
+
+	// 每个进程使用独立的消费者名称，多个实例共同消费同一个消费者组
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	sq := &StreamQueue{
+		group:       group,
+		consumer:    fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		batchSize:   batchSize,
+		block:       flushInterval,
+		maxLen:      cfg.StreamMaxLen,
+		reclaimIdle: reclaimIdle,
+		maxRetries:  maxRetries,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	if err := redis.CreateVoteStreamGroup(context.Background(), sq.group); err != nil {
+		cancel()
+		return nil, err
+	}
+	sq.startWorker()
+	return sq, nil
+}
+
+// Enqueue 投票消息写入stream
+// stream超过maxLen时裁剪最早的消息，裁剪不考虑消息是否已经确认，见checkBacklog
+func (sq *StreamQueue) Enqueue(msg VoteMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return redis.AddVoteStream(context.Background(), map[string]interface{}{
+		streamDataField: string(data),
+	}, sq.maxLen)
+}
+
+// startWorker 启动消费协程
+func (sq *StreamQueue) startWorker() {
+	sq.wg.Add(1)
+	go func() {
+		defer sq.wg.Done()
+		// 启动时先认领一次，处理上次退出时未确认的消息
+		lastReclaim := time.Time{}
+		for {
+			if sq.ctx.Err() != nil {
+				return
+			}
+			if time.Since(lastReclaim) >= sq.reclaimIdle {
+				sq.reclaim()
+				lastReclaim = time.Now()
+			}
+
+			msgs, err := redis.ReadVoteStream(sq.ctx, sq.group, sq.consumer, sq.batchSize, sq.block)
+			if err != nil {
+				if sq.ctx.Err() != nil {
+					return
+				}
+				zap.L().Error("redis.ReadVoteStream failed", zap.Error(err))
+				// 读取失败时稍等一会再重试，避免Redis不可用时空转
+				select {
+				case <-time.After(time.Second):
+				case <-sq.ctx.Done():
+					return
+				}
+				continue
+			}
+			sq.handle(msgs)
+		}
+	}()
+}
+
+// reclaim 认领长时间未确认的消息重新处理
+func (sq *StreamQueue) reclaim() {
+	sq.checkBacklog()
+	msgs, err := redis.ClaimPendingVotes(context.Background(), sq.group, sq.consumer, sq.reclaimIdle, sq.batchSize)
+	if err != nil {
+		zap.L().Error("redis.ClaimPendingVotes failed", zap.Error(err))
+		return
+	}
+	if len(msgs) > 0 {
+		zap.L().Warn("reclaim pending vote messages", zap.Int("count", len(msgs)))
+		sq.handle(msgs)
+	}
+}
+
+// checkBacklog 未确认的消息接近stream上限时告警
+// XADD按stream的总长度裁剪，MySQL长时间不可用时积压的消息超过上限，最早的未确认消息会被裁剪掉，投票不再写入MySQL
+func (sq *StreamQueue) checkBacklog() {
+	if sq.maxLen <= 0 {
+		return
+	}
+	pending, err := redis.CountPendingVotes(context.Background(), sq.group)
+	if err != nil {
+		zap.L().Error("redis.CountPendingVotes failed", zap.Error(err))
+		return
+	}
+	if float64(pending) >= float64(sq.maxLen)*pendingWarnRatio {
+		zap.L().Error("pending vote messages near stream max length, oldest messages will be trimmed",
+			zap.Int64("pending", pending),
+			zap.Int64("maxLen", sq.maxLen))
+	}
+}
+
+// handle 处理一批消息，写入MySQL成功后确认
+// 整批写入失败时逐条写入，一条数据有问题不影响同一批的其他消息；
+// 单独写入失败的消息不确认，留在待处理列表中等待重新认领，投递次数达到maxRetries时转入死信stream；
+// MySQL不可用时不再逐条写入，整批消息恢复投递次数后等待重新认领
+func (sq *StreamQueue) handle(msgs []redis.StreamMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	batch := make([]VoteMessage, 0, len(msgs))
+	valid := make([]redis.StreamMessage, 0, len(msgs))
+	for _, m := range msgs {
+		var vm VoteMessage
+		data, _ := m.Values[streamDataField].(string)
+		if err := json.Unmarshal([]byte(data), &vm); err != nil {
+			// 无法解析的消息重试也没有意义，直接转入死信stream
+			sq.deadLetter(m, "invalid message: "+err.Error())
+			continue
+		}
+		batch = append(batch, vm)
+		valid = append(valid, m)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	err := saveBatch(batch)
+	if err == nil {
+		sq.ack(valid)
+		return
+	}
+	if mysql.IsUnavailable(err) {
+		sq.keepPending(valid)
+		return
+	}
+	if len(batch) == 1 {
+		sq.retryLater(valid[0], err)
+		return
+	}
+
+	done := make([]redis.StreamMessage, 0, len(valid))
+	for i, vm := range batch {
+		err = saveBatch([]VoteMessage{vm})
+		if err == nil {
+			done = append(done, valid[i])
+			continue
+		}
+		if mysql.IsUnavailable(err) {
+			sq.keepPending(valid[i:])
+			break
+		}
+		sq.retryLater(valid[i], err)
+	}
+	sq.ack(done)
+}
+
+// ack 确认已经写入MySQL的消息
+func (sq *StreamQueue) ack(msgs []redis.StreamMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	if err := redis.AckVoteStream(context.Background(), sq.group, ids...); err != nil {
+		// 确认失败的消息会被重新处理，重复写入的投票时间相同，写入结果不变
+		zap.L().Error("redis.AckVoteStream failed", zap.Error(err))
+	}
+}
+
+// retryLater 单独写入失败的消息留在待处理列表中，这次投递计入重试次数，达到maxRetries时转入死信stream
+// 第一次读取的消息RetryCount为0，重新认领的消息RetryCount是认领之前的投递次数，这次投递是第RetryCount+1次
+func (sq *StreamQueue) retryLater(m redis.StreamMessage, err error) {
+	if sq.maxRetries > 0 && m.RetryCount+1 >= sq.maxRetries {
+		sq.deadLetter(m, "exceeded max retries: "+err.Error())
+	}
+}
+
+// keepPending MySQL不可用时消息留在待处理列表中，恢复这次投递之前的投递次数
+// 否则MySQL不可用超过maxRetries*reclaimIdle后，所有积压的投票都会被转入死信stream
+func (sq *StreamQueue) keepPending(msgs []redis.StreamMessage) {
+	zap.L().Warn("mysql unavailable, vote messages stay pending", zap.Int("count", len(msgs)))
+	if err := redis.RestoreVoteRetryCount(context.Background(), sq.group, sq.consumer, msgs); err != nil {
+		zap.L().Error("redis.RestoreVoteRetryCount failed", zap.Error(err))
+	}
+}
+
+// deadLetter 消息转入死信stream并确认，不再重试
+func (sq *StreamQueue) deadLetter(m redis.StreamMessage, reason string) {
+	zap.L().Error("vote message moved to dead letter stream",
+		zap.String("id", m.ID),
+		zap.Int64("retryCount", m.RetryCount),
+		zap.String("reason", reason))
+	if err := redis.AddVoteDeadStream(context.Background(), m, reason); err != nil {
+		zap.L().Error("redis.AddVoteDeadStream failed", zap.Error(err))
+		return
+	}
+	if err := redis.AckVoteStream(context.Background(), sq.group, m.ID); err != nil {
+		zap.L().Error("redis.AckVoteStream failed", zap.Error(err))
+	}
+}
+
+// Close 关闭队列
+// 未确认的消息仍然保存在Redis中，下次启动后会被重新认领
+func (sq *StreamQueue) Close() {
+	if sq.cancel != nil {
+		sq.cancel()
+	}
+	sq.wg.Wait()
+}
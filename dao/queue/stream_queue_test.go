@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/setting"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const testGroup = "bluebell-test"
+
+// newTestStreamQueue 创建不启动消费协程的StreamQueue，由测试直接调用handle和reclaim
+func newTestStreamQueue(t *testing.T, maxRetries int64) *StreamQueue {
+	if err := redis.CreateVoteStreamGroup(context.Background(), testGroup); err != nil {
+		t.Fatalf("CreateVoteStreamGroup failed, err:%v", err)
+	}
+	return &StreamQueue{
+		group:       testGroup,
+		consumer:    "c1",
+		batchSize:   10,
+		block:       10 * time.Millisecond,
+		reclaimIdle: time.Minute,
+		maxRetries:  maxRetries,
+	}
+}
+
+// pendingCount 还没有确认的消息数量
+func pendingCount(t *testing.T) int {
+	msgs, err := redis.ClaimPendingVotes(context.Background(), testGroup, "checker", 0, 100)
+	if errors.Is(err, goredis.Nil) {
+		// miniredis在没有待处理消息时返回nil，而不是空数组
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("ClaimPendingVotes failed, err:%v", err)
+	}
+	return len(msgs)
+}
+
+func TestStreamQueue(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	mock.ExpectExec(`INSERT INTO vote`).
+		WithArgs(models.VoteTargetPost, 1, 100, 1, 1000, models.VoteTargetPost, 2, 100, -1, 1001).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	// 启动消费协程之前写入，保证两条消息在同一批中读取
+	sq := newTestStreamQueue(t, 3)
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 1, UserID: 100, VoteValue: 1, Timestamp: 1000})
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 2, UserID: 100, VoteValue: -1, Timestamp: 1001})
+	sq.ctx, sq.cancel = context.WithCancel(context.Background())
+	sq.startWorker()
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sq.Close()
+	// 写入MySQL成功后消息已确认
+	if n := pendingCount(t); n != 0 {
+		t.Fatalf("%d messages still pending", n)
+	}
+}
+
+func TestStreamQueueDeadLetter(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	m.SetTime(time.Now())
+
+	sq := newTestStreamQueue(t, 2)
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 1, UserID: 100, VoteValue: 1, Timestamp: 1000})
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 2, UserID: 100, VoteValue: 1, Timestamp: 1000})
+	// 无法解析的消息直接转入死信stream
+	_ = redis.AddVoteStream(context.Background(), map[string]interface{}{streamDataField: "{"}, 0)
+
+	// 整批写入失败后逐条写入，只有2号帖子的投票单独写入也失败，1号帖子的投票写入后确认
+	badRow := errors.New("Error 1452: Cannot add or update a child row")
+	mock.ExpectExec(`INSERT INTO vote`).WillReturnError(badRow)
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 1, 100, 1, 1000).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 2, 100, 1, 1000).WillReturnError(badRow)
+	msgs, err := redis.ReadVoteStream(context.Background(), testGroup, sq.consumer, 10, sq.block)
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("ReadVoteStream got %d messages, err:%v", len(msgs), err)
+	}
+	sq.handle(msgs)
+	if dead, _ := m.Stream(redis.Prefix + redis.KeyVoteDeadStream); len(dead) != 1 {
+		t.Fatalf("dead letter stream has %d messages, want 1", len(dead))
+	}
+	if n, _ := redis.CountPendingVotes(context.Background(), testGroup); n != 1 {
+		t.Fatalf("%d messages pending, want 1", n)
+	}
+
+	// 空闲时间未到时不认领
+	sq.reclaim()
+
+	// 空闲超过reclaimIdle后重新认领，第二次投递仍然失败，投递次数达到maxRetries，转入死信stream并确认
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 2, 100, 1, 1000).WillReturnError(badRow)
+	m.SetTime(time.Now().Add(2 * time.Minute))
+	sq.reclaim()
+	if dead, _ := m.Stream(redis.Prefix + redis.KeyVoteDeadStream); len(dead) != 2 {
+		t.Fatalf("dead letter stream has %d messages, want 2", len(dead))
+	}
+	if n := pendingCount(t); n != 0 {
+		t.Fatalf("%d messages still pending", n)
+	}
+}
+
+func TestStreamQueueMySQLOutage(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	now := time.Now()
+	m.SetTime(now)
+
+	sq := newTestStreamQueue(t, 2)
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 1, UserID: 100, VoteValue: 1, Timestamp: 1000})
+	_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: 2, UserID: 100, VoteValue: -1, Timestamp: 1001})
+	down := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	// MySQL不可用的时间远超过maxRetries*reclaimIdle，每次认领都写入失败，不逐条重试，也不转入死信stream
+	mock.ExpectExec(`INSERT INTO vote`).WillReturnError(down)
+	msgs, err := redis.ReadVoteStream(context.Background(), testGroup, sq.consumer, 10, sq.block)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("ReadVoteStream got %d messages, err:%v", len(msgs), err)
+	}
+	sq.handle(msgs)
+	for i := 1; i <= 5; i++ {
+		mock.ExpectExec(`INSERT INTO vote`).WillReturnError(down)
+		m.SetTime(now.Add(time.Duration(i) * 2 * time.Minute))
+		sq.reclaim()
+	}
+	if dead, _ := m.Stream(redis.Prefix + redis.KeyVoteDeadStream); len(dead) != 0 {
+		t.Fatalf("dead letter stream has %d messages during outage, want 0", len(dead))
+	}
+	if n, _ := redis.CountPendingVotes(context.Background(), testGroup); n != 2 {
+		t.Fatalf("%d messages pending, want 2", n)
+	}
+
+	// MySQL恢复后重新认领，1号帖子的投票写入并确认
+	// 2号帖子的投票单独写入失败一次，不可用期间的投递没有计入重试次数，不会直接转入死信stream
+	badRow := errors.New("Error 1452: Cannot add or update a child row")
+	mock.ExpectExec(`INSERT INTO vote`).WillReturnError(badRow)
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 1, 100, 1, 1000).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 2, 100, -1, 1001).WillReturnError(badRow)
+	m.SetTime(now.Add(20 * time.Minute))
+	sq.reclaim()
+	if dead, _ := m.Stream(redis.Prefix + redis.KeyVoteDeadStream); len(dead) != 0 {
+		t.Fatalf("dead letter stream has %d messages, want 0", len(dead))
+	}
+
+	mock.ExpectExec(`INSERT INTO vote`).WithArgs(models.VoteTargetPost, 2, 100, -1, 1001).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.SetTime(now.Add(22 * time.Minute))
+	sq.reclaim()
+	if dead, _ := m.Stream(redis.Prefix + redis.KeyVoteDeadStream); len(dead) != 0 {
+		t.Fatalf("dead letter stream has %d messages, want 0", len(dead))
+	}
+	if n := pendingCount(t); n != 0 {
+		t.Fatalf("%d messages still pending", n)
+	}
+}
+
+func TestNewStreamQueueDefaults(t *testing.T) {
+	testutil.Redis(t)
+
+	sq, err := NewStreamQueue(&setting.VoteQueueConfig{}, 10, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewStreamQueue failed, err:%v", err)
+	}
+	sq.Close()
+	if sq.group != defaultStreamGroup || sq.reclaimIdle != defaultReclaimIdle || sq.maxRetries != defaultMaxRetries {
+		t.Fatalf("defaults not applied: group=%q reclaimIdle=%v maxRetries=%d", sq.group, sq.reclaimIdle, sq.maxRetries)
+	}
+
+	// 小于默认值的配置会让正在处理的消息被反复认领，直接拒绝
+	for _, cfg := range []*setting.VoteQueueConfig{
+		{ReclaimIdle: 1},
+		{ReclaimIdle: -1},
+		{MaxRetries: 1},
+		{StreamMaxLen: -1},
+	} {
+		if _, err = NewStreamQueue(cfg, 10, 10*time.Millisecond); err == nil {
+			t.Errorf("NewStreamQueue(%+v) got nil error", cfg)
+		}
+	}
+}
+
+func TestCountPendingVotes(t *testing.T) {
+	testutil.Redis(t)
+
+	sq := newTestStreamQueue(t, 3)
+	for i := int64(1); i <= 3; i++ {
+		_ = sq.Enqueue(VoteMessage{TargetType: models.VoteTargetPost, TargetID: i, UserID: 100, VoteValue: 1, Timestamp: 1000})
+	}
+	if n, err := redis.CountPendingVotes(context.Background(), testGroup); err != nil || n != 0 {
+		t.Fatalf("CountPendingVotes before read got %d, %v", n, err)
+	}
+	// 读取之后没有确认的消息计入待处理列表
+	if _, err := redis.ReadVoteStream(context.Background(), testGroup, sq.consumer, 10, sq.block); err != nil {
+		t.Fatalf("ReadVoteStream failed, err:%v", err)
+	}
+	if n, err := redis.CountPendingVotes(context.Background(), testGroup); err != nil || n != 3 {
+		t.Fatalf("CountPendingVotes after read got %d, %v", n, err)
+	}
+}
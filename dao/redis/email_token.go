@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 邮件中的一次性token
+// 邮箱验证和重置密码的链接中带有随机token，Redis中只保存token的sha256以及对应的用户和邮箱，
+// token使用一次后立即删除，过期后自动删除。
+
+var ErrEmailTokenInvalid = errors.New("链接无效或已过期")
+
+// consumeEmailTokenScript 取出token对应的用户和邮箱并删除token
+// KEYS[1]: token的key
+// 返回值: {用户id, 邮箱} 成功；{} token不存在或已过期
+var consumeEmailTokenScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'user_id', 'email')
+if not v[1] then
+	return {}
+end
+redis.call('DEL', KEYS[1])
+return {v[1], v[2]}
+`)
+
+// createEmailToken 保存token对应的用户和邮箱
+func createEmailToken(key string, userID int64, email string, ttl time.Duration) error {
+	ctx := context.Background()
+	pipeline := client.TxPipeline()
+	pipeline.HSet(ctx, key, "user_id", userID, "email", email)
+	pipeline.Expire(ctx, key, ttl)
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// consumeEmailToken 取出token对应的用户和邮箱，token随即失效
+func consumeEmailToken(key string) (userID int64, email string, err error) {
+	ret, err := consumeEmailTokenScript.Run(context.Background(), client, []string{key}).Slice()
+	if err != nil {
+		return 0, "", err
+	}
+	if len(ret) == 0 {
+		return 0, "", ErrEmailTokenInvalid
+	}
+	userID, err = strconv.ParseInt(ret[0].(string), 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, ret[1].(string), nil
+}
+
+// CreateEmailVerifyToken 保存邮箱验证token
+// 参数 tokenHash: token的sha256
+func CreateEmailVerifyToken(tokenHash string, userID int64, email string, ttl time.Duration) error {
+	return createEmailToken(getRedisKey(KeyEmailVerifyPF+tokenHash), userID, email, ttl)
+}
+
+// ConsumeEmailVerifyToken 使用邮箱验证token，返回待验证的用户和邮箱
+func ConsumeEmailVerifyToken(tokenHash string) (userID int64, email string, err error) {
+	return consumeEmailToken(getRedisKey(KeyEmailVerifyPF + tokenHash))
+}
+
+// CreatePasswordResetToken 保存重置密码token
+// 参数 tokenHash: token的sha256
+func CreatePasswordResetToken(tokenHash string, userID int64, email string, ttl time.Duration) error {
+	return createEmailToken(getRedisKey(KeyPasswordResetPF+tokenHash), userID, email, ttl)
+}
+
+// ConsumePasswordResetToken 使用重置密码token，返回要重置密码的用户和发送链接的邮箱
+func ConsumePasswordResetToken(tokenHash string) (userID int64, email string, err error) {
+	return consumeEmailToken(getRedisKey(KeyPasswordResetPF + tokenHash))
+}
@@ -5,12 +5,45 @@ package redis
 // redis key注意使用命名空间的方式,方便查询和拆分
 
 const (
-	Prefix             = "bluebell:"   // 项目key前缀
-	KeyPostTimeZSet    = "post:time"   // zset;贴子及发帖时间
-	KeyPostScoreZSet   = "post:score"  // zset;贴子及投票的分数
-	KeyPostVotedZSetPF = "post:voted:" // zset;记录用户及投票类型;参数是post id
+	Prefix             = "bluebell:"     // 项目key前缀
+	KeyPostTimeZSet    = "post:time"     // zset;贴子及发帖时间
+	KeyPostScoreZSet   = "post:score"    // zset;贴子及投票的分数
+	KeyPostVotedZSetPF = "post:voted:"   // zset;记录用户及投票类型;参数是post id
+	KeyPostLockedSet   = "post:locked"   // set;被版主锁定、不允许投票的帖子id
+	KeyPostClearedPF   = "post:cleared:" // string;帖子的投票被全部取消、post:voted:<id>已删除的标记;参数是post id
 
 	KeyCommunitySetPF = "community:" // set;保存每个分区下帖子的id
+
+	// 可投票对象的key后缀，完整的key为 对象命名空间 + 后缀，如帖子为 post:time、post:voted:<id>
+	KeyTimeZSetSF  = ":time"     // zset;对象及创建时间
+	KeyScoreZSetSF = ":score"    // zset;对象及投票的分数
+	KeyVotedZSetSF = ":voted:"   // zset;记录用户及投票类型;参数是对象id
+	KeyLockedSetSF = ":locked"   // set;被版主锁定、不允许投票的对象id
+	KeyClearedSF   = ":cleared:" // string;对象的投票被全部取消、投票记录zset已删除的标记，投票时间窗口结束时过期;参数是对象id
+
+	KeyVoteArchiveCursorSF = ":archive:cursor" // string;投票归档任务已处理到的对象创建时间
+
+	KeyVoteStream     = "vote:stream"      // stream;待写入MySQL的投票消息
+	KeyVoteDeadStream = "vote:stream:dead" // stream;多次处理失败的投票消息（死信）
+
+	KeyRefreshTokenPF  = "token:refresh:"  // hash;refresh token的用户、所属会话和是否已使用;参数是token的sha256
+	KeyTokenFamilyPF   = "token:family:"   // string;会话当前有效的refresh token的sha256;参数是会话id
+	KeyTokenDenylistPF = "token:denylist:" // string;已吊销的access token;参数是jti
+	KeyUserSessionPF   = "user:session:"   // string;用户最近一次登录的会话id;参数是用户id
+	KeyUserFamiliesPF  = "user:families:"  // set;用户所有登录会话的id，用于让用户的全部会话下线;参数是用户id
+
+	KeyRateLimitPF       = "ratelimit:"        // string;窗口内的请求次数;参数是 操作:user:<用户id> 或 操作:ip:<IP>
+	KeyRateLimitBucketPF = "ratelimit:bucket:" // hash;路由组的令牌桶，剩余令牌数和上次更新时间;参数是路由组名
+
+	KeyLoginFailPF = "login:fail:" // string;连续登录失败的次数;参数是 user:<用户名> 或 ip:<IP>
+	KeyLoginLockPF = "login:lock:" // string;登录锁定，key的过期时间即锁定的剩余时间;参数同上
+
+	KeyTwoFactorChallengePF = "2fa:challenge:" // hash;两步验证登录的用户和已尝试次数;参数是challenge token的sha256
+
+	KeyEmailVerifyPF   = "email:verify:"   // hash;邮箱验证链接对应的用户和邮箱;参数是token的sha256
+	KeyPasswordResetPF = "password:reset:" // hash;重置密码链接对应的用户和邮箱;参数是token的sha256
+
+	KeyOIDCStatePF = "oidc:state:" // hash;第三方登录请求的身份提供方、nonce、code_verifier和要绑定的用户;参数是state的sha256
 )
 
 // 给redis key加上前缀, 好处是避免key冲突,因为多个项目共用一个redis
@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 登录失败锁定
+// 失败次数和锁定分别保存：失败次数在窗口内没有新的失败时过期；锁定key的过期时间就是锁定的剩余时间。
+// 失败次数超过上限后每失败一次锁定一次，锁定时长从基础时长开始翻倍。
+
+// recordLoginFailureScript 记录一次登录失败，超过上限时锁定
+// KEYS[1]: 失败次数的key  KEYS[2]: 锁定的key
+// ARGV[1]: 失败次数上限  ARGV[2]: 基础锁定时长（毫秒）  ARGV[3]: 最长锁定时长（毫秒）  ARGV[4]: 失败次数的保留时间（毫秒）
+// 返回值: 本次失败后的锁定时长（毫秒），0表示没有锁定
+var recordLoginFailureScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+local limit = tonumber(ARGV[1])
+local lock = 0
+if n > limit then
+	local exp = math.min(n - limit - 1, 30)
+	lock = math.floor(math.min(tonumber(ARGV[2]) * 2 ^ exp, tonumber(ARGV[3])))
+	redis.call('SET', KEYS[2], n, 'PX', lock)
+end
+redis.call('PEXPIRE', KEYS[1], math.max(tonumber(ARGV[4]), lock))
+return lock
+`)
+
+// LoginLockout 登录锁定策略
+type LoginLockout struct {
+	MaxAttempts int64         // 失败次数上限
+	Base        time.Duration // 第一次锁定的时长
+	Max         time.Duration // 最长锁定时长
+	Window      time.Duration // 失败次数的保留时间
+}
+
+// GetLoginLock 查询锁定的剩余时间，返回所有对象中最长的，为0表示没有锁定
+// 参数 subjects: 锁定对象，如 user:<用户名>、ip:<IP>
+func GetLoginLock(subjects ...string) (time.Duration, error) {
+	ctx := context.Background()
+	pipeline := client.Pipeline()
+	cmds := make([]*redis.DurationCmd, 0, len(subjects))
+	for _, s := range subjects {
+		cmds = append(cmds, pipeline.PTTL(ctx, getRedisKey(KeyLoginLockPF+s)))
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return 0, err
+	}
+	var remain time.Duration
+	for _, cmd := range cmds {
+		// key不存在时PTTL返回负数
+		if d := cmd.Val(); d > remain {
+			remain = d
+		}
+	}
+	return remain, nil
+}
+
+// RecordLoginFailure 记录一次登录失败
+// 返回值: 本次失败后的锁定时长，为0表示没有锁定
+func RecordLoginFailure(subject string, l LoginLockout) (time.Duration, error) {
+	lock, err := recordLoginFailureScript.Run(context.Background(), client,
+		[]string{getRedisKey(KeyLoginFailPF + subject), getRedisKey(KeyLoginLockPF + subject)},
+		l.MaxAttempts, l.Base.Milliseconds(), l.Max.Milliseconds(), l.Window.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(lock) * time.Millisecond, nil
+}
+
+// ClearLoginFailure 登录成功后清除失败次数，锁定已经过期，不需要清除
+func ClearLoginFailure(subject string) error {
+	return client.Del(context.Background(), getRedisKey(KeyLoginFailPF+subject)).Err()
+}
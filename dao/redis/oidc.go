@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"bluebell/models"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 第三方登录请求
+// 跳转到身份提供方登录前保存nonce和PKCE的code_verifier，跳转回来时按state取出，每个state只能使用一次。
+// Redis中只保存state的sha256。
+
+var ErrOIDCStateInvalid = errors.New("登录请求无效或已过期")
+
+// consumeOIDCStateScript 取出登录请求并删除
+// KEYS[1]: state的key
+// 返回值: {身份提供方, nonce, code_verifier, 用户id} 成功；{} state不存在或已过期
+var consumeOIDCStateScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'provider', 'nonce', 'verifier', 'user_id')
+if not v[1] then
+	return {}
+end
+redis.call('DEL', KEYS[1])
+return v
+`)
+
+// CreateOIDCState 保存第三方登录请求
+// 参数 stateHash: state的sha256
+func CreateOIDCState(stateHash string, s *models.OIDCState, ttl time.Duration) error {
+	ctx := context.Background()
+	key := getRedisKey(KeyOIDCStatePF + stateHash)
+	pipeline := client.TxPipeline()
+	pipeline.HSet(ctx, key,
+		"provider", s.Provider,
+		"nonce", s.Nonce,
+		"verifier", s.Verifier,
+		"user_id", s.UserID,
+	)
+	pipeline.Expire(ctx, key, ttl)
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// ConsumeOIDCState 取出第三方登录请求，state随即失效
+func ConsumeOIDCState(stateHash string) (*models.OIDCState, error) {
+	ret, err := consumeOIDCStateScript.Run(context.Background(), client,
+		[]string{getRedisKey(KeyOIDCStatePF + stateHash)}).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 4 {
+		return nil, ErrOIDCStateInvalid
+	}
+	fields := make([]string, len(ret))
+	for i, v := range ret {
+		fields[i], _ = v.(string)
+	}
+	userID, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OIDCState{
+		Provider: fields[0],
+		Nonce:    fields[1],
+		Verifier: fields[2],
+		UserID:   userID,
+	}, nil
+}
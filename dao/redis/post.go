@@ -28,7 +28,18 @@ func GetPostIDsInOrder(p *models.ParamPostList) ([]string, error) {
 }
 
 // GetPostVoteData 根据ids查询每篇帖子的投赞成票的数据
-func GetPostVoteData(ids []string) (data []int64, err error) {
+func GetPostVoteData(ids []string) (data []int64, missing []int64, err error) {
+	return GetVoteData(models.VoteTargetPost, ids)
+}
+
+// GetVoteData 根据ids查询每个投票对象的赞成票数
+// 返回值 missing: Redis中没有投票记录的对象id，它们可能已经过了投票时间窗口被归档到MySQL，
+// 由调用方到归档数据中查询
+func GetVoteData(tt models.VoteTargetType, ids []string) (data []int64, missing []int64, err error) {
+	target, err := GetVoteTarget(tt)
+	if err != nil {
+		return nil, nil, err
+	}
 	//data = make([]int64, 0, len(ids))
 	//for _, id := range ids {
 	//	key := getRedisKey(KeyPostVotedZSetPF + id)
@@ -37,26 +48,83 @@ func GetPostVoteData(ids []string) (data []int64, err error) {
 	//	data = append(data, v)
 	//}
 	// 使用pipeline一次发送多条命令,减少RTT
+	// 同时查询投票记录是否存在，不存在的可能已经过了投票时间窗口被归档到MySQL
 	pipeline := client.Pipeline()
+	existsCmds := make([]*redis.IntCmd, 0, len(ids))
+	countCmds := make([]*redis.IntCmd, 0, len(ids))
 	for _, id := range ids {
-		key := getRedisKey(KeyPostVotedZSetPF + id)
-		pipeline.ZCount(context.Background(), key, "1", "1")
+		key := target.VotedKey(id)
+		existsCmds = append(existsCmds, pipeline.Exists(context.Background(), key))
+		countCmds = append(countCmds, pipeline.ZCount(context.Background(), key, "1", "1"))
 	}
-	cmders, err := pipeline.Exec(context.Background())
-	if err != nil {
-		return nil, err
+	if _, err = pipeline.Exec(context.Background()); err != nil {
+		return nil, nil, err
 	}
-	data = make([]int64, 0, len(cmders))
-	for _, cmder := range cmders {
-		v := cmder.(*redis.IntCmd).Val()
-		data = append(data, v)
+	data = make([]int64, 0, len(ids))
+	for i, id := range ids {
+		data = append(data, countCmds[i].Val())
+		if existsCmds[i].Val() == 0 {
+			if tid, err := strconv.ParseInt(id, 10, 64); err == nil {
+				missing = append(missing, tid)
+			}
+		}
 	}
 	return
 }
 
 // GetCommunityPostIDsInOrder 按社区查询ids
 func GetCommunityPostIDsInOrder(p *models.ParamPostList) ([]string, error) {
+	key, err := communityOrderKey(p)
+	if err != nil {
+		return nil, err
+	}
+	// 存在的话就直接根据key查询ids
+	return getIDsFormKey(key, p.Page, p.Size)
+}
+
+// GetCommunityPostIDsRange 按社区查询排序后从start开始的count个帖子id
+func GetCommunityPostIDsRange(p *models.ParamPostList, start, count int64) ([]string, error) {
+	if count <= 0 {
+		return []string{}, nil
+	}
+	key, err := communityOrderKey(p)
+	if err != nil {
+		return nil, err
+	}
+	return client.ZRevRange(context.Background(), key, start, start+count-1).Result()
+}
 
+// GetCommunityPostRanks 查询帖子在社区排序列表中的位置，从0开始，不在列表中的为-1
+func GetCommunityPostRanks(p *models.ParamPostList, ids []string) ([]int64, error) {
+	ranks := make([]int64, 0, len(ids))
+	if len(ids) == 0 {
+		return ranks, nil
+	}
+	key, err := communityOrderKey(p)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipeline.ZRevRank(context.Background(), key, id))
+	}
+	// ZRevRank查不到成员时返回redis.Nil，属于正常情况
+	if _, err = pipeline.Exec(context.Background()); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() == redis.Nil {
+			ranks = append(ranks, -1)
+			continue
+		}
+		ranks = append(ranks, cmd.Val())
+	}
+	return ranks, nil
+}
+
+// communityOrderKey 社区帖子按时间或分数排序的zset
+func communityOrderKey(p *models.ParamPostList) (string, error) {
 	orderKey := getRedisKey(KeyPostTimeZSet)
 	if p.Order == models.OrderScore {
 		orderKey = getRedisKey(KeyPostScoreZSet)
@@ -80,9 +148,8 @@ func GetCommunityPostIDsInOrder(p *models.ParamPostList) ([]string, error) {
 		pipeline.Expire(context.Background(), key, 60*time.Second) // 设置超时时间
 		_, err := pipeline.Exec(context.Background())
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 	}
-	// 存在的话就直接根据key查询ids
-	return getIDsFormKey(key, p.Page, p.Size)
+	return key, nil
 }
@@ -0,0 +1,203 @@
+package redis
+
+import (
+	"bluebell/models"
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 帖子排序数据的读取和恢复
+// Redis数据丢失后，根据MySQL中的帖子、投票记录和锁定记录重建 post:time、post:score、community:<id>、post:voted:<id> 和 post:locked
+
+// PostRankState 帖子在Redis中的排序数据
+type PostRankState struct {
+	PostID      int64
+	CommunityID int64
+	Time        float64            // post:time中的分数（发帖时间），0表示不存在
+	Score       float64            // post:score中的分数，0表示不存在
+	InCommunity bool               // 是否在所属社区的集合中
+	Locked      bool               // 是否在post:locked中，即被版主锁定
+	Voted       map[string]float64 // post:voted:<id>中的用户投票记录，nil表示不关心投票记录
+}
+
+// GetPostRankStates 批量查询帖子当前在Redis中的排序数据
+// 参数 posts: 需要查询的帖子，只使用PostID和CommunityID字段
+// 参数 withVoted: 是否同时查询用户投票记录
+func GetPostRankStates(posts []*PostRankState, withVoted bool) (states []*PostRankState, err error) {
+	ctx := context.Background()
+	timeKey := getRedisKey(KeyPostTimeZSet)
+	scoreKey := getRedisKey(KeyPostScoreZSet)
+
+	pipeline := client.Pipeline()
+	timeCmds := make([]*redis.FloatCmd, 0, len(posts))
+	scoreCmds := make([]*redis.FloatCmd, 0, len(posts))
+	lockedKey := getRedisKey(KeyPostLockedSet)
+	memberCmds := make([]*redis.BoolCmd, 0, len(posts))
+	lockedCmds := make([]*redis.BoolCmd, 0, len(posts))
+	votedCmds := make([]*redis.ZSliceCmd, 0, len(posts))
+	for _, p := range posts {
+		pid := strconv.FormatInt(p.PostID, 10)
+		timeCmds = append(timeCmds, pipeline.ZScore(ctx, timeKey, pid))
+		scoreCmds = append(scoreCmds, pipeline.ZScore(ctx, scoreKey, pid))
+		cKey := getRedisKey(KeyCommunitySetPF + strconv.FormatInt(p.CommunityID, 10))
+		memberCmds = append(memberCmds, pipeline.SIsMember(ctx, cKey, pid))
+		lockedCmds = append(lockedCmds, pipeline.SIsMember(ctx, lockedKey, pid))
+		if withVoted {
+			votedCmds = append(votedCmds, pipeline.ZRangeWithScores(ctx, getRedisKey(KeyPostVotedZSetPF+pid), 0, -1))
+		}
+	}
+	// ZScore查不到成员时返回redis.Nil，属于正常情况
+	if _, err = pipeline.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	states = make([]*PostRankState, 0, len(posts))
+	for i, p := range posts {
+		state := &PostRankState{
+			PostID:      p.PostID,
+			CommunityID: p.CommunityID,
+			Time:        timeCmds[i].Val(),
+			Score:       scoreCmds[i].Val(),
+			InCommunity: memberCmds[i].Val(),
+			Locked:      lockedCmds[i].Val(),
+		}
+		if withVoted {
+			state.Voted = make(map[string]float64)
+			for _, z := range votedCmds[i].Val() {
+				state.Voted[z.Member.(string)] = z.Score
+			}
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// SetPostRankStates 把帖子的排序数据写入Redis
+// Voted为nil的帖子不修改用户投票记录，否则用Voted覆盖原有的投票记录
+func SetPostRankStates(states []*PostRankState) error {
+	ctx := context.Background()
+	timeKey := getRedisKey(KeyPostTimeZSet)
+	scoreKey := getRedisKey(KeyPostScoreZSet)
+	lockedKey := getRedisKey(KeyPostLockedSet)
+
+	pipeline := client.TxPipeline()
+	for _, s := range states {
+		pid := strconv.FormatInt(s.PostID, 10)
+		pipeline.ZAdd(ctx, timeKey, &redis.Z{Score: s.Time, Member: pid})
+		pipeline.ZAdd(ctx, scoreKey, &redis.Z{Score: s.Score, Member: pid})
+		pipeline.SAdd(ctx, getRedisKey(KeyCommunitySetPF+strconv.FormatInt(s.CommunityID, 10)), pid)
+		if s.Locked {
+			pipeline.SAdd(ctx, lockedKey, pid)
+		} else {
+			pipeline.SRem(ctx, lockedKey, pid)
+		}
+		if s.Voted == nil {
+			continue
+		}
+		votedKey := getRedisKey(KeyPostVotedZSetPF + pid)
+		pipeline.Del(ctx, votedKey)
+		for uid, v := range s.Voted {
+			pipeline.ZAdd(ctx, votedKey, &redis.Z{Score: v, Member: uid})
+		}
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// AddPostRankNX 补充帖子缺失的排序数据
+// post:time和post:score只在成员不存在时写入，不覆盖已有的分数，同时保证帖子在所属社区的集合中
+func AddPostRankNX(states []*PostRankState) error {
+	ctx := context.Background()
+	timeKey := getRedisKey(KeyPostTimeZSet)
+	scoreKey := getRedisKey(KeyPostScoreZSet)
+
+	pipeline := client.TxPipeline()
+	for _, s := range states {
+		pid := strconv.FormatInt(s.PostID, 10)
+		pipeline.ZAddNX(ctx, timeKey, &redis.Z{Score: s.Time, Member: pid})
+		pipeline.ZAddNX(ctx, scoreKey, &redis.Z{Score: s.Score, Member: pid})
+		pipeline.SAdd(ctx, getRedisKey(KeyCommunitySetPF+strconv.FormatInt(s.CommunityID, 10)), pid)
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// restoreVotedScript 投票记录不存在时按给定的数据恢复
+// KEYS[1]: 用户投票记录zset  KEYS[2]: 帖子分数zset  KEYS[3]: 投票被全部取消的标记
+// ARGV[1]: 帖子id  ARGV[2]: 帖子分数  ARGV[3...]: 用户id和投票值交替排列
+// 投票记录已经存在时什么都不做，说明恢复之前有用户投了票，Redis中的数据已经比读取时新
+// 存在取消标记时同样什么都不做，投票记录是被取消投票删除的，vote表中的投票还没有被队列改为取消
+var restoreVotedScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+for i = 3, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i+1], ARGV[i])
+end
+redis.call('ZADD', KEYS[2], 'XX', ARGV[2], ARGV[1])
+return 1
+`)
+
+// RestorePostVotedNX 恢复Redis中丢失的用户投票记录
+// 只处理post:voted:<id>和post:cleared:<id>都不存在的帖子，写入Voted中的投票记录，并把post:score中已有的分数改为Score，使分数与投票记录一致
+// 返回值 restored: 与states顺序一致，表示每个帖子是否实际恢复
+func RestorePostVotedNX(states []*PostRankState) (restored []bool, err error) {
+	ctx := context.Background()
+	scoreKey := getRedisKey(KeyPostScoreZSet)
+
+	restored = make([]bool, 0, len(states))
+	for _, s := range states {
+		pid := strconv.FormatInt(s.PostID, 10)
+		args := make([]interface{}, 0, 2+2*len(s.Voted))
+		args = append(args, pid, s.Score)
+		for uid, v := range s.Voted {
+			args = append(args, uid, v)
+		}
+		ret, err := restoreVotedScript.Run(ctx, client,
+			[]string{getRedisKey(KeyPostVotedZSetPF + pid), scoreKey, getRedisKey(KeyPostClearedPF + pid)}, args...).Int64()
+		if err != nil {
+			return nil, err
+		}
+		restored = append(restored, ret == 1)
+	}
+	return restored, nil
+}
+
+// ScanPostIDs 使用ZSCAN分批遍历post:time或post:score中的帖子id
+// 参数 order: models.OrderTime 或 models.OrderScore
+// 参数 cursor: 游标，第一次传0，返回的next为0时表示遍历结束
+func ScanPostIDs(order string, cursor uint64, count int64) (ids []string, next uint64, err error) {
+	key := getRedisKey(KeyPostTimeZSet)
+	if order == models.OrderScore {
+		key = getRedisKey(KeyPostScoreZSet)
+	}
+	// ZSCAN返回的是成员和分数交替排列的列表
+	items, next, err := client.ZScan(context.Background(), key, cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids = make([]string, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		ids = append(ids, items[i])
+	}
+	return ids, next, nil
+}
+
+// RemovePostRank 将帖子从post:time和post:score中移除
+// 用于清理MySQL中已经不存在的帖子，这类帖子不知道所属社区，社区集合中的残留不影响列表查询
+func RemovePostRank(postIDs ...string) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(postIDs))
+	for _, id := range postIDs {
+		members = append(members, id)
+	}
+	pipeline := client.TxPipeline()
+	pipeline.ZRem(context.Background(), getRedisKey(KeyPostTimeZSet), members...)
+	pipeline.ZRem(context.Background(), getRedisKey(KeyPostScoreZSet), members...)
+	_, err := pipeline.Exec(context.Background())
+	return err
+}
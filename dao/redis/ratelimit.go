@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 限流
+// 路由组限流使用令牌桶，见TakeToken。
+// 按操作限流：每个限流对象（如某个用户的发帖、某个IP的登录）一个计数器，固定窗口计数：
+// 窗口内第一次请求时创建计数器并设置过期时间为窗口长度，计数器过期后进入下一个窗口。
+// 同一请求的多个限流对象（用户和IP）在一个脚本中检查，任意一个超限时都不计数，被拒绝的请求不占用次数。
+
+// RateLimitRule 一个限流对象
+type RateLimitRule struct {
+	Key   string // 计数器key（不含前缀），如 post:user:123
+	Limit int64  // 窗口内最多请求的次数
+}
+
+// rateLimitScript 检查所有计数器都未超限时全部加1
+// KEYS: 计数器的key  ARGV[1]: 窗口长度（毫秒）  ARGV[2..]: 与KEYS一一对应的次数上限
+// 返回值: 0 允许；大于0 被拒绝，值为超限的计数器剩余的毫秒数
+var rateLimitScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local n = tonumber(redis.call('GET', key) or '0')
+	if n >= tonumber(ARGV[i + 1]) then
+		local ttl = redis.call('PTTL', key)
+		if ttl < 0 then
+			redis.call('PEXPIRE', key, window)
+			ttl = window
+		end
+		return ttl
+	end
+end
+for _, key in ipairs(KEYS) do
+	if redis.call('INCR', key) == 1 then
+		redis.call('PEXPIRE', key, window)
+	end
+end
+return 0
+`)
+
+// AllowRequest 检查请求是否超过限流对象的次数上限，未超限时计数
+// 返回值 retryAfter: 被拒绝时距离窗口结束的时间，为0表示允许
+func AllowRequest(rules []RateLimitRule, window time.Duration) (retryAfter time.Duration, err error) {
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, 0, len(rules))
+	args := make([]interface{}, 0, len(rules)+1)
+	args = append(args, window.Milliseconds())
+	for _, r := range rules {
+		keys = append(keys, getRedisKey(KeyRateLimitPF+r.Key))
+		args = append(args, r.Limit)
+	}
+	ttl, err := rateLimitScript.Run(context.Background(), client, keys, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+// tokenBucketScript 从令牌桶中取一个令牌
+// 令牌按上次更新到现在经过的时间补充，时间取Redis服务器的时间，避免各实例的时钟不一致
+// KEYS[1]: 令牌桶的key  ARGV[1]: 每秒生成的令牌数  ARGV[2]: 令牌桶容量
+// 返回值: 0 取到令牌；大于0 令牌不足，值为生成一个令牌还需要的毫秒数
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local v = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(v[1]) or burst
+local ts = tonumber(v[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
+// TakeToken 从路由组的令牌桶中取一个令牌，令牌桶保存在Redis中，所有实例共享
+// 桶满之后的一段时间内没有请求时key自动过期，下次请求时按满桶重新开始
+// 参数 rate: 每秒生成的令牌数
+// 参数 burst: 令牌桶容量
+// 返回值 retryAfter: 令牌不足时需要等待的时间，为0表示取到令牌
+func TakeToken(group string, rate float64, burst int64) (retryAfter time.Duration, err error) {
+	wait, err := tokenBucketScript.Run(context.Background(), client,
+		[]string{getRedisKey(KeyRateLimitBucketPF + group)}, rate, burst,
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,16 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// setupRedis 启动一个内存中的Redis，并把包内的客户端指向它，测试结束后自动关闭
+func setupRedis(t *testing.T) *miniredis.Miniredis {
+	m := miniredis.RunT(t)
+	client = redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return m
+}
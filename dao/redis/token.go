@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 登录凭证
+// access token是有效期很短的JWT，refresh token是随机字符串，只在Redis中保存它的sha256。
+// 每次登录产生一个会话（family），会话中同一时间只有一个有效的refresh token：
+//   刷新时旧的refresh token标记为已使用，同时签发新的refresh token，成为会话当前的token
+//   已使用的refresh token再次出现说明它可能被盗用，整个会话立即失效，合法用户和攻击者都需要重新登录
+// 退出登录时吊销当前的access token（jti加入黑名单直到过期）并删除会话
+// access token只在所属的会话存在时有效，会话被删除后，会话中尚未过期的access token也立即失效
+// 每个用户的所有会话id记录在一个set中，重置密码时据此让用户在所有设备上下线
+// 开启单会话模式时，用户每次登录都会记录最新的会话id并删除之前的会话，只有最新会话的token可以使用
+// 开启两步验证的用户校验密码成功后先保存一个challenge，提交正确的验证码之后才创建会话
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token无效或已过期")
+	ErrRefreshTokenReused  = errors.New("refresh token重复使用")
+
+	ErrTwoFactorChallengeInvalid = errors.New("两步验证的challenge无效或已过期")
+)
+
+// rotateRefreshTokenScript 轮换refresh token
+// KEYS[1]: 旧token的key  KEYS[2]: 新token的key  KEYS[3]: 会话的key
+// ARGV[1]: 会话id  ARGV[2]: 旧token的sha256  ARGV[3]: 新token的sha256  ARGV[4]: 有效期（秒）
+// 返回值: {0, 用户id, 用户名, 会话id} 成功；{-1} 无效或过期；{-2} 重复使用
+// 会话id由调用方先从旧token中读出，脚本访问的key都通过KEYS传入，脚本中再确认旧token仍然属于这个会话
+var rotateRefreshTokenScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'user_id', 'username', 'family', 'used')
+if not v[1] or v[3] ~= ARGV[1] then
+	return {-1}
+end
+if v[4] == '1' then
+	redis.call('DEL', KEYS[3])
+	return {-2}
+end
+if redis.call('GET', KEYS[3]) ~= ARGV[2] then
+	return {-1}
+end
+redis.call('HSET', KEYS[1], 'used', '1')
+redis.call('HSET', KEYS[2], 'user_id', v[1], 'username', v[2], 'family', v[3], 'used', '0')
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+redis.call('SET', KEYS[3], ARGV[3], 'EX', ARGV[4])
+return {0, v[1], v[2], v[3]}
+`)
+
+// CreateRefreshToken 登录时创建会话和会话的第一个refresh token
+// 参数 tokenHash: refresh token的sha256
+// 参数 family: 会话id
+func CreateRefreshToken(tokenHash, family string, userID int64, username string, ttl time.Duration) error {
+	ctx := context.Background()
+	key := getRedisKey(KeyRefreshTokenPF + tokenHash)
+	pipeline := client.TxPipeline()
+	pipeline.HSet(ctx, key, "user_id", userID, "username", username, "family", family, "used", 0)
+	pipeline.Expire(ctx, key, ttl)
+	pipeline.Set(ctx, getRedisKey(KeyTokenFamilyPF+family), tokenHash, ttl)
+	// 记录用户的会话，set的过期时间跟随最近一次登录，已经过期的会话id留在set中不影响使用
+	familiesKey := getRedisKey(KeyUserFamiliesPF + strconv.FormatInt(userID, 10))
+	pipeline.SAdd(ctx, familiesKey, family)
+	pipeline.Expire(ctx, familiesKey, ttl)
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// RotateRefreshToken 使用旧的refresh token换取新的refresh token
+// 返回值: refresh token所属的用户和会话
+func RotateRefreshToken(oldHash, newHash string, ttl time.Duration) (userID int64, username, family string, err error) {
+	ctx := context.Background()
+	oldKey := getRedisKey(KeyRefreshTokenPF + oldHash)
+	family, err = client.HGet(ctx, oldKey, "family").Result()
+	if err == redis.Nil {
+		return 0, "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+	ret, err := rotateRefreshTokenScript.Run(ctx, client,
+		[]string{oldKey, getRedisKey(KeyRefreshTokenPF + newHash), getRedisKey(KeyTokenFamilyPF + family)},
+		family, oldHash, newHash, int64(ttl.Seconds()),
+	).Slice()
+	if err != nil {
+		return 0, "", "", err
+	}
+	switch ret[0].(int64) {
+	case -1:
+		return 0, "", "", ErrRefreshTokenInvalid
+	case -2:
+		return 0, "", "", ErrRefreshTokenReused
+	}
+	userID, err = strconv.ParseInt(ret[1].(string), 10, 64)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return userID, ret[2].(string), ret[3].(string), nil
+}
+
+// RevokeRefreshToken 删除refresh token所属的会话，会话中所有的refresh token随之失效
+// 只删除属于userID的会话，token不存在或不属于该用户时直接返回
+func RevokeRefreshToken(tokenHash string, userID int64) error {
+	ctx := context.Background()
+	v, err := client.HMGet(ctx, getRedisKey(KeyRefreshTokenPF+tokenHash), "user_id", "family").Result()
+	if err != nil {
+		return err
+	}
+	uid, _ := v[0].(string)
+	family, _ := v[1].(string)
+	if uid != strconv.FormatInt(userID, 10) || family == "" {
+		return nil
+	}
+	return RevokeTokenFamily(family)
+}
+
+// RevokeTokenFamily 删除会话，会话中所有的refresh token随之失效
+func RevokeTokenFamily(family string) error {
+	return client.Del(context.Background(), getRedisKey(KeyTokenFamilyPF+family)).Err()
+}
+
+// revokeUserSessionsScript 删除用户的所有会话
+// KEYS[1]: 用户的会话id集合  KEYS[2]: 用户最近一次登录的会话id  KEYS[3...]: 集合中每个会话的key
+// 返回值: 删除的会话数量
+// 会话id由调用方先从集合中读出，脚本访问的key都通过KEYS传入；读取之后新登录的会话不在其中，会保留下来
+var revokeUserSessionsScript = redis.NewScript(`
+local n = 0
+for i = 3, #KEYS do
+	n = n + redis.call('DEL', KEYS[i])
+end
+for i = 3, #KEYS do
+	redis.call('SREM', KEYS[1], ARGV[i - 2])
+end
+if redis.call('SCARD', KEYS[1]) == 0 then
+	redis.call('DEL', KEYS[1])
+end
+redis.call('DEL', KEYS[2])
+return n
+`)
+
+// RevokeUserSessions 删除用户的所有会话，用户在所有设备上的refresh token和access token随之失效
+// 返回值 n: 删除的会话数量
+func RevokeUserSessions(userID int64) (n int64, err error) {
+	ctx := context.Background()
+	uid := strconv.FormatInt(userID, 10)
+	familiesKey := getRedisKey(KeyUserFamiliesPF + uid)
+	families, err := client.SMembers(ctx, familiesKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0, len(families)+2)
+	keys = append(keys, familiesKey, getRedisKey(KeyUserSessionPF+uid))
+	args := make([]interface{}, 0, len(families))
+	for _, family := range families {
+		keys = append(keys, getRedisKey(KeyTokenFamilyPF+family))
+		args = append(args, family)
+	}
+	return revokeUserSessionsScript.Run(ctx, client, keys, args...).Int64()
+}
+
+// SetUserSession 记录用户最近一次登录的会话id
+// 返回值 old: 之前记录的会话id，没有时为空
+func SetUserSession(userID int64, family string, ttl time.Duration) (old string, err error) {
+	ctx := context.Background()
+	key := getRedisKey(KeyUserSessionPF + strconv.FormatInt(userID, 10))
+	pipeline := client.TxPipeline()
+	getSet := pipeline.GetSet(ctx, key, family)
+	pipeline.Expire(ctx, key, ttl)
+	if _, err = pipeline.Exec(ctx); err != nil && err != redis.Nil {
+		return "", err
+	}
+	return getSet.Val(), nil
+}
+
+// GetUserSession 查询用户最近一次登录的会话id，没有记录时返回空字符串
+func GetUserSession(userID int64) (string, error) {
+	family, err := client.Get(context.Background(), getRedisKey(KeyUserSessionPF+strconv.FormatInt(userID, 10))).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return family, err
+}
+
+// RevokeAccessToken 吊销access token，jti在黑名单中保留到token过期
+func RevokeAccessToken(jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		// token已经过期，不需要吊销
+		return nil
+	}
+	return client.Set(context.Background(), getRedisKey(KeyTokenDenylistPF+jti), 1, ttl).Err()
+}
+
+// IsAccessTokenRevoked 查询access token是否已被吊销
+// jti在黑名单中，或者token所属的会话已被删除时返回true
+// 参数 family: token所属的会话id，为空时只检查黑名单
+func IsAccessTokenRevoked(jti, family string) (bool, error) {
+	ctx := context.Background()
+	pipeline := client.Pipeline()
+	denied := pipeline.Exists(ctx, getRedisKey(KeyTokenDenylistPF+jti))
+	var session *redis.IntCmd
+	if family != "" {
+		session = pipeline.Exists(ctx, getRedisKey(KeyTokenFamilyPF+family))
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return false, err
+	}
+	if denied.Val() > 0 {
+		return true, nil
+	}
+	return session != nil && session.Val() == 0, nil
+}
+
+// verifyTwoFactorChallengeScript 取出两步验证登录的challenge，每次取出尝试次数加1
+// KEYS[1]: challenge的key  ARGV[1]: 最多尝试次数
+// 返回值: {用户id, 用户名} 成功；{} 不存在、已过期或尝试次数用尽（同时删除）
+var verifyTwoFactorChallengeScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'user_id', 'username')
+if not v[1] then
+	return {}
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) > tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+	return {}
+end
+return {v[1], v[2]}
+`)
+
+// CreateTwoFactorChallenge 校验密码成功后保存两步验证登录的challenge
+// 参数 tokenHash: challenge token的sha256
+func CreateTwoFactorChallenge(tokenHash string, userID int64, username string, ttl time.Duration) error {
+	ctx := context.Background()
+	key := getRedisKey(KeyTwoFactorChallengePF + tokenHash)
+	pipeline := client.TxPipeline()
+	pipeline.HSet(ctx, key, "user_id", userID, "username", username, "attempts", 0)
+	pipeline.Expire(ctx, key, ttl)
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// VerifyTwoFactorChallenge 取出challenge所属的用户，超过最多尝试次数后challenge失效
+func VerifyTwoFactorChallenge(tokenHash string, maxAttempts int) (userID int64, username string, err error) {
+	ret, err := verifyTwoFactorChallengeScript.Run(context.Background(), client,
+		[]string{getRedisKey(KeyTwoFactorChallengePF + tokenHash)}, maxAttempts,
+	).Slice()
+	if err != nil {
+		return 0, "", err
+	}
+	if len(ret) == 0 {
+		return 0, "", ErrTwoFactorChallengeInvalid
+	}
+	userID, err = strconv.ParseInt(ret[0].(string), 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, ret[1].(string), nil
+}
+
+// DeleteTwoFactorChallenge 两步验证登录成功后删除challenge，避免重复使用
+// 返回值 ok: challenge是否还存在，并发提交时只有一个请求返回true
+func DeleteTwoFactorChallenge(tokenHash string) (ok bool, err error) {
+	n, err := client.Del(context.Background(), getRedisKey(KeyTwoFactorChallengePF+tokenHash)).Result()
+	return n > 0, err
+}
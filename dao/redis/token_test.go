@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	m := setupRedis(t)
+	if err := CreateRefreshToken("h1", "f1", 1, "alice", time.Hour); err != nil {
+		t.Fatalf("CreateRefreshToken failed, err:%v", err)
+	}
+
+	if _, _, _, err := RotateRefreshToken("unknown", "h2", time.Hour); err != ErrRefreshTokenInvalid {
+		t.Fatalf("rotate unknown token got %v", err)
+	}
+
+	userID, username, family, err := RotateRefreshToken("h1", "h2", time.Hour)
+	if err != nil || userID != 1 || username != "alice" || family != "f1" {
+		t.Fatalf("RotateRefreshToken got %d %q %q, err:%v", userID, username, family, err)
+	}
+	if got, _ := m.Get(Prefix + KeyTokenFamilyPF + "f1"); got != "h2" {
+		t.Fatalf("family token got %q, want h2", got)
+	}
+
+	// 已使用的token再次出现，整个会话失效，新token也不能再使用
+	if _, _, _, err = RotateRefreshToken("h1", "h3", time.Hour); err != ErrRefreshTokenReused {
+		t.Fatalf("rotate used token got %v", err)
+	}
+	if m.Exists(Prefix + KeyTokenFamilyPF + "f1") {
+		t.Fatal("family not revoked after reuse")
+	}
+	if _, _, _, err = RotateRefreshToken("h2", "h4", time.Hour); err != ErrRefreshTokenInvalid {
+		t.Fatalf("rotate token of revoked family got %v", err)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	m := setupRedis(t)
+	for _, f := range []string{"f1", "f2"} {
+		if err := CreateRefreshToken("h"+f, f, 1, "alice", time.Hour); err != nil {
+			t.Fatalf("CreateRefreshToken failed, err:%v", err)
+		}
+	}
+	if _, err := SetUserSession(1, "f2", time.Hour); err != nil {
+		t.Fatalf("SetUserSession failed, err:%v", err)
+	}
+
+	n, err := RevokeUserSessions(1)
+	if err != nil || n != 2 {
+		t.Fatalf("RevokeUserSessions got %d, err:%v", n, err)
+	}
+	for _, key := range []string{KeyTokenFamilyPF + "f1", KeyTokenFamilyPF + "f2", KeyUserFamiliesPF + "1", KeyUserSessionPF + "1"} {
+		if m.Exists(Prefix + key) {
+			t.Fatalf("%s not deleted", key)
+		}
+	}
+	if n, err = RevokeUserSessions(1); err != nil || n != 0 {
+		t.Fatalf("RevokeUserSessions without sessions got %d, err:%v", n, err)
+	}
+}
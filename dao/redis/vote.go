@@ -1,10 +1,9 @@
 package redis
 
 import (
-	"bluebell/dao/mysql"
+	"bluebell/models"
 	"context"
 	"errors"
-	"math"
 	"strconv"
 	"time"
 
@@ -30,54 +29,51 @@ import (
 
    投票的限制：
    每个贴子自发表之日起一个星期之内允许用户投票，超过一个星期就不允许再投票了。
+   投票时间窗口和每票分数由VoteTarget注册，帖子的注册信息见vote_target.go。
    	1. 到期之后将redis中保存的赞成票数及反对票数存储到mysql表中
    	2. 到期之后删除那个 KeyPostVotedZSetPF
+   以上两步由投票归档任务完成，见logic.StartVoteArchiver
 */
 
 // 实际生产环境下 context.Background() 按需替换
 
-const (
-	// oneWeekInSeconds: 一周的秒数
-	// 命名逻辑：one + Week + In + Seconds（一周的秒数）
-	// 7天 * 24小时 * 3600秒 = 604800秒
-	oneWeekInSeconds = 7 * 24 * 3600
-
-	// scorePerVote: 每票的分数值
-	// 命名逻辑：score + Per + Vote（每次投票的分数）
-	// 432分 = 86400秒/200票，即200张赞成票可以让帖子在热门榜上多待一天
-	scorePerVote = 432 // 每一票值多少分
-)
-
 var (
 	// ErrVoteTimeExpire: 投票时间过期错误
 	// 命名逻辑：Err + Vote + Time + Expire（投票时间过期错误）
-	// 用于表示帖子发布超过一周，不允许再投票
+	// 用于表示对象创建超过投票时间窗口，不允许再投票
 	ErrVoteTimeExpire = errors.New("投票时间已过")
 
 	// ErrVoteRepeated: 重复投票错误
 	// 命名逻辑：Err + Vote + Repeated（重复投票错误）
-	// 用于表示用户对同一帖子重复投相同的票
+	// 用于表示用户对同一对象重复投相同的票
 	ErrVoteRepeated = errors.New("不允许重复投票")
+
+	// ErrVoteLocked: 对象已被锁定错误
+	// 命名逻辑：Err + Vote + Locked（投票对象已锁定错误）
+	// 用于表示对象已被版主锁定，不允许再投票（包括取消投票）
+	ErrVoteLocked = errors.New("已被锁定，不允许投票")
 )
 
 // CreatePost 创建帖子时初始化Redis数据结构
 // 参数 postID: 帖子ID（int64类型）
 // 参数 communityID: 社区ID（int64类型）
+// 参数 createTime: 发帖时间，与post表的create_time一致
 // 返回值: 错误信息，成功时返回nil
-func CreatePost(postID, communityID int64) error {
+// 由outbox转发任务调用，同一事件可能被重复处理，这里只在帖子不存在时写入，不会覆盖投票后的分数
+func CreatePost(postID, communityID int64, createTime time.Time) error {
 	// pipeline: Redis事务流水线对象
 	// 命名逻辑：pipeline（管道），表示批量执行Redis命令的管道
 	pipeline := client.TxPipeline()
 
 	// 帖子时间：将帖子ID和发布时间添加到时间排序集合
-	pipeline.ZAdd(context.Background(), getRedisKey(KeyPostTimeZSet), &redis.Z{
-		Score:  float64(time.Now().Unix()), // 发布时间戳作为分数
+	pipeline.ZAddNX(context.Background(), getRedisKey(KeyPostTimeZSet), &redis.Z{
+		Score:  float64(createTime.Unix()), // 发布时间戳作为分数
 		Member: postID,                     // 帖子ID作为成员
 	})
 
 	// 帖子分数：将帖子ID和初始分数添加到分数排序集合
-	pipeline.ZAdd(context.Background(), getRedisKey(KeyPostScoreZSet), &redis.Z{
-		Score:  float64(time.Now().Unix()), // 初始分数等于发布时间戳
+	pipeline.ZAddNX(context.Background(), getRedisKey(KeyPostScoreZSet), &redis.Z{
+		Score:  float64(createTime.Unix()), // 初始分数等于发布时间戳
 		Member: postID,                     // 帖子ID作为成员
 	})
 
@@ -95,95 +91,146 @@ func CreatePost(postID, communityID int64) error {
 	return err
 }
 
+// DeletePost 删除帖子时清理Redis中的排序数据
+// 将帖子从时间排序集合、分数排序集合以及所属社区的集合中移除，使其不再出现在帖子列表中
+// 参数 postID: 帖子ID（int64类型）
+// 参数 communityID: 社区ID（int64类型）
+// 返回值: 错误信息，成功时返回nil
+func DeletePost(postID, communityID int64) error {
+	pipeline := client.TxPipeline()
+
+	timeKey := getRedisKey(KeyPostTimeZSet)
+	scoreKey := getRedisKey(KeyPostScoreZSet)
+	pipeline.ZRem(context.Background(), timeKey, postID)
+	pipeline.ZRem(context.Background(), scoreKey, postID)
+
+	cid := strconv.Itoa(int(communityID))
+	pipeline.SRem(context.Background(), getRedisKey(KeyCommunitySetPF+cid), postID)
+
+	// 社区帖子列表使用了zinterstore生成的缓存key（见GetCommunityPostIDsInOrder）
+	// 这里同步移除，避免在缓存过期前删除的帖子仍然出现在社区列表中
+	pipeline.ZRem(context.Background(), timeKey+cid, postID)
+	pipeline.ZRem(context.Background(), scoreKey+cid, postID)
+
+	_, err := pipeline.Exec(context.Background())
+	return err
+}
+
+// 投票脚本的返回值
+const (
+	voteResultOK       = 0  // 投票成功
+	voteResultExpired  = -1 // 超过投票时间窗口
+	voteResultRepeated = -2 // 重复投票
+	voteResultLocked   = -3 // 对象已被锁定
+)
+
+// voteScript 投票脚本
+// KEYS[1]: 对象创建时间zset  KEYS[2]: 对象分数zset  KEYS[3]: 用户投票记录zset  KEYS[4]: 已锁定对象set
+// KEYS[5]: 投票被全部取消的标记
+// ARGV[1]: 对象id  ARGV[2]: 用户id  ARGV[3]: 投票值  ARGV[4]: 当前时间戳
+// ARGV[5]: 投票时间窗口（秒）  ARGV[6]: 每票分数
+//
+// 分数变化量 = (value - ov) * 每票分数，与文件开头列出的几种情况一一对应：
+// 如之前投反对票(ov=-1)现在改投赞成票(value=1)，分数变化为 +2*432
+//
+// 取消最后一票时zset被删除，同时写入KEYS[5]标记，保留到投票时间窗口结束，再次有人投票时删除：
+// 取消投票在队列中等待写入MySQL时，对账看到zset不存在而vote表中还有投票，靠这个标记判断不是Redis数据丢失
+var voteScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[4], ARGV[1]) == 1 then
+	return -3
+end
+
+local createTime = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1]) or 0)
+if tonumber(ARGV[4]) - createTime > tonumber(ARGV[5]) then
+	return -1
+end
+
+local value = tonumber(ARGV[3])
+local ov = tonumber(redis.call('ZSCORE', KEYS[3], ARGV[2]) or 0)
+if value == ov then
+	return -2
+end
+
+redis.call('ZINCRBY', KEYS[2], (value - ov) * tonumber(ARGV[6]), ARGV[1])
+if value == 0 then
+	redis.call('ZREM', KEYS[3], ARGV[2])
+	if redis.call('EXISTS', KEYS[3]) == 0 then
+		local ttl = math.floor(createTime + tonumber(ARGV[5]) - tonumber(ARGV[4]))
+		redis.call('SET', KEYS[5], 1, 'EX', math.max(ttl, 1))
+	end
+else
+	redis.call('ZADD', KEYS[3], value, ARGV[2])
+	redis.call('DEL', KEYS[5])
+end
+return 0
+`)
+
 // VoteForPost 处理用户对帖子的投票操作
 // 参数 userID: 用户ID（字符串类型）
 // 参数 postID: 帖子ID（字符串类型）
 // 参数 value: 投票值（1=赞成，-1=反对，0=取消投票）
 // 返回值: 错误信息，成功时返回nil
 func VoteForPost(userID, postID string, value float64) error {
-	// ==================== 第一步：判断投票时间限制 ====================
-	// postTime: 帖子发布时间
-	// 命名逻辑：post + Time（帖子时间）
-	// 从Redis有序集合中获取帖子的发布时间戳
-	postTime := client.ZScore(context.Background(), getRedisKey(KeyPostTimeZSet), postID).Val()
-
-	// 检查帖子是否超过一周，超过则不允许投票
-	if float64(time.Now().Unix())-postTime > oneWeekInSeconds {
-		return ErrVoteTimeExpire
-	}
-
-	// ==================== 第二步：查询历史投票记录 ====================
-	// ov: 原始投票值（Original Vote）
-	// 命名逻辑：o + v（original vote的缩写）
-	// 获取用户对该帖子的历史投票记录（1、-1、0或不存在）
-	ov := client.ZScore(context.Background(), getRedisKey(KeyPostVotedZSetPF+postID), userID).Val()
+	return VoteForTarget(models.VoteTargetPost, userID, postID, value)
+}
 
-	// 判断本次投票和历史投票是否一致，一致则返回重复投票错误
-	if value == ov {
-		return ErrVoteRepeated
+// VoteForTarget 处理用户对任意已注册对象的投票操作
+// 参数 tt: 投票对象类型，必须已通过RegisterVoteTarget注册
+// 参数 userID: 用户ID（字符串类型）
+// 参数 targetID: 投票对象ID（字符串类型）
+// 参数 value: 投票值（1=赞成，-1=反对，0=取消投票）
+// 返回值: 错误信息，成功时返回nil
+// 这里只更新Redis，投票记录由调用方通过投票队列异步写入MySQL
+func VoteForTarget(tt models.VoteTargetType, userID, targetID string, value float64) error {
+	target, err := GetVoteTarget(tt)
+	if err != nil {
+		return err
 	}
 
-	// ==================== 第三步：计算分数变化 ====================
-	// op: 操作方向（Operation）
-	// 命名逻辑：o + p（operation的缩写）
-	// 1表示分数增加，-1表示分数减少
-	var op float64
-	if value > ov {
-		op = 1 // 分数增加（如：从-1改为1，或从0改为1）
-	} else {
-		op = -1 // 分数减少（如：从1改为-1，或从1改为0）
+	// ==================== 第一步：执行投票脚本 ====================
+	// 锁定校验、投票时间校验、历史投票查询、分数更新和投票记录更新在一个Lua脚本中原子执行，
+	// 避免同一用户的并发请求读到相同的历史投票而重复累加分数
+	ret, err := voteScript.Run(context.Background(), client,
+		[]string{target.TimeKey(), target.ScoreKey(), target.VotedKey(targetID), target.LockedKey(), target.ClearedKey(targetID)},
+		targetID, userID, value, time.Now().Unix(), target.Window.Seconds(), target.ScorePerVote,
+	).Int64()
+	if err != nil {
+		return err
 	}
 
-	// diff: 投票差值（Difference）
-	// 命名逻辑：diff（difference的缩写）
-	// 计算两次投票的差值绝对值，用于计算分数变化量
-	diff := math.Abs(ov - value)
-
-	// ==================== 第四步：执行Redis事务 ====================
-	// pipeline: Redis事务流水线对象
-	// 命名逻辑：pipeline（管道），用于批量执行Redis命令
-	pipeline := client.TxPipeline()
-
-	// 更新帖子分数：根据投票差值计算分数变化
-	// op*diff*scorePerVote: 分数变化量
-	// op: 方向（+1或-1）
-	// diff: 差值（1或2）
-	// scorePerVote: 每票分数（432）
-	pipeline.ZIncrBy(context.Background(), getRedisKey(KeyPostScoreZSet), op*diff*scorePerVote, postID)
-
-	// ==================== 第五步：记录用户投票信息 ====================
-	// 如果本次投票为0，表示取消投票，删除用户的投票记录
-	if value == 0 {
-		pipeline.ZRem(context.Background(), getRedisKey(KeyPostVotedZSetPF+postID), userID)
-	} else {
-		// 否则，添加或更新用户的投票记录
-		// value: 投票值（1=赞成，-1=反对）
-		// userID: 用户ID作为成员
-		pipeline.ZAdd(context.Background(), getRedisKey(KeyPostVotedZSetPF+postID), &redis.Z{
-			Score:  value,  // 投票值作为分数
-			Member: userID, // 用户ID作为成员
-		})
+	// ==================== 第二步：转换脚本返回值 ====================
+	switch ret {
+	case voteResultExpired:
+		return ErrVoteTimeExpire
+	case voteResultRepeated:
+		return ErrVoteRepeated
+	case voteResultLocked:
+		return ErrVoteLocked
 	}
 
-	// ==================== 第六步：执行事务 ====================
-	// err: 错误变量
-	// 命名逻辑：err（error的缩写）
-	_, err := pipeline.Exec(context.Background())
+	return nil
+}
+
+// SetTargetLocked 锁定或解锁对象，锁定后投票脚本拒绝对该对象的所有投票
+// 参数 tt: 投票对象类型
+// 参数 targetID: 对象ID
+// 参数 locked: true为锁定，false为解锁
+func SetTargetLocked(tt models.VoteTargetType, targetID int64, locked bool) error {
+	target, err := GetVoteTarget(tt)
 	if err != nil {
 		return err
 	}
+	if locked {
+		return client.SAdd(context.Background(), target.LockedKey(), targetID).Err()
+	}
+	return client.SRem(context.Background(), target.LockedKey(), targetID).Err()
+}
 
-	// ==================== 第七步：异步更新MySQL ====================
-	// 异步保存投票数据到MySQL，避免影响Redis性能
-	go func() {
-		// 转换参数类型
-		postIDInt, _ := strconv.ParseInt(postID, 10, 64)
-		userIDInt, _ := strconv.ParseInt(userID, 10, 64)
-		voteValueInt := int8(value)
-
-		// 保存到MySQL
-		_ = mysql.SaveVoteData(postIDInt, userIDInt, voteValueInt)
-	}()
-
-	return nil
+// IsTargetLocked 查询对象是否已被锁定
+func IsTargetLocked(tt models.VoteTargetType, targetID int64) (bool, error) {
+	target, err := GetVoteTarget(tt)
+	if err != nil {
+		return false, err
+	}
+	return client.SIsMember(context.Background(), target.LockedKey(), targetID).Result()
 }
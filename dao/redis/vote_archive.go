@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 投票归档相关的Redis操作
+// 对象的投票时间窗口结束后，赞成票数和反对票数归档到MySQL，然后删除记录用户投票情况的zset
+
+// GetArchiveCursor 获取投票归档任务已处理到的对象创建时间，没有记录时返回0
+func GetArchiveCursor(t *VoteTarget) (float64, error) {
+	v, err := client.Get(context.Background(), t.ArchiveCursorKey()).Float64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// SetArchiveCursor 记录投票归档任务已处理到的对象创建时间
+func SetArchiveCursor(t *VoteTarget, cursor float64) error {
+	return client.Set(context.Background(), t.ArchiveCursorKey(),
+		strconv.FormatFloat(cursor, 'f', -1, 64), 0).Err()
+}
+
+// GetVoteExpiredTargets 按创建时间顺序查询投票时间窗口已结束的对象
+// 参数 cursor: 起始创建时间（包含），通常为上次归档的进度
+// 参数 offset, count: 分页参数
+// 返回值: 对象id及其创建时间
+func GetVoteExpiredTargets(t *VoteTarget, cursor float64, offset, count int64) ([]redis.Z, error) {
+	// 投票校验的条件是 now-createTime > Window 时拒绝投票
+	// 这里只取严格早于截止时间的对象，保证归档之后不会再有新的投票写入
+	deadline := float64(time.Now().Unix()) - t.Window.Seconds()
+	return client.ZRangeByScoreWithScores(context.Background(), t.TimeKey(), &redis.ZRangeBy{
+		Min:    strconv.FormatFloat(cursor, 'f', -1, 64),
+		Max:    "(" + strconv.FormatFloat(deadline, 'f', -1, 64),
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
+
+// GetTargetVoteCount 查询对象当前的赞成票数和反对票数
+// 返回值 exists: 记录用户投票情况的zset是否存在，不存在说明没有人投过票或者已经归档
+func GetTargetVoteCount(t *VoteTarget, targetID string) (up, down int64, exists bool, err error) {
+	key := t.VotedKey(targetID)
+	pipeline := client.Pipeline()
+	existsCmd := pipeline.Exists(context.Background(), key)
+	upCmd := pipeline.ZCount(context.Background(), key, "1", "1")
+	downCmd := pipeline.ZCount(context.Background(), key, "-1", "-1")
+	if _, err = pipeline.Exec(context.Background()); err != nil {
+		return
+	}
+	return upCmd.Val(), downCmd.Val(), existsCmd.Val() > 0, nil
+}
+
+// DeleteTargetVoted 删除对象的用户投票记录
+func DeleteTargetVoted(t *VoteTarget, targetID string) error {
+	return client.Del(context.Background(), t.VotedKey(targetID)).Err()
+}
+
+// GetVoteActiveTargets 按创建时间顺序查询仍在投票时间窗口内的对象id
+func GetVoteActiveTargets(t *VoteTarget, offset, count int64) ([]string, error) {
+	deadline := float64(time.Now().Unix()) - t.Window.Seconds()
+	return client.ZRangeByScore(context.Background(), t.TimeKey(), &redis.ZRangeBy{
+		Min:    strconv.FormatFloat(deadline, 'f', -1, 64),
+		Max:    "+inf",
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
+
+// GetTargetClearedList 批量查询对象的投票是否被全部取消
+// 返回值: 与targetIDs顺序一致，存在取消标记时为true
+func GetTargetClearedList(t *VoteTarget, targetIDs []string) ([]bool, error) {
+	pipeline := client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(targetIDs))
+	for _, id := range targetIDs {
+		cmds = append(cmds, pipeline.Exists(context.Background(), t.ClearedKey(id)))
+	}
+	if _, err := pipeline.Exec(context.Background()); err != nil {
+		return nil, err
+	}
+	cleared := make([]bool, 0, len(targetIDs))
+	for _, cmd := range cmds {
+		cleared = append(cleared, cmd.Val() > 0)
+	}
+	return cleared, nil
+}
+
+// GetTargetVotedList 批量查询对象的用户投票记录
+// 返回值: 与targetIDs顺序一致的 用户id -> 投票值 映射
+func GetTargetVotedList(t *VoteTarget, targetIDs []string) ([]map[string]float64, error) {
+	pipeline := client.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, 0, len(targetIDs))
+	for _, id := range targetIDs {
+		cmds = append(cmds, pipeline.ZRangeWithScores(context.Background(), t.VotedKey(id), 0, -1))
+	}
+	if _, err := pipeline.Exec(context.Background()); err != nil {
+		return nil, err
+	}
+	data := make([]map[string]float64, 0, len(targetIDs))
+	for _, cmd := range cmds {
+		voted := make(map[string]float64)
+		for _, z := range cmd.Val() {
+			voted[z.Member.(string)] = z.Score
+		}
+		data = append(data, voted)
+	}
+	return data, nil
+}
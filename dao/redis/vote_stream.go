@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 基于Redis Streams的投票消息队列相关操作
+// 投票消息写入stream后由消费者组消费，处理成功后确认（XACK），
+// 未确认的消息留在消费者组的待处理列表（PEL）中，可以被重新认领处理，
+// 多次处理失败的消息转入死信stream，便于人工排查
+
+// StreamMessage stream中的一条消息
+type StreamMessage struct {
+	ID         string                 // 消息ID
+	Values     map[string]interface{} // 消息内容
+	RetryCount int64                  // 已投递次数，只有重新认领的消息才有值
+}
+
+// CreateVoteStreamGroup 创建投票stream的消费者组，stream不存在时一并创建
+// 消费者组已存在时直接返回nil
+func CreateVoteStreamGroup(ctx context.Context, group string) error {
+	err := client.XGroupCreateMkStream(ctx, getRedisKey(KeyVoteStream), group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// AddVoteStream 写入一条投票消息
+// 参数 maxLen: stream保留的最大消息数量（近似值），0表示不限制
+// 裁剪只看stream的总长度，超过上限时还没有确认的消息也会被删除
+func AddVoteStream(ctx context.Context, values map[string]interface{}, maxLen int64) error {
+	return client.XAdd(ctx, &redis.XAddArgs{
+		Stream: getRedisKey(KeyVoteStream),
+		MaxLen: maxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+// CountPendingVotes 查询消费者组中还没有确认的消息数量
+func CountPendingVotes(ctx context.Context, group string) (int64, error) {
+	pending, err := client.XPending(ctx, getRedisKey(KeyVoteStream), group).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return pending.Count, nil
+}
+
+// ReadVoteStream 以消费者组的方式读取新的投票消息
+// 参数 block: 没有新消息时的最长阻塞时间
+func ReadVoteStream(ctx context.Context, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{getRedisKey(KeyVoteStream), ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]StreamMessage, 0, count)
+	for _, stream := range streams {
+		for _, m := range stream.Messages {
+			msgs = append(msgs, StreamMessage{ID: m.ID, Values: m.Values})
+		}
+	}
+	return msgs, nil
+}
+
+// AckVoteStream 确认投票消息已处理完成
+func AckVoteStream(ctx context.Context, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return client.XAck(ctx, getRedisKey(KeyVoteStream), group, ids...).Err()
+}
+
+// ClaimPendingVotes 认领长时间未确认的投票消息
+// 消费者崩溃或处理失败时，消息会一直留在待处理列表中，这里把空闲超过minIdle的消息认领给当前消费者
+func ClaimPendingVotes(ctx context.Context, group, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	key := getRedisKey(KeyVoteStream)
+	pending, err := client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: key,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(pending))
+	retries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		if p.Idle < minIdle {
+			continue
+		}
+		ids = append(ids, p.ID)
+		retries[p.ID] = p.RetryCount
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// XCLAIM会再次校验空闲时间，并发认领时只有一个消费者能成功
+	claimed, err := client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   key,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]StreamMessage, 0, len(claimed))
+	for _, m := range claimed {
+		msgs = append(msgs, StreamMessage{ID: m.ID, Values: m.Values, RetryCount: retries[m.ID]})
+	}
+	return msgs, nil
+}
+
+// RestoreVoteRetryCount 把消息的投递次数恢复为count，并重新开始计算空闲时间
+// 数据库不可用时写入失败不是消息本身的问题，这次投递不计入重试次数
+func RestoreVoteRetryCount(ctx context.Context, group, consumer string, msgs []StreamMessage) error {
+	key := getRedisKey(KeyVoteStream)
+	pipeline := client.Pipeline()
+	for _, m := range msgs {
+		// JUSTID不增加投递次数，RETRYCOUNT直接设置投递次数
+		pipeline.Do(ctx, "XCLAIM", key, group, consumer, 0, m.ID, "RETRYCOUNT", m.RetryCount, "JUSTID")
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
+}
+
+// AddVoteDeadStream 将处理失败的投票消息写入死信stream
+func AddVoteDeadStream(ctx context.Context, msg StreamMessage, reason string) error {
+	values := make(map[string]interface{}, len(msg.Values)+3)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["origin_id"] = msg.ID
+	values["retry_count"] = msg.RetryCount
+	values["reason"] = reason
+	return client.XAdd(ctx, &redis.XAddArgs{
+		Stream: getRedisKey(KeyVoteDeadStream),
+		Values: values,
+	}).Err()
+}
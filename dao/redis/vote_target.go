@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"bluebell/models"
+	"errors"
+	"time"
+)
+
+// VoteTarget 可投票对象的注册信息
+// 每种可投票对象（帖子、社区公告、用户回答等）注册自己的key命名空间、投票时间窗口和每票分数，
+// 投票引擎根据这些信息完成投票时间校验、分数计算和投票记录的保存
+type VoteTarget struct {
+	Type         models.VoteTargetType // 对象类型，对应vote表的target_type字段
+	Namespace    string                // key命名空间，如"post"对应 post:time、post:score、post:voted:<id>
+	Window       time.Duration         // 自对象创建起允许投票的时长，超过后不允许再投票
+	ScorePerVote float64               // 每一票对应的分数
+}
+
+// TimeKey 对象及创建时间的zset
+func (t *VoteTarget) TimeKey() string {
+	return getRedisKey(t.Namespace + KeyTimeZSetSF)
+}
+
+// ScoreKey 对象及投票分数的zset
+func (t *VoteTarget) ScoreKey() string {
+	return getRedisKey(t.Namespace + KeyScoreZSetSF)
+}
+
+// VotedKey 记录某个对象的用户投票情况的zset
+func (t *VoteTarget) VotedKey(targetID string) string {
+	return getRedisKey(t.Namespace + KeyVotedZSetSF + targetID)
+}
+
+// ClearedKey 对象的投票被全部取消的标记
+// 最后一票被取消时投票记录zset随之删除，与Redis数据丢失无法区分，对账时根据这个标记判断
+func (t *VoteTarget) ClearedKey(targetID string) string {
+	return getRedisKey(t.Namespace + KeyClearedSF + targetID)
+}
+
+// LockedKey 被锁定、不允许投票的对象id集合
+func (t *VoteTarget) LockedKey() string {
+	return getRedisKey(t.Namespace + KeyLockedSetSF)
+}
+
+// ArchiveCursorKey 投票归档进度的key
+func (t *VoteTarget) ArchiveCursorKey() string {
+	return getRedisKey(t.Namespace + KeyVoteArchiveCursorSF)
+}
+
+// ErrVoteTargetNotRegistered 投票对象类型未注册
+var ErrVoteTargetNotRegistered = errors.New("未注册的投票对象类型")
+
+// voteTargets 已注册的可投票对象
+// 只在程序初始化阶段注册，运行期间只读，因此不需要加锁
+var voteTargets = make(map[models.VoteTargetType]*VoteTarget)
+
+// RegisterVoteTarget 注册可投票对象，需要在程序初始化阶段调用
+func RegisterVoteTarget(t *VoteTarget) {
+	voteTargets[t.Type] = t
+}
+
+// GetVoteTarget 根据类型获取已注册的可投票对象
+func GetVoteTarget(tt models.VoteTargetType) (*VoteTarget, error) {
+	t, ok := voteTargets[tt]
+	if !ok {
+		return nil, ErrVoteTargetNotRegistered
+	}
+	return t, nil
+}
+
+// ListVoteTargets 返回所有已注册的可投票对象
+func ListVoteTargets() []*VoteTarget {
+	targets := make([]*VoteTarget, 0, len(voteTargets))
+	for _, t := range voteTargets {
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+func init() {
+	// 帖子：自发表之日起一周内允许投票
+	// 每票432分 = 86400秒/200票，即200张赞成票可以让帖子在热门榜上多待一天
+	RegisterVoteTarget(&VoteTarget{
+		Type:         models.VoteTargetPost,
+		Namespace:    "post",
+		Window:       7 * 24 * time.Hour,
+		ScorePerVote: 432,
+	})
+}
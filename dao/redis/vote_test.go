@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"bluebell/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVoteForRegisteredTarget(t *testing.T) {
+	m := setupRedis(t)
+
+	// 注册一个与帖子使用不同命名空间和分数的对象
+	const answer models.VoteTargetType = 99
+	RegisterVoteTarget(&VoteTarget{Type: answer, Namespace: "answer", Window: time.Hour, ScorePerVote: 10})
+	t.Cleanup(func() { delete(voteTargets, answer) })
+
+	target, _ := GetVoteTarget(answer)
+	now := float64(time.Now().Unix())
+	m.ZAdd(target.TimeKey(), now, "7")
+	m.ZAdd(target.ScoreKey(), now, "7")
+
+	if err := VoteForTarget(answer, "1", "7", 1); err != nil {
+		t.Fatalf("VoteForTarget failed, err:%v", err)
+	}
+	if score, _ := m.ZScore(target.ScoreKey(), "7"); score != now+10 {
+		t.Fatalf("score got %v, want %v", score, now+10)
+	}
+	if v, _ := m.ZScore(getRedisKey("answer:voted:7"), "1"); v != 1 {
+		t.Fatalf("vote record got %v, want 1", v)
+	}
+	// 帖子的key不受影响
+	if m.Exists(getRedisKey(KeyPostScoreZSet)) || m.Exists(getRedisKey(KeyPostVotedZSetPF+"7")) {
+		t.Fatal("vote on answer wrote post keys")
+	}
+
+	err := VoteForTarget(models.VoteTargetType(100), "1", "7", 1)
+	if !errors.Is(err, ErrVoteTargetNotRegistered) {
+		t.Fatalf("unregistered target got err %v", err)
+	}
+}
+
+func TestVoteScript(t *testing.T) {
+	m := setupRedis(t)
+
+	now := float64(time.Now().Unix())
+	created := now - 3600
+	m.ZAdd(getRedisKey(KeyPostTimeZSet), created, "1")
+	m.ZAdd(getRedisKey(KeyPostScoreZSet), created, "1")
+	// 2号帖子发表于8天前，已经超过投票时间窗口
+	m.ZAdd(getRedisKey(KeyPostTimeZSet), now-8*24*3600, "2")
+
+	cases := []struct {
+		value float64
+		err   error
+		score float64 // 投票后1号帖子的分数相对发帖时间的变化
+	}{
+		{1, nil, 432},
+		{1, ErrVoteRepeated, 432},
+		{-1, nil, -432}, // 赞成改反对，变化2*432
+		{0, nil, 0},
+		{0, ErrVoteRepeated, 0},
+	}
+	for i, tc := range cases {
+		err := VoteForPost("100", "1", tc.value)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("case %d: got err %v, want %v", i, err, tc.err)
+		}
+		if score, _ := m.ZScore(getRedisKey(KeyPostScoreZSet), "1"); score != created+tc.score {
+			t.Fatalf("case %d: score got %v, want %v", i, score-created, tc.score)
+		}
+	}
+	if m.Exists(getRedisKey(KeyPostVotedZSetPF + "1")) {
+		t.Fatal("vote record not removed after cancel")
+	}
+
+	if err := VoteForPost("100", "2", 1); !errors.Is(err, ErrVoteTimeExpire) {
+		t.Fatalf("expired post got err %v", err)
+	}
+
+	if err := SetTargetLocked(models.VoteTargetPost, 1, true); err != nil {
+		t.Fatalf("SetTargetLocked failed, err:%v", err)
+	}
+	if err := VoteForPost("100", "1", 1); !errors.Is(err, ErrVoteLocked) {
+		t.Fatalf("locked post got err %v", err)
+	}
+}
+
+func TestVoteScriptConcurrent(t *testing.T) {
+	m := setupRedis(t)
+
+	created := float64(time.Now().Unix())
+	m.ZAdd(getRedisKey(KeyPostTimeZSet), created, "1")
+	m.ZAdd(getRedisKey(KeyPostScoreZSet), created, "1")
+
+	// 同一用户并发投相同的票，只有一次成功，分数只增加一次
+	const n = 20
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- VoteForPost("100", "1", 1) }()
+	}
+	ok := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			ok++
+		} else if !errors.Is(err, ErrVoteRepeated) {
+			t.Fatalf("VoteForPost failed, err:%v", err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("%d votes succeeded, want 1", ok)
+	}
+	if score, _ := m.ZScore(getRedisKey(KeyPostScoreZSet), "1"); score != created+432 {
+		t.Fatalf("score got %v, want %v", score-created, 432)
+	}
+}
@@ -0,0 +1,74 @@
+// Package testutil 提供测试共用的Redis、MySQL和登录凭证环境
+// 只在测试中导入：Redis使用内存中的miniredis，MySQL使用sqlmock，测试结束后自动清理
+package testutil
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/pkg/jwt"
+	"bluebell/pkg/password"
+	"bluebell/setting"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// Redis 启动一个内存中的Redis并让dao/redis连接它，测试结束后自动关闭
+func Redis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	m := miniredis.RunT(t)
+	port, _ := strconv.Atoi(m.Port())
+	if err := redis.Init(&setting.RedisConfig{Host: m.Host(), Port: port}); err != nil {
+		t.Fatalf("redis.Init failed, err:%v", err)
+	}
+	t.Cleanup(redis.Close)
+	return m
+}
+
+// MySQL 让dao/mysql使用sqlmock的连接，测试结束时检查预期的SQL是否都已执行
+func MySQL(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed, err:%v", err)
+	}
+	mysql.SetDB(sqlx.NewDb(db, "mysql"))
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet sql expectations: %v", err)
+		}
+		_ = db.Close()
+	})
+	return mock
+}
+
+// JWT 使用测试密钥签发和校验token
+func JWT(t *testing.T) {
+	t.Helper()
+	err := jwt.Init(&setting.JWTConfig{
+		Issuer:    "bluebell",
+		ActiveKid: "test",
+		Keys:      []*setting.JWTKeyConfig{{Kid: "test", Alg: "HS256", Secret: "0123456789abcdef0123456789abcdef"}},
+	})
+	if err != nil {
+		t.Fatalf("jwt.Init failed, err:%v", err)
+	}
+}
+
+// ExpectLogin 预期一次密码正确、没有开启两步验证的登录查询，user_role表中的角色为roles
+func ExpectLogin(mock sqlmock.Sqlmock, userID int64, username, pwd string, roles ...*models.UserRole) {
+	hash, _ := password.Hash(pwd)
+	mock.ExpectQuery("from user where username").WithArgs(username).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "password"}).AddRow(userID, username, hash))
+	mock.ExpectQuery("from user_totp").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_counter"}))
+	rows := sqlmock.NewRows([]string{"user_id", "role", "community_id"})
+	for _, r := range roles {
+		rows.AddRow(userID, r.Role, r.CommunityID)
+	}
+	mock.ExpectQuery("from user_role").WithArgs(userID).WillReturnRows(rows)
+}
@@ -0,0 +1,156 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/pkg/snowflake"
+	"bluebell/setting"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 个人API key
+// key的格式为 bb_ + 32字节随机数的base64url编码，固定前缀便于在代码仓库和日志中扫描泄露的key。
+// 每次请求都按key的sha256查询数据库，吊销后立即失效。
+
+const (
+	APIKeyPrefix = "bb_"
+
+	defaultAPIKeyMaxPerUser = 20
+	defaultLastUsedInterval = time.Minute
+	apiKeyPrefixLen         = len(APIKeyPrefix) + 8 // 列表中显示的key前缀长度
+)
+
+var (
+	ErrorAPIKeyLimit    = errors.New("API key数量已达上限")
+	ErrorAPIKeyNotExist = errors.New("API key不存在")
+	ErrorInvalidAPIKey  = errors.New("API key无效")
+	ErrorAPIKeyScope    = errors.New("API key没有访问该接口的权限")
+)
+
+// apiKeyConfig API key的配置，未配置的项使用默认值
+func apiKeyConfig() (maxPerUser int64, lastUsedInterval time.Duration) {
+	maxPerUser, lastUsedInterval = defaultAPIKeyMaxPerUser, defaultLastUsedInterval
+	cfg := setting.Conf
+	if cfg == nil || cfg.APIKeyConfig == nil {
+		return
+	}
+	if cfg.APIKeyMaxPerUser > 0 {
+		maxPerUser = int64(cfg.APIKeyMaxPerUser)
+	}
+	if cfg.LastUsedInterval > 0 {
+		lastUsedInterval = time.Duration(cfg.LastUsedInterval) * time.Second
+	}
+	return
+}
+
+// CreateAPIKey 创建API key
+// 返回值中的Key是完整的key，只在这里返回一次
+func CreateAPIKey(userID int64, p *models.ParamCreateAPIKey) (*models.APIKey, error) {
+	// ==================== 第一步：检查数量上限 ====================
+	maxPerUser, _ := apiKeyConfig()
+	count, err := mysql.CountAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxPerUser {
+		return nil, ErrorAPIKeyLimit
+	}
+
+	// ==================== 第二步：生成key ====================
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	key := APIKeyPrefix + token
+	k := &models.APIKey{
+		KeyID:      snowflake.GenID(),
+		UserID:     userID,
+		Name:       p.Name,
+		KeyPrefix:  key[:apiKeyPrefixLen],
+		KeyHash:    hashToken(key),
+		Scopes:     normalizeScopes(p.Scopes),
+		CreateTime: time.Now(),
+		Key:        key,
+	}
+	if p.ExpireDays > 0 {
+		expire := k.CreateTime.AddDate(0, 0, p.ExpireDays)
+		k.ExpireTime = &expire
+	}
+
+	// ==================== 第三步：保存 ====================
+	if err = mysql.InsertAPIKey(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// normalizeScopes 去掉重复的权限范围并排序
+func normalizeScopes(scopes []string) models.APIKeyScopes {
+	seen := make(map[string]bool, len(scopes))
+	ret := make(models.APIKeyScopes, 0, len(scopes))
+	for _, s := range scopes {
+		if !seen[s] {
+			seen[s] = true
+			ret = append(ret, s)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// GetAPIKeyList 获取用户未吊销的API key列表，不包含完整的key
+func GetAPIKeyList(userID int64) ([]*models.APIKey, error) {
+	return mysql.GetAPIKeyList(userID)
+}
+
+// RevokeAPIKey 吊销用户的API key，吊销后立即失效
+func RevokeAPIKey(userID, keyID int64) error {
+	ok, err := mysql.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrorAPIKeyNotExist
+	}
+	return nil
+}
+
+// AuthenticateAPIKey 校验API key及其权限范围
+// 参数 scope: 访问的接口需要的权限范围
+// 参数 ip: 客户端IP，记录为最近使用的IP
+// 返回值: key不存在、已吊销或已过期时返回ErrorInvalidAPIKey，没有权限范围时返回ErrorAPIKeyScope
+func AuthenticateAPIKey(key, scope, ip string) (*models.APIKey, error) {
+	// 格式不对的key不查询数据库
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) <= apiKeyPrefixLen {
+		return nil, ErrorInvalidAPIKey
+	}
+	k, err := mysql.GetAPIKeyByHash(hashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if k.ExpireTime != nil && !now.Before(*k.ExpireTime) {
+		return nil, ErrorInvalidAPIKey
+	}
+	if !k.Scopes.Has(scope) {
+		return nil, ErrorAPIKeyScope
+	}
+
+	// 记录最近使用时间，间隔较短时不更新，失败只记录日志
+	_, interval := apiKeyConfig()
+	if k.LastUsedTime == nil || now.Sub(*k.LastUsedTime) >= interval {
+		if err := mysql.UpdateAPIKeyLastUsed(k.KeyID, ip); err != nil {
+			zap.L().Error("mysql.UpdateAPIKeyLastUsed failed", zap.Int64("keyID", k.KeyID), zap.Error(err))
+		}
+	}
+	return k, nil
+}
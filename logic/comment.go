@@ -0,0 +1,116 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/pkg/snowflake"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// CreateComment 发表评论
+// 回复评论时，父评论必须属于同一篇帖子
+func CreateComment(userID, pid int64, p *models.ParamComment) (comment *models.Comment, err error) {
+	// 1. 帖子必须存在且未被删除，评论者没有被禁止在帖子所属社区发言
+	post, err := getNormalPost(pid)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCommunityBan(post.CommunityID, userID); err != nil {
+		return nil, err
+	}
+	// 2. 校验父评论
+	if p.ParentID != 0 {
+		parent, err := mysql.GetCommentById(p.ParentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrorCommentNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parent.PostID != pid {
+			return nil, ErrorCommentNotExist
+		}
+	}
+	// 3. 生成评论id并保存
+	comment = &models.Comment{
+		ID:       snowflake.GenID(),
+		PostID:   pid,
+		ParentID: p.ParentID,
+		AuthorID: userID,
+		Content:  p.Content,
+	}
+	if err = mysql.CreateComment(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// GetCommentTree 获取帖子下的评论，按parent_id组织成树形结构
+func GetCommentTree(pid int64) (data []*models.ApiCommentDetail, err error) {
+	if _, err = getNormalPost(pid); err != nil {
+		return nil, err
+	}
+	comments, err := mysql.GetCommentListByPostID(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 批量查询评论者信息，避免逐条查询用户表
+	authorIDs := make([]int64, 0, len(comments))
+	for _, c := range comments {
+		authorIDs = append(authorIDs, c.AuthorID)
+	}
+	users, err := mysql.GetUserListByIDs(authorIDs)
+	if err != nil {
+		zap.L().Error("mysql.GetUserListByIDs failed",
+			zap.Int64("pid", pid),
+			zap.Error(err))
+		return nil, err
+	}
+	names := make(map[int64]string, len(users))
+	for _, u := range users {
+		names[u.UserID] = u.Username
+	}
+
+	// 评论按时间正序排列，父评论一定先于它的回复出现
+	nodes := make(map[int64]*models.ApiCommentDetail, len(comments))
+	data = make([]*models.ApiCommentDetail, 0)
+	for _, c := range comments {
+		node := &models.ApiCommentDetail{
+			AuthorName: names[c.AuthorID],
+			Comment:    c,
+			Replies:    make([]*models.ApiCommentDetail, 0),
+		}
+		nodes[c.ID] = node
+		parent, ok := nodes[c.ParentID]
+		if c.ParentID == 0 || !ok {
+			data = append(data, node)
+			continue
+		}
+		parent.Replies = append(parent.Replies, node)
+	}
+	return
+}
+
+// fillCommentNum 批量查询并填充帖子列表的评论数
+func fillCommentNum(data []*models.ApiPostDetail) {
+	if len(data) == 0 {
+		return
+	}
+	pids := make([]int64, 0, len(data))
+	for _, d := range data {
+		pids = append(pids, d.Post.ID)
+	}
+	counts, err := mysql.GetCommentCountByPostIDs(pids)
+	if err != nil {
+		// 评论数只是展示信息，查询失败不影响帖子列表的返回
+		zap.L().Error("mysql.GetCommentCountByPostIDs failed", zap.Error(err))
+		return
+	}
+	for _, d := range data {
+		d.CommentNum = counts[d.Post.ID]
+	}
+}
@@ -0,0 +1,187 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/pkg/mailer"
+	"bluebell/setting"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 邮箱验证和找回密码
+// 注册时填写了邮箱的用户会收到验证邮件，点击邮件中的链接完成验证，也可以登录后重新发送。
+// 忘记密码时提交已验证的邮箱，收到重置密码的链接后设置新密码；
+// 不论邮箱是否存在都返回成功，邮件在后台发送，避免通过响应内容或响应时间判断邮箱是否注册过。
+// 链接中的token只能使用一次，Redis中只保存它的sha256。
+
+const (
+	defaultEmailVerifyExpire   = 24 * time.Hour
+	defaultPasswordResetExpire = 30 * time.Minute
+)
+
+var (
+	ErrorInvalidEmailToken = errors.New("链接无效或已过期")
+	ErrorEmailNotSet       = errors.New("未设置邮箱")
+	ErrorEmailVerified     = errors.New("邮箱已验证")
+)
+
+// mailConfig 邮件相关的配置，未配置时返回空的配置
+func mailConfig() *setting.MailConfig {
+	if cfg := setting.Conf; cfg != nil && cfg.MailConfig != nil {
+		return cfg.MailConfig
+	}
+	return new(setting.MailConfig)
+}
+
+// expireOrDefault 配置的有效期，单位秒，未配置时使用默认值
+func expireOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// formatExpire 邮件中显示的有效期，如 24小时、30分钟
+func formatExpire(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d小时", d/time.Hour)
+	}
+	return fmt.Sprintf("%d分钟", (d+time.Minute-1)/time.Minute)
+}
+
+// sendMailAsync 在后台发送邮件，发送失败只记录日志
+func sendMailAsync(msg *mailer.Message) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			zap.L().Error("mailer.Send failed",
+				zap.String("to", msg.To),
+				zap.String("subject", msg.Subject),
+				zap.Error(err))
+		}
+	}()
+}
+
+// sendVerifyEmail 生成邮箱验证token并发送验证邮件
+func sendVerifyEmail(user *models.User) error {
+	cfg := mailConfig()
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	expire := expireOrDefault(cfg.EmailVerifyExpire, defaultEmailVerifyExpire)
+	if err = redis.CreateEmailVerifyToken(hashToken(token), user.UserID, user.Email, expire); err != nil {
+		return err
+	}
+	link := strings.ReplaceAll(cfg.EmailVerifyURL, "{token}", token)
+	sendMailAsync(&mailer.Message{
+		To:      user.Email,
+		Subject: "验证你的bluebell邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在%s内点击下面的链接验证你的邮箱：\n%s\n\n如果这不是你的操作，请忽略这封邮件。\n",
+			user.Username, formatExpire(expire), link),
+	})
+	return nil
+}
+
+// VerifyEmail 使用验证邮件中的token完成邮箱验证
+// 邮箱已被其他用户验证时返回mysql.ErrorEmailExist
+func VerifyEmail(token string) error {
+	userID, email, err := redis.ConsumeEmailVerifyToken(hashToken(token))
+	if errors.Is(err, redis.ErrEmailTokenInvalid) {
+		return ErrorInvalidEmailToken
+	}
+	if err != nil {
+		return err
+	}
+	ok, err := mysql.VerifyUserEmail(userID, email)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 发送验证邮件之后用户的邮箱变了，或者被验证了同一邮箱的其他用户清空
+		return ErrorInvalidEmailToken
+	}
+	return nil
+}
+
+// ResendVerifyEmail 重新发送验证邮件
+func ResendVerifyEmail(userID int64) error {
+	user, err := mysql.GetUserEmail(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return ErrorEmailNotSet
+	}
+	if user.EmailVerified {
+		return ErrorEmailVerified
+	}
+	return sendVerifyEmail(user)
+}
+
+// ForgotPassword 向已验证的邮箱发送重置密码的链接
+// 邮箱不存在或未验证时同样返回成功
+func ForgotPassword(p *models.ParamForgotPassword) error {
+	user, err := mysql.GetUserByVerifiedEmail(p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 不需要登录就可以提交任意地址，不记录邮箱，避免日志中留下别人的邮箱
+		zap.L().Info("forgot password with unknown or unverified email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg := mailConfig()
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	expire := expireOrDefault(cfg.PasswordResetExpire, defaultPasswordResetExpire)
+	if err = redis.CreatePasswordResetToken(hashToken(token), user.UserID, user.Email, expire); err != nil {
+		return err
+	}
+	link := strings.ReplaceAll(cfg.PasswordResetURL, "{token}", token)
+	sendMailAsync(&mailer.Message{
+		To:      user.Email,
+		Subject: "重置你的bluebell密码",
+		Body: fmt.Sprintf("%s，你好：\n\n请在%s内点击下面的链接设置新密码：\n%s\n\n如果这不是你的操作，请忽略这封邮件，你的密码不会改变。\n",
+			user.Username, formatExpire(expire), link),
+	})
+	return nil
+}
+
+// ResetPassword 使用重置密码邮件中的token设置新密码
+// 设置成功后用户所有设备上的会话失效，需要用新密码重新登录
+func ResetPassword(p *models.ParamResetPassword) error {
+	userID, email, err := redis.ConsumePasswordResetToken(hashToken(p.Token))
+	if errors.Is(err, redis.ErrEmailTokenInvalid) {
+		return ErrorInvalidEmailToken
+	}
+	if err != nil {
+		return err
+	}
+	// 发送链接之后用户修改了邮箱，旧邮箱收到的链接不再有效
+	user, err := mysql.GetUserEmail(userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified || user.Email != email {
+		return ErrorInvalidEmailToken
+	}
+	if err = mysql.UpdatePassword(userID, p.Password); err != nil {
+		return err
+	}
+	// 密码已经修改成功，下面的清理失败只记录日志
+	// 删除用户在所有设备上的会话，用旧密码登录的人无法继续使用已有的refresh token和access token
+	if _, err := redis.RevokeUserSessions(userID); err != nil {
+		zap.L().Error("redis.RevokeUserSessions failed", zap.Int64("userID", userID), zap.Error(err))
+	}
+	clearLoginFailure(user.Username)
+	return nil
+}
@@ -0,0 +1,14 @@
+package logic
+
+import "errors"
+
+var (
+	ErrorPostNotExist    = errors.New("帖子不存在")
+	ErrorNoPermission    = errors.New("没有操作权限")
+	ErrorCommentNotExist = errors.New("评论不存在")
+
+	ErrorBannedInCommunity = errors.New("已被禁止在该社区发帖")
+	ErrorPostLocked        = errors.New("帖子已被锁定")
+
+	ErrorSensitiveWord = errors.New("内容包含敏感词")
+)
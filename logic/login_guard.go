@@ -0,0 +1,159 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/pkg/password"
+	"bluebell/setting"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 登录防暴力破解
+// 登录失败的次数按用户名和IP分别统计（配置项login_guard），超过上限之后每失败一次锁定一次，
+// 锁定时长从base_lockout开始翻倍，最长max_lockout。锁定期间直接拒绝登录，不再校验密码。
+// 不存在的用户名同样计数和锁定，避免通过是否会被锁定判断用户名是否存在。
+// 登录成功只清除该用户名的失败次数，IP的失败次数不清除，防止攻击者用自己的账号登录来重置计数。
+// Redis不可用时只记录日志，不影响正常登录。
+
+var ErrorLoginLocked = errors.New("登录失败次数过多，请稍后再试")
+
+const defaultLoginFailWindow = time.Hour
+
+// LoginLockedError 登录被锁定，errors.Is(err, ErrorLoginLocked)为true
+type LoginLockedError struct {
+	RetryAfter time.Duration // 锁定的剩余时间
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrorLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrorLoginLocked
+}
+
+// loginSubject 统计失败次数的对象
+type loginSubject struct {
+	key         string // user:<用户名> 或 ip:<IP>
+	maxAttempts int64
+}
+
+// loginGuard 登录锁定的配置，没有配置时返回nil
+func loginGuard() *setting.LoginGuardConfig {
+	if cfg := setting.Conf; cfg != nil {
+		return cfg.LoginGuardConfig
+	}
+	return nil
+}
+
+// loginSubjects 本次登录需要统计的对象
+// MySQL中用户名不区分大小写，这里统一转为小写，避免换个大小写绕过锁定
+func loginSubjects(cfg *setting.LoginGuardConfig, username, ip string) []loginSubject {
+	if cfg == nil {
+		return nil
+	}
+	subjects := make([]loginSubject, 0, 2)
+	if cfg.UserMaxAttempts > 0 && username != "" {
+		subjects = append(subjects, loginSubject{key: "user:" + strings.ToLower(username), maxAttempts: cfg.UserMaxAttempts})
+	}
+	if cfg.IPMaxAttempts > 0 && ip != "" {
+		subjects = append(subjects, loginSubject{key: "ip:" + ip, maxAttempts: cfg.IPMaxAttempts})
+	}
+	return subjects
+}
+
+// checkLoginLock 检查用户名或IP是否处于锁定中，锁定时返回*LoginLockedError
+func checkLoginLock(username, ip string) error {
+	subjects := loginSubjects(loginGuard(), username, ip)
+	if len(subjects) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		keys = append(keys, s.key)
+	}
+	remain, err := redis.GetLoginLock(keys...)
+	if err != nil {
+		zap.L().Error("redis.GetLoginLock failed", zap.String("username", username), zap.Error(err))
+		return nil
+	}
+	if remain > 0 {
+		return &LoginLockedError{RetryAfter: remain}
+	}
+	return nil
+}
+
+// recordLoginFailure 记录一次登录失败，失败次数超过上限时锁定
+func recordLoginFailure(username, ip string) {
+	cfg := loginGuard()
+	subjects := loginSubjects(cfg, username, ip)
+	if len(subjects) == 0 {
+		return
+	}
+	base := time.Duration(cfg.BaseLockout) * time.Second
+	if base <= 0 {
+		base = time.Second
+	}
+	max := time.Duration(cfg.MaxLockout) * time.Second
+	if max < base {
+		max = base
+	}
+	window := time.Duration(cfg.LoginFailWindow) * time.Second
+	if window <= 0 {
+		window = defaultLoginFailWindow
+	}
+	for _, s := range subjects {
+		lock, err := redis.RecordLoginFailure(s.key, redis.LoginLockout{
+			MaxAttempts: s.maxAttempts,
+			Base:        base,
+			Max:         max,
+			Window:      window,
+		})
+		if err != nil {
+			zap.L().Error("redis.RecordLoginFailure failed", zap.String("subject", s.key), zap.Error(err))
+			continue
+		}
+		if lock > 0 {
+			zap.L().Warn("login locked after too many failures",
+				zap.String("subject", s.key),
+				zap.Duration("lock", lock))
+		}
+	}
+}
+
+// clearLoginFailure 登录成功后清除用户名的失败次数
+func clearLoginFailure(username string) {
+	cfg := loginGuard()
+	if cfg == nil || cfg.UserMaxAttempts <= 0 {
+		return
+	}
+	if err := redis.ClearLoginFailure("user:" + strings.ToLower(username)); err != nil {
+		zap.L().Error("redis.ClearLoginFailure failed", zap.String("username", username), zap.Error(err))
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// uniformLoginError 开启login_guard.uniform_error时，用户名不存在也按密码错误返回
+// 同时对一个固定的哈希校验一次密码，使用户名不存在和密码错误的耗时接近，避免通过响应时间探测用户名
+func uniformLoginError(err error, pwd string) error {
+	cfg := loginGuard()
+	if cfg == nil || !cfg.UniformError || !errors.Is(err, mysql.ErrorUserNotExist) {
+		return err
+	}
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = password.Hash("bluebell-dummy-password")
+	})
+	if dummyHash != "" {
+		_, _, _ = password.Verify(pwd, dummyHash)
+	}
+	return mysql.ErrorInvalidPassword
+}
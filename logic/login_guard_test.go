@@ -0,0 +1,117 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/pkg/password"
+	"bluebell/setting"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// setLoginGuard 替换登录锁定的配置，测试结束后恢复
+func setLoginGuard(t *testing.T, cfg *setting.LoginGuardConfig) {
+	old := setting.Conf.LoginGuardConfig
+	setting.Conf.LoginGuardConfig = cfg
+	t.Cleanup(func() { setting.Conf.LoginGuardConfig = old })
+}
+
+func TestLoginSubjects(t *testing.T) {
+	both := &setting.LoginGuardConfig{UserMaxAttempts: 5, IPMaxAttempts: 20}
+	cases := []struct {
+		cfg      *setting.LoginGuardConfig
+		username string
+		ip       string
+		want     []loginSubject
+	}{
+		{nil, "alice", "1.2.3.4", nil},
+		// 用户名统一转为小写
+		{both, "Alice", "1.2.3.4", []loginSubject{{"user:alice", 5}, {"ip:1.2.3.4", 20}}},
+		{both, "", "1.2.3.4", []loginSubject{{"ip:1.2.3.4", 20}}},
+		{&setting.LoginGuardConfig{UserMaxAttempts: 5}, "ALICE", "1.2.3.4", []loginSubject{{"user:alice", 5}}},
+		{&setting.LoginGuardConfig{IPMaxAttempts: 20}, "alice", "", []loginSubject{}},
+	}
+	for _, tc := range cases {
+		got := loginSubjects(tc.cfg, tc.username, tc.ip)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("loginSubjects(%+v, %q, %q) got %v, want %v", tc.cfg, tc.username, tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestUniformLoginError(t *testing.T) {
+	other := errors.New("db is down")
+	cases := []struct {
+		uniform bool
+		err     error
+		want    error
+	}{
+		{false, mysql.ErrorUserNotExist, mysql.ErrorUserNotExist},
+		{true, mysql.ErrorUserNotExist, mysql.ErrorInvalidPassword},
+		{true, mysql.ErrorInvalidPassword, mysql.ErrorInvalidPassword},
+		// 其他错误原样返回
+		{true, other, other},
+	}
+	for _, tc := range cases {
+		setLoginGuard(t, &setting.LoginGuardConfig{UniformError: tc.uniform})
+		if got := uniformLoginError(tc.err, "123456"); got != tc.want {
+			t.Errorf("uniform=%v: uniformLoginError(%v) got %v, want %v", tc.uniform, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	setLoginGuard(t, &setting.LoginGuardConfig{UserMaxAttempts: 2, BaseLockout: 60, MaxLockout: 600, UniformError: true})
+
+	hash, _ := password.Hash("right-password")
+	expectUser := func(username string) {
+		mock.ExpectQuery("from user where username").WithArgs(username).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "password"}).AddRow(1, "alice", hash))
+	}
+	login := func(username, pwd string) error {
+		_, err := Login(&models.ParamLogin{Username: username, Password: pwd}, "1.2.3.4")
+		return err
+	}
+	lockKey := "bluebell:login:lock:user:alice"
+
+	// 超过2次失败之后开始锁定，换大小写不能绕过
+	for _, username := range []string{"alice", "ALICE", "Alice"} {
+		expectUser(username)
+		if err := login(username, "wrong"); !errors.Is(err, mysql.ErrorInvalidPassword) {
+			t.Fatalf("login %s got err %v", username, err)
+		}
+	}
+	if ttl := m.TTL(lockKey); ttl != time.Minute {
+		t.Fatalf("first lockout got %v, want 1m", ttl)
+	}
+
+	// 锁定期间密码正确也拒绝，不查询MySQL
+	var locked *LoginLockedError
+	if err := login("alice", "right-password"); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Fatalf("login while locked got err %v", err)
+	}
+
+	// 锁定到期后再次失败，锁定时长翻倍
+	m.FastForward(61 * time.Second)
+	expectUser("alice")
+	if err := login("alice", "wrong"); !errors.Is(err, mysql.ErrorInvalidPassword) {
+		t.Fatalf("login after lockout got err %v", err)
+	}
+	if ttl := m.TTL(lockKey); ttl != 2*time.Minute {
+		t.Fatalf("second lockout got %v, want 2m", ttl)
+	}
+
+	// 不存在的用户名返回与密码错误相同的错误
+	mock.ExpectQuery("from user where username").WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username", "password"}))
+	if err := login("ghost", "wrong"); !errors.Is(err, mysql.ErrorInvalidPassword) {
+		t.Fatalf("login unknown user got err %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/setting"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 社区管理
+// 调用方（路由中的RequirePermission中间件）已经确认操作人是该社区的版主或管理员，
+// 这里只需要确认被操作的帖子属于该社区，避免版主通过自己的社区操作其他社区的帖子。
+// 所有操作都会写入管理日志，与改动MySQL的操作在同一个事务中；只有状态真正改变时才写日志。
+
+const defaultMaxPinned = 3 // 未配置时每个社区最多置顶的帖子数
+
+// maxPinned 每个社区最多置顶的帖子数，配置项moderation.max_pinned
+func maxPinned() int {
+	if cfg := setting.Conf; cfg != nil && cfg.ModerationConfig != nil && cfg.MaxPinned > 0 {
+		return cfg.MaxPinned
+	}
+	return defaultMaxPinned
+}
+
+// getCommunityPost 查询属于指定社区且状态正常的帖子
+func getCommunityPost(communityID, pid int64) (*models.Post, error) {
+	post, err := getNormalPost(pid)
+	if err != nil {
+		return nil, err
+	}
+	if post.CommunityID != communityID {
+		return nil, ErrorPostNotExist
+	}
+	return post, nil
+}
+
+// RemovePost 版主移除帖子
+// 与作者删除帖子一样把帖子从Redis的各个排序集合中移除，同时取消置顶
+func RemovePost(operatorID, communityID, pid int64, p *models.ParamModeration) (err error) {
+	post, err := getCommunityPost(communityID, pid)
+	if err != nil {
+		return err
+	}
+	ok, err := mysql.RemovePost(pid, &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionRemovePost,
+		TargetID:    pid,
+		Reason:      p.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 查询之后帖子被作者删除或被其他版主移除
+		return ErrorPostNotExist
+	}
+	// MySQL中已经移除成功，Redis清理失败只记录日志，列表接口会跳过状态不正常的帖子
+	if err := redis.DeletePost(pid, post.CommunityID); err != nil {
+		zap.L().Error("redis.DeletePost failed", zap.Int64("pid", pid), zap.Error(err))
+	}
+	return nil
+}
+
+// LockPost 锁定或解锁帖子，锁定后不允许投票
+// 锁定状态先写入MySQL的post_lock表，再写入Redis，由投票脚本在投票时原子地检查；
+// Redis数据丢失后cmd/rebuild根据post_lock表恢复
+func LockPost(operatorID, communityID, pid int64, locked bool, p *models.ParamModeration) (err error) {
+	if _, err = getCommunityPost(communityID, pid); err != nil {
+		return err
+	}
+	l := &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionLockPost,
+		TargetID:    pid,
+		Reason:      p.Reason,
+	}
+	if locked {
+		_, err = mysql.LockPost(communityID, pid, operatorID, l)
+	} else {
+		l.Action = models.ModActionUnlockPost
+		_, err = mysql.UnlockPost(pid, l)
+	}
+	if err != nil {
+		return err
+	}
+	// 已经是目标状态时MySQL没有改动，仍然写一次Redis，修复之前写Redis失败的情况
+	return redis.SetTargetLocked(models.VoteTargetPost, pid, locked)
+}
+
+// PinPost 置顶帖子，每个社区最多置顶maxPinned篇，已经置顶时直接返回成功
+func PinPost(operatorID, communityID, pid int64, p *models.ParamModeration) (err error) {
+	if _, err = getCommunityPost(communityID, pid); err != nil {
+		return err
+	}
+	_, err = mysql.PinPost(communityID, pid, operatorID, maxPinned(), &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionPinPost,
+		TargetID:    pid,
+		Reason:      p.Reason,
+	})
+	return err
+}
+
+// UnpinPost 取消置顶，帖子没有置顶时直接返回成功
+// 已删除或被移除的帖子已经取消了置顶，这里不检查帖子状态
+func UnpinPost(operatorID, communityID, pid int64, p *models.ParamModeration) (err error) {
+	post, err := mysql.GetPostById(pid)
+	if err == sql.ErrNoRows || (err == nil && post.CommunityID != communityID) {
+		return ErrorPostNotExist
+	}
+	if err != nil {
+		return err
+	}
+	_, err = mysql.UnpinPost(pid, &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionUnpinPost,
+		TargetID:    pid,
+		Reason:      p.Reason,
+	})
+	return err
+}
+
+// BanUser 禁止用户在社区发帖和评论
+// p.Duration为0时永久禁止，再次禁止时覆盖原来的到期时间
+func BanUser(operatorID, communityID int64, p *models.ParamBanUser) (err error) {
+	if _, err = mysql.GetUserById(p.UserID); err == sql.ErrNoRows {
+		return mysql.ErrorUserNotExist
+	}
+	if err != nil {
+		return err
+	}
+	ban := &models.CommunityBan{
+		CommunityID: communityID,
+		UserID:      p.UserID,
+		OperatorID:  operatorID,
+		Reason:      p.Reason,
+	}
+	if p.Duration > 0 {
+		expire := time.Now().Add(time.Duration(p.Duration) * time.Hour)
+		ban.ExpireTime = &expire
+	}
+	return mysql.BanUser(ban, &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionBanUser,
+		TargetID:    p.UserID,
+		Reason:      p.Reason,
+	})
+}
+
+// UnbanUser 解除用户在社区的禁言
+// 返回值 ok: 用户原本是否处于禁言中
+func UnbanUser(operatorID, communityID, userID int64, p *models.ParamModeration) (ok bool, err error) {
+	return mysql.UnbanUser(communityID, userID, &models.ModLog{
+		CommunityID: communityID,
+		OperatorID:  operatorID,
+		Action:      models.ModActionUnbanUser,
+		TargetID:    userID,
+		Reason:      p.Reason,
+	})
+}
+
+// GetCommunityBanList 获取社区中仍然有效的禁言列表
+func GetCommunityBanList(communityID int64) ([]*models.CommunityBan, error) {
+	return mysql.GetCommunityBanList(communityID)
+}
+
+// GetModLogList 获取社区的管理日志
+func GetModLogList(communityID, page, size int64) ([]*models.ModLog, error) {
+	return mysql.GetModLogList(communityID, page, size)
+}
+
+// checkCommunityBan 检查用户是否被禁止在社区发帖
+// 返回值: 处于禁言中时返回ErrorBannedInCommunity
+func checkCommunityBan(communityID, userID int64) error {
+	ban, err := mysql.GetCommunityBan(communityID, userID)
+	if err != nil {
+		return err
+	}
+	if ban != nil && ban.Active(time.Now()) {
+		return ErrorBannedInCommunity
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/setting"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var postColumns = []string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}
+
+// expectPostByID 预期一次按id查询帖子
+func expectPostByID(mock sqlmock.Sqlmock, pid, communityID int64, status int32) {
+	mock.ExpectQuery("where post_id = ").WithArgs(pid).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(pid, "t", "c", 100, communityID, status, time.Now()))
+}
+
+// timeNear 匹配与want相差不超过一分钟的时间参数
+type timeNear struct{ want time.Time }
+
+func (n *timeNear) Match(v driver.Value) bool {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Sub(n.want) < time.Minute && n.want.Sub(t) < time.Minute
+	case *time.Time:
+		return t != nil && t.Sub(n.want) < time.Minute && n.want.Sub(*t) < time.Minute
+	}
+	return false
+}
+
+func TestModerationRejectsOtherCommunity(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	p := &models.ParamModeration{Reason: "spam"}
+
+	// 7号帖子属于20号社区，10号社区的版主不能操作
+	ops := map[string]func() error{
+		"remove": func() error { return RemovePost(1, 10, 7, p) },
+		"lock":   func() error { return LockPost(1, 10, 7, true, p) },
+		"pin":    func() error { return PinPost(1, 10, 7, p) },
+		"unpin":  func() error { return UnpinPost(1, 10, 7, p) },
+	}
+	for name, op := range ops {
+		expectPostByID(mock, 7, 20, models.PostStatusNormal)
+		if err := op(); !errors.Is(err, ErrorPostNotExist) {
+			t.Errorf("%s got %v, want ErrorPostNotExist", name, err)
+		}
+	}
+}
+
+func TestRemovePost(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	if err := redis.CreatePost(7, 10, time.Now()); err != nil {
+		t.Fatalf("redis.CreatePost failed, err:%v", err)
+	}
+
+	expectPostByID(mock, 7, 10, models.PostStatusNormal)
+	mock.ExpectBegin()
+	mock.ExpectExec("update post set status").WithArgs(models.PostStatusRemoved, 7, models.PostStatusNormal).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("delete from community_pin").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into mod_log").WithArgs(10, 1, models.ModActionRemovePost, 7, "spam").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := RemovePost(1, 10, 7, &models.ParamModeration{Reason: "spam"}); err != nil {
+		t.Fatalf("RemovePost failed, err:%v", err)
+	}
+	if members, _ := m.ZMembers(redis.Prefix + redis.KeyPostTimeZSet); len(members) != 0 {
+		t.Fatalf("post:time got %v, removed post not deleted", members)
+	}
+	if ok, _ := m.SIsMember(redis.Prefix+redis.KeyCommunitySetPF+"10", "7"); ok {
+		t.Fatal("removed post still in its community")
+	}
+}
+
+func TestPinPostLimit(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	old := setting.Conf.ModerationConfig
+	setting.Conf.ModerationConfig = &setting.ModerationConfig{MaxPinned: 2}
+	t.Cleanup(func() { setting.Conf.ModerationConfig = old })
+	p := &models.ParamModeration{}
+
+	expectPinned := func(pid int64, pinned ...int64) {
+		expectPostByID(mock, pid, 10, models.PostStatusNormal)
+		mock.ExpectBegin()
+		mock.ExpectQuery("from community where community_id = ").WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"community_id"}).AddRow(10))
+		rows := sqlmock.NewRows([]string{"post_id"})
+		for _, id := range pinned {
+			rows.AddRow(id)
+		}
+		mock.ExpectQuery("from community_pin where community_id").WithArgs(10, models.PostStatusNormal).WillReturnRows(rows)
+	}
+
+	// 已经置顶了max_pinned篇，不能再置顶
+	expectPinned(5, 3, 4)
+	mock.ExpectRollback()
+	if err := PinPost(1, 10, 5, p); !errors.Is(err, mysql.ErrorPinLimit) {
+		t.Fatalf("PinPost over limit got %v, want ErrorPinLimit", err)
+	}
+
+	// 已经置顶的帖子直接返回成功，不写管理日志
+	expectPinned(4, 3, 4)
+	mock.ExpectRollback()
+	if err := PinPost(1, 10, 4, p); err != nil {
+		t.Fatalf("PinPost pinned post failed, err:%v", err)
+	}
+
+	// 没有达到上限时置顶
+	expectPinned(5, 3)
+	mock.ExpectExec("insert into community_pin").WithArgs(10, 5, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into mod_log").WithArgs(10, 1, models.ModActionPinPost, 5, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := PinPost(1, 10, 5, p); err != nil {
+		t.Fatalf("PinPost failed, err:%v", err)
+	}
+}
+
+func TestBanUserExpiry(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	// 按小时设置到期时间
+	mock.ExpectQuery("from user where user_id").WithArgs(200).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(200, "bob"))
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into community_ban").
+		WithArgs(10, 200, 1, "spam", &timeNear{want: time.Now().Add(24 * time.Hour)}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into mod_log").WithArgs(10, 1, models.ModActionBanUser, 200, "spam").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := BanUser(1, 10, &models.ParamBanUser{UserID: 200, Duration: 24, Reason: "spam"}); err != nil {
+		t.Fatalf("BanUser failed, err:%v", err)
+	}
+
+	// 禁言到期后可以发帖，永久禁言和未到期的禁言不能发帖
+	cases := []struct {
+		expire interface{}
+		want   error
+	}{
+		{time.Now().Add(-time.Minute), nil},
+		{time.Now().Add(time.Hour), ErrorBannedInCommunity},
+		{nil, ErrorBannedInCommunity},
+	}
+	for _, tc := range cases {
+		mock.ExpectQuery("from community_ban").WithArgs(10, 200).
+			WillReturnRows(sqlmock.NewRows([]string{"community_id", "user_id", "operator_id", "reason", "expire_time", "create_time"}).
+				AddRow(10, 200, 1, "spam", tc.expire, time.Now()))
+		if err := checkCommunityBan(10, 200); !errors.Is(err, tc.want) {
+			t.Errorf("checkCommunityBan with expire %v got %v, want %v", tc.expire, err, tc.want)
+		}
+	}
+}
+
+func TestCommunityPostListWithPinned(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	// 10号社区的帖子按时间排序为 1 2 3 4 5，4号帖子被置顶
+	now := time.Now().Unix()
+	for i, id := range []string{"1", "2", "3", "4", "5"} {
+		m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, float64(now-int64(i)), id)
+		m.SAdd(redis.Prefix+redis.KeyCommunitySetPF+"10", id)
+	}
+
+	expectPage := func(ids ...string) {
+		mock.ExpectQuery("from community_pin where community_id").WithArgs(10, models.PostStatusNormal).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow("4"))
+		// 按本页的帖子id查询，参数就是本页的帖子及其顺序
+		args := make([]driver.Value, 0, len(ids)+1)
+		rows := sqlmock.NewRows(postColumns)
+		for _, id := range ids {
+			args = append(args, id)
+			rows.AddRow(id, "t", "c", 100, 10, models.PostStatusNormal, time.Now())
+		}
+		args = append(args, strings.Join(ids, ","))
+		mock.ExpectQuery("where post_id in").WithArgs(args...).WillReturnRows(rows)
+		mock.ExpectQuery("from vote_archive").WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "up_votes", "down_votes"}))
+		for range ids {
+			mock.ExpectQuery("from user where user_id").
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "username"}).AddRow(100, "alice"))
+			mock.ExpectQuery("from community").
+				WillReturnRows(sqlmock.NewRows([]string{"community_id", "community_name", "introduction", "create_time"}).
+					AddRow(10, "go", "", time.Now()))
+		}
+		mock.ExpectQuery("from comment").WillReturnRows(sqlmock.NewRows([]string{"post_id", "num"}))
+	}
+
+	// 每页都是size条，置顶帖子只在第一页出现，其余帖子按顺序接续
+	pages := [][]string{{"4", "1"}, {"2", "3"}, {"5"}}
+	for i, want := range pages {
+		expectPage(want...)
+		data, err := GetCommunityPostList(&models.ParamPostList{CommunityID: 10, Page: int64(i + 1), Size: 2, Order: models.OrderTime})
+		if err != nil {
+			t.Fatalf("page %d failed, err:%v", i+1, err)
+		}
+		if len(data) != len(want) {
+			t.Fatalf("page %d got %d posts, want %d", i+1, len(data), len(want))
+		}
+		for _, d := range data {
+			if pinned := d.Post.ID == 4; d.Pinned != pinned {
+				t.Errorf("page %d post %d pinned got %v", i+1, d.Post.ID, d.Pinned)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/pkg/oidc"
+	"bluebell/pkg/snowflake"
+	"bluebell/setting"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// 第三方登录（OIDC）
+// 登录：GET /oidc/<名称>/authorize 重定向到身份提供方，登录后跳转回 /oidc/<名称>/callback，
+//       校验ID token后按(身份提供方, sub)找到关联的用户，没有关联时自动注册新用户，之后与普通登录一样签发token
+// 绑定：已登录的用户调用 POST /oidc/<名称>/link 得到身份提供方的登录地址，跳转回来后把身份提供方账号关联到该用户
+// 不按邮箱关联已有用户，已有用户需要登录后主动绑定；开启了两步验证的用户仍然需要提交验证码
+
+const (
+	defaultOIDCStateExpire = 10 * time.Minute
+	oidcRequestTimeout     = 15 * time.Second // 换取和校验ID token的总超时时间
+	maxUsernameRunes       = 32
+	usernameRetries        = 5 // 自动注册时用户名重复后加随机后缀重试的次数
+)
+
+var (
+	ErrorOIDCProviderNotFound = errors.New("不支持的登录方式")
+	ErrorInvalidOIDCState     = errors.New("登录请求无效或已过期")
+	ErrorOIDCLoginFailed      = errors.New("第三方登录失败")
+	ErrorIdentityLinked       = errors.New("第三方账号已绑定其他用户")
+)
+
+// OIDCStateExpire 跳转到身份提供方登录后返回的期限，配置项oidc.state_expire，单位秒
+func OIDCStateExpire() time.Duration {
+	if cfg := setting.Conf; cfg != nil && cfg.OIDCConfig != nil && cfg.OIDCStateExpire > 0 {
+		return time.Duration(cfg.OIDCStateExpire) * time.Second
+	}
+	return defaultOIDCStateExpire
+}
+
+// OIDCAuthURL 生成身份提供方的登录地址
+// 参数 userID: 要绑定身份提供方账号的用户，登录时为0
+// 返回值 state: 本次登录请求的state，控制器写入cookie，跳转回来时校验是同一个浏览器
+func OIDCAuthURL(providerName string, userID int64) (authURL, state string, err error) {
+	provider, err := oidc.Get(providerName)
+	if err != nil {
+		return "", "", ErrorOIDCProviderNotFound
+	}
+	s := &models.OIDCState{Provider: providerName, UserID: userID}
+	if state, err = oidc.RandomString(); err != nil {
+		return "", "", err
+	}
+	if s.Nonce, err = oidc.RandomString(); err != nil {
+		return "", "", err
+	}
+	if s.Verifier, err = oidc.RandomString(); err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	if authURL, err = provider.AuthCodeURL(ctx, state, s.Nonce, s.Verifier); err != nil {
+		return "", "", err
+	}
+	if err = redis.CreateOIDCState(hashToken(state), s, OIDCStateExpire()); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// OIDCCallback 处理身份提供方跳转回来的请求
+// 返回值 user: 登录时为签发了token的用户，开启了两步验证的用户只有ChallengeToken；绑定时为被绑定的用户
+// 返回值 linked: 是否为绑定请求
+func OIDCCallback(providerName string, p *models.ParamOIDCCallback) (user *models.User, linked bool, err error) {
+	// ==================== 第一步：取出登录请求 ====================
+	// 不论后续是否成功，state都只能使用一次
+	s, err := redis.ConsumeOIDCState(hashToken(p.State))
+	if errors.Is(err, redis.ErrOIDCStateInvalid) {
+		return nil, false, ErrorInvalidOIDCState
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if s.Provider != providerName {
+		return nil, false, ErrorInvalidOIDCState
+	}
+	provider, err := oidc.Get(providerName)
+	if err != nil {
+		return nil, false, ErrorOIDCProviderNotFound
+	}
+	if p.Error != "" || p.Code == "" {
+		// 用户拒绝授权或身份提供方出错
+		return nil, false, fmt.Errorf("%w: %s %s", ErrorOIDCLoginFailed, p.Error, p.ErrorDescription)
+	}
+
+	// ==================== 第二步：换取并校验ID token ====================
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	rawIDToken, err := provider.Exchange(ctx, p.Code, s.Verifier)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrorOIDCLoginFailed, err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, s.Nonce)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrorOIDCLoginFailed, err)
+	}
+	identity := &models.UserIdentity{
+		UserID:   s.UserID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	// ==================== 第三步：绑定到已登录的用户 ====================
+	if s.UserID != 0 {
+		if err = linkIdentity(identity); err != nil {
+			return nil, true, err
+		}
+		return &models.User{UserID: s.UserID}, true, nil
+	}
+
+	// ==================== 第四步：查找或注册用户 ====================
+	user, err = mysql.GetUserByIdentity(providerName, claims.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = createOIDCUser(identity, claims)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// ==================== 第五步：检查两步验证 ====================
+	required, err := startTwoFactorLogin(user)
+	if err != nil {
+		return nil, false, err
+	}
+	if required {
+		return user, false, nil
+	}
+
+	// ==================== 第六步：签发身份令牌 ====================
+	if err = issueTokens(user); err != nil {
+		return nil, false, err
+	}
+	return user, false, nil
+}
+
+// linkIdentity 把身份提供方账号绑定到已有用户，重复绑定同一个账号视为成功
+func linkIdentity(identity *models.UserIdentity) error {
+	err := mysql.LinkUserIdentity(identity)
+	if !errors.Is(err, mysql.ErrorIdentityExist) {
+		return err
+	}
+	owner, err := mysql.GetUserByIdentity(identity.Provider, identity.Subject)
+	if err == nil && owner.UserID == identity.UserID {
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	// 该账号已关联其他用户，或者用户已经绑定了同一身份提供方的其他账号
+	return ErrorIdentityLinked
+}
+
+// createOIDCUser 第一次通过身份提供方登录时注册新用户
+// 密码是随机生成的，用户不知道，身份提供方验证过的邮箱会保存为已验证，之后可以通过找回密码设置密码
+func createOIDCUser(identity *models.UserIdentity, claims *oidc.Claims) (*models.User, error) {
+	username, err := availableUsername(identity.Provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		UserID:   snowflake.GenID(),
+		Username: username,
+		Password: password,
+	}
+	// 邮箱已被其他用户验证时不保存，也不关联到那个用户；只被其他用户填写、没有验证时归新用户
+	if claims.Email != "" && claims.EmailVerified && len(claims.Email) <= 64 {
+		err := mysql.CheckEmailExist(claims.Email)
+		if err == nil {
+			user.Email, user.EmailVerified = claims.Email, true
+		} else if !errors.Is(err, mysql.ErrorEmailExist) {
+			return nil, err
+		}
+	}
+	identity.UserID = user.UserID
+	if err = mysql.InsertUserWithIdentity(user, identity); err != nil {
+		return nil, err
+	}
+	zap.L().Info("user signed up with oidc",
+		zap.Int64("userID", user.UserID),
+		zap.String("provider", identity.Provider),
+		zap.String("username", username))
+	return user, nil
+}
+
+// availableUsername 根据身份提供方返回的用户信息生成一个未被使用的用户名
+// 依次尝试preferred_username、name和邮箱的用户名部分，重复时加随机数字后缀
+func availableUsername(provider string, claims *oidc.Claims) (string, error) {
+	base := ""
+	localPart := claims.Email
+	if i := strings.IndexByte(localPart, '@'); i >= 0 {
+		localPart = localPart[:i]
+	}
+	for _, s := range []string{claims.PreferredUsername, claims.Name, localPart} {
+		if base = sanitizeUsername(s); base != "" {
+			break
+		}
+	}
+	if base == "" {
+		base = sanitizeUsername(provider + "_user")
+	}
+
+	name := base
+	for i := 0; i < usernameRetries; i++ {
+		err := mysql.CheckUserExist(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, mysql.ErrorUserExist) {
+			return "", err
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s_%04d", base, n.Int64())
+	}
+	return "", mysql.ErrorUserExist
+}
+
+// sanitizeUsername 只保留字母、数字、下划线、中划线和点，空白替换为下划线
+// 最多保留maxUsernameRunes-5个字符，给重复时的随机后缀留出位置
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.TrimSpace(s) {
+		if n >= maxUsernameRunes-5 {
+			break
+		}
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		default:
+			continue
+		}
+		n++
+	}
+	return b.String()
+}
@@ -2,30 +2,132 @@ package logic
 
 import (
 	"bluebell/dao/mysql"
+	"bluebell/dao/outbox"
 	"bluebell/dao/redis"
 	"bluebell/models"
 	"bluebell/pkg/snowflake"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+func init() {
+	outbox.RegisterHandler(models.OutboxEventPostCreated, applyPostCreated)
+}
+
 func CreatePost(p *models.Post) (err error) {
-	// 1. 生成post id
+	// 0. 被禁止在该社区发帖的用户不能发帖
+	if err = checkCommunityBan(p.CommunityID, p.AuthorID); err != nil {
+		return err
+	}
+	// 1. 检查标题和内容中的敏感词
+	hits, err := filterPostText(&p.Title, &p.Content)
+	if err != nil {
+		return err
+	}
+	// 2. 生成post id
 	p.ID = snowflake.GenID()
-	// 2. 保存到数据库
+	// 发帖时间由服务端决定，忽略请求中可能携带的create_time，create_time字段精度为秒
+	p.CreateTime = time.Now().Truncate(time.Second)
+	// 3. 保存到数据库，帖子和post.created事件在同一个事务中写入
 	err = mysql.CreatePost(p)
 	if err != nil {
 		return err
 	}
-	err = redis.CreatePost(p.ID, p.CommunityID)
+	// 4. 唤醒outbox转发任务，尽快把帖子写入Redis
+	outbox.Notify()
+	// 5. 命中敏感词但允许发布的帖子加入举报队列
+	flagSensitivePost(p, hits)
 	return
-	// 3. 返回
+}
+
+// applyPostCreated 处理post.created事件，把帖子写入Redis的排序集合
+// 事件可能被重复处理，redis.CreatePost不会覆盖已有的分数
+func applyPostCreated(e *models.OutboxEvent) error {
+	var ev models.PostCreatedEvent
+	if err := json.Unmarshal([]byte(e.Payload), &ev); err != nil {
+		return err
+	}
+	// 事件处理前帖子已经被删除或移除，不再写入Redis
+	post, err := mysql.GetPostById(ev.PostID)
+	if err != nil {
+		return err
+	}
+	if post.Status != models.PostStatusNormal {
+		return nil
+	}
+	return redis.CreatePost(ev.PostID, ev.CommunityID, time.Unix(ev.CreateTime, 0))
+}
+
+// getNormalPost 查询状态正常的帖子，帖子不存在、已删除或被移除时返回ErrorPostNotExist
+func getNormalPost(pid int64) (post *models.Post, err error) {
+	post, err = mysql.GetPostById(pid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorPostNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != models.PostStatusNormal {
+		return nil, ErrorPostNotExist
+	}
+	return post, nil
+}
+
+// UpdatePost 编辑帖子，只有帖子作者本人可以编辑
+func UpdatePost(userID, pid int64, p *models.ParamUpdatePost) (err error) {
+	post, err := getNormalPost(pid)
+	if err != nil {
+		return err
+	}
+	if post.AuthorID != userID {
+		return ErrorNoPermission
+	}
+	post.Title = p.Title
+	post.Content = p.Content
+	hits, err := filterPostText(&post.Title, &post.Content)
+	if err != nil {
+		return err
+	}
+	if err = mysql.UpdatePost(post); err != nil {
+		return err
+	}
+	flagSensitivePost(post, hits)
+	return nil
+}
+
+// DeletePost 删除帖子，只有帖子作者本人可以删除
+// MySQL中做软删除，同时把帖子从Redis的各个排序集合中移除
+func DeletePost(userID, pid int64) (err error) {
+	post, err := getNormalPost(pid)
+	if err != nil {
+		return err
+	}
+	if post.AuthorID != userID {
+		return ErrorNoPermission
+	}
+	if err = mysql.DeletePost(pid); err != nil {
+		return err
+	}
+	// MySQL中已经删除成功，Redis清理失败只记录日志
+	// 列表接口会跳过已删除的帖子，不影响展示
+	if err := redis.DeletePost(pid, post.CommunityID); err != nil {
+		zap.L().Error("redis.DeletePost failed",
+			zap.Int64("pid", pid),
+			zap.Error(err))
+	}
+	return nil
 }
 
 // GetPostById 根据帖子id查询帖子详情数据
 func GetPostById(pid int64) (data *models.ApiPostDetail, err error) {
 	// 查询并组合我们接口想用的数据
-	post, err := mysql.GetPostById(pid)
+	post, err := getNormalPost(pid)
 	if err != nil {
 		zap.L().Error("mysql.GetPostById(pid) failed",
 			zap.Int64("pid", pid),
@@ -48,12 +150,22 @@ func GetPostById(pid int64) (data *models.ApiPostDetail, err error) {
 			zap.Error(err))
 		return
 	}
+	// 查询帖子是否被锁定，查询失败不影响展示
+	locked, err := redis.IsTargetLocked(models.VoteTargetPost, pid)
+	if err != nil {
+		zap.L().Error("redis.IsTargetLocked failed",
+			zap.Int64("pid", pid),
+			zap.Error(err))
+		err = nil
+	}
 	// 接口数据拼接
 	data = &models.ApiPostDetail{
 		AuthorName:      user.Username,
+		Locked:          locked,
 		Post:            post,
 		CommunityDetail: community,
 	}
+	fillCommentNum([]*models.ApiPostDetail{data})
 	return
 }
 
@@ -120,7 +232,11 @@ func GetPostList(page, size int64) (data []*models.ApiPostDetail, err error) {
 		data = append(data, postDetail)
 	}
 
-	// ==================== 第四步：返回结果 ====================
+	// ==================== 第四步：填充评论数 ====================
+	// 一次查询统计整页帖子的评论数
+	fillCommentNum(data)
+
+	// ==================== 第五步：返回结果 ====================
 	// 返回组装好的帖子详情列表
 	return
 }
@@ -144,13 +260,17 @@ func GetPostList2(p *models.ParamPostList) (data []*models.ApiPostDetail, err er
 	}
 	zap.L().Debug("GetPostList2", zap.Any("posts", posts))
 	// 提前查询好每篇帖子的投票数
-	voteData, err := redis.GetPostVoteData(ids)
+	voteData, err := getPostVoteData(ids)
 	if err != nil {
 		return
 	}
 
 	// 将帖子的作者及分区信息查询出来填充到帖子中
 	for idx, post := range posts {
+		// Redis中的排序数据清理失败时，已删除或被移除的帖子可能仍然出现在id列表中
+		if post.Status != models.PostStatusNormal {
+			continue
+		}
 		// 根据作者id查询作者信息
 		user, err := mysql.GetUserById(post.AuthorID)
 		if err != nil {
@@ -175,16 +295,28 @@ func GetPostList2(p *models.ParamPostList) (data []*models.ApiPostDetail, err er
 		}
 		data = append(data, postDetail)
 	}
+	fillCommentNum(data)
 	return
 
 }
 
 func GetCommunityPostList(p *models.ParamPostList) (data []*models.ApiPostDetail, err error) {
-	// 2. 去redis查询id列表
-	ids, err := redis.GetCommunityPostIDsInOrder(p)
+	// 1. 查询社区的置顶帖子
+	pinnedIDs, err := mysql.GetPinnedPostIDs(p.CommunityID)
 	if err != nil {
 		return
 	}
+	// 2. 去redis查询id列表，置顶帖子排在最前面，后面的帖子依次后移
+	ranks, err := redis.GetCommunityPostRanks(p, pinnedIDs)
+	if err != nil {
+		return
+	}
+	pg := communityPage(p.Page, p.Size, ranks)
+	ids, err := redis.GetCommunityPostIDsRange(p, pg.Start, pg.Count)
+	if err != nil {
+		return
+	}
+	ids, pinned := mergePinnedPostIDs(pinnedIDs[pg.PinFrom:pg.PinTo], pinnedIDs, ids, p.Size)
 	if len(ids) == 0 {
 		zap.L().Warn("redis.GetPostIDsInOrder(p) return 0 data")
 		return
@@ -198,13 +330,17 @@ func GetCommunityPostList(p *models.ParamPostList) (data []*models.ApiPostDetail
 	}
 	zap.L().Debug("GetPostList2", zap.Any("posts", posts))
 	// 提前查询好每篇帖子的投票数
-	voteData, err := redis.GetPostVoteData(ids)
+	voteData, err := getPostVoteData(ids)
 	if err != nil {
 		return
 	}
 
 	// 将帖子的作者及分区信息查询出来填充到帖子中
 	for idx, post := range posts {
+		// Redis中的排序数据清理失败时，已删除或被移除的帖子可能仍然出现在id列表中
+		if post.Status != models.PostStatusNormal {
+			continue
+		}
 		// 根据作者id查询作者信息
 		user, err := mysql.GetUserById(post.AuthorID)
 		if err != nil {
@@ -224,14 +360,98 @@ func GetCommunityPostList(p *models.ParamPostList) (data []*models.ApiPostDetail
 		postDetail := &models.ApiPostDetail{
 			AuthorName:      user.Username,
 			VoteNum:         voteData[idx],
+			Pinned:          pinned[post.ID],
 			Post:            post,
 			CommunityDetail: community,
 		}
 		data = append(data, postDetail)
 	}
+	fillCommentNum(data)
+	return
+}
+
+// pinnedPage 社区帖子列表某一页的读取范围
+type pinnedPage struct {
+	PinFrom, PinTo int64 // 本页展示的置顶帖子为 pinnedIDs[PinFrom:PinTo]
+	Start, Count   int64 // 需要从排序列表读取的范围，其中可能夹着置顶帖子，去掉后再截取
+}
+
+// communityPage 计算社区帖子列表某一页的读取范围
+// 社区帖子列表 = 置顶帖子 + 去掉置顶帖子之后的排序列表，按size分页，每篇帖子只出现一次，除最后一页外每页都是size条：
+// 第一页先展示置顶帖子，剩下的位置由排序列表补齐；之后的页在去掉置顶帖子的排序列表中相应后移
+// 参数 ranks: 置顶帖子在排序列表中的位置，不在列表中的为-1，顺序与置顶帖子的展示顺序相同
+func communityPage(page, size int64, ranks []int64) (pg pinnedPage) {
+	if page < 1 {
+		page = 1
+	}
+	n := int64(len(ranks))
+	from, to := (page-1)*size, page*size
+	pg.PinFrom, pg.PinTo = minInt64(from, n), minInt64(to, n)
+	need := size - (pg.PinTo - pg.PinFrom)
+	if need <= 0 {
+		return
+	}
+	// 本页在去掉置顶帖子的排序列表中从第offset个开始，
+	// 换算为排序列表中的位置：排在它前面的每个置顶帖子都让位置后移一个
+	offset := from - n
+	if offset < 0 {
+		offset = 0
+	}
+	sorted := make([]int64, 0, n)
+	for _, r := range ranks {
+		if r >= 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	pg.Start = offset
+	for _, r := range sorted {
+		if r <= pg.Start {
+			pg.Start++
+		}
+	}
+	// 读取范围内最多夹着所有置顶帖子，多读这么多个
+	pg.Count = need + int64(len(sorted))
 	return
 }
 
+// mergePinnedPostIDs 把本页的置顶帖子放到社区帖子列表的最前面
+// 参数 pagePinned: 本页展示的置顶帖子
+// 参数 allPinned: 社区所有的置顶帖子，从排序列表中去掉，避免重复出现
+// 参数 ids: 从排序列表中读取的帖子id
+// 参数 size: 每页数量，合并后最多保留size个
+// 返回值 pinned: 列表中的置顶帖子
+func mergePinnedPostIDs(pagePinned, allPinned, ids []string, size int64) (merged []string, pinned map[int64]bool) {
+	pinned = make(map[int64]bool, len(pagePinned))
+	skip := make(map[string]bool, len(allPinned))
+	merged = make([]string, 0, size)
+	for _, id := range allPinned {
+		skip[id] = true
+	}
+	for _, id := range pagePinned {
+		if pid, err := strconv.ParseInt(id, 10, 64); err == nil {
+			pinned[pid] = true
+			merged = append(merged, id)
+		}
+	}
+	for _, id := range ids {
+		if int64(len(merged)) >= size {
+			break
+		}
+		if !skip[id] {
+			merged = append(merged, id)
+		}
+	}
+	return merged, pinned
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // GetPostListNew  将两个查询帖子列表逻辑合二为一的函数
 func GetPostListNew(p *models.ParamPostList) (data []*models.ApiPostDetail, err error) {
 	// 根据请求参数的不同，执行不同的逻辑。
@@ -0,0 +1,149 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// pageIDs 模拟Redis按communityPage计算的范围读取排序列表，返回合并后的一页帖子id
+func pageIDs(ranked, pinnedIDs []string, page, size int64) []string {
+	pos := make(map[string]int64, len(ranked))
+	for i, id := range ranked {
+		pos[id] = int64(i)
+	}
+	ranks := make([]int64, 0, len(pinnedIDs))
+	for _, id := range pinnedIDs {
+		r, ok := pos[id]
+		if !ok {
+			r = -1
+		}
+		ranks = append(ranks, r)
+	}
+	pg := communityPage(page, size, ranks)
+	var ids []string
+	if pg.Count > 0 && pg.Start < int64(len(ranked)) {
+		end := pg.Start + pg.Count
+		if end > int64(len(ranked)) {
+			end = int64(len(ranked))
+		}
+		ids = ranked[pg.Start:end]
+	}
+	merged, _ := mergePinnedPostIDs(pinnedIDs[pg.PinFrom:pg.PinTo], pinnedIDs, ids, size)
+	return merged
+}
+
+func TestCommunityPage(t *testing.T) {
+	cases := []struct {
+		name   string
+		ranked []string // 排序列表
+		pinned []string // 置顶帖子，按展示顺序
+		size   int64
+		pages  [][]string
+	}{
+		{
+			name:   "no pinned",
+			ranked: []string{"1", "2", "3", "4", "5"},
+			size:   2,
+			pages:  [][]string{{"1", "2"}, {"3", "4"}, {"5"}, {}},
+		},
+		{
+			name:   "pinned inside ranked list",
+			ranked: []string{"1", "9", "2", "3", "8", "4", "5"},
+			pinned: []string{"8", "9"},
+			size:   3,
+			pages:  [][]string{{"8", "9", "1"}, {"2", "3", "4"}, {"5"}},
+		},
+		{
+			name:   "pinned fill more than one page",
+			ranked: []string{"7", "1", "8", "2", "9", "3"},
+			pinned: []string{"9", "8", "7"},
+			size:   2,
+			pages:  [][]string{{"9", "8"}, {"7", "1"}, {"2", "3"}, {}},
+		},
+		{
+			name:   "pinned missing from ranked list",
+			ranked: []string{"1", "2", "3"},
+			pinned: []string{"9"},
+			size:   2,
+			pages:  [][]string{{"9", "1"}, {"2", "3"}, {}},
+		},
+	}
+	for _, tc := range cases {
+		for i, want := range tc.pages {
+			got := pageIDs(tc.ranked, tc.pinned, int64(i+1), tc.size)
+			if len(got) == 0 && len(want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: page %d got %v, want %v", tc.name, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestMergePinnedPostIDs(t *testing.T) {
+	merged, pinned := mergePinnedPostIDs([]string{"9"}, []string{"9", "8"}, []string{"1", "8", "9", "2", "3"}, 3)
+	if want := []string{"9", "1", "2"}; !reflect.DeepEqual(merged, want) {
+		t.Fatalf("merged got %v, want %v", merged, want)
+	}
+	if len(pinned) != 1 || !pinned[9] {
+		t.Fatalf("pinned got %v", pinned)
+	}
+}
+
+func TestApplyPostCreated(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	created := time.Now().Truncate(time.Second)
+	expectPost := func(pid int64, status int32) {
+		mock.ExpectQuery("where post_id = ").WithArgs(pid).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}).
+				AddRow(pid, "t", "c", 100, 10, status, created))
+	}
+	event := func(pid int64) *models.OutboxEvent {
+		return &models.OutboxEvent{
+			EventType:   models.OutboxEventPostCreated,
+			AggregateID: pid,
+			Payload:     `{"post_id":"` + strconv.FormatInt(pid, 10) + `","community_id":10,"create_time":` + strconv.FormatInt(created.Unix(), 10) + `}`,
+		}
+	}
+	scoreKey := redis.Prefix + redis.KeyPostScoreZSet
+
+	expectPost(1, models.PostStatusNormal)
+	if err := applyPostCreated(event(1)); err != nil {
+		t.Fatalf("applyPostCreated failed, err:%v", err)
+	}
+	if score, _ := m.ZScore(scoreKey, "1"); score != float64(created.Unix()) {
+		t.Fatalf("score got %v, want %v", score, created.Unix())
+	}
+	if ok, _ := m.SIsMember(redis.Prefix+redis.KeyCommunitySetPF+"10", "1"); !ok {
+		t.Fatal("post not added to its community")
+	}
+
+	// 事件被重复处理时不覆盖投票后的分数
+	m.ZAdd(scoreKey, float64(created.Unix())+432, "1")
+	expectPost(1, models.PostStatusNormal)
+	if err := applyPostCreated(event(1)); err != nil {
+		t.Fatalf("applyPostCreated again failed, err:%v", err)
+	}
+	if score, _ := m.ZScore(scoreKey, "1"); score != float64(created.Unix())+432 {
+		t.Fatalf("score overwritten, got %v", score)
+	}
+
+	// 事件处理前已经被移除的帖子不写入Redis
+	expectPost(2, models.PostStatusRemoved)
+	if err := applyPostCreated(event(2)); err != nil {
+		t.Fatalf("applyPostCreated removed post failed, err:%v", err)
+	}
+	if members, _ := m.ZMembers(scoreKey); len(members) != 1 {
+		t.Fatalf("post:score got %v", members)
+	}
+}
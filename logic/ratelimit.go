@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/setting"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+	"go.uber.org/zap"
+)
+
+// 按操作限流
+// 每个操作（注册、登录、发帖、投票等）有独立的限流策略，配置项rate_limit.actions.<操作>，
+// 分别限制每个用户和每个IP在窗口内的请求次数，计数保存在Redis中，多个实例共享。
+// 每个请求读取当前的配置快照，修改配置文件后立即生效；没有配置的操作不限流。
+
+// rateLimitPolicy 操作的限流策略，没有配置时返回nil
+func rateLimitPolicy(action string) *setting.RateLimitPolicy {
+	p := setting.RateLimit().RateLimitActions[action]
+	if p == nil || p.Window <= 0 {
+		return nil
+	}
+	return p
+}
+
+// CheckRateLimit 检查用户或IP的请求是否超过操作的限流策略
+// 参数 userID: 当前登录的用户，未登录时为0，不按用户限制
+// 参数 ip: 客户端IP，为空时不按IP限制
+// 返回值 retryAfter: 被限流时需要等待的时间，为0表示允许
+func CheckRateLimit(action string, userID int64, ip string) (retryAfter time.Duration, err error) {
+	p := rateLimitPolicy(action)
+	if p == nil {
+		return 0, nil
+	}
+	rules := make([]redis.RateLimitRule, 0, 2)
+	if p.User > 0 && userID != 0 {
+		rules = append(rules, redis.RateLimitRule{Key: action + ":user:" + strconv.FormatInt(userID, 10), Limit: p.User})
+	}
+	if p.IP > 0 && ip != "" {
+		rules = append(rules, redis.RateLimitRule{Key: action + ":ip:" + ip, Limit: p.IP})
+	}
+	return redis.AllowRequest(rules, time.Duration(p.Window)*time.Second)
+}
+
+// 路由组限流
+// 每个路由组一个令牌桶，配置项rate_limit.groups.<组名>，没有配置的路由组不限流。
+// 令牌桶的实现由rate_limit.backend选择：
+//   memory 进程内的令牌桶，每个实例独立计数，多实例部署时总的QPS是配置值的实例数倍
+//   redis  令牌桶保存在Redis中，所有实例共享；Redis不可用时临时使用进程内的令牌桶
+// 每个请求读取当前的配置快照，修改配置文件后立即生效
+
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+// memoryBucket 进程内的令牌桶，记录创建时的配置，配置修改后重新创建
+type memoryBucket struct {
+	bucket *ratelimit.Bucket
+	rate   float64
+	burst  int64
+}
+
+var (
+	memoryBucketsMu sync.Mutex
+	memoryBuckets   = make(map[string]*memoryBucket)
+)
+
+// takeMemoryToken 从进程内的令牌桶中取一个令牌
+func takeMemoryToken(group string, rate float64, burst int64) time.Duration {
+	memoryBucketsMu.Lock()
+	b := memoryBuckets[group]
+	if b == nil || b.rate != rate || b.burst != burst {
+		b = &memoryBucket{bucket: ratelimit.NewBucketWithRate(rate, burst), rate: rate, burst: burst}
+		memoryBuckets[group] = b
+	}
+	memoryBucketsMu.Unlock()
+
+	if b.bucket.TakeAvailable(1) == 1 {
+		return 0
+	}
+	// 令牌不足时最多等待生成一个令牌的时间
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// CheckGroupRateLimit 从路由组的令牌桶中取一个令牌
+// 返回值 retryAfter: 被限流时需要等待的时间，为0表示允许
+func CheckGroupRateLimit(group string) (retryAfter time.Duration) {
+	// 本次请求只读取一次配置，修改配置文件时整体替换，不会与正在读取的map冲突
+	cfg := setting.RateLimit()
+	b := cfg.RateLimitGroups[group]
+	if b == nil || b.Rate <= 0 || b.Burst <= 0 {
+		return 0
+	}
+	if cfg.RateLimitBackend != RateLimitBackendRedis {
+		return takeMemoryToken(group, b.Rate, b.Burst)
+	}
+	retryAfter, err := redis.TakeToken(group, b.Rate, b.Burst)
+	if err != nil {
+		zap.L().Error("redis.TakeToken failed, fall back to memory bucket",
+			zap.String("group", group),
+			zap.Error(err))
+		return takeMemoryToken(group, b.Rate, b.Burst)
+	}
+	return retryAfter
+}
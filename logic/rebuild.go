@@ -0,0 +1,182 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 根据MySQL重建Redis中的帖子排序数据
+// Redis数据丢失后，所有帖子都会从 /posts2 列表中消失，因为列表只读取 post:time 和 post:score。
+// 这里按帖子表和投票表重新计算：
+//   post:time          发帖时间
+//   post:score         发帖时间 + 每票分数 * (赞成票数 - 反对票数)，与投票时的计分方式一致
+//   community:<id>     帖子所属社区
+//   post:voted:<id>    用户投票记录，只恢复仍在投票时间窗口内的帖子，过期帖子的投票数已经归档
+//   post:locked        被版主锁定的帖子，按post_lock表恢复
+
+const maxRebuildDetails = 100 // 报告中最多保留的差异明细条数
+
+// RebuildReport 重建结果
+type RebuildReport struct {
+	DryRun           bool     `json:"dry_run"`
+	Posts            int      `json:"posts"`             // 检查的帖子数
+	TimeMismatch     int      `json:"time_mismatch"`     // post:time缺失或不一致的帖子数
+	ScoreMismatch    int      `json:"score_mismatch"`    // post:score缺失或不一致的帖子数
+	CommunityMissing int      `json:"community_missing"` // 不在所属社区集合中的帖子数
+	VotedMismatch    int      `json:"voted_mismatch"`    // 用户投票记录不一致的帖子数
+	LockedMismatch   int      `json:"locked_mismatch"`   // 锁定状态不一致的帖子数
+	Repaired         int      `json:"repaired"`          // 实际写入Redis的帖子数，dry-run时为0
+	Details          []string `json:"details"`           // 差异明细，最多保留maxRebuildDetails条
+}
+
+func (r *RebuildReport) addDetail(format string, args ...interface{}) {
+	if len(r.Details) < maxRebuildDetails {
+		r.Details = append(r.Details, fmt.Sprintf(format, args...))
+	}
+}
+
+// RebuildRedis 根据MySQL重建Redis中的帖子排序数据
+// 参数 dryRun: 为true时只对比差异，不写入Redis
+// 参数 batchSize: 每批处理的帖子数量
+func RebuildRedis(dryRun bool, batchSize int64) (report *RebuildReport, err error) {
+	target, err := redis.GetVoteTarget(models.VoteTargetPost)
+	if err != nil {
+		return nil, err
+	}
+	report = &RebuildReport{DryRun: dryRun}
+
+	var lastID int64
+	for {
+		posts, err := mysql.GetPostListAfterID(lastID, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(posts) == 0 {
+			break
+		}
+		lastID = posts[len(posts)-1].ID
+
+		expected, err := expectedPostRankStates(target, posts)
+		if err != nil {
+			return report, err
+		}
+		current, err := redis.GetPostRankStates(expected, true)
+		if err != nil {
+			return report, err
+		}
+
+		changed := make([]*redis.PostRankState, 0, len(expected))
+		for i, want := range expected {
+			if diffPostRankState(report, want, current[i]) {
+				changed = append(changed, want)
+			}
+		}
+		report.Posts += len(posts)
+
+		if dryRun || len(changed) == 0 {
+			continue
+		}
+		if err = redis.SetPostRankStates(changed); err != nil {
+			return report, err
+		}
+		report.Repaired += len(changed)
+	}
+	return report, nil
+}
+
+// expectedPostRankStates 根据帖子和投票记录计算帖子应有的排序数据
+func expectedPostRankStates(target *redis.VoteTarget, posts []*models.Post) ([]*redis.PostRankState, error) {
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	votes, err := mysql.GetVoteListByTargetIDs(target.Type, ids)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := mysql.GetLockedPostIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	voted := make(map[int64]map[string]float64, len(posts))
+	for _, v := range votes {
+		if voted[v.TargetID] == nil {
+			voted[v.TargetID] = make(map[string]float64)
+		}
+		voted[v.TargetID][strconv.FormatInt(v.UserID, 10)] = float64(v.VoteType)
+	}
+
+	now := time.Now()
+	states := make([]*redis.PostRankState, 0, len(posts))
+	for _, p := range posts {
+		createTime := float64(p.CreateTime.Unix())
+		var net float64
+		for _, v := range voted[p.ID] {
+			net += v
+		}
+		state := &redis.PostRankState{
+			PostID:      p.ID,
+			CommunityID: p.CommunityID,
+			Time:        createTime,
+			Score:       createTime + net*target.ScorePerVote,
+			InCommunity: true,
+			Locked:      locked[p.ID],
+		}
+		// 投票时间窗口内的帖子才恢复用户投票记录
+		if now.Sub(p.CreateTime) <= target.Window {
+			state.Voted = voted[p.ID]
+			if state.Voted == nil {
+				state.Voted = make(map[string]float64)
+			}
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// diffPostRankState 对比帖子应有的排序数据和Redis中的当前数据，差异记录到报告中
+// 返回值: 是否存在差异
+func diffPostRankState(report *RebuildReport, want, got *redis.PostRankState) (changed bool) {
+	if want.Time != got.Time {
+		report.TimeMismatch++
+		report.addDetail("post %d: time %v -> %v", want.PostID, got.Time, want.Time)
+		changed = true
+	}
+	if want.Score != got.Score {
+		report.ScoreMismatch++
+		report.addDetail("post %d: score %v -> %v", want.PostID, got.Score, want.Score)
+		changed = true
+	}
+	if !got.InCommunity {
+		report.CommunityMissing++
+		report.addDetail("post %d: missing from community %d", want.PostID, want.CommunityID)
+		changed = true
+	}
+	if want.Locked != got.Locked {
+		report.LockedMismatch++
+		report.addDetail("post %d: locked %v -> %v", want.PostID, got.Locked, want.Locked)
+		changed = true
+	}
+	if want.Voted != nil && !equalVoted(want.Voted, got.Voted) {
+		report.VotedMismatch++
+		report.addDetail("post %d: voted %d -> %d records", want.PostID, len(got.Voted), len(want.Voted))
+		changed = true
+	}
+	return
+}
+
+func equalVoted(a, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRebuildRedis(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	// 1号帖子仍在投票时间窗口内并且被锁定，2号帖子已经过了投票时间窗口
+	recent := time.Now().Add(-time.Hour).Truncate(time.Second)
+	old := time.Now().Add(-30 * 24 * time.Hour).Truncate(time.Second)
+	expectQueries := func() {
+		mock.ExpectQuery("from post").WithArgs(0, models.PostStatusNormal, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}).
+				AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, recent).
+				AddRow(2, "t2", "c2", 100, 20, models.PostStatusNormal, old))
+		mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "user_id", "vote_type"}).
+				AddRow(1, 1, 100, 1).
+				AddRow(1, 1, 101, 1).
+				AddRow(1, 1, 102, -1).
+				AddRow(1, 2, 100, 1))
+		mock.ExpectQuery("from post_lock").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(1))
+		mock.ExpectQuery("from post").WithArgs(2, models.PostStatusNormal, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"post_id"}))
+	}
+
+	// 2号帖子的数据完整；1号帖子只有发帖时间，分数是投票前的
+	m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, float64(recent.Unix()), "1")
+	m.ZAdd(redis.Prefix+redis.KeyPostScoreZSet, float64(recent.Unix()), "1")
+	m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, float64(old.Unix()), "2")
+	m.ZAdd(redis.Prefix+redis.KeyPostScoreZSet, float64(old.Unix())+432, "2")
+	m.SAdd(redis.Prefix+redis.KeyCommunitySetPF+"20", "2")
+
+	expectQueries()
+	report, err := RebuildRedis(true, 10)
+	if err != nil {
+		t.Fatalf("RebuildRedis dry-run failed, err:%v", err)
+	}
+	if report.Posts != 2 || report.TimeMismatch != 0 || report.ScoreMismatch != 1 || report.CommunityMissing != 1 ||
+		report.VotedMismatch != 1 || report.LockedMismatch != 1 || report.Repaired != 0 || len(report.Details) != 4 {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+	if m.Exists(redis.Prefix + redis.KeyPostLockedSet) {
+		t.Fatal("dry-run wrote Redis")
+	}
+
+	expectQueries()
+	if report, err = RebuildRedis(false, 10); err != nil || report.Repaired != 1 {
+		t.Fatalf("RebuildRedis got %+v, %v", report, err)
+	}
+	if score, _ := m.ZScore(redis.Prefix+redis.KeyPostScoreZSet, "1"); score != float64(recent.Unix())+432 {
+		t.Fatalf("score of post 1 got %v", score-float64(recent.Unix()))
+	}
+	if ok, _ := m.SIsMember(redis.Prefix+redis.KeyCommunitySetPF+"10", "1"); !ok {
+		t.Fatal("post 1 not added to its community")
+	}
+	if ok, _ := m.SIsMember(redis.Prefix+redis.KeyPostLockedSet, "1"); !ok {
+		t.Fatal("lock of post 1 not restored")
+	}
+	if members, _ := m.ZMembers(redis.Prefix + redis.KeyPostVotedZSetPF + "1"); len(members) != 3 {
+		t.Fatalf("vote records of post 1 got %v", members)
+	}
+	// 过期帖子的投票数已经归档，不恢复投票记录
+	if m.Exists(redis.Prefix + redis.KeyPostVotedZSetPF + "2") {
+		t.Fatal("vote records of expired post 2 restored")
+	}
+
+	// 重建之后再对比没有差异
+	expectQueries()
+	if report, err = RebuildRedis(true, 10); err != nil || report.Repaired != 0 || len(report.Details) != 0 {
+		t.Fatalf("RebuildRedis after repair got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,399 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MySQL和Redis的一致性对账
+// 发帖先写MySQL再由outbox转发任务写Redis，投票先写Redis再异步写MySQL，任何一步失败或延迟都会让两边的数据不一致：
+//   帖子缺失     MySQL中状态正常的帖子不在post:time、post:score或所属社区的集合中，列表中看不到这个帖子
+//   孤儿帖子     post:time或post:score中的帖子在MySQL中不存在、已删除或被移除
+//   投票不一致   投票时间窗口内帖子的post:voted:<id>与vote表中的记录不同
+// 对账任务定期执行，发现的问题按以下方式修复：
+//   帖子缺失     根据MySQL补齐缺失的部分，已经存在的分数不覆盖
+//   孤儿帖子     从Redis中移除
+//   投票不一致   以读取时的Redis为准写入vote表，只覆盖读取之前的记录，投票在Redis中原子完成，MySQL只是异步持久化的副本
+//                帖子的post:voted:<id>不存在时不以Redis为准：可能是Redis数据丢失，
+//                这时按vote表恢复投票记录和分数（与cmd/rebuild的计算方式一致），而不是把vote表中的投票改为取消；
+//                但存在post:cleared:<id>时说明投票是被全部取消的，取消投票还在队列中没有写入MySQL，仍以Redis为准
+
+const maxReconcileDetails = 100 // 报告中最多保留的差异明细条数
+
+var ErrorReconcileRunning = errors.New("对账任务正在执行")
+
+// ReconcileReport 对账结果
+type ReconcileReport struct {
+	StartTime      time.Time `json:"start_time"`
+	Duration       string    `json:"duration"`
+	Repair         bool      `json:"repair"`           // 是否修复发现的问题
+	Posts          int       `json:"posts"`            // 检查的MySQL帖子数
+	MissingInRedis int       `json:"missing_in_redis"` // Redis中缺失排序数据的帖子数
+	RedisPosts     int       `json:"redis_posts"`      // 检查的Redis帖子id数（post:time和post:score分别计数）
+	OrphanInRedis  int       `json:"orphan_in_redis"`  // MySQL中不存在、已删除或被移除的帖子数
+	VotePosts      int       `json:"vote_posts"`       // 检查投票记录的帖子数
+	VoteMismatch   int       `json:"vote_mismatch"`    // 不一致的用户投票记录条数
+	Repaired       int       `json:"repaired"`         // 修复的问题数，不修复时为0
+	Details        []string  `json:"details"`          // 差异明细，最多保留maxReconcileDetails条
+	Error          string    `json:"error,omitempty"`  // 对账中断时的错误信息
+}
+
+func (r *ReconcileReport) addDetail(format string, args ...interface{}) {
+	if len(r.Details) < maxReconcileDetails {
+		r.Details = append(r.Details, fmt.Sprintf(format, args...))
+	}
+}
+
+var (
+	reconcileMu sync.Mutex // 同一时间只执行一次对账
+
+	reportMu   sync.RWMutex
+	lastReport *ReconcileReport // 最近一次的对账结果
+)
+
+// StartReconciler 启动对账后台任务
+// 参数 interval: 对账任务的执行间隔
+// 参数 batchSize: 每批检查的帖子数量
+// 参数 repair: 是否修复发现的问题，为false时只记录
+// 返回值: 停止对账任务的函数，会等待正在执行的对账完成
+// interval不大于0时不启动定期对账，只能通过管理员接口手动触发
+func StartReconciler(interval time.Duration, batchSize int64, repair bool) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// 启动时不立即执行，等服务稳定后再开始对账
+				_, _ = Reconcile(batchSize, repair)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// GetLastReconcileReport 获取最近一次的对账结果，还没有执行过对账时返回nil
+func GetLastReconcileReport() *ReconcileReport {
+	reportMu.RLock()
+	defer reportMu.RUnlock()
+	return lastReport
+}
+
+// Reconcile 执行一次对账
+// 已经有对账在执行时返回ErrorReconcileRunning
+func Reconcile(batchSize int64, repair bool) (report *ReconcileReport, err error) {
+	if !reconcileMu.TryLock() {
+		return nil, ErrorReconcileRunning
+	}
+	defer reconcileMu.Unlock()
+
+	target, err := redis.GetVoteTarget(models.VoteTargetPost)
+	if err != nil {
+		return nil, err
+	}
+	report = &ReconcileReport{StartTime: time.Now(), Repair: repair}
+	err = reconcileMissingPosts(report, target, batchSize)
+	if err == nil {
+		err = reconcileOrphanPosts(report, batchSize)
+	}
+	if err == nil {
+		err = reconcileVotes(report, target, batchSize)
+	}
+	report.Duration = time.Since(report.StartTime).String()
+
+	fields := []zap.Field{
+		zap.Bool("repair", repair),
+		zap.Int("posts", report.Posts),
+		zap.Int("missingInRedis", report.MissingInRedis),
+		zap.Int("redisPosts", report.RedisPosts),
+		zap.Int("orphanInRedis", report.OrphanInRedis),
+		zap.Int("votePosts", report.VotePosts),
+		zap.Int("voteMismatch", report.VoteMismatch),
+		zap.Int("repaired", report.Repaired),
+		zap.String("duration", report.Duration),
+	}
+	if err != nil {
+		report.Error = err.Error()
+		zap.L().Error("reconcile mysql and redis failed", append(fields, zap.Error(err))...)
+	} else {
+		zap.L().Info("reconcile mysql and redis", fields...)
+	}
+
+	reportMu.Lock()
+	lastReport = report
+	reportMu.Unlock()
+	return report, err
+}
+
+// reconcileMissingPosts 检查MySQL中状态正常的帖子在Redis中是否有完整的排序数据
+func reconcileMissingPosts(report *ReconcileReport, target *redis.VoteTarget, batchSize int64) error {
+	var lastID int64
+	for {
+		posts, err := mysql.GetPostListAfterID(lastID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+		lastID = posts[len(posts)-1].ID
+		report.Posts += len(posts)
+
+		query := make([]*redis.PostRankState, 0, len(posts))
+		for _, p := range posts {
+			query = append(query, &redis.PostRankState{PostID: p.ID, CommunityID: p.CommunityID})
+		}
+		current, err := redis.GetPostRankStates(query, false)
+		if err != nil {
+			return err
+		}
+		missing := make([]*models.Post, 0)
+		for i, s := range current {
+			if s.Time != 0 && s.Score != 0 && s.InCommunity {
+				continue
+			}
+			report.MissingInRedis++
+			report.addDetail("post %d: missing in redis (time=%v score=%v community=%v)",
+				s.PostID, s.Time != 0, s.Score != 0, s.InCommunity)
+			missing = append(missing, posts[i])
+		}
+		if !report.Repair || len(missing) == 0 {
+			continue
+		}
+
+		// 分数按MySQL中的投票记录计算，与重建时的计分方式一致
+		states, err := expectedPostRankStates(target, missing)
+		if err != nil {
+			return err
+		}
+		if err = redis.AddPostRankNX(states); err != nil {
+			return err
+		}
+		report.Repaired += len(states)
+	}
+}
+
+// reconcileOrphanPosts 检查post:time和post:score中的帖子在MySQL中是否存在且状态正常
+func reconcileOrphanPosts(report *ReconcileReport, batchSize int64) error {
+	for _, order := range []string{models.OrderTime, models.OrderScore} {
+		var cursor uint64
+		for {
+			ids, next, err := redis.ScanPostIDs(order, cursor, batchSize)
+			if err != nil {
+				return err
+			}
+			report.RedisPosts += len(ids)
+			if err = reconcileOrphanBatch(report, ids); err != nil {
+				return err
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil
+}
+
+// reconcileOrphanBatch 检查一批Redis中的帖子id
+func reconcileOrphanBatch(report *ReconcileReport, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	posts, err := mysql.GetPostListByIDs(ids)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]*models.Post, len(posts))
+	for _, p := range posts {
+		found[strconv.FormatInt(p.ID, 10)] = p
+	}
+
+	notExist := make([]string, 0)
+	for _, id := range ids {
+		post, ok := found[id]
+		if ok && post.Status == models.PostStatusNormal {
+			continue
+		}
+		report.OrphanInRedis++
+		if !ok {
+			report.addDetail("post %s: in redis but not in mysql", id)
+			notExist = append(notExist, id)
+			continue
+		}
+		report.addDetail("post %s: in redis but status is %d in mysql", id, post.Status)
+		if !report.Repair {
+			continue
+		}
+		// 已删除或被移除的帖子知道所属社区，按删除帖子的方式一起清理社区集合
+		if err = redis.DeletePost(post.ID, post.CommunityID); err != nil {
+			return err
+		}
+		report.Repaired++
+	}
+	if !report.Repair || len(notExist) == 0 {
+		return nil
+	}
+	if err = redis.RemovePostRank(notExist...); err != nil {
+		return err
+	}
+	report.Repaired += len(notExist)
+	return nil
+}
+
+// reconcileVotes 检查投票时间窗口内帖子的用户投票记录
+// 时间窗口外的帖子投票记录已经归档，Redis中不再保存，不需要检查
+func reconcileVotes(report *ReconcileReport, target *redis.VoteTarget, batchSize int64) error {
+	for offset := int64(0); ; offset += batchSize {
+		ids, err := redis.GetVoteActiveTargets(target, offset, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		report.VotePosts += len(ids)
+		if err = reconcileVoteBatch(report, target, ids); err != nil {
+			return err
+		}
+		if int64(len(ids)) < batchSize {
+			return nil
+		}
+	}
+}
+
+// reconcileVoteBatch 对比一批帖子的投票记录
+// 修复的记录使用读取Redis之前的时间作为投票时间，写入时只覆盖比它更早的记录：
+// 读取Redis之后用户又投了票，队列写入的新投票时间更晚，不会被修复写入的旧值覆盖，先写入的也不会被覆盖
+// 投票队列中还没写入MySQL的投票同样被当作不一致，修复写入的值与它相同，队列之后写入还是丢弃结果都一样
+func reconcileVoteBatch(report *ReconcileReport, target *redis.VoteTarget, ids []string) error {
+	tids := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		tid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return err
+		}
+		tids = append(tids, tid)
+	}
+	snapshot := time.Now().UnixMilli()
+	redisVoted, err := redis.GetTargetVotedList(target, ids)
+	if err != nil {
+		return err
+	}
+	// 在投票记录之后读取：读取之间有人投票时标记被删除，按丢失处理，恢复时发现投票记录已存在不会覆盖
+	cleared, err := redis.GetTargetClearedList(target, ids)
+	if err != nil {
+		return err
+	}
+	votes, err := mysql.GetVoteListByTargetIDs(target.Type, tids)
+	if err != nil {
+		return err
+	}
+	mysqlVoted := make(map[int64]map[int64]int8, len(tids))
+	for _, v := range votes {
+		if mysqlVoted[v.TargetID] == nil {
+			mysqlVoted[v.TargetID] = make(map[int64]int8)
+		}
+		mysqlVoted[v.TargetID][v.UserID] = v.VoteType
+	}
+
+	fixes := make([]*models.Vote, 0)
+	lost := make([]string, 0)
+	for i, tid := range tids {
+		saved := mysqlVoted[tid]
+		// 有效投票被取消到一票不剩时zset会被删除，投票脚本会留下取消标记，没有标记时是Redis数据丢失
+		// 这种情况以vote表为准恢复，不能把MySQL中唯一的一份投票数据改为取消
+		if len(redisVoted[i]) == 0 && !cleared[i] {
+			if len(saved) > 0 {
+				report.VoteMismatch += len(saved)
+				report.addDetail("post %d: voted set missing in redis, %d votes in mysql", tid, len(saved))
+				lost = append(lost, ids[i])
+			}
+			continue
+		}
+		for uid, score := range redisVoted[i] {
+			userID, err := strconv.ParseInt(uid, 10, 64)
+			if err != nil {
+				return err
+			}
+			want := int8(score)
+			if got, ok := saved[userID]; ok && got == want {
+				continue
+			}
+			report.VoteMismatch++
+			report.addDetail("post %d: user %d vote %d in redis, %d in mysql", tid, userID, want, saved[userID])
+			fixes = append(fixes, &models.Vote{TargetType: target.Type, TargetID: tid, UserID: userID, VoteType: want, VoteTime: snapshot})
+		}
+		// MySQL中有投票而Redis中没有，说明用户已经取消投票，MySQL中改为取消
+		for userID, got := range saved {
+			if _, ok := redisVoted[i][strconv.FormatInt(userID, 10)]; ok {
+				continue
+			}
+			report.VoteMismatch++
+			report.addDetail("post %d: user %d vote missing in redis, %d in mysql", tid, userID, got)
+			fixes = append(fixes, &models.Vote{TargetType: target.Type, TargetID: tid, UserID: userID, VoteType: 0, VoteTime: snapshot})
+		}
+	}
+	if !report.Repair {
+		return nil
+	}
+	if len(fixes) > 0 {
+		if err = mysql.BatchSaveVoteData(fixes); err != nil {
+			return err
+		}
+		report.Repaired += len(fixes)
+	}
+	return restoreLostVoted(report, target, lost)
+}
+
+// restoreLostVoted 按vote表恢复Redis中丢失的帖子投票记录
+// 写入前会再次确认投票记录不存在，读取之后有用户投了票的帖子不会被覆盖
+func restoreLostVoted(report *ReconcileReport, target *redis.VoteTarget, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	posts, err := mysql.GetPostListByIDs(ids)
+	if err != nil {
+		return err
+	}
+	states, err := expectedPostRankStates(target, posts)
+	if err != nil {
+		return err
+	}
+	// 已经过了投票时间窗口的帖子Voted为nil，由投票归档任务处理
+	restore := make([]*redis.PostRankState, 0, len(states))
+	for _, s := range states {
+		if len(s.Voted) > 0 {
+			restore = append(restore, s)
+		}
+	}
+	restored, err := redis.RestorePostVotedNX(restore)
+	if err != nil {
+		return err
+	}
+	for i, ok := range restored {
+		if ok {
+			report.Repaired += len(restore[i].Voted)
+		}
+	}
+	return nil
+}
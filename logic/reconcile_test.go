@@ -0,0 +1,199 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// millisBetween 匹配落在[from, to]之间的毫秒时间戳参数
+type millisBetween struct{ from, to int64 }
+
+func (b *millisBetween) Match(v driver.Value) bool {
+	n, ok := v.(int64)
+	return ok && n >= b.from && n <= b.to
+}
+
+func TestReconcile(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	postColumns := []string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	posts := func() *sqlmock.Rows {
+		return sqlmock.NewRows(postColumns).
+			AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, created).
+			AddRow(2, "t2", "c2", 100, 10, models.PostStatusNormal, created.Add(time.Second))
+	}
+
+	// Redis中缺少2号帖子，多出MySQL中不存在的3号帖子；1号帖子的投票记录与MySQL不一致
+	m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, float64(created.Unix()), "1")
+	m.ZAdd(redis.Prefix+redis.KeyPostScoreZSet, float64(created.Unix()), "1")
+	m.SAdd(redis.Prefix+redis.KeyCommunitySetPF+"10", "1")
+	m.ZAdd(redis.Prefix+redis.KeyPostTimeZSet, float64(created.Unix()), "3")
+	m.ZAdd(redis.Prefix+redis.KeyPostScoreZSet, float64(created.Unix()), "3")
+	m.ZAdd(redis.Prefix+redis.KeyPostVotedZSetPF+"1", 1, "100")
+	m.ZAdd(redis.Prefix+redis.KeyPostVotedZSetPF+"1", -1, "101")
+
+	// 缺失的帖子
+	mock.ExpectQuery("from post").WithArgs(0, models.PostStatusNormal, 10).WillReturnRows(posts())
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "user_id", "vote_type"}))
+	mock.ExpectQuery("from post_lock").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"post_id"}))
+	mock.ExpectQuery("from post").WithArgs(2, models.PostStatusNormal, 10).WillReturnRows(sqlmock.NewRows(postColumns))
+	// 孤儿帖子，post:time和post:score各查一次
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	// 投票记录：MySQL中少了101的反对票，102的赞成票在Redis中已经取消
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "user_id", "vote_type"}).
+			AddRow(1, 1, 100, 1).
+			AddRow(1, 1, 102, 1))
+	// 修复写入的投票时间是读取Redis时的时间
+	now := time.Now()
+	snapshot := &millisBetween{from: now.UnixMilli(), to: now.Add(time.Minute).UnixMilli()}
+	mock.ExpectExec("INSERT INTO vote").
+		WithArgs(models.VoteTargetPost, 1, 101, -1, snapshot, models.VoteTargetPost, 1, 102, 0, snapshot).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	report, err := Reconcile(10, true)
+	if err != nil {
+		t.Fatalf("Reconcile failed, err:%v", err)
+	}
+	if report.Posts != 2 || report.MissingInRedis != 1 || report.RedisPosts != 5 || report.OrphanInRedis != 1 ||
+		report.VotePosts != 2 || report.VoteMismatch != 2 || report.Repaired != 4 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if ok, _ := m.SIsMember(redis.Prefix+redis.KeyCommunitySetPF+"10", "2"); !ok {
+		t.Fatal("missing post 2 not added")
+	}
+	if members, _ := m.ZMembers(redis.Prefix + redis.KeyPostTimeZSet); len(members) != 2 {
+		t.Fatalf("post:time got %v, orphan post 3 not removed", members)
+	}
+	if GetLastReconcileReport() != report {
+		t.Fatal("last report not saved")
+	}
+}
+
+func TestReconcileRestoresLostVoted(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	// Redis数据全部丢失，MySQL中1号帖子有三条有效投票
+	postColumns := []string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}
+	voteColumns := []string{"target_type", "target_id", "user_id", "vote_type"}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	posts := func() *sqlmock.Rows {
+		return sqlmock.NewRows(postColumns).AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, created)
+	}
+	votes := func() *sqlmock.Rows {
+		return sqlmock.NewRows(voteColumns).
+			AddRow(1, 1, 100, 1).
+			AddRow(1, 1, 101, -1).
+			AddRow(1, 1, 102, 1)
+	}
+
+	// 补齐缺失的帖子
+	mock.ExpectQuery("from post").WithArgs(0, models.PostStatusNormal, 10).WillReturnRows(posts())
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1).WillReturnRows(votes())
+	mock.ExpectQuery("from post_lock").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"post_id"}))
+	mock.ExpectQuery("from post").WithArgs(1, models.PostStatusNormal, 10).WillReturnRows(sqlmock.NewRows(postColumns))
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	// 投票记录在Redis中不存在，按vote表恢复，不写入vote表
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1).WillReturnRows(votes())
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1).WillReturnRows(votes())
+	mock.ExpectQuery("from post_lock").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"post_id"}))
+
+	report, err := Reconcile(10, true)
+	if err != nil {
+		t.Fatalf("Reconcile failed, err:%v", err)
+	}
+	if report.MissingInRedis != 1 || report.VoteMismatch != 3 || report.Repaired != 4 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	votedKey := redis.Prefix + redis.KeyPostVotedZSetPF + "1"
+	for uid, want := range map[string]float64{"100": 1, "101": -1, "102": 1} {
+		if got, err := m.ZScore(votedKey, uid); err != nil || got != want {
+			t.Fatalf("vote of user %s got %v, %v", uid, got, err)
+		}
+	}
+	if score, _ := m.ZScore(redis.Prefix+redis.KeyPostScoreZSet, "1"); score != float64(created.Unix())+432 {
+		t.Fatalf("score of post 1 got %v", score-float64(created.Unix()))
+	}
+
+	// 恢复之后两边一致，再次对账没有差异
+	mock.ExpectQuery("from post").WithArgs(0, models.PostStatusNormal, 10).WillReturnRows(posts())
+	mock.ExpectQuery("from post").WithArgs(1, models.PostStatusNormal, 10).WillReturnRows(sqlmock.NewRows(postColumns))
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	mock.ExpectQuery("where post_id in").WillReturnRows(posts())
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1).WillReturnRows(votes())
+	if report, err = Reconcile(10, true); err != nil || report.VoteMismatch != 0 || report.Repaired != 0 {
+		t.Fatalf("Reconcile after restore got %+v, %v", report, err)
+	}
+}
+
+func TestReconcileKeepsCancelledLastVote(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	postColumns := []string{"post_id", "title", "content", "author_id", "community_id", "status", "create_time"}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := redis.CreatePost(1, 10, created); err != nil {
+		t.Fatalf("redis.CreatePost failed, err:%v", err)
+	}
+	// 1号帖子唯一的一票被取消，post:voted:1被删除，取消投票还没有从队列写入MySQL
+	if err := redis.VoteForPost("100", "1", 1); err != nil {
+		t.Fatalf("redis.VoteForPost failed, err:%v", err)
+	}
+	if err := redis.VoteForPost("100", "1", 0); err != nil {
+		t.Fatalf("redis.VoteForPost cancel failed, err:%v", err)
+	}
+	target, _ := redis.GetVoteTarget(models.VoteTargetPost)
+	if m.Exists(target.VotedKey("1")) || !m.Exists(target.ClearedKey("1")) {
+		t.Fatal("cancelling the last vote should delete the voted set and leave the cleared marker")
+	}
+
+	// 对账以Redis为准把vote表中的投票改为取消，不恢复已经取消的投票
+	mock.ExpectQuery("from post").WithArgs(0, models.PostStatusNormal, 10).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, created))
+	mock.ExpectQuery("from post").WithArgs(1, models.PostStatusNormal, 10).WillReturnRows(sqlmock.NewRows(postColumns))
+	mock.ExpectQuery("where post_id in").
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, created))
+	mock.ExpectQuery("where post_id in").
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(1, "t1", "c1", 100, 10, models.PostStatusNormal, created))
+	mock.ExpectQuery("from vote").WithArgs(models.VoteTargetPost, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "user_id", "vote_type"}).AddRow(1, 1, 100, 1))
+	now := time.Now()
+	snapshot := &millisBetween{from: now.UnixMilli(), to: now.Add(time.Minute).UnixMilli()}
+	mock.ExpectExec("INSERT INTO vote").WithArgs(models.VoteTargetPost, 1, 100, 0, snapshot).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, err := Reconcile(10, true)
+	if err != nil {
+		t.Fatalf("Reconcile failed, err:%v", err)
+	}
+	if report.VoteMismatch != 1 || report.Repaired != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if m.Exists(target.VotedKey("1")) {
+		t.Fatal("cancelled vote restored into redis")
+	}
+	if score, _ := m.ZScore(redis.Prefix+redis.KeyPostScoreZSet, "1"); score != float64(created.Unix()) {
+		t.Fatalf("score of post 1 got %v", score-float64(created.Unix()))
+	}
+
+	// 再次投票后删除标记，之后投票记录丢失时仍然可以恢复
+	if err := redis.VoteForPost("101", "1", 1); err != nil {
+		t.Fatalf("redis.VoteForPost failed, err:%v", err)
+	}
+	if m.Exists(target.ClearedKey("1")) {
+		t.Fatal("cleared marker not removed by a new vote")
+	}
+}
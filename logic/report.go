@@ -0,0 +1,203 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/setting"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// 用户举报和处理
+// 举报按对象汇总到report_target表，未处理的举报数达到report.hide_threshold时自动隐藏帖子（status改为隐藏），
+// 隐藏的帖子与删除的帖子一样从Redis的排序集合中移除，等待管理员处理：
+//   举报成立   帖子改为被移除，不再恢复
+//   举报不成立 自动隐藏的帖子恢复正常，按MySQL中的投票记录重新写入Redis
+// 自动隐藏、处理举报都会写入所属社区的管理日志，自动隐藏的操作人为0
+
+var (
+	ErrorReportRepeated = errors.New("已经举报过")
+	ErrorReportNotExist = errors.New("举报不存在或已处理")
+)
+
+// reportHideThreshold 自动隐藏帖子的举报数，配置项report.hide_threshold，为0时不自动隐藏
+func reportHideThreshold() int64 {
+	if cfg := setting.Conf; cfg != nil && cfg.ReportConfig != nil {
+		return cfg.HideThreshold
+	}
+	return 0
+}
+
+// CreateReport 举报帖子
+// 同一用户对同一帖子只能举报一次，重复举报返回ErrorReportRepeated
+func CreateReport(userID int64, p *models.ParamReport) (err error) {
+	// 1. 被举报的帖子必须存在且状态正常，已经隐藏或移除的帖子用户看不到，也不能再举报
+	post, err := getNormalPost(p.TargetID)
+	if err != nil {
+		return err
+	}
+	// 2. 保存举报并累加帖子的未处理举报数
+	target, err := mysql.CreateReport(&models.ReportTarget{
+		TargetType:  p.TargetType,
+		TargetID:    post.ID,
+		CommunityID: post.CommunityID,
+	}, &models.Report{
+		ReporterID: userID,
+		Reason:     p.Reason,
+		Detail:     p.Detail,
+	})
+	if errors.Is(err, mysql.ErrorReportExist) {
+		return ErrorReportRepeated
+	}
+	if err != nil {
+		return err
+	}
+	// 3. 举报数达到阈值时自动隐藏，隐藏失败不影响本次举报，下一次举报时再试
+	threshold := reportHideThreshold()
+	if threshold <= 0 || target.ReportCount < threshold {
+		return nil
+	}
+	if err := hideReportedPost(post, target); err != nil {
+		zap.L().Error("hide reported post failed",
+			zap.Int64("pid", post.ID),
+			zap.Int64("reportCount", target.ReportCount),
+			zap.Error(err))
+	}
+	return nil
+}
+
+// hideReportedPost 自动隐藏被举报次数过多的帖子
+func hideReportedPost(post *models.Post, target *models.ReportTarget) error {
+	ok, err := mysql.HidePost(post.ID, &models.ModLog{
+		CommunityID: post.CommunityID,
+		Action:      models.ModActionHidePost,
+		TargetID:    post.ID,
+		Reason:      fmt.Sprintf("被举报%d次", target.ReportCount),
+	})
+	if err != nil || !ok {
+		// 帖子已经被隐藏、删除或移除
+		return err
+	}
+	zap.L().Info("reported post hidden",
+		zap.Int64("pid", post.ID),
+		zap.Int64("reportCount", target.ReportCount))
+	return redis.DeletePost(post.ID, post.CommunityID)
+}
+
+// GetReportList 按处理状态获取被举报对象列表，未处理的举报数多的在前
+func GetReportList(p *models.ParamReportList) ([]*models.ReportTarget, error) {
+	targets, err := mysql.GetReportTargetList(p.Status, p.Page, p.Size)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != models.ReportStatusOpen {
+		// 已处理的对象没有未处理的举报
+		return targets, nil
+	}
+	ids := make([]int64, 0, len(targets))
+	for _, t := range targets {
+		ids = append(ids, t.ID)
+	}
+	counts, err := mysql.GetReportReasonCounts(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		t.Reasons = counts[t.ID]
+	}
+	return targets, nil
+}
+
+// getOpenReportTarget 查询待处理的被举报对象
+func getOpenReportTarget(id int64) (*models.ReportTarget, error) {
+	target, err := mysql.GetReportTargetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrorReportNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if target.Status != models.ReportStatusOpen {
+		return nil, ErrorReportNotExist
+	}
+	return target, nil
+}
+
+// ResolveReport 举报成立，移除被举报的帖子
+// 参数 id: 被举报对象的id，即report_target表的id
+func ResolveReport(handlerID, id int64, p *models.ParamModeration) (err error) {
+	target, err := getOpenReportTarget(id)
+	if err != nil {
+		return err
+	}
+	ok, err := mysql.ResolvePostReport(target, handlerID, &models.ModLog{
+		CommunityID: target.CommunityID,
+		OperatorID:  handlerID,
+		Action:      models.ModActionRemovePost,
+		TargetID:    target.TargetID,
+		Reason:      p.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 查询之后被其他管理员处理了
+		return ErrorReportNotExist
+	}
+	// 正常状态的帖子还在Redis中，这里统一清理一次，自动隐藏时已经清理过的帖子重复清理没有影响
+	if err := redis.DeletePost(target.TargetID, target.CommunityID); err != nil {
+		zap.L().Error("redis.DeletePost failed", zap.Int64("pid", target.TargetID), zap.Error(err))
+	}
+	return nil
+}
+
+// DismissReport 举报不成立，自动隐藏的帖子恢复正常
+// 参数 id: 被举报对象的id，即report_target表的id
+func DismissReport(handlerID, id int64, p *models.ParamModeration) (err error) {
+	target, err := getOpenReportTarget(id)
+	if err != nil {
+		return err
+	}
+	ok, restored, err := mysql.DismissPostReport(target, handlerID, &models.ModLog{
+		CommunityID: target.CommunityID,
+		OperatorID:  handlerID,
+		TargetID:    target.TargetID,
+		Reason:      p.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrorReportNotExist
+	}
+	if !restored {
+		return nil
+	}
+	// 帖子隐藏时从Redis中移除了，按MySQL中的投票记录重新计算分数后写回
+	// 写回失败时由对账任务补齐，这里只记录日志
+	if err := restorePostRank(target.TargetID); err != nil {
+		zap.L().Error("restore post rank failed", zap.Int64("pid", target.TargetID), zap.Error(err))
+	}
+	return nil
+}
+
+// restorePostRank 把恢复正常的帖子重新写入Redis的排序集合
+func restorePostRank(pid int64) error {
+	post, err := mysql.GetPostById(pid)
+	if err != nil {
+		return err
+	}
+	target, err := redis.GetVoteTarget(models.VoteTargetPost)
+	if err != nil {
+		return err
+	}
+	states, err := expectedPostRankStates(target, []*models.Post{post})
+	if err != nil {
+		return err
+	}
+	return redis.AddPostRankNX(states)
+}
@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/setting"
+	"database/sql"
+	"errors"
+)
+
+// 用户角色
+// 角色保存在user_role表中，签发token时写入token，请求时由中间件从token中读取，不需要每次查询MySQL。
+// 授予或收回角色后，用户下一次刷新token时生效，最长延迟为access token的有效期。
+// 配置文件admin.user_ids中的用户始终拥有全局admin角色，用于初始化第一个管理员。
+
+var ErrorInvalidRole = errors.New("无效的角色")
+
+// GetUserRoles 获取用户的所有角色，包括配置文件中指定的管理员
+func GetUserRoles(userID int64) (models.Roles, error) {
+	roles, err := mysql.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	if isConfiguredAdmin(userID) && !roles.HasRole(models.RoleAdmin, 0) {
+		roles = append(roles, &models.UserRole{UserID: userID, Role: models.RoleAdmin})
+	}
+	return roles, nil
+}
+
+// GrantRole 授予用户角色
+// admin只能是全局角色；moderator必须指定社区，且社区必须存在
+func GrantRole(p *models.ParamUserRole) (err error) {
+	r := &models.UserRole{UserID: p.UserID, Role: p.Role, CommunityID: p.CommunityID}
+	if err = checkUserRole(r); err != nil {
+		return err
+	}
+	if _, err = mysql.GetUserById(r.UserID); err == sql.ErrNoRows {
+		return mysql.ErrorUserNotExist
+	}
+	if err != nil {
+		return err
+	}
+	return mysql.AddUserRole(r)
+}
+
+// RevokeRole 收回用户角色
+// 返回值 ok: 用户原本是否拥有该角色
+func RevokeRole(p *models.ParamUserRole) (ok bool, err error) {
+	r := &models.UserRole{UserID: p.UserID, Role: p.Role, CommunityID: p.CommunityID}
+	if err = checkUserRole(r); err != nil {
+		return false, err
+	}
+	return mysql.RemoveUserRole(r)
+}
+
+// checkUserRole 检查角色和社区的组合是否有效
+func checkUserRole(r *models.UserRole) error {
+	switch r.Role {
+	case models.RoleAdmin:
+		if r.CommunityID != 0 {
+			return ErrorInvalidRole
+		}
+		return nil
+	case models.RoleModerator:
+		if r.CommunityID == 0 {
+			return ErrorInvalidRole
+		}
+		return mysql.CheckCommunityExist(r.CommunityID)
+	default:
+		return ErrorInvalidRole
+	}
+}
+
+// isConfiguredAdmin 是否为配置文件admin.user_ids中的管理员
+func isConfiguredAdmin(userID int64) bool {
+	if setting.Conf == nil || setting.Conf.AdminConfig == nil {
+		return false
+	}
+	for _, id := range setting.Conf.AdminConfig.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
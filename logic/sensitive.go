@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/models"
+	"bluebell/pkg/sensitive"
+	"bluebell/setting"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// 帖子的敏感词过滤
+// 发帖和编辑帖子时检查标题和内容，命中敏感词时按配置项sensitive.action处理：
+//   reject 拒绝发布，返回ErrorSensitiveWord
+//   mask   敏感词替换为*后发布
+//   flag   原样发布，同时以系统身份（举报人为0）举报该帖子，由管理员在举报队列中审核
+// 每次都读取当前配置，修改配置文件后立即生效
+
+// sensitiveAction 命中敏感词时的处理方式，未配置或配置错误时按reject处理
+func sensitiveAction() string {
+	if cfg := setting.Conf; cfg != nil && cfg.SensitiveConfig != nil {
+		switch cfg.SensitiveConfig.Action {
+		case sensitive.ActionMask, sensitive.ActionFlag:
+			return cfg.SensitiveConfig.Action
+		}
+	}
+	return sensitive.ActionReject
+}
+
+// filterPostText 检查帖子的标题和内容，mask时直接替换其中的敏感词
+// 返回值 hits: flag时命中的敏感词（已去重），帖子保存后调用flagSensitivePost
+func filterPostText(title, content *string) (hits []string, err error) {
+	matches := append(sensitive.FindAll(*title), sensitive.FindAll(*content)...)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	switch sensitiveAction() {
+	case sensitive.ActionMask:
+		*title = sensitive.Mask(*title)
+		*content = sensitive.Mask(*content)
+		return nil, nil
+	case sensitive.ActionFlag:
+		seen := make(map[string]bool, len(matches))
+		for _, m := range matches {
+			if !seen[m.Word] {
+				seen[m.Word] = true
+				hits = append(hits, m.Word)
+			}
+		}
+		return hits, nil
+	default:
+		return nil, ErrorSensitiveWord
+	}
+}
+
+// flagSensitivePost 以系统身份举报命中敏感词的帖子
+// 帖子已经保存成功，举报失败只记录日志；系统已经举报过该帖子时不重复举报
+func flagSensitivePost(post *models.Post, hits []string) {
+	if len(hits) == 0 {
+		return
+	}
+	detail := strings.Join(hits, ",")
+	for utf8.RuneCountInString(detail) > 512 {
+		// 超出report.detail的长度时去掉后面的词
+		hits = hits[:len(hits)-1]
+		detail = strings.Join(hits, ",")
+	}
+	_, err := mysql.CreateReport(&models.ReportTarget{
+		TargetType:  models.ReportTargetPost,
+		TargetID:    post.ID,
+		CommunityID: post.CommunityID,
+	}, &models.Report{
+		Reason: models.ReportReasonSensitive,
+		Detail: detail,
+	})
+	if err != nil && !errors.Is(err, mysql.ErrorReportExist) {
+		zap.L().Error("flag sensitive post failed",
+			zap.Int64("pid", post.ID),
+			zap.Strings("words", hits),
+			zap.Error(err))
+	}
+}
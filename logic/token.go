@@ -0,0 +1,176 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/pkg/jwt"
+	"bluebell/setting"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 登录凭证的签发、刷新和吊销
+// 登录和刷新都会返回一对token：有效期很短的access token（JWT）和用于换取新token的refresh token，
+// refresh token每使用一次就会更换，详细规则见dao/redis/token.go
+
+const defaultRefreshTokenExpire = 30 * 24 * time.Hour // 未配置时refresh token的有效期
+
+var (
+	ErrorInvalidRefreshToken = errors.New("refresh token无效")
+	ErrorLoggedInElsewhere   = errors.New("账号已在其他设备登录")
+)
+
+// authConfig 登录凭证相关的配置，未配置时返回空的配置
+func authConfig() *setting.AuthConfig {
+	if cfg := setting.Conf; cfg != nil && cfg.AuthConfig != nil {
+		return cfg.AuthConfig
+	}
+	return new(setting.AuthConfig)
+}
+
+// refreshTokenExpire refresh token的有效期，配置项auth.refresh_token_expire，单位小时
+func refreshTokenExpire() time.Duration {
+	if h := authConfig().RefreshTokenExpire; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultRefreshTokenExpire
+}
+
+// singleSession 是否开启单会话模式，配置项auth.single_session
+// 开启后用户在新设备登录时，之前登录的设备会被踢下线
+func singleSession() bool {
+	return authConfig().SingleSession
+}
+
+// issueTokens 签发新会话的access token和refresh token，保存到user中
+func issueTokens(user *models.User) (err error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	family, err := randomToken()
+	if err != nil {
+		return err
+	}
+	if err = redis.CreateRefreshToken(hashToken(refreshToken), family, user.UserID, user.Username, refreshTokenExpire()); err != nil {
+		return err
+	}
+	// 不论是否开启单会话模式都记录最新的会话，开启时之前登录的设备立即失效
+	old, err := redis.SetUserSession(user.UserID, family, refreshTokenExpire())
+	if err != nil {
+		return err
+	}
+	if singleSession() && old != "" && old != family {
+		// 删除之前的会话，它的refresh token不能再换取新token
+		if err = redis.RevokeTokenFamily(old); err != nil {
+			return err
+		}
+	}
+	roles, err := GetUserRoles(user.UserID)
+	if err != nil {
+		return err
+	}
+	user.Token, _, err = jwt.GenToken(user.UserID, user.Username, family, roles.Strings())
+	if err != nil {
+		return err
+	}
+	user.RefreshToken = refreshToken
+	return nil
+}
+
+// RefreshToken 使用refresh token换取新的access token和refresh token
+func RefreshToken(p *models.ParamRefreshToken) (user *models.User, err error) {
+	newToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	userID, username, family, err := redis.RotateRefreshToken(hashToken(p.RefreshToken), hashToken(newToken), refreshTokenExpire())
+	if errors.Is(err, redis.ErrRefreshTokenReused) {
+		// 已经使用过的refresh token再次出现，它所属的会话已经被整体吊销
+		zap.L().Warn("refresh token reused, session revoked")
+		return nil, ErrorInvalidRefreshToken
+	}
+	if errors.Is(err, redis.ErrRefreshTokenInvalid) {
+		return nil, ErrorInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 每次刷新都重新读取角色，角色变更在刷新后生效
+	roles, err := GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	user = &models.User{UserID: userID, Username: username, RefreshToken: newToken}
+	user.Token, _, err = jwt.GenToken(userID, username, family, roles.Strings())
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Logout 退出登录
+// 吊销当前请求使用的access token，并删除它所属的会话，会话中的refresh token随之失效；
+// 请求中带有refresh token时，同时删除refresh token所属的会话
+// 参数 jti: 当前access token的id
+// 参数 sessionID: 当前access token所属的会话id
+// 参数 expiresAt: 当前access token的过期时间
+func Logout(userID int64, jti, sessionID string, expiresAt time.Time, p *models.ParamLogout) (err error) {
+	if err = redis.RevokeAccessToken(jti, time.Until(expiresAt)); err != nil {
+		return err
+	}
+	if sessionID != "" {
+		if err = redis.RevokeTokenFamily(sessionID); err != nil {
+			return err
+		}
+	}
+	if p.RefreshToken == "" {
+		return nil
+	}
+	return redis.RevokeRefreshToken(hashToken(p.RefreshToken), userID)
+}
+
+// IsTokenRevoked 查询access token是否已被吊销
+// 参数 sessionID: token所属的会话id，会话已被删除（退出登录、重置密码等）时token同样无效
+func IsTokenRevoked(jti, sessionID string) (bool, error) {
+	return redis.IsAccessTokenRevoked(jti, sessionID)
+}
+
+// CheckSession 单会话模式下检查token所属的会话是否为用户最近一次登录的会话
+// 未开启单会话模式、或者没有会话记录（如开启前签发的token）时不做限制
+// 返回值: 不是最近一次登录的会话时返回ErrorLoggedInElsewhere
+func CheckSession(userID int64, sessionID string) error {
+	if !singleSession() {
+		return nil
+	}
+	current, err := redis.GetUserSession(userID)
+	if err != nil {
+		return err
+	}
+	if current != "" && current != sessionID {
+		return ErrorLoggedInElsewhere
+	}
+	return nil
+}
+
+// randomToken 生成32字节的随机字符串
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken Redis中只保存refresh token的sha256，Redis数据泄露时无法直接使用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,274 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/pkg/totp"
+	"bluebell/setting"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 两步验证（TOTP）
+// 开启：POST /2fa/setup 生成密钥并返回otpauth URI，用户用验证器App扫码后提交验证码确认，
+//       确认时生成一组一次性恢复码，只返回这一次
+// 登录：校验密码成功后，开启了两步验证的用户只得到一个challenge token（有效期two_factor.challenge_expire），
+//       再提交challenge token和验证码（或恢复码）换取access token和refresh token
+// 验证码允许前后一个时间步的时钟误差，同一个验证码只能使用一次；每个challenge最多尝试maxChallengeAttempts次
+// 登录和关闭两步验证时验证码或恢复码错误与密码错误一样计入登录失败次数（见login_guard.go），
+// 用户名被锁定期间不再校验验证码，防止用密码不断获取新的challenge或用盗取的access token暴力尝试验证码
+
+const (
+	defaultTwoFactorIssuer   = "bluebell"
+	defaultChallengeExpire   = 5 * time.Minute
+	defaultRecoveryCodeCount = 10
+	maxChallengeAttempts     = 5
+	totpSkew                 = 1
+)
+
+var (
+	ErrorTwoFactorEnabled     = errors.New("已开启两步验证")
+	ErrorTwoFactorNotSetup    = errors.New("未开启两步验证")
+	ErrorInvalidTwoFactorCode = errors.New("验证码错误")
+	ErrorTwoFactorChallenge   = errors.New("两步验证已过期，请重新登录")
+)
+
+// twoFactorConfig 两步验证的配置，未配置的项使用默认值
+func twoFactorConfig() (issuer string, challengeExpire time.Duration, recoveryCodes int) {
+	issuer, challengeExpire, recoveryCodes = defaultTwoFactorIssuer, defaultChallengeExpire, defaultRecoveryCodeCount
+	cfg := setting.Conf
+	if cfg == nil || cfg.TwoFactorConfig == nil {
+		return
+	}
+	if cfg.TwoFactorIssuer != "" {
+		issuer = cfg.TwoFactorIssuer
+	}
+	if cfg.ChallengeExpire > 0 {
+		challengeExpire = time.Duration(cfg.ChallengeExpire) * time.Second
+	}
+	if cfg.RecoveryCodes > 0 {
+		recoveryCodes = cfg.RecoveryCodes
+	}
+	return
+}
+
+// getUserTOTP 查询用户的TOTP密钥，没有生成过密钥时返回nil
+func getUserTOTP(userID int64) (*models.UserTOTP, error) {
+	t, err := mysql.GetUserTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// SetupTwoFactor 为用户生成新的TOTP密钥，确认之前两步验证不生效
+// 重复调用会生成新的密钥，之前生成但未确认的密钥作废
+func SetupTwoFactor(userID int64) (*models.TwoFactorSetup, error) {
+	user, err := mysql.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := mysql.SaveTOTPSecret(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrorTwoFactorEnabled
+	}
+	issuer, _, _ := twoFactorConfig()
+	return &models.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor 校验验证器App上的验证码，正确时开启两步验证
+// 返回值 codes: 新生成的恢复码，只在这里返回一次
+func ConfirmTwoFactor(userID int64, p *models.ParamTwoFactorCode) (codes []string, err error) {
+	t, err := getUserTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrorTwoFactorNotSetup
+	}
+	if t.Enabled {
+		return nil, ErrorTwoFactorEnabled
+	}
+	counter, ok := totp.Validate(t.Secret, p.Code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrorInvalidTwoFactorCode
+	}
+	_, _, n := twoFactorConfig()
+	codes = make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	ok, err = mysql.EnableTOTP(userID, t.Secret, counter, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 确认期间重新生成了密钥，或者已经在其他请求中确认过
+		return nil, ErrorInvalidTwoFactorCode
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor 关闭两步验证，需要提交验证码或恢复码
+// 参数 ip: 客户端IP，用于统计验证码错误次数
+// 用户名或IP被锁定时返回*LoginLockedError
+func DisableTwoFactor(userID int64, p *models.ParamTwoFactorCode, ip string) error {
+	user, err := mysql.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkLoginLock(user.Username, ip); err != nil {
+		return err
+	}
+	t, err := getUserTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if t == nil || !t.Enabled {
+		return ErrorTwoFactorNotSetup
+	}
+	if err := checkTwoFactorCode(t, p.Code, user.Username, ip); err != nil {
+		return err
+	}
+	return mysql.DisableTOTP(userID)
+}
+
+// checkTwoFactorCode 校验验证码或恢复码，错误时计入用户名和IP的登录失败次数，正确时清除用户名的失败次数
+func checkTwoFactorCode(t *models.UserTOTP, code, username, ip string) error {
+	err := verifyTwoFactorCode(t, code)
+	if errors.Is(err, ErrorInvalidTwoFactorCode) {
+		recordLoginFailure(username, ip)
+	}
+	if err != nil {
+		return err
+	}
+	clearLoginFailure(username)
+	return nil
+}
+
+// verifyTwoFactorCode 校验验证码或恢复码，校验通过的验证码和恢复码都不能再次使用
+func verifyTwoFactorCode(t *models.UserTOTP, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return ErrorInvalidTwoFactorCode
+		}
+		ok, err := mysql.UseTOTPCounter(t.UserID, counter)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 验证码已经使用过
+			return ErrorInvalidTwoFactorCode
+		}
+		return nil
+	}
+	ok, err := mysql.UseRecoveryCode(t.UserID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrorInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// newRecoveryCode 生成一个恢复码，格式为 xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := hex.EncodeToString(b)
+	return s[:5] + "-" + s[5:], nil
+}
+
+// normalizeRecoveryCode 恢复码不区分大小写，可以省略中间的-
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// startTwoFactorLogin 开启了两步验证的用户校验密码成功后，生成challenge token保存到user中
+// 返回值 required: 用户是否开启了两步验证，为false时按原来的流程签发token
+func startTwoFactorLogin(user *models.User) (required bool, err error) {
+	t, err := getUserTOTP(user.UserID)
+	if err != nil {
+		return false, err
+	}
+	if t == nil || !t.Enabled {
+		return false, nil
+	}
+	token, err := randomToken()
+	if err != nil {
+		return false, err
+	}
+	_, expire, _ := twoFactorConfig()
+	if err = redis.CreateTwoFactorChallenge(hashToken(token), user.UserID, user.Username, expire); err != nil {
+		return false, err
+	}
+	user.ChallengeToken = token
+	return true, nil
+}
+
+// LoginTwoFactor 两步验证登录的第二步，校验验证码后签发token
+// 参数 ip: 客户端IP，用于统计验证码错误次数
+// 用户名或IP被锁定时返回*LoginLockedError
+func LoginTwoFactor(p *models.ParamLoginTwoFactor, ip string) (user *models.User, err error) {
+	tokenHash := hashToken(p.ChallengeToken)
+	userID, username, err := redis.VerifyTwoFactorChallenge(tokenHash, maxChallengeAttempts)
+	if errors.Is(err, redis.ErrTwoFactorChallengeInvalid) {
+		return nil, ErrorTwoFactorChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkLoginLock(username, ip); err != nil {
+		return nil, err
+	}
+	t, err := getUserTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || !t.Enabled {
+		// 校验密码之后关闭了两步验证，需要重新登录
+		return nil, ErrorTwoFactorChallenge
+	}
+	if err = checkTwoFactorCode(t, p.Code, username, ip); err != nil {
+		return nil, err
+	}
+	ok, err := redis.DeleteTwoFactorChallenge(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 同一个challenge已经在其他请求中完成登录
+		return nil, ErrorTwoFactorChallenge
+	}
+	user = &models.User{UserID: userID, Username: username}
+	if err = issueTokens(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -5,15 +5,17 @@ package logic
 import (
 	"bluebell/dao/mysql"     // 导入MySQL数据访问层，用于用户数据操作
 	"bluebell/models"        // 导入数据模型，定义业务数据结构
-	"bluebell/pkg/jwt"       // 导入JWT工具包，用于生成身份令牌
 	"bluebell/pkg/snowflake" // 导入雪花算法包，用于生成唯一ID
+	"errors"                 // 导入错误处理包，用于判断登录失败的原因
+
+	"go.uber.org/zap" // 导入结构化日志包
 )
 
 // ==================== 用户业务逻辑处理 ====================
 
 // SignUp 用户注册业务逻辑
 // 处理用户注册的完整流程，包括用户存在性检查、ID生成、数据保存等
-// 参数 p: 注册参数，包含用户名和密码
+// 参数 p: 注册参数，包含用户名、密码和可选的邮箱
 // 返回值: 错误信息，成功时返回nil
 func SignUp(p *models.ParamSignUp) (err error) {
 	// ==================== 第一步：检查用户是否已存在 ====================
@@ -22,6 +24,8 @@ func SignUp(p *models.ParamSignUp) (err error) {
 		// 如果用户已存在，返回相应错误
 		return err
 	}
+	// 不检查邮箱是否已被使用，避免通过注册接口判断邮箱是否注册过
+	// 邮箱保存为未验证，验证时才检查是否已被其他用户验证
 
 	// ==================== 第二步：生成用户唯一ID ====================
 	// 使用雪花算法生成全局唯一的用户ID
@@ -33,43 +37,74 @@ func SignUp(p *models.ParamSignUp) (err error) {
 		UserID:   userID,
 		Username: p.Username,
 		Password: p.Password, // 注意：这里的密码应该已经在前端或控制器层进行了加密
+		Email:    p.Email,
 	}
 
 	// ==================== 第四步：保存用户数据到数据库 ====================
 	// 调用数据访问层将用户信息插入数据库
-	return mysql.InsertUser(user)
+	if err := mysql.InsertUser(user); err != nil {
+		return err
+	}
+
+	// ==================== 第五步：发送邮箱验证邮件 ====================
+	// 注册已经成功，发送失败只记录日志，用户可以登录后重新发送
+	if user.Email != "" {
+		if err := sendVerifyEmail(user); err != nil {
+			zap.L().Error("send verify email failed", zap.Int64("userID", user.UserID), zap.Error(err))
+		}
+	}
+	return nil
 }
 
 // Login 用户登录业务逻辑
 // 处理用户登录的完整流程，包括密码验证、JWT令牌生成等
 // 参数 p: 登录参数，包含用户名和密码
-// 返回值: 用户信息（包含JWT令牌）和错误信息
-func Login(p *models.ParamLogin) (user *models.User, err error) {
-	// ==================== 第一步：构造用户查询对象 ====================
+// 参数 ip: 客户端IP，用于统计登录失败次数
+// 返回值: 用户信息（包含JWT令牌）和错误信息，用户名或IP被锁定时返回*LoginLockedError
+// 开启了两步验证的用户只返回ChallengeToken，需要再调用LoginTwoFactor完成登录
+func Login(p *models.ParamLogin, ip string) (user *models.User, err error) {
+	// ==================== 第一步：检查是否被锁定 ====================
+	// 失败次数过多的用户名或IP在锁定期间直接拒绝，不再校验密码
+	if err := checkLoginLock(p.Username, ip); err != nil {
+		return nil, err
+	}
+
+	// ==================== 第二步：构造用户查询对象 ====================
 	// 创建用户实例，用于数据库查询
 	user = &models.User{
 		Username: p.Username,
 		Password: p.Password, // 注意：这里的密码应该已经在前端或控制器层进行了加密
 	}
 
-	// ==================== 第二步：验证用户登录信息 ====================
+	// ==================== 第三步：验证用户登录信息 ====================
 	// 调用数据访问层验证用户名和密码
 	// 传递的是指针，验证成功后能拿到user.UserID等完整信息
 	if err := mysql.Login(user); err != nil {
+		// 用户名不存在或密码错误时记录失败次数
+		if errors.Is(err, mysql.ErrorUserNotExist) || errors.Is(err, mysql.ErrorInvalidPassword) {
+			recordLoginFailure(p.Username, ip)
+		}
 		// 登录验证失败，返回错误
-		return nil, err
+		return nil, uniformLoginError(err, p.Password)
 	}
 
-	// ==================== 第三步：生成JWT身份令牌 ====================
-	// 使用用户ID和用户名生成JWT令牌，用于后续接口的身份认证
-	token, err := jwt.GenToken(user.UserID, user.Username)
+	// ==================== 第四步：检查两步验证 ====================
+	// 开启了两步验证的用户只返回challenge token，提交验证码后再签发身份令牌
+	// 失败次数在两步验证通过后才清除，否则知道密码就能不断获取新的challenge尝试验证码
+	required, err := startTwoFactorLogin(user)
 	if err != nil {
-		// JWT生成失败，返回错误
-		return
+		return nil, err
 	}
+	if required {
+		return user, nil
+	}
+	clearLoginFailure(p.Username)
 
-	// ==================== 第四步：设置用户令牌信息 ====================
-	// 将生成的JWT令牌保存到用户对象中，返回给客户端
-	user.Token = token
+	// ==================== 第五步：签发身份令牌 ====================
+	// 生成短期有效的access token和用于换取新token的refresh token，用于后续接口的身份认证
+	if err = issueTokens(user); err != nil {
+		// 令牌签发失败，返回错误
+		return nil, err
+	}
 	return
 }
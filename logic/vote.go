@@ -1,8 +1,10 @@
 package logic
 
 import (
+	"bluebell/dao/queue"
 	"bluebell/dao/redis"
 	"bluebell/models"
+	"errors"
 	"strconv"
 
 	"go.uber.org/zap"
@@ -37,5 +39,24 @@ func VoteForPost(userID int64, p *models.ParamVoteData) error {
 		zap.Int64("userID", userID),
 		zap.String("postID", p.PostID),
 		zap.Int8("direction", p.Direction))
-	return redis.VoteForPost(strconv.Itoa(int(userID)), p.PostID, float64(p.Direction))
+	postID, err := strconv.ParseInt(p.PostID, 10, 64)
+	if err != nil {
+		return err
+	}
+	// 1. 更新Redis中的分数和投票记录
+	if err := redis.VoteForPost(strconv.Itoa(int(userID)), p.PostID, float64(p.Direction)); err != nil {
+		if errors.Is(err, redis.ErrVoteLocked) {
+			return ErrorPostLocked
+		}
+		return err
+	}
+	// 2. 投票记录放入投票队列，由队列批量写入MySQL
+	if err := queue.EnqueueVote(models.VoteTargetPost, postID, userID, p.Direction); err != nil {
+		// Redis中已经投票成功，这里只记录日志，不影响本次投票的结果
+		zap.L().Error("queue.EnqueueVote failed",
+			zap.Int64("userID", userID),
+			zap.Int64("postID", postID),
+			zap.Error(err))
+	}
+	return nil
 }
@@ -0,0 +1,171 @@
+package logic
+
+import (
+	"bluebell/dao/mysql"
+	"bluebell/dao/redis"
+	"bluebell/models"
+	"bluebell/setting"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 投票归档
+// 对象的投票时间窗口结束后不再接受投票，此时把Redis中的赞成票数和反对票数写入MySQL的vote_archive表，
+// 再删除记录用户投票情况的zset，避免Redis中的投票记录无限增长。
+// 归档进度（已处理到的对象创建时间）保存在Redis中，每次从上次的进度继续向后处理。
+
+const (
+	defaultArchiveInterval  = 5 * time.Minute // 未配置时归档任务的执行间隔
+	defaultArchiveBatchSize = 100             // 未配置时每批处理的对象数量
+)
+
+// StartVoteArchiver 启动投票归档后台任务
+// 参数 cfg: 归档配置，为nil或者配置项为0时使用默认值；archive_interval小于0时不启动归档任务
+// 返回值: 停止归档任务的函数，会等待正在执行的归档完成
+func StartVoteArchiver(cfg *setting.VoteConfig) (stop func()) {
+	interval, batchSize := defaultArchiveInterval, int64(defaultArchiveBatchSize)
+	if cfg != nil {
+		if cfg.ArchiveInterval != 0 {
+			interval = time.Duration(cfg.ArchiveInterval) * time.Second
+		}
+		if cfg.ArchiveBatchSize > 0 {
+			batchSize = cfg.ArchiveBatchSize
+		}
+	}
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ArchiveExpiredVotes(batchSize)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// ArchiveExpiredVotes 归档所有已注册投票对象中投票时间窗口已结束的对象
+func ArchiveExpiredVotes(batchSize int64) {
+	for _, target := range redis.ListVoteTargets() {
+		n, err := archiveTargetVotes(target, batchSize)
+		if err != nil {
+			zap.L().Error("archiveTargetVotes failed",
+				zap.String("namespace", target.Namespace),
+				zap.Int("archived", n),
+				zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			zap.L().Info("archive expired votes",
+				zap.String("namespace", target.Namespace),
+				zap.Int("archived", n))
+		}
+	}
+}
+
+// archiveTargetVotes 归档一种投票对象
+// 返回值: 本次归档的对象数量
+func archiveTargetVotes(target *redis.VoteTarget, batchSize int64) (archived int, err error) {
+	if batchSize <= 0 {
+		// 每批0个对象时offset不会前进，循环永远不会结束
+		batchSize = defaultArchiveBatchSize
+	}
+	cursor, err := redis.GetArchiveCursor(target)
+	if err != nil {
+		return
+	}
+	next := cursor
+	for offset := int64(0); ; offset += batchSize {
+		items, err := redis.GetVoteExpiredTargets(target, cursor, offset, batchSize)
+		if err != nil {
+			return archived, err
+		}
+		for _, item := range items {
+			targetID := item.Member.(string)
+			ok, err := archiveTargetVote(target, targetID)
+			if err != nil {
+				// 当前对象归档失败，进度停在它之前，下次从这里重试
+				if next > cursor {
+					_ = redis.SetArchiveCursor(target, next)
+				}
+				return archived, err
+			}
+			if ok {
+				archived++
+			}
+			next = item.Score
+		}
+		if int64(len(items)) < batchSize {
+			break
+		}
+	}
+	// 进度包含等于next的创建时间，同一秒内的对象下次会再被扫描一遍，
+	// 它们的投票记录已经删除，archiveTargetVote会直接跳过
+	if next > cursor {
+		err = redis.SetArchiveCursor(target, next)
+	}
+	return
+}
+
+// getPostVoteData 查询每篇帖子的赞成票数，已归档的帖子使用MySQL中的归档数据
+func getPostVoteData(ids []string) ([]int64, error) {
+	return getVoteData(models.VoteTargetPost, ids)
+}
+
+// getVoteData 查询每个投票对象的赞成票数
+// 先从Redis中统计，Redis中没有投票记录的对象回退到MySQL中的归档数据
+func getVoteData(tt models.VoteTargetType, ids []string) (data []int64, err error) {
+	data, missing, err := redis.GetVoteData(tt, ids)
+	if err != nil || len(missing) == 0 {
+		return data, err
+	}
+	archives, err := mysql.GetVoteArchiveByIDs(tt, missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		tid, _ := strconv.ParseInt(id, 10, 64)
+		if a, ok := archives[tid]; ok {
+			data[i] = a.UpVotes
+		}
+	}
+	return data, nil
+}
+
+// archiveTargetVote 归档单个对象的投票数
+// 返回值 ok: 是否写入了归档数据，没有投票记录（没人投票或已归档）时为false
+func archiveTargetVote(target *redis.VoteTarget, targetID string) (ok bool, err error) {
+	up, down, exists, err := redis.GetTargetVoteCount(target, targetID)
+	if err != nil || !exists {
+		return false, err
+	}
+	tid, err := strconv.ParseInt(targetID, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	err = mysql.SaveVoteArchive(&models.VoteArchive{
+		TargetType: target.Type,
+		TargetID:   tid,
+		UpVotes:    up,
+		DownVotes:  down,
+	})
+	if err != nil {
+		return false, err
+	}
+	// 先写MySQL再删Redis，删除失败时下次会重新归档，结果相同
+	return true, redis.DeleteTargetVoted(target, targetID)
+}
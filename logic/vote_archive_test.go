@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"bluebell/setting"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestArchiveTargetVotes(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	target, _ := redis.GetVoteTarget(models.VoteTargetPost)
+	now := float64(time.Now().Unix())
+	expired := now - target.Window.Seconds() - 3600
+	// 1、2、3号帖子已经过了投票时间窗口，2号帖子没有人投票；4号帖子仍然可以投票
+	for i, id := range []string{"1", "2", "3"} {
+		m.ZAdd(target.TimeKey(), expired+float64(i), id)
+	}
+	m.ZAdd(target.TimeKey(), now, "4")
+	m.ZAdd(target.VotedKey("1"), 1, "100")
+	m.ZAdd(target.VotedKey("1"), 1, "101")
+	m.ZAdd(target.VotedKey("1"), -1, "102")
+	m.ZAdd(target.VotedKey("3"), -1, "100")
+	m.ZAdd(target.VotedKey("4"), 1, "100")
+
+	mock.ExpectExec("REPLACE INTO vote_archive").
+		WithArgs(models.VoteTargetPost, 1, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("REPLACE INTO vote_archive").
+		WithArgs(models.VoteTargetPost, 3, 0, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 每批2个对象，需要翻页才能处理完
+	n, err := archiveTargetVotes(target, 2)
+	if err != nil || n != 2 {
+		t.Fatalf("archiveTargetVotes got %d, %v", n, err)
+	}
+	if m.Exists(target.VotedKey("1")) || m.Exists(target.VotedKey("3")) {
+		t.Fatal("voted zset of archived post not deleted")
+	}
+	if !m.Exists(target.VotedKey("4")) {
+		t.Fatal("voted zset of active post deleted")
+	}
+	if cursor, _ := redis.GetArchiveCursor(target); cursor != expired+2 {
+		t.Fatalf("cursor got %v, want %v", cursor, expired+2)
+	}
+
+	// batchSize为0时使用默认值，已经归档的帖子不会再写MySQL
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err = archiveTargetVotes(target, 0)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("archiveTargetVotes with batch size 0 did not return")
+	}
+	if err != nil || n != 0 {
+		t.Fatalf("archiveTargetVotes again got %d, %v", n, err)
+	}
+}
+
+func TestGetVoteDataFallback(t *testing.T) {
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+
+	target, _ := redis.GetVoteTarget(models.VoteTargetPost)
+	m.ZAdd(target.VotedKey("1"), 1, "100")
+	m.ZAdd(target.VotedKey("1"), -1, "101")
+
+	// 2号帖子在Redis中没有投票记录，使用归档数据
+	mock.ExpectQuery("from vote_archive").
+		WithArgs(models.VoteTargetPost, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"target_type", "target_id", "up_votes", "down_votes"}).
+			AddRow(1, 2, 5, 3))
+
+	data, err := getPostVoteData([]string{"1", "2"})
+	if err != nil {
+		t.Fatalf("getPostVoteData failed, err:%v", err)
+	}
+	if len(data) != 2 || data[0] != 1 || data[1] != 5 {
+		t.Fatalf("getPostVoteData got %v, want [1 5]", data)
+	}
+}
+
+func TestStartVoteArchiver(t *testing.T) {
+	// archive_interval小于0时不启动归档任务，stop直接返回
+	StartVoteArchiver(&setting.VoteConfig{ArchiveInterval: -1})()
+
+	// 没有配置时使用默认值，启动后立即执行一次归档
+	m := testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	target, _ := redis.GetVoteTarget(models.VoteTargetPost)
+	m.ZAdd(target.TimeKey(), float64(time.Now().Unix())-target.Window.Seconds()-1, "1")
+	m.ZAdd(target.VotedKey("1"), 1, "100")
+	mock.ExpectExec("REPLACE INTO vote_archive").
+		WithArgs(models.VoteTargetPost, 1, 1, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	StartVoteArchiver(nil)()
+	if m.Exists(target.VotedKey("1")) {
+		t.Fatal("archiver with nil config did not archive expired post")
+	}
+}
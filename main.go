@@ -5,13 +5,28 @@ package main
 import (
 	"bluebell/controller"    // 导入控制器包，处理HTTP请求
 	"bluebell/dao/mysql"     // 导入MySQL数据访问层
+	"bluebell/dao/outbox"    // 导入事务发件箱，把发帖事件转发到Redis
+	"bluebell/dao/queue"     // 导入投票队列，批量写入投票数据
 	"bluebell/dao/redis"     // 导入Redis数据访问层
 	"bluebell/logger"        // 导入日志包
+	"bluebell/logic"         // 导入业务逻辑层，用于启动后台任务
+	"bluebell/pkg/jwt"       // 导入JWT工具包，用于加载token签名密钥
+	"bluebell/pkg/mailer"    // 导入邮件发送包，用于发送验证邮箱和重置密码的邮件
+	"bluebell/pkg/oidc"      // 导入OIDC客户端，用于第三方登录
+	"bluebell/pkg/password"  // 导入密码哈希包，用于选择新密码的哈希算法
+	"bluebell/pkg/sensitive" // 导入敏感词过滤包，用于加载敏感词词库
 	"bluebell/pkg/snowflake" // 导入雪花算法包，用于生成唯一ID
 	"bluebell/router"        // 导入路由包
 	"bluebell/setting"       // 导入配置包
+	"context"                // 导入上下文包，用于控制优雅关机的超时时间
 	"fmt"                    // 导入格式化输出包
+	"net/http"               // 导入HTTP包，用于创建HTTP服务器
 	"os"                     // 导入操作系统接口包
+	"os/signal"              // 导入信号包，用于监听退出信号
+	"syscall"                // 导入系统调用包，提供信号常量
+	"time"                   // 导入时间包，用于设置后台任务的执行间隔和关机超时
+
+	"go.uber.org/zap" // 导入结构化日志包
 )
 
 // @title bluebell项目接口文档
@@ -70,21 +85,112 @@ func main() {
 		return
 	}
 
-	// ==================== 第六步：初始化验证器翻译器 ====================
+	// ==================== 第六步：初始化密码哈希算法 ====================
+	// 新密码使用配置的算法（bcrypt或argon2id），旧算法生成的哈希仍然可以校验，登录成功后自动迁移
+	if err := password.Init(setting.Conf.PasswordHasher); err != nil {
+		fmt.Printf("init password hasher failed, err:%v\n", err)
+		return
+	}
+
+	// ==================== 第七步：加载JWT签名密钥 ====================
+	// 签名密钥来自配置文件或环境变量，支持HS256、RS256、EdDSA以及多密钥轮换
+	if err := jwt.Init(setting.Conf.JWTConfig); err != nil {
+		fmt.Printf("init jwt keys failed, err:%v\n", err)
+		return
+	}
+
+	// ==================== 第八步：加载敏感词词库 ====================
+	// 发帖和编辑帖子时按词库过滤标题和内容，词库文件修改后自动重新加载
+	stopSensitive, err := sensitive.Init(setting.Conf.SensitiveConfig)
+	if err != nil {
+		fmt.Printf("init sensitive words failed, err:%v\n", err)
+		return
+	}
+	defer stopSensitive()
+
+	// ==================== 第九步：初始化邮件发送 ====================
+	// 注册验证邮箱和找回密码时发送邮件，发送方式由配置项mail.backend选择：smtp、file或log
+	if err := mailer.Init(setting.Conf.MailConfig); err != nil {
+		fmt.Printf("init mailer failed, err:%v\n", err)
+		return
+	}
+
+	// ==================== 第十步：加载第三方登录的身份提供方 ====================
+	// 身份提供方的接口地址和签名公钥在第一次登录时自动读取，身份提供方暂时不可用不影响启动
+	if err := oidc.Init(setting.Conf.OIDCConfig); err != nil {
+		fmt.Printf("init oidc providers failed, err:%v\n", err)
+		return
+	}
+
+	// ==================== 第十一步：初始化验证器翻译器 ====================
 	// 初始化Gin框架内置验证器的中文翻译器，用于错误信息本地化
 	if err := controller.InitTrans("zh"); err != nil {
 		fmt.Printf("init validator trans failed, err:%v\n", err)
 		return
 	}
 
-	// ==================== 第七步：设置路由并启动服务器 ====================
+	// ==================== 第十二步：初始化投票队列 ====================
+	// 投票记录先进入队列，由后台协程批量写入MySQL，减少数据库连接的占用
+	// 程序退出时先把队列中剩余的投票写入MySQL，再关闭数据库连接
+	// 队列实现由配置文件的vote_queue.backend选择：memory（内存）或 stream（Redis Streams）
+	if err := queue.InitVoteQueue(setting.Conf.VoteQueueConfig); err != nil {
+		fmt.Printf("init vote queue failed, err:%v\n", err)
+		return
+	}
+	defer queue.CloseVoteQueue()
+
+	// ==================== 第十三步：启动投票归档任务 ====================
+	// 投票时间窗口结束后，把Redis中的投票数归档到MySQL并清理投票记录
+	stopArchiver := logic.StartVoteArchiver(setting.Conf.VoteConfig)
+	defer stopArchiver()
+
+	// ==================== 第十四步：启动一致性对账任务 ====================
+	// 定期检查MySQL与Redis中的帖子和投票记录是否一致，并修复发现的问题
+	stopReconciler := logic.StartReconciler(
+		time.Duration(setting.Conf.ReconcileInterval)*time.Second,
+		setting.Conf.ReconcileBatchSize,
+		setting.Conf.ReconcileRepair,
+	)
+	defer stopReconciler()
+
+	// ==================== 第十五步：启动outbox转发任务 ====================
+	// 发帖时帖子和事件在同一个MySQL事务中写入，由转发任务把事件应用到Redis，失败时自动重试
+	stopRelay := outbox.NewRelay(setting.Conf.OutboxConfig).Start()
+	defer stopRelay()
+
+	// ==================== 第十六步：设置路由并启动服务器 ====================
 	// 根据运行模式（开发/生产）设置路由规则
 	r := router.SetupRouter(setting.Conf.Mode)
 
-	// 启动HTTP服务器，监听指定端口
-	err := r.Run(fmt.Sprintf(":%d", setting.Conf.Port))
-	if err != nil {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", setting.Conf.Port),
+		Handler: r,
+	}
+
+	// 在单独的协程中启动HTTP服务器，监听指定端口
+	errCh := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	// ==================== 第十七步：等待退出信号，优雅关机 ====================
+	// 收到SIGINT或SIGTERM后，先停止接收新请求并等待正在处理的请求完成，
+	// 然后依次执行上面注册的defer：停止outbox转发任务、对账任务和归档任务、清空投票队列、停止监听敏感词词库、关闭Redis和MySQL连接
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errCh:
 		fmt.Printf("run server failed, err:%v\n", err)
 		return
+	case <-quit:
+	}
+	zap.L().Info("shutdown server ...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		zap.L().Error("server shutdown failed", zap.Error(err))
 	}
 }
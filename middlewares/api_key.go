@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"bluebell/controller" // 导入控制器包，用于返回统一格式的错误响应
+	"bluebell/logic"      // 导入业务逻辑层，用于校验API key和查询用户角色
+	"errors"              // 导入错误处理包，用于判断API key校验失败的原因
+	"strings"             // 导入字符串处理包，用于分割Authorization请求头
+
+	"github.com/gin-gonic/gin" // 导入Gin Web框架
+	"go.uber.org/zap"          // 导入结构化日志包
+)
+
+// APIKeyAuthMiddleware 同时支持API key和JWT的认证中间件
+// 请求头为 Authorization: ApiKey <key> 时校验API key，API key必须拥有scope权限范围；
+// 其他请求交给JWTAuthMiddleware处理，与只接受JWT的接口行为相同。
+// 只有使用了本中间件的接口可以用API key访问，其他需要登录的接口（如API key的管理）只接受JWT。
+// 参数 scope: 使用API key访问时需要的权限范围，取值见models.APIKeyScope系列常量
+// 返回值: Gin中间件函数
+func APIKeyAuthMiddleware(scope string) func(c *gin.Context) {
+	jwtAuth := JWTAuthMiddleware()
+	return func(c *gin.Context) {
+		// ==================== 第一步：判断认证方式 ====================
+		parts := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2)
+		if !(len(parts) == 2 && parts[0] == "ApiKey") {
+			jwtAuth(c)
+			return
+		}
+
+		// ==================== 第二步：校验API key和权限范围 ====================
+		key, err := logic.AuthenticateAPIKey(parts[1], scope, c.ClientIP())
+		if err != nil {
+			switch {
+			case errors.Is(err, logic.ErrorInvalidAPIKey):
+				controller.ResponseError(c, controller.CodeInvalidToken)
+			case errors.Is(err, logic.ErrorAPIKeyScope):
+				controller.ResponseError(c, controller.CodeNoPermission)
+			default:
+				zap.L().Error("logic.AuthenticateAPIKey failed", zap.Error(err))
+				controller.ResponseError(c, controller.CodeServerBusy)
+			}
+			c.Abort()
+			return
+		}
+
+		// ==================== 第三步：保存用户信息到请求上下文 ====================
+		// 每次请求都读取用户当前的角色，收回角色后立即生效
+		roles, err := logic.GetUserRoles(key.UserID)
+		if err != nil {
+			zap.L().Error("logic.GetUserRoles failed", zap.Int64("userID", key.UserID), zap.Error(err))
+			controller.ResponseError(c, controller.CodeServerBusy)
+			c.Abort()
+			return
+		}
+		c.Set(controller.CtxUserIDKey, key.UserID)
+		c.Set(controller.CtxAPIKeyIDKey, key.KeyID)
+		c.Set(controller.CtxUserRolesKey, roles)
+		c.Next()
+	}
+}
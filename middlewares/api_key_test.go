@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"bluebell/controller"
+	"bluebell/internal/testutil"
+	"bluebell/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAPIKey = "bb_0123456789abcdefghijklmnopqrstuvwxyzABCDE"
+
+// expectAPIKey 预期一次按testAPIKey的sha256查询key，found为false时表示key不存在或已吊销
+func expectAPIKey(mock sqlmock.Sqlmock, scopes string, expire, lastUsed interface{}, found bool) {
+	sum := sha256.Sum256([]byte(testAPIKey))
+	rows := sqlmock.NewRows([]string{"key_id", "user_id", "name", "key_prefix", "scopes", "expire_time", "last_used_time"})
+	if found {
+		rows.AddRow(7, 100, "bot", testAPIKey[:11], scopes, expire, lastUsed)
+	}
+	mock.ExpectQuery("from api_key").WithArgs(hex.EncodeToString(sum[:])).WillReturnRows(rows)
+}
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := testutil.MySQL(t)
+	r := gin.New()
+	r.POST("/post", APIKeyAuthMiddleware(models.APIKeyScopePost), func(c *gin.Context) {
+		controller.ResponseSuccess(c, gin.H{
+			"user_id": c.GetInt64(controller.CtxUserIDKey),
+			"key_id":  c.GetInt64(controller.CtxAPIKeyIDKey),
+		})
+	})
+	call := func(auth string) *controller.ResponseData {
+		req := httptest.NewRequest(http.MethodPost, "/post", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		res := new(controller.ResponseData)
+		if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+			t.Fatalf("json.Unmarshal w.Body failed, err:%v\n", err)
+		}
+		return res
+	}
+
+	// 没有Authorization请求头或不是ApiKey时按JWT校验
+	assert.Equal(t, controller.CodeNeedLogin, call("").Code)
+	assert.Equal(t, controller.CodeInvalidToken, call("Bearer invalid").Code)
+	// 格式不对的API key不查询数据库
+	assert.Equal(t, controller.CodeInvalidToken, call("ApiKey invalid").Code)
+
+	// 第一次使用时记录使用时间和IP，用户和key保存到上下文
+	expectAPIKey(mock, "post,vote", nil, nil, true)
+	mock.ExpectExec("update api_key set last_used_time").WithArgs("192.0.2.1", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("from user_role").WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "community_id"}))
+	res := call("ApiKey " + testAPIKey)
+	assert.Equal(t, controller.CodeSuccess, res.Code)
+	assert.Equal(t, map[string]interface{}{"user_id": float64(100), "key_id": float64(7)}, res.Data)
+
+	// 刚使用过时不再更新使用时间
+	expectAPIKey(mock, "post", nil, time.Now().Add(-time.Second), true)
+	mock.ExpectQuery("from user_role").WithArgs(int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role", "community_id"}))
+	assert.Equal(t, controller.CodeSuccess, call("ApiKey "+testAPIKey).Code)
+
+	// 没有接口需要的权限范围
+	expectAPIKey(mock, "read,vote", nil, nil, true)
+	assert.Equal(t, controller.CodeNoPermission, call("ApiKey "+testAPIKey).Code)
+
+	// 已过期
+	expectAPIKey(mock, "post", time.Now().Add(-time.Minute), nil, true)
+	assert.Equal(t, controller.CodeInvalidToken, call("ApiKey "+testAPIKey).Code)
+
+	// 已吊销或不存在
+	expectAPIKey(mock, "", nil, nil, false)
+	assert.Equal(t, controller.CodeInvalidToken, call("ApiKey "+testAPIKey).Code)
+}
@@ -4,10 +4,15 @@ package middlewares
 
 import (
 	"bluebell/controller" // 导入控制器包，用于返回统一格式的错误响应
+	"bluebell/logic"      // 导入业务逻辑层，用于查询token是否已被吊销和检查会话
+	"bluebell/models"     // 导入数据模型，用于解析token中的角色
 	"bluebell/pkg/jwt"    // 导入JWT工具包，用于解析和验证token
+	"errors"              // 导入错误处理包，用于判断会话检查的错误类型
 	"strings"             // 导入字符串处理包，用于分割token字符串
+	"time"                // 导入时间包，用于转换token的过期时间
 
 	"github.com/gin-gonic/gin" // 导入Gin Web框架
+	"go.uber.org/zap"          // 导入结构化日志包
 )
 
 // JWTAuthMiddleware 基于JWT的认证中间件
@@ -49,10 +54,46 @@ func JWTAuthMiddleware() func(c *gin.Context) {
 			return
 		}
 
-		// ==================== 第四步：保存用户信息到请求上下文 ====================
+		// ==================== 第四步：检查Token是否仍然有效 ====================
+		// 单会话模式下，只有用户最近一次登录的会话可以使用
+		// 新设备登录时之前的会话已经被删除，先检查会话，被挤下线的设备才能收到"已在其他设备登录"的提示
+		if err := logic.CheckSession(mc.UserID, mc.SessionID); err != nil {
+			if errors.Is(err, logic.ErrorLoggedInElsewhere) {
+				controller.ResponseError(c, controller.CodeLoggedInElsewhere)
+			} else {
+				zap.L().Error("logic.CheckSession failed", zap.Error(err))
+				controller.ResponseError(c, controller.CodeServerBusy)
+			}
+			c.Abort()
+			return
+		}
+
+		// 退出登录或发现token被盗用时，token的jti会加入黑名单，直到token过期；
+		// token所属的会话被删除（退出登录、refresh token重复使用、重置密码）时同样失效
+		revoked, err := logic.IsTokenRevoked(mc.Id, mc.SessionID)
+		if err != nil {
+			// 无法确认token状态时拒绝请求，避免已吊销的token继续使用
+			zap.L().Error("logic.IsTokenRevoked failed", zap.Error(err))
+			controller.ResponseError(c, controller.CodeServerBusy)
+			c.Abort()
+			return
+		}
+		if revoked {
+			controller.ResponseError(c, controller.CodeInvalidToken)
+			c.Abort()
+			return
+		}
+
+		// ==================== 第五步：保存用户信息到请求上下文 ====================
 		// 将当前请求的用户ID信息保存到请求的上下文c上
 		// 后续的处理函数中可以通过c.Get(controller.CtxUserIDKey)来获取当前请求的用户信息
 		c.Set(controller.CtxUserIDKey, mc.UserID)
+		// 保存token的id、过期时间和所属会话，退出登录时用于吊销当前token和会话
+		c.Set(controller.CtxTokenIDKey, mc.Id)
+		c.Set(controller.CtxTokenExpireKey, time.Unix(mc.ExpiresAt, 0))
+		c.Set(controller.CtxSessionIDKey, mc.SessionID)
+		// 保存token中的角色，RequireRole和RequirePermission中间件据此校验权限
+		c.Set(controller.CtxUserRolesKey, models.ParseRoles(mc.Roles))
 
 		// 继续执行后续的中间件和请求处理函数
 		c.Next()
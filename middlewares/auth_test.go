@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"bluebell/controller"
+	"bluebell/dao/redis"
+	"bluebell/internal/testutil"
+	"bluebell/logic"
+	"bluebell/models"
+	"bluebell/pkg/jwt"
+	"bluebell/setting"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuthRouter 经过JWTAuthMiddleware后返回成功
+func newAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", JWTAuthMiddleware(), func(c *gin.Context) {
+		controller.ResponseSuccess(c, c.GetString(controller.CtxSessionIDKey))
+	})
+	return r
+}
+
+// getMe 使用Authorization请求头请求/me，返回响应的业务状态码
+func getMe(t *testing.T, r *gin.Engine, auth string) controller.ResCode {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res := new(controller.ResponseData)
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatalf("json.Unmarshal w.Body failed, err:%v\n", err)
+	}
+	return res.Code
+}
+
+// login 通过logic.Login登录，返回Authorization请求头和token中的声明
+func login(t *testing.T, mock sqlmock.Sqlmock) (string, *jwt.MyClaims) {
+	testutil.ExpectLogin(mock, 1, "alice", "123456")
+	user, err := logic.Login(&models.ParamLogin{Username: "alice", Password: "123456"}, "1.2.3.4")
+	if err != nil {
+		t.Fatalf("logic.Login failed, err:%v", err)
+	}
+	mc, err := jwt.ParseToken(user.Token)
+	if err != nil {
+		t.Fatalf("jwt.ParseToken failed, err:%v", err)
+	}
+	return "Bearer " + user.Token, mc
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	setAuthConfig(t, &setting.AuthConfig{})
+	r := newAuthRouter()
+
+	assert.Equal(t, controller.CodeNeedLogin, getMe(t, r, ""))
+	assert.Equal(t, controller.CodeInvalidToken, getMe(t, r, "Token abc"))
+	assert.Equal(t, controller.CodeInvalidToken, getMe(t, r, "Bearer abc"))
+
+	// 退出登录后token不能再使用
+	auth, mc := login(t, mock)
+	assert.Equal(t, controller.CodeSuccess, getMe(t, r, auth))
+	if err := logic.Logout(mc.UserID, mc.Id, mc.SessionID, time.Unix(mc.ExpiresAt, 0), &models.ParamLogout{}); err != nil {
+		t.Fatalf("logic.Logout failed, err:%v", err)
+	}
+	assert.Equal(t, controller.CodeInvalidToken, getMe(t, r, auth))
+
+	// 会话被删除（如重置密码）后，没有加入黑名单的token同样失效
+	auth, _ = login(t, mock)
+	assert.Equal(t, controller.CodeSuccess, getMe(t, r, auth))
+	if _, err := redis.RevokeUserSessions(1); err != nil {
+		t.Fatalf("redis.RevokeUserSessions failed, err:%v", err)
+	}
+	assert.Equal(t, controller.CodeInvalidToken, getMe(t, r, auth))
+}
+
+func TestJWTAuthMiddlewareSingleSession(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	r := newAuthRouter()
+
+	// 未开启单会话模式时，多个设备可以同时登录
+	setAuthConfig(t, &setting.AuthConfig{})
+	first, _ := login(t, mock)
+	second, _ := login(t, mock)
+	assert.Equal(t, controller.CodeSuccess, getMe(t, r, first))
+	assert.Equal(t, controller.CodeSuccess, getMe(t, r, second))
+
+	// 开启后在新设备登录，之前的设备提示已在其他设备登录
+	setAuthConfig(t, &setting.AuthConfig{SingleSession: true})
+	third, _ := login(t, mock)
+	assert.Equal(t, controller.CodeSuccess, getMe(t, r, third))
+	assert.Equal(t, controller.CodeLoggedInElsewhere, getMe(t, r, second))
+	assert.Equal(t, controller.CodeLoggedInElsewhere, getMe(t, r, first))
+}
@@ -0,0 +1,13 @@
+package middlewares
+
+import (
+	"bluebell/setting"
+	"testing"
+)
+
+// setAuthConfig 替换登录凭证相关的配置，测试结束后恢复
+func setAuthConfig(t *testing.T, cfg *setting.AuthConfig) {
+	old := setting.Conf.AuthConfig
+	setting.Conf.AuthConfig = cfg
+	t.Cleanup(func() { setting.Conf.AuthConfig = old })
+}
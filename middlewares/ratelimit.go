@@ -3,32 +3,40 @@
 package middlewares
 
 import (
-	"net/http" // 导入HTTP包，提供HTTP状态码等常量
-	"time"     // 导入时间包，用于定义时间间隔
+	"bluebell/controller" // 导入控制器包，用于返回统一格式的限流响应
+	"bluebell/logic"      // 导入业务逻辑层，用于检查按操作的限流策略
 
-	"github.com/gin-gonic/gin"  // 导入Gin Web框架
-	"github.com/juju/ratelimit" // 导入限流工具包，提供令牌桶算法实现
+	"github.com/gin-gonic/gin" // 导入Gin Web框架
+	"go.uber.org/zap"          // 导入结构化日志包
 )
 
-// RateLimitMiddleware 基于令牌桶算法的限流中间件
-// 使用令牌桶算法控制请求频率，防止系统过载
-// 参数 fillInterval: 令牌填充间隔，如2*time.Second表示每2秒填充一个令牌
-// 参数 cap: 令牌桶容量，即最大可存储的令牌数量
-// 返回值: Gin中间件函数，用于限制请求频率
-func RateLimitMiddleware(fillInterval time.Duration, cap int64) func(c *gin.Context) {
-	// 创建令牌桶实例
-	// fillInterval: 令牌填充间隔，控制令牌生成速率
-	// cap: 令牌桶容量，控制突发请求的处理能力
-	bucket := ratelimit.NewBucket(fillInterval, cap)
+// 路由组名，对应配置项rate_limit.groups下的key
+const (
+	RateLimitGroupGlobal = "global" // 所有请求
+	RateLimitGroupAPI    = "api"    // /api/v1下的接口
+	RateLimitGroupAdmin  = "admin"  // 管理员接口
+)
+
+// 按操作限流的操作名，对应配置项rate_limit.actions下的key
+const (
+	RateLimitSignup        = "signup"         // 注册，按IP限制
+	RateLimitLogin         = "login"          // 登录，按IP限制
+	RateLimitPost          = "post"           // 发帖，按用户和IP限制
+	RateLimitVote          = "vote"           // 投票，按用户和IP限制
+	RateLimitPasswordReset = "password_reset" // 忘记密码，按IP限制
+)
 
+// RateLimitGroup 按路由组限流的中间件
+// 每个路由组一个令牌桶，配置项rate_limit.groups.<group>，令牌桶的实现由rate_limit.backend选择，
+// 使用redis时所有实例共享令牌桶，多实例部署不会放大QPS；修改配置文件后立即生效
+// 参数 group: 路由组名，如RateLimitGroupGlobal
+// 返回值: Gin中间件函数
+func RateLimitGroup(group string) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// ==================== 第一步：尝试获取令牌 ====================
-		// 尝试从令牌桶中获取一个令牌
-		// TakeAvailable(1) 返回实际获取到的令牌数量
-		// 如果返回1，说明成功获取到令牌；如果返回0，说明令牌不足
-		if bucket.TakeAvailable(1) != 1 {
-			// 取不到令牌，说明请求频率过高，返回限流响应
-			c.String(http.StatusOK, "rate limit...")
+		if retryAfter := logic.CheckGroupRateLimit(group); retryAfter > 0 {
+			// 取不到令牌，说明请求频率过高，返回429
+			controller.ResponseTooManyRequests(c, controller.CodeTooManyRequests, retryAfter)
 			c.Abort() // 终止后续中间件和处理器执行
 			return
 		}
@@ -38,3 +46,33 @@ func RateLimitMiddleware(fillInterval time.Duration, cap int64) func(c *gin.Cont
 		c.Next()
 	}
 }
+
+// RateLimitAction 按操作限流的中间件
+// 按配置项rate_limit.actions.<action>分别限制每个用户和每个IP的请求次数，计数保存在Redis中
+// 需要按用户限制的操作要注册在JWT认证中间件之后，未登录的请求只按IP限制
+// Redis不可用时放行请求，避免限流故障导致整个服务不可用
+// 参数 action: 操作名，如RateLimitPost
+// 返回值: Gin中间件函数
+func RateLimitAction(action string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		// ==================== 第一步：检查限流策略 ====================
+		userID := c.GetInt64(controller.CtxUserIDKey)
+		retryAfter, err := logic.CheckRateLimit(action, userID, c.ClientIP())
+		if err != nil {
+			zap.L().Error("logic.CheckRateLimit failed",
+				zap.String("action", action),
+				zap.Int64("userID", userID),
+				zap.Error(err))
+			c.Next()
+			return
+		}
+
+		// ==================== 第二步：超限时返回429 ====================
+		if retryAfter > 0 {
+			controller.ResponseTooManyRequests(c, controller.CodeTooManyRequests, retryAfter)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
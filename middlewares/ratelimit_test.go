@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"bluebell/controller"
+	"bluebell/logic"
+	"bluebell/setting"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitGroup(t *testing.T) {
+	old := setting.RateLimit()
+	defer setting.SetRateLimit(old)
+	// 进程内的令牌桶，容量为1，每秒生成0.5个令牌，第二个请求被限流，需要等待2秒
+	setting.SetRateLimit(&setting.RateLimitConfig{
+		RateLimitBackend: logic.RateLimitBackendMemory,
+		RateLimitGroups: map[string]*setting.RateLimitBucket{
+			"test": {Rate: 0.5, Burst: 1},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", RateLimitGroup("test"), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	res := new(controller.ResponseData)
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatalf("json.Unmarshal w.Body failed, err:%v\n", err)
+	}
+	assert.Equal(t, controller.CodeTooManyRequests, res.Code)
+
+	// 修改配置后立即按新的令牌桶限流
+	setting.SetRateLimit(&setting.RateLimitConfig{
+		RateLimitBackend: logic.RateLimitBackendMemory,
+		RateLimitGroups: map[string]*setting.RateLimitBucket{
+			"test": {Rate: 0.5, Burst: 3},
+		},
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitActionWithoutPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// 没有配置限流策略的操作不限流，也不访问Redis
+	r.POST("/signup", RateLimitAction(RateLimitSignup), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/signup", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,78 @@
+// Package middlewares 提供HTTP中间件功能
+// 包括认证、限流、日志等中间件，用于处理HTTP请求的通用逻辑
+package middlewares
+
+import (
+	"bluebell/controller" // 导入控制器包，用于返回统一格式的错误响应
+	"bluebell/models"     // 导入数据模型，使用角色和权限定义
+	"strconv"             // 导入字符串转换包，用于解析社区id
+
+	"github.com/gin-gonic/gin" // 导入Gin Web框架
+)
+
+// ScopeFunc 从请求中获取权限生效的社区id
+// 返回0表示不限定社区，此时只有全局角色可以通过校验
+type ScopeFunc func(c *gin.Context) (communityID int64, err error)
+
+// CommunityParam 从路径参数中获取社区id，如 /community/:id 中的id
+func CommunityParam(name string) ScopeFunc {
+	return func(c *gin.Context) (int64, error) {
+		return strconv.ParseInt(c.Param(name), 10, 64)
+	}
+}
+
+// RequireRole 角色校验中间件
+// 必须放在JWTAuthMiddleware之后使用，只允许拥有指定角色的用户访问
+// 参数 role: 需要的角色
+// 参数 scope: 可选，角色生效的社区；不传时只接受全局角色
+// 返回值: Gin中间件函数
+func RequireRole(role string, scope ...ScopeFunc) func(c *gin.Context) {
+	return authorize(scope, func(roles models.Roles, communityID int64) bool {
+		return roles.HasRole(role, communityID)
+	})
+}
+
+// RequirePermission 权限校验中间件
+// 必须放在JWTAuthMiddleware之后使用，只允许拥有指定权限的用户访问
+// 参数 perm: 需要的权限
+// 参数 scope: 可选，权限生效的社区；不传时只接受全局角色的权限
+// 返回值: Gin中间件函数
+func RequirePermission(perm models.Permission, scope ...ScopeFunc) func(c *gin.Context) {
+	return authorize(scope, func(roles models.Roles, communityID int64) bool {
+		return roles.HasPermission(perm, communityID)
+	})
+}
+
+// authorize 获取当前用户的角色和社区id，交给allow判断是否允许访问
+func authorize(scope []ScopeFunc, allow func(roles models.Roles, communityID int64) bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		// ==================== 第一步：获取当前用户的角色 ====================
+		v, ok := c.Get(controller.CtxUserRolesKey)
+		if !ok {
+			controller.ResponseError(c, controller.CodeNeedLogin)
+			c.Abort()
+			return
+		}
+		roles, _ := v.(models.Roles)
+
+		// ==================== 第二步：获取权限生效的社区 ====================
+		var communityID int64
+		if len(scope) > 0 && scope[0] != nil {
+			id, err := scope[0](c)
+			if err != nil {
+				controller.ResponseError(c, controller.CodeInvalidParam)
+				c.Abort()
+				return
+			}
+			communityID = id
+		}
+
+		// ==================== 第三步：校验角色或权限 ====================
+		if !allow(roles, communityID) {
+			controller.ResponseError(c, controller.CodeNoPermission)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
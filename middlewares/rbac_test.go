@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"bluebell/controller"
+	"bluebell/internal/testutil"
+	"bluebell/logic"
+	"bluebell/models"
+	"bluebell/setting"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRBACRouter 经过JWTAuthMiddleware和角色、权限校验后返回成功
+func newRBACRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { controller.ResponseSuccess(c, nil) }
+	r.GET("/admin", JWTAuthMiddleware(), RequireRole(models.RoleAdmin), ok)
+	r.GET("/reconcile", JWTAuthMiddleware(), RequirePermission(models.PermissionReconcile), ok)
+	r.GET("/community/:id/moderator", JWTAuthMiddleware(), RequireRole(models.RoleModerator, CommunityParam("id")), ok)
+	r.POST("/community/:id/ban", JWTAuthMiddleware(), RequirePermission(models.PermissionBanUser, CommunityParam("id")), ok)
+	// 没有经过JWTAuthMiddleware，上下文中没有角色
+	r.GET("/anonymous", RequireRole(models.RoleAdmin), ok)
+	return r
+}
+
+// request 使用Authorization请求头发送请求，返回响应的业务状态码
+func request(t *testing.T, r *gin.Engine, method, path, auth string) controller.ResCode {
+	req := httptest.NewRequest(method, path, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	res := new(controller.ResponseData)
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatalf("json.Unmarshal w.Body failed, err:%v\n", err)
+	}
+	return res.Code
+}
+
+// loginWithRoles 登录并在token中写入user_role表中的角色，返回Authorization请求头
+func loginWithRoles(t *testing.T, mock sqlmock.Sqlmock, userID int64, username string, roles ...*models.UserRole) string {
+	testutil.ExpectLogin(mock, userID, username, "123456", roles...)
+	user, err := logic.Login(&models.ParamLogin{Username: username, Password: "123456"}, "1.2.3.4")
+	if err != nil {
+		t.Fatalf("logic.Login failed, err:%v", err)
+	}
+	return "Bearer " + user.Token
+}
+
+func TestRequireRoleAndPermission(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	setAuthConfig(t, &setting.AuthConfig{})
+	r := newRBACRouter()
+
+	assert.Equal(t, controller.CodeNeedLogin, request(t, r, http.MethodGet, "/anonymous", ""))
+
+	// 全局管理员在所有社区都有全部权限
+	admin := loginWithRoles(t, mock, 1, "root", &models.UserRole{Role: models.RoleAdmin})
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodGet, "/admin", admin))
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodGet, "/reconcile", admin))
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodPost, "/community/20/ban", admin))
+
+	// 10号社区的版主只能管理自己的社区，没有全局权限
+	mod := loginWithRoles(t, mock, 2, "bob", &models.UserRole{Role: models.RoleModerator, CommunityID: 10})
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodGet, "/community/10/moderator", mod))
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodPost, "/community/10/ban", mod))
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodGet, "/community/20/moderator", mod))
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodPost, "/community/20/ban", mod))
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodGet, "/admin", mod))
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodGet, "/reconcile", mod))
+	assert.Equal(t, controller.CodeInvalidParam, request(t, r, http.MethodPost, "/community/abc/ban", mod))
+
+	// 普通用户没有任何管理权限
+	user := loginWithRoles(t, mock, 3, "carol")
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodGet, "/admin", user))
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodPost, "/community/10/ban", user))
+}
+
+func TestRequireRoleConfiguredAdmin(t *testing.T) {
+	testutil.Redis(t)
+	mock := testutil.MySQL(t)
+	testutil.JWT(t)
+	setAuthConfig(t, &setting.AuthConfig{})
+	old := setting.Conf.AdminConfig
+	t.Cleanup(func() { setting.Conf.AdminConfig = old })
+	r := newRBACRouter()
+
+	// 不在admin.user_ids中时没有管理权限
+	setting.Conf.AdminConfig = &setting.AdminConfig{}
+	auth := loginWithRoles(t, mock, 3, "carol")
+	assert.Equal(t, controller.CodeNoPermission, request(t, r, http.MethodGet, "/admin", auth))
+
+	// user_role表中没有角色，admin.user_ids中的用户登录后同样是全局管理员
+	setting.Conf.AdminConfig = &setting.AdminConfig{UserIDs: []int64{3}}
+	auth = loginWithRoles(t, mock, 3, "carol")
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodGet, "/admin", auth))
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodGet, "/reconcile", auth))
+	assert.Equal(t, controller.CodeSuccess, request(t, r, http.MethodPost, "/community/20/ban", auth))
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 个人API key
+// 机器人和第三方集成使用 Authorization: ApiKey <key> 访问接口，不需要用密码登录，也不需要保存长期有效的JWT。
+// 每个API key有自己的权限范围，只能访问权限范围对应的接口；API key的管理接口只接受JWT。
+// 数据库中只保存key的sha256，完整的key只在创建时返回一次。
+
+const (
+	APIKeyScopeRead = "read" // 读取需要登录的数据，如版主查看管理日志和禁言列表
+	APIKeyScopePost = "post" // 发帖、编辑和删除自己的帖子、发表评论
+	APIKeyScopeVote = "vote" // 投票
+)
+
+// APIKeyScopes API key的权限范围，数据库中保存为逗号分隔的字符串
+type APIKeyScopes []string
+
+// Has 是否包含权限范围
+func (s APIKeyScopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Value 实现driver.Valuer，保存为 read,post 的形式
+func (s APIKeyScopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+// Scan 实现sql.Scanner
+func (s *APIKeyScopes) Scan(src interface{}) error {
+	var str string
+	switch v := src.(type) {
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	case nil:
+	default:
+		return errors.New("invalid api key scopes")
+	}
+	*s = APIKeyScopes{}
+	if str != "" {
+		*s = strings.Split(str, ",")
+	}
+	return nil
+}
+
+// APIKey 个人API key，对应api_key表
+type APIKey struct {
+	KeyID        int64        `json:"key_id,string" db:"key_id"`
+	UserID       int64        `json:"-" db:"user_id"`
+	Name         string       `json:"name" db:"name"`             // 用户起的名称，如 "发帖机器人"
+	KeyPrefix    string       `json:"key_prefix" db:"key_prefix"` // key的前几个字符，用于在列表中辨认
+	KeyHash      string       `json:"-" db:"key_hash"`            // key的sha256
+	Scopes       APIKeyScopes `json:"scopes" db:"scopes"`
+	ExpireTime   *time.Time   `json:"expire_time" db:"expire_time"`       // 为空表示永不过期
+	LastUsedTime *time.Time   `json:"last_used_time" db:"last_used_time"` // 为空表示从未使用
+	LastUsedIP   string       `json:"last_used_ip" db:"last_used_ip"`
+	CreateTime   time.Time    `json:"create_time" db:"create_time"`
+
+	Key string `json:"key,omitempty" db:"-"` // 完整的key，只在创建时返回一次
+}
@@ -0,0 +1,21 @@
+package models
+
+import "testing"
+
+func TestAPIKeyScopes(t *testing.T) {
+	v, err := APIKeyScopes{APIKeyScopePost, APIKeyScopeVote}.Value()
+	if err != nil || v != "post,vote" {
+		t.Fatalf("Value got %v, %v", v, err)
+	}
+
+	var s APIKeyScopes
+	if err := s.Scan([]byte("post,vote")); err != nil {
+		t.Fatalf("Scan failed, err:%v", err)
+	}
+	if !s.Has(APIKeyScopePost) || !s.Has(APIKeyScopeVote) || s.Has(APIKeyScopeRead) {
+		t.Fatalf("unexpected scopes: %v", s)
+	}
+	if err := s.Scan(""); err != nil || len(s) != 0 {
+		t.Fatalf("Scan empty got %v, %v", s, err)
+	}
+}
@@ -0,0 +1,24 @@
+// Package models 提供数据模型定义功能
+// 定义系统中各种业务实体的数据结构，用于数据存储和传输
+package models
+
+import "time"
+
+// Comment 评论数据模型
+// 对应数据库中的评论表，ParentID为0表示直接评论帖子，否则表示回复某条评论
+type Comment struct {
+	ID         int64     `json:"id,string" db:"comment_id"`       // 评论ID，使用雪花算法生成
+	PostID     int64     `json:"post_id,string" db:"post_id"`     // 所属帖子ID
+	ParentID   int64     `json:"parent_id,string" db:"parent_id"` // 父评论ID，0表示直接评论帖子
+	AuthorID   int64     `json:"author_id,string" db:"author_id"` // 评论者ID
+	Content    string    `json:"content" db:"content"`            // 评论内容
+	CreateTime time.Time `json:"create_time" db:"create_time"`    // 评论时间
+}
+
+// ApiCommentDetail 评论接口的响应结构体
+// 通过Replies字段把同一帖子下的评论组织成树形结构
+type ApiCommentDetail struct {
+	AuthorName string              `json:"author_name"` // 评论者名称
+	*Comment                       // 嵌入评论结构体
+	Replies    []*ApiCommentDetail `json:"replies"` // 对这条评论的回复
+}
@@ -7,21 +7,28 @@
 -- 设计思路：
 -- 1. 使用bigint类型存储用户ID，支持大量用户
 -- 2. 用户名和用户ID都设置唯一索引，防止重复
--- 3. 密码字段存储加密后的密码
+-- 3. 密码字段存储自描述的密码哈希（bcrypt/argon2id），旧版本的md5哈希在用户下次登录时自动迁移
 -- 4. 性别使用tinyint，节省存储空间
 -- 5. 自动记录创建和更新时间
+-- 6. 邮箱可选；email_verified标记邮箱是否已验证，只有验证过的邮箱可以找回密码
+--    未验证的邮箱可以被多个用户填写，只有验证过的邮箱唯一，避免未验证的邮箱一直占用，也避免注册时暴露邮箱是否注册过
 CREATE TABLE `user` (
     `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键，用于内部关联
     `user_id` bigint(20) NOT NULL,                     -- 用户ID，业务主键，全局唯一
     `username` varchar(64) COLLATE utf8mb4_general_ci NOT NULL,  -- 用户名，用于登录
-    `password` varchar(64) COLLATE utf8mb4_general_ci NOT NULL,  -- 加密后的密码
-    `email` varchar(64) COLLATE utf8mb4_general_ci,              -- 邮箱，可选字段
+    `password` varchar(255) COLLATE utf8mb4_general_ci NOT NULL,  -- 密码哈希，自带算法标识，如bcrypt、argon2id
+    `email` varchar(64) COLLATE utf8mb4_general_ci,              -- 邮箱，可选字段，未填写时为NULL
+    `email_verified` tinyint(4) NOT NULL DEFAULT '0',  -- 邮箱是否已验证：0=未验证，1=已验证
+    `verified_email` varchar(64) COLLATE utf8mb4_general_ci
+        GENERATED ALWAYS AS (IF(`email_verified` = 1, `email`, NULL)) VIRTUAL,  -- 已验证的邮箱，未验证时为NULL
     `gender` tinyint(4) NOT NULL DEFAULT '0',          -- 性别：0=未知，1=男，2=女
     `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP,      -- 创建时间，自动设置
     `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,  -- 更新时间，自动更新
     PRIMARY KEY (`id`),                                 -- 主键索引，用于内部关联
     UNIQUE KEY `idx_username` (`username`) USING BTREE, -- 用户名唯一索引，防止重复注册
-    UNIQUE KEY `idx_user_id` (`user_id`) USING BTREE   -- 用户ID唯一索引，业务主键
+    UNIQUE KEY `idx_user_id` (`user_id`) USING BTREE,  -- 用户ID唯一索引，业务主键
+    KEY `idx_email` (`email`) USING BTREE,             -- 邮箱索引，验证邮箱时清空其他用户未验证的同一邮箱
+    UNIQUE KEY `idx_verified_email` (`verified_email`) USING BTREE  -- 已验证邮箱唯一索引，NULL不参与唯一性检查
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
 -- ==================== 社区表 (community) ====================
@@ -66,7 +73,7 @@ CREATE TABLE `post` (
     `content` varchar(8192) COLLATE utf8mb4_general_ci NOT NULL COMMENT '内容',  -- 帖子内容，支持长文本
     `author_id` bigint(20) NOT NULL COMMENT '作者的用户id',  -- 作者ID，关联用户表
     `community_id` bigint(20) NOT NULL COMMENT '所属社区',   -- 社区ID，关联社区表
-    `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '帖子状态',  -- 状态：1=正常，0=删除，2=置顶等
+    `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '帖子状态',  -- 状态：1=正常，0=删除，2=被版主移除，3=被举报自动隐藏
     `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 发布时间
     `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',  -- 最后修改时间
     PRIMARY KEY (`id`),                               -- 主键索引
@@ -75,20 +82,294 @@ CREATE TABLE `post` (
     KEY `idx_community_id` (`community_id`)           -- 社区ID索引，优化按社区查询
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
--- ==================== 投票表 (post_vote) ====================
+-- ==================== 投票表 (vote) ====================
 -- 设计思路：
--- 1. 记录用户对帖子的投票历史
--- 2. 使用复合唯一索引防止重复投票
--- 3. vote_type字段：1=赞成，-1=反对
--- 4. 支持投票历史查询和统计
+-- 1. 记录用户对各类对象（帖子、社区公告、用户回答等）的投票历史
+-- 2. target_type区分投票对象的类型：1=帖子，取值见models.VoteTargetType
+-- 3. 使用(target_type, target_id, user_id)复合唯一索引防止重复投票
+-- 4. vote_type字段：1=赞成，-1=反对，0=取消投票
 -- 5. 与Redis投票数据保持同步
-DROP TABLE IF EXISTS `post_vote`;
-CREATE TABLE `post_vote` (
+-- 6. vote_time记录投票发生的时间（毫秒时间戳），只用更新的投票覆盖已有记录，
+--    投票队列重新投递的旧消息不会覆盖已经写入的新投票
+-- 旧版本的post_vote表可以通过sql/migrate_post_vote.sql迁移到本表
+-- 已有的vote表通过sql/migrate_vote_time.sql添加vote_time字段
+DROP TABLE IF EXISTS `vote`;
+CREATE TABLE `vote` (
     `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `target_type` tinyint(4) NOT NULL COMMENT '投票对象类型',  -- 投票对象类型：1=帖子
+    `target_id` bigint(20) NOT NULL COMMENT '投票对象ID',      -- 被投票的对象ID，如帖子ID
     `user_id` bigint(20) NOT NULL COMMENT '用户ID',    -- 投票用户ID
-    `post_id` bigint(20) NOT NULL COMMENT '帖子ID',    -- 被投票的帖子ID
-    `vote_type` tinyint(4) YES DEFAULT 1 COMMENT '投票类型',  -- 投票类型：1=赞成，-1=反对
-    `create_time` timestamp YES DEFAULT CURRENT_TIMESTAMP DEFAULT_GENERATED COMMENT '创建时间',  -- 投票时间
+    `vote_type` tinyint(4) NOT NULL DEFAULT '1' COMMENT '投票类型',  -- 投票类型：1=赞成，-1=反对，0=取消
+    `vote_time` bigint(20) NOT NULL DEFAULT '0' COMMENT '投票时间',  -- 投票发生的毫秒时间戳，用于丢弃过期的投票消息
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 投票时间
     PRIMARY KEY (`id`),                               -- 主键索引
-    UNIQUE KEY `uk_post_user` (`post_id`, `user_id`) COMMENT '防止重复投票'  -- 复合唯一索引，确保每个用户对每个帖子只能投一票
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
\ No newline at end of file
+    UNIQUE KEY `uk_target_user` (`target_type`, `target_id`, `user_id`) COMMENT '防止重复投票'  -- 复合唯一索引，确保每个用户对每个对象只能投一票
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 评论表 (comment) ====================
+-- 设计思路：
+-- 1. 评论ID使用雪花算法生成，与帖子ID、用户ID保持一致
+-- 2. parent_id为0表示直接评论帖子，否则表示回复parent_id对应的评论
+-- 3. 同一帖子下的评论通过parent_id组织成树形结构（楼中楼）
+-- 4. 帖子ID建立索引，优化按帖子查询评论列表和统计评论数
+DROP TABLE IF EXISTS `comment`;
+CREATE TABLE `comment` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `comment_id` bigint(20) NOT NULL COMMENT '评论id',  -- 评论ID，业务主键，全局唯一
+    `post_id` bigint(20) NOT NULL COMMENT '所属帖子id',  -- 评论所属的帖子ID
+    `parent_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '父评论id',  -- 父评论ID，0表示直接评论帖子
+    `author_id` bigint(20) NOT NULL COMMENT '评论者的用户id',  -- 评论者ID，关联用户表
+    `content` varchar(1024) COLLATE utf8mb4_general_ci NOT NULL COMMENT '内容',  -- 评论内容
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 评论时间
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',  -- 最后修改时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `idx_comment_id` (`comment_id`),       -- 评论ID唯一索引
+    KEY `idx_post_id` (`post_id`)                     -- 帖子ID索引，优化按帖子查询评论
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 投票归档表 (vote_archive) ====================
+-- 设计思路：
+-- 1. 对象的投票时间窗口结束后，由后台归档任务把Redis中的最终赞成票数和反对票数写入本表
+-- 2. 归档完成后删除Redis中记录用户投票情况的zset（如post:voted:<id>），避免其无限增长
+-- 3. 查询投票数时，Redis中已经没有投票记录的对象回退到本表查询
+-- 4. (target_type, target_id)唯一索引，重复归档时覆盖写入
+DROP TABLE IF EXISTS `vote_archive`;
+CREATE TABLE `vote_archive` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `target_type` tinyint(4) NOT NULL COMMENT '投票对象类型',  -- 投票对象类型：1=帖子
+    `target_id` bigint(20) NOT NULL COMMENT '投票对象ID',      -- 被投票的对象ID，如帖子ID
+    `up_votes` int(11) NOT NULL DEFAULT '0' COMMENT '赞成票数',    -- 归档时的赞成票数
+    `down_votes` int(11) NOT NULL DEFAULT '0' COMMENT '反对票数',  -- 归档时的反对票数
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '归档时间',  -- 归档时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_target` (`target_type`, `target_id`)  -- 每个对象只保留一条归档记录
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 事务发件箱表 (outbox) ====================
+-- 设计思路：
+-- 1. 业务数据和事件在同一个MySQL事务中写入，保证两者同时成功或同时失败
+-- 2. 后台转发任务按id顺序读取待处理的事件，交给注册的处理函数（如写入Redis），失败后按指数退避重试
+-- 3. status：0=待处理，1=已处理，2=重试次数用尽，需要人工处理
+-- 4. next_retry_time既是重试时间也是认领租约，多个实例同时运行时只有一个实例能认领到同一个事件
+-- 5. 已处理的事件保留一段时间后由转发任务清理
+DROP TABLE IF EXISTS `outbox`;
+CREATE TABLE `outbox` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键，事件按id顺序处理
+    `event_type` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '事件类型',  -- 事件类型，如post.created
+    `aggregate_id` bigint(20) NOT NULL COMMENT '业务对象ID',  -- 事件所属的业务对象ID，如帖子ID
+    `payload` text COLLATE utf8mb4_general_ci NOT NULL COMMENT '事件内容',  -- 事件内容，JSON格式
+    `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '事件状态',  -- 状态：0=待处理，1=已处理，2=失败
+    `retry_count` int(11) NOT NULL DEFAULT '0' COMMENT '重试次数',  -- 已经失败的次数
+    `next_retry_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次处理时间',  -- 早于当前时间的待处理事件才会被认领
+    `last_error` varchar(512) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '最近一次错误',  -- 最近一次处理失败的原因
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 事件产生时间
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',  -- 最后修改时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    KEY `idx_status_next_retry` (`status`, `next_retry_time`)  -- 优化查询待处理事件
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 用户角色表 (user_role) ====================
+-- 设计思路：
+-- 1. 所有登录用户默认都是普通用户(user)，不需要保存；本表只保存版主(moderator)和管理员(admin)
+-- 2. community_id为0表示全局角色，否则角色只在该社区内生效，如某个社区的版主
+-- 3. 签发token时读取用户的角色写入token，修改角色后用户刷新token时生效
+-- 4. (user_id, role, community_id)唯一索引，重复授予同一角色时忽略
+DROP TABLE IF EXISTS `user_role`;
+CREATE TABLE `user_role` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- 拥有角色的用户ID
+    `role` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '角色',  -- 角色：moderator、admin
+    `community_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '社区id',  -- 角色生效的社区，0表示全局
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 授予角色的时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_user_role` (`user_id`, `role`, `community_id`)  -- 同一用户的同一角色只保存一条
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 社区置顶表 (community_pin) ====================
+-- 设计思路：
+-- 1. 版主可以把本社区的帖子置顶，置顶帖子出现在社区帖子列表第一页的最前面
+-- 2. 每个社区最多置顶moderation.max_pinned篇帖子，置顶时锁定community表中的社区行，避免并发置顶超过上限
+-- 3. 帖子被移除时同时取消置顶
+DROP TABLE IF EXISTS `community_pin`;
+CREATE TABLE `community_pin` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',  -- 帖子所属社区
+    `post_id` bigint(20) NOT NULL COMMENT '帖子id',     -- 被置顶的帖子
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',  -- 执行置顶的版主或管理员
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '置顶时间',  -- 后置顶的帖子排在前面
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_post_id` (`post_id`),              -- 同一帖子只能置顶一次
+    KEY `idx_community_id` (`community_id`)           -- 优化按社区查询置顶帖子
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 帖子锁定表 (post_lock) ====================
+-- 设计思路：
+-- 1. 版主可以锁定本社区的帖子，锁定后不允许投票（包括取消投票）
+-- 2. 投票脚本检查的是Redis中的post:locked集合，本表是锁定状态的持久化记录，
+--    Redis数据丢失后cmd/rebuild根据本表恢复post:locked
+-- 3. 解锁时删除记录，post_id唯一索引保证同一帖子只有一条
+DROP TABLE IF EXISTS `post_lock`;
+CREATE TABLE `post_lock` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',  -- 帖子所属社区
+    `post_id` bigint(20) NOT NULL COMMENT '帖子id',     -- 被锁定的帖子
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',  -- 执行锁定的版主或管理员
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '锁定时间',  -- 锁定时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_post_id` (`post_id`)               -- 同一帖子只锁定一次
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 社区禁言表 (community_ban) ====================
+-- 设计思路：
+-- 1. 被禁言的用户不能在该社区发帖和评论，其他社区不受影响
+-- 2. expire_time为NULL表示永久禁言，否则到期后自动失效，不需要清理任务
+-- 3. (community_id, user_id)唯一索引，再次禁言时覆盖原来的记录
+DROP TABLE IF EXISTS `community_ban`;
+CREATE TABLE `community_ban` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',  -- 禁言生效的社区
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- 被禁言的用户
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',  -- 执行禁言的版主或管理员
+    `reason` varchar(256) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '原因',  -- 禁言原因
+    `expire_time` timestamp NULL DEFAULT NULL COMMENT '到期时间',  -- NULL表示永久
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 禁言时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_community_user` (`community_id`, `user_id`)  -- 每个社区每个用户只保留一条
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 管理日志表 (mod_log) ====================
+-- 设计思路：
+-- 1. 版主和管理员的每一次管理操作（移除、锁定、置顶帖子，禁言用户）都记录一条日志
+-- 2. 改动MySQL数据的操作与日志在同一个事务中写入
+-- 3. 按社区查看日志，(community_id, id)索引优化按社区分页查询
+DROP TABLE IF EXISTS `mod_log`;
+CREATE TABLE `mod_log` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键，越大越新
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',  -- 操作所在的社区
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',  -- 执行操作的版主或管理员
+    `action` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '操作类型',  -- 如post.remove、user.ban
+    `target_id` bigint(20) NOT NULL COMMENT '操作对象id',  -- 帖子操作为帖子id，用户操作为用户id
+    `reason` varchar(256) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '原因',  -- 操作原因
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',  -- 操作时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    KEY `idx_community_id` (`community_id`, `id`)     -- 优化按社区分页查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 被举报对象表 (report_target) ====================
+-- 设计思路：
+-- 1. 每个被举报的对象（目前只有帖子）一条记录，汇总该对象未处理的举报数，管理员按举报数从多到少处理
+-- 2. status：0=待处理，1=举报成立（内容已移除），2=举报不成立（内容保留）
+-- 3. 处理后report_count清零，之后的新举报重新打开这条记录
+-- 4. community_id冗余保存对象所属社区，方便以后按社区查看举报
+DROP TABLE IF EXISTS `report_target`;
+CREATE TABLE `report_target` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `target_type` tinyint(4) NOT NULL COMMENT '被举报对象类型',  -- 被举报对象类型：1=帖子
+    `target_id` bigint(20) NOT NULL COMMENT '被举报对象ID',      -- 被举报对象ID，如帖子ID
+    `community_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '所属社区',  -- 被举报对象所属的社区
+    `report_count` int(11) NOT NULL DEFAULT '0' COMMENT '未处理的举报数',  -- 处理后清零
+    `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '处理状态',  -- 状态：0=待处理，1=成立，2=不成立
+    `handler_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '处理人id',  -- 最近一次处理的管理员
+    `handle_time` timestamp NULL DEFAULT NULL COMMENT '处理时间',  -- 最近一次处理的时间
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',  -- 第一次被举报的时间
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',  -- 最近一次被举报或处理的时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_target` (`target_type`, `target_id`),  -- 每个对象只有一条汇总记录
+    KEY `idx_status_count` (`status`, `report_count`)  -- 优化按状态和举报数查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 举报表 (report) ====================
+-- 设计思路：
+-- 1. 每个用户的每次举报一条记录，通过report_target_id关联被举报对象
+-- 2. (report_target_id, reporter_id)唯一索引，同一用户对同一对象只能举报一次，避免刷举报
+-- 3. handled：被举报对象处理后，之前的举报都标记为已处理，按原因统计时只统计未处理的举报
+DROP TABLE IF EXISTS `report`;
+CREATE TABLE `report` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `report_target_id` bigint(20) NOT NULL COMMENT '被举报对象记录id',  -- 关联report_target表
+    `reporter_id` bigint(20) NOT NULL COMMENT '举报人id',  -- 举报人
+    `reason` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '举报原因',  -- spam、abuse、illegal、porn、other，系统自动举报为sensitive
+    `detail` varchar(512) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '补充说明',  -- 举报人的补充说明
+    `handled` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否已处理',  -- 0=未处理，1=已处理
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '举报时间',  -- 举报时间
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_target_reporter` (`report_target_id`, `reporter_id`)  -- 同一用户对同一对象只能举报一次
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 两步验证表 (user_totp) ====================
+-- 设计思路：
+-- 1. 每个用户最多一条记录，开启两步验证时先生成密钥（enabled=0），用户用验证器App扫码并提交验证码确认后enabled改为1
+-- 2. secret为base32编码的TOTP密钥，验证码每30秒变化一次
+-- 3. last_counter记录最近一次使用的验证码所在的时间步，同一个验证码不能重复使用
+DROP TABLE IF EXISTS `user_totp`;
+CREATE TABLE `user_totp` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- 开启两步验证的用户ID
+    `secret` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'TOTP密钥',  -- base32编码的密钥
+    `enabled` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否已开启',  -- 0=等待确认，1=已开启
+    `last_counter` bigint(20) NOT NULL DEFAULT '0' COMMENT '最近使用的时间步',  -- 防止验证码重复使用
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_user_id` (`user_id`)               -- 每个用户一条记录
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 恢复码表 (user_recovery_code) ====================
+-- 设计思路：
+-- 1. 确认开启两步验证时生成一组一次性恢复码，只在生成时返回给用户一次，丢失验证器App时用来登录
+-- 2. 只保存恢复码的sha256，数据库泄露也不能直接使用
+-- 3. used_time不为空表示已使用，每个恢复码只能使用一次；重新开启两步验证时旧的恢复码全部删除
+DROP TABLE IF EXISTS `user_recovery_code`;
+CREATE TABLE `user_recovery_code` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- 恢复码所属的用户ID
+    `code_hash` char(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '恢复码的sha256',
+    `used_time` timestamp NULL DEFAULT NULL COMMENT '使用时间',  -- NULL表示未使用
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_user_code` (`user_id`, `code_hash`) -- 按用户和恢复码查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 第三方账号表 (user_identity) ====================
+-- 设计思路：
+-- 1. 用户通过OIDC身份提供方登录时，按(provider, subject)找到关联的用户，subject是用户在身份提供方的唯一标识（ID token中的sub）
+-- 2. 不按邮箱关联已有用户，避免身份提供方返回的邮箱被用来登录他人的账号；已有用户需要登录后主动绑定
+-- 3. (user_id, provider)唯一索引，每个用户在同一个身份提供方只能绑定一个账号
+DROP TABLE IF EXISTS `user_identity`;
+CREATE TABLE `user_identity` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- 关联的bluebell用户ID
+    `provider` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '身份提供方',  -- 配置项oidc.providers中的名称，如google
+    `subject` varchar(255) COLLATE utf8mb4_general_ci NOT NULL COMMENT '身份提供方的用户标识',  -- ID token中的sub
+    `email` varchar(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '身份提供方返回的邮箱',  -- 只用于展示
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '绑定时间',
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_provider_subject` (`provider`, `subject`),  -- 同一个身份提供方账号只能关联一个用户
+    UNIQUE KEY `uk_user_provider` (`user_id`, `provider`)      -- 每个用户在同一个身份提供方只能绑定一个账号
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- ==================== 个人API key表 (api_key) ====================
+-- 设计思路：
+-- 1. 机器人和第三方集成使用API key访问接口，每个key有名称和权限范围（read、post、vote），用户可以随时吊销
+-- 2. 只保存key的sha256，完整的key只在创建时返回一次；key_prefix保存key的前几个字符，方便用户在列表中辨认
+-- 3. 吊销时记录revoke_time，不删除记录；认证时只查询未吊销的key
+-- 4. last_used_time和last_used_ip记录最近一次使用，同一个key在api_key.last_used_interval秒内只更新一次
+DROP TABLE IF EXISTS `api_key`;
+CREATE TABLE `api_key` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,           -- 自增主键
+    `key_id` bigint(20) NOT NULL COMMENT 'API key id',  -- 业务主键，雪花算法生成
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',     -- API key所属的用户
+    `name` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '名称',  -- 用户起的名称
+    `key_prefix` varchar(16) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'key前缀',  -- key的前几个字符，用于辨认
+    `key_hash` char(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'key的sha256',
+    `scopes` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '权限范围',  -- 逗号分隔，如read,post
+    `expire_time` timestamp NULL DEFAULT NULL COMMENT '过期时间',  -- NULL表示永不过期
+    `last_used_time` timestamp NULL DEFAULT NULL COMMENT '最近使用时间',  -- NULL表示从未使用
+    `last_used_ip` varchar(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '最近使用的IP',
+    `revoke_time` timestamp NULL DEFAULT NULL COMMENT '吊销时间',  -- NULL表示未吊销
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),                               -- 主键索引
+    UNIQUE KEY `uk_key_id` (`key_id`),                -- API key id唯一索引
+    UNIQUE KEY `uk_key_hash` (`key_hash`),            -- 认证时按key的sha256查询
+    KEY `idx_user_id` (`user_id`)                     -- 优化查询用户的API key列表
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,21 @@
+package models
+
+// 第三方登录
+// 用户通过OIDC身份提供方（如Google、公司SSO）登录，身份提供方账号的唯一标识(provider, subject)关联到user表中的用户。
+// 第一次登录时自动注册新用户，已登录的用户也可以主动绑定身份提供方账号。
+
+// UserIdentity 用户在身份提供方的账号，对应user_identity表
+type UserIdentity struct {
+	UserID   int64  `db:"user_id"`
+	Provider string `db:"provider"` // 身份提供方名称，即配置项oidc.providers中的key
+	Subject  string `db:"subject"`  // 用户在身份提供方的唯一标识，即ID token中的sub
+	Email    string `db:"email"`    // 绑定时身份提供方返回的邮箱，只用于展示
+}
+
+// OIDCState 跳转到身份提供方登录前保存的登录请求，跳转回来时按state取出
+type OIDCState struct {
+	Provider string // 身份提供方名称，跳转回来的地址必须是同一个身份提供方
+	Nonce    string // 写入ID token的nonce
+	Verifier string // PKCE的code_verifier
+	UserID   int64  // 绑定身份提供方账号的用户，为0表示登录
+}
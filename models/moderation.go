@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// 社区管理
+// 版主（社区内的moderator角色）可以移除、锁定、置顶本社区的帖子，禁止用户在本社区发帖，
+// 每一次操作都记录到mod_log表中，按社区公开给版主查看
+
+// ModAction 管理操作类型，对应mod_log表的action字段
+type ModAction string
+
+const (
+	ModActionRemovePost ModAction = "post.remove" // 移除帖子
+	ModActionLockPost   ModAction = "post.lock"   // 锁定帖子，不允许投票
+	ModActionUnlockPost ModAction = "post.unlock" // 解锁帖子
+	ModActionPinPost    ModAction = "post.pin"    // 置顶帖子
+	ModActionUnpinPost  ModAction = "post.unpin"  // 取消置顶
+	ModActionBanUser    ModAction = "user.ban"    // 禁止用户在社区发帖
+	ModActionUnbanUser  ModAction = "user.unban"  // 解除禁止
+
+	// 用户举报相关的操作，见report.go
+	ModActionHidePost      ModAction = "post.hide"      // 举报次数过多自动隐藏帖子，操作人为0
+	ModActionRestorePost   ModAction = "post.restore"   // 举报不成立，恢复自动隐藏的帖子
+	ModActionDismissReport ModAction = "report.dismiss" // 举报不成立，内容保留
+)
+
+// ModLog 管理日志，对应mod_log表
+type ModLog struct {
+	ID          int64     `json:"id,string" db:"id"`
+	CommunityID int64     `json:"community_id" db:"community_id"`      // 操作所在的社区
+	OperatorID  int64     `json:"operator_id,string" db:"operator_id"` // 执行操作的版主或管理员
+	Action      ModAction `json:"action" db:"action"`
+	TargetID    int64     `json:"target_id,string" db:"target_id"` // 帖子操作为帖子id，用户操作为用户id
+	Reason      string    `json:"reason" db:"reason"`
+	CreateTime  time.Time `json:"create_time" db:"create_time"`
+}
+
+// CommunityBan 社区禁言记录，对应community_ban表
+type CommunityBan struct {
+	CommunityID int64      `json:"community_id" db:"community_id"`
+	UserID      int64      `json:"user_id,string" db:"user_id"`
+	OperatorID  int64      `json:"operator_id,string" db:"operator_id"`
+	Reason      string     `json:"reason" db:"reason"`
+	ExpireTime  *time.Time `json:"expire_time" db:"expire_time"` // 为空表示永久禁止
+	CreateTime  time.Time  `json:"create_time" db:"create_time"`
+}
+
+// Active 禁言是否仍然有效
+func (b *CommunityBan) Active(now time.Time) bool {
+	return b.ExpireTime == nil || b.ExpireTime.After(now)
+}
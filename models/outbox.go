@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// OutboxEventType 事务发件箱中的事件类型
+// 新增事件类型时在这里追加，并在消费方通过outbox.RegisterHandler注册处理函数
+type OutboxEventType string
+
+const (
+	OutboxEventPostCreated OutboxEventType = "post.created" // 帖子已创建，payload为PostCreatedEvent
+)
+
+// 事件状态，与outbox表status字段的取值保持一致
+const (
+	OutboxStatusPending int8 = 0 // 待处理（包括等待重试）
+	OutboxStatusDone    int8 = 1 // 已处理
+	OutboxStatusFailed  int8 = 2 // 重试次数用尽，不再自动处理
+)
+
+// OutboxEvent 事务发件箱中的事件，对应outbox表
+type OutboxEvent struct {
+	ID            int64           `db:"id"`
+	EventType     OutboxEventType `db:"event_type"`
+	AggregateID   int64           `db:"aggregate_id"` // 事件所属的业务对象ID，如帖子ID
+	Payload       string          `db:"payload"`      // 事件内容，JSON格式
+	Status        int8            `db:"status"`
+	RetryCount    int64           `db:"retry_count"`
+	NextRetryTime time.Time       `db:"next_retry_time"`
+	LastError     string          `db:"last_error"`
+	CreateTime    time.Time       `db:"create_time"`
+}
+
+// PostCreatedEvent 帖子已创建事件的内容
+type PostCreatedEvent struct {
+	PostID      int64 `json:"post_id,string"`
+	CommunityID int64 `json:"community_id"`
+	CreateTime  int64 `json:"create_time"` // 发帖时间戳，与post表的create_time一致
+}
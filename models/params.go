@@ -12,6 +12,7 @@ type ParamSignUp struct {
 	Username   string `json:"username" binding:"required"`
 	Password   string `json:"password" binding:"required"`
 	RePassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+	Email      string `json:"email" binding:"omitempty,email,max=64"` // 可选，填写后发送验证邮件
 }
 
 // ParamLogin 登录请求参数
@@ -20,6 +21,66 @@ type ParamLogin struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ParamTwoFactorCode 两步验证的验证码参数，用于确认开启和关闭两步验证
+type ParamTwoFactorCode struct {
+	Code string `json:"code" binding:"required"` // 验证器App上的6位验证码，关闭时也可以使用恢复码
+}
+
+// ParamLoginTwoFactor 两步验证登录请求参数
+type ParamLoginTwoFactor struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"` // 校验密码成功后返回的challenge token
+	Code           string `json:"code" binding:"required"`            // 验证器App上的6位验证码或恢复码
+}
+
+// ParamOIDCCallback 身份提供方跳转回bluebell时的查询参数
+type ParamOIDCCallback struct {
+	State            string `form:"state" binding:"required"` // 跳转到身份提供方时带的state
+	Code             string `form:"code"`                     // 授权码，用户拒绝授权时为空
+	Error            string `form:"error"`                    // 用户拒绝授权等情况下身份提供方返回的错误码
+	ErrorDescription string `form:"error_description"`        // 错误说明
+}
+
+// ParamCreateAPIKey 创建API key请求参数
+type ParamCreateAPIKey struct {
+	Name       string   `json:"name" binding:"required,max=64"`                            // API key的名称
+	Scopes     []string `json:"scopes" binding:"required,min=1,dive,oneof=read post vote"` // 权限范围
+	ExpireDays int      `json:"expire_days" binding:"min=0,max=3650"`                      // 有效天数，0表示永不过期
+}
+
+// ParamForgotPassword 忘记密码请求参数
+type ParamForgotPassword struct {
+	Email string `json:"email" binding:"required,email"` // 已验证的邮箱，重置密码链接发送到该邮箱
+}
+
+// ParamResetPassword 重置密码请求参数
+type ParamResetPassword struct {
+	Token      string `json:"token" binding:"required"` // 重置密码邮件中的token
+	Password   string `json:"password" binding:"required"`
+	RePassword string `json:"confirm_password" binding:"required,eqfield=Password"`
+}
+
+// ParamRefreshToken 刷新token请求参数
+type ParamRefreshToken struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ParamLogout 退出登录请求参数
+type ParamLogout struct {
+	RefreshToken string `json:"refresh_token"` // 同时吊销该refresh token所属的会话，为空时吊销当前access token所属的会话
+}
+
+// ParamUpdatePost 编辑帖子请求参数
+type ParamUpdatePost struct {
+	Title   string `json:"title" binding:"required"`   // 新标题
+	Content string `json:"content" binding:"required"` // 新内容
+}
+
+// ParamComment 发表评论请求参数
+type ParamComment struct {
+	ParentID int64  `json:"parent_id,string"`                    // 回复的评论id，为空表示直接评论帖子
+	Content  string `json:"content" binding:"required,max=1024"` // 评论内容
+}
+
 // ParamVoteData 投票数据
 type ParamVoteData struct {
 	// UserID 从请求中获取当前的用户
@@ -34,3 +95,37 @@ type ParamPostList struct {
 	Size        int64  `json:"size" form:"size" example:"10"`      // 每页数据量
 	Order       string `json:"order" form:"order" example:"score"` // 排序依据
 }
+
+// ParamUserRole 授予或收回角色请求参数
+type ParamUserRole struct {
+	UserID      int64  `json:"user_id,string" binding:"required"`             // 用户id
+	Role        string `json:"role" binding:"required,oneof=moderator admin"` // 角色
+	CommunityID int64  `json:"community_id"`                                  // 角色生效的社区，moderator必填，admin为空
+}
+
+// ParamModeration 版主操作帖子的请求参数
+type ParamModeration struct {
+	Reason string `json:"reason" binding:"max=256"` // 操作原因，记录到管理日志
+}
+
+// ParamBanUser 禁止用户在社区发帖的请求参数
+type ParamBanUser struct {
+	UserID   int64  `json:"user_id,string" binding:"required"` // 被禁止的用户id
+	Duration int64  `json:"duration" binding:"min=0"`          // 禁止时长，单位小时，0表示永久
+	Reason   string `json:"reason" binding:"max=256"`          // 禁止原因，记录到管理日志
+}
+
+// ParamReport 举报请求参数
+type ParamReport struct {
+	TargetType ReportTargetType `json:"target_type" binding:"required,oneof=1"`                        // 被举报对象类型，目前只支持帖子(1)
+	TargetID   int64            `json:"target_id,string" binding:"required"`                           // 被举报对象id
+	Reason     string           `json:"reason" binding:"required,oneof=spam abuse illegal porn other"` // 举报原因
+	Detail     string           `json:"detail" binding:"max=512"`                                      // 补充说明
+}
+
+// ParamReportList 获取举报列表query string参数
+type ParamReportList struct {
+	Status int8  `json:"status" form:"status" binding:"oneof=0 1 2"` // 处理状态，默认为待处理
+	Page   int64 `json:"page" form:"page" example:"1"`               // 页码
+	Size   int64 `json:"size" form:"size" example:"10"`              // 每页数据量
+}
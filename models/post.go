@@ -8,13 +8,21 @@ import "time" // 导入时间包，用于时间类型定义
 // Go语言中结构体字段的排列顺序会影响内存占用
 // 按照字段大小从大到小排列可以减少内存碎片，提高访问效率
 
+// 帖子状态，与post表status字段的取值保持一致
+const (
+	PostStatusDeleted int32 = 0 // 已删除（软删除），不再出现在任何列表和详情中
+	PostStatusNormal  int32 = 1 // 正常
+	PostStatusRemoved int32 = 2 // 被版主移除，与已删除一样不再出现在列表和详情中
+	PostStatusHidden  int32 = 3 // 被举报次数过多自动隐藏，等待管理员处理，处理前不出现在列表和详情中
+)
+
 // Post 帖子数据模型
 // 定义帖子的基本信息结构，对应数据库中的帖子表
 type Post struct {
 	ID          int64     `json:"id,string" db:"post_id"`                            // 帖子ID，使用雪花算法生成，JSON序列化时转为字符串避免精度丢失
 	AuthorID    int64     `json:"author_id" db:"author_id"`                          // 作者ID，关联用户表
 	CommunityID int64     `json:"community_id" db:"community_id" binding:"required"` // 社区ID，关联社区表，必填字段
-	Status      int32     `json:"status" db:"status"`                                // 帖子状态，如：1-正常，2-已删除
+	Status      int32     `json:"status" db:"status"`                                // 帖子状态，取值见PostStatus系列常量
 	Title       string    `json:"title" db:"title" binding:"required"`               // 帖子标题，必填字段
 	Content     string    `json:"content" db:"content" binding:"required"`           // 帖子内容，必填字段
 	CreateTime  time.Time `json:"create_time" db:"create_time"`                      // 帖子创建时间
@@ -25,6 +33,9 @@ type Post struct {
 type ApiPostDetail struct {
 	AuthorName       string             `json:"author_name"` // 作者名称，通过关联查询获取
 	VoteNum          int64              `json:"vote_num"`    // 投票数量，包括赞成票和反对票的差值
+	CommentNum       int64              `json:"comment_num"` // 评论数量，包括楼中楼的回复
+	Pinned           bool               `json:"pinned"`      // 是否被版主置顶，只在社区帖子列表中返回
+	Locked           bool               `json:"locked"`      // 是否被版主锁定，锁定后不允许投票，只在帖子详情中返回
 	*Post                               // 嵌入帖子结构体，继承帖子的所有字段
 	*CommunityDetail `json:"community"` // 嵌入社区信息，包含社区名称等详细信息
 }
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// 用户举报
+// 用户对帖子（以后还有评论等其他内容）的举报按对象汇总，管理员按未处理的举报数从多到少处理。
+// 同一用户对同一对象只能举报一次。未处理的举报数达到report.hide_threshold时，帖子自动隐藏等待处理。
+
+// ReportTargetType 被举报对象的类型，对应report_target表的target_type字段
+type ReportTargetType int8
+
+const (
+	ReportTargetPost ReportTargetType = 1 // 帖子
+)
+
+// 举报原因，与ParamReport的binding保持一致
+const (
+	ReportReasonSpam    = "spam"    // 垃圾广告
+	ReportReasonAbuse   = "abuse"   // 辱骂、人身攻击
+	ReportReasonIllegal = "illegal" // 违法违规
+	ReportReasonPorn    = "porn"    // 色情低俗
+	ReportReasonOther   = "other"   // 其他，需要在detail中说明
+
+	ReportReasonSensitive = "sensitive" // 命中敏感词，由系统自动举报，举报人为0，用户不能选择
+)
+
+// 被举报对象的处理状态
+const (
+	ReportStatusOpen      int8 = 0 // 待处理
+	ReportStatusResolved  int8 = 1 // 举报成立，内容已移除
+	ReportStatusDismissed int8 = 2 // 举报不成立，内容保留
+)
+
+// Report 单条举报，对应report表
+type Report struct {
+	ID             int64     `json:"id,string" db:"id"`
+	ReportTargetID int64     `json:"report_target_id,string" db:"report_target_id"` // 所属的被举报对象
+	ReporterID     int64     `json:"reporter_id,string" db:"reporter_id"`
+	Reason         string    `json:"reason" db:"reason"`
+	Detail         string    `json:"detail" db:"detail"`
+	CreateTime     time.Time `json:"create_time" db:"create_time"`
+}
+
+// ReportTarget 被举报对象的汇总，对应report_target表
+type ReportTarget struct {
+	ID          int64            `json:"id,string" db:"id"`
+	TargetType  ReportTargetType `json:"target_type" db:"target_type"`
+	TargetID    int64            `json:"target_id,string" db:"target_id"`
+	CommunityID int64            `json:"community_id" db:"community_id"`
+	ReportCount int64            `json:"report_count" db:"report_count"` // 未处理的举报数，处理后清零
+	Status      int8             `json:"status" db:"status"`             // 取值见ReportStatus系列常量
+	HandlerID   int64            `json:"handler_id,string" db:"handler_id"`
+	HandleTime  *time.Time       `json:"handle_time" db:"handle_time"`
+	UpdateTime  time.Time        `json:"update_time" db:"update_time"` // 最近一次被举报或处理的时间
+	Reasons     map[string]int64 `json:"reasons" db:"-"`               // 未处理的举报按原因统计的数量
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// 角色和权限
+// 所有登录用户都有user角色，不需要保存；moderator和admin角色保存在user_role表中。
+// 角色可以限定在某个社区内：community_id为0表示全局角色，否则只在该社区内生效。
+// 角色在签发token时写入MyClaims，修改角色后最迟在access token过期、刷新token后生效。
+
+const (
+	RoleUser      = "user"      // 普通用户
+	RoleModerator = "moderator" // 版主，一般限定在某个社区
+	RoleAdmin     = "admin"     // 管理员，拥有所有权限
+)
+
+// Permission 权限
+type Permission string
+
+const (
+	PermissionModeratePost Permission = "post:moderate"    // 管理帖子：移除、锁定、置顶
+	PermissionBanUser      Permission = "user:ban"         // 在社区内封禁用户
+	PermissionViewModLog   Permission = "modlog:view"      // 查看管理日志
+	PermissionManageRole   Permission = "role:manage"      // 授予和收回角色
+	PermissionReconcile    Permission = "system:reconcile" // 查看和执行数据对账
+	PermissionHandleReport Permission = "report:handle"    // 处理用户举报
+)
+
+// rolePermissions 每个角色拥有的权限，admin拥有所有权限不需要列出
+var rolePermissions = map[string][]Permission{
+	RoleModerator: {PermissionModeratePost, PermissionBanUser, PermissionViewModLog},
+}
+
+var ErrInvalidRole = errors.New("无效的角色")
+
+// UserRole 用户角色，对应user_role表
+type UserRole struct {
+	UserID      int64  `json:"user_id,string" db:"user_id"`
+	Role        string `json:"role" db:"role"`
+	CommunityID int64  `json:"community_id" db:"community_id"` // 0表示全局角色
+}
+
+// String 角色的字符串形式，全局角色为角色名，社区角色为 角色名:社区id，如 moderator:1
+func (r *UserRole) String() string {
+	if r.CommunityID == 0 {
+		return r.Role
+	}
+	return r.Role + ":" + strconv.FormatInt(r.CommunityID, 10)
+}
+
+// ParseUserRole 解析String生成的角色字符串
+func ParseUserRole(s string) (*UserRole, error) {
+	role, cid, found := strings.Cut(s, ":")
+	r := &UserRole{Role: role}
+	if found {
+		id, err := strconv.ParseInt(cid, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRole
+		}
+		r.CommunityID = id
+	}
+	if r.Role != RoleModerator && r.Role != RoleAdmin {
+		return nil, ErrInvalidRole
+	}
+	return r, nil
+}
+
+// Roles 用户拥有的角色
+type Roles []*UserRole
+
+// ParseRoles 解析token中的角色列表，无法识别的角色忽略
+func ParseRoles(list []string) Roles {
+	roles := make(Roles, 0, len(list))
+	for _, s := range list {
+		if r, err := ParseUserRole(s); err == nil {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// Strings 转换为写入token的角色列表
+func (rs Roles) Strings() []string {
+	list := make([]string, 0, len(rs))
+	for _, r := range rs {
+		list = append(list, r.String())
+	}
+	return list
+}
+
+// HasRole 是否拥有角色
+// 参数 communityID: 在哪个社区内检查，0表示只接受全局角色；全局角色在所有社区内都有效
+func (rs Roles) HasRole(role string, communityID int64) bool {
+	if role == RoleUser {
+		return true
+	}
+	for _, r := range rs {
+		if r.Role != role {
+			continue
+		}
+		if r.CommunityID == 0 || r.CommunityID == communityID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 是否拥有权限
+// 参数 communityID: 在哪个社区内检查，0表示只接受全局角色的权限
+func (rs Roles) HasPermission(perm Permission, communityID int64) bool {
+	if rs.HasRole(RoleAdmin, communityID) {
+		return true
+	}
+	for _, r := range rs {
+		if r.CommunityID != 0 && r.CommunityID != communityID {
+			continue
+		}
+		for _, p := range rolePermissions[r.Role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
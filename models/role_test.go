@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestRoles(t *testing.T) {
+	roles := ParseRoles([]string{"moderator:1", "unknown", "moderator:x"})
+	if len(roles) != 1 || roles[0].String() != "moderator:1" {
+		t.Fatalf("ParseRoles got %v", roles.Strings())
+	}
+
+	// 社区版主只在自己的社区内有权限
+	if !roles.HasPermission(PermissionModeratePost, 1) {
+		t.Fatal("moderator:1 should moderate community 1")
+	}
+	if roles.HasPermission(PermissionModeratePost, 2) || roles.HasPermission(PermissionModeratePost, 0) {
+		t.Fatal("moderator:1 should not moderate other communities")
+	}
+	if roles.HasPermission(PermissionManageRole, 1) {
+		t.Fatal("moderator should not manage roles")
+	}
+	if !roles.HasRole(RoleUser, 0) || roles.HasRole(RoleAdmin, 1) {
+		t.Fatal("unexpected HasRole result")
+	}
+
+	// 全局管理员在所有社区内拥有所有权限
+	admin := ParseRoles([]string{"admin"})
+	if !admin.HasPermission(PermissionReconcile, 0) || !admin.HasPermission(PermissionBanUser, 3) {
+		t.Fatal("admin should have all permissions")
+	}
+}
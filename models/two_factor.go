@@ -0,0 +1,19 @@
+package models
+
+// 两步验证
+// 用户开启两步验证后，登录时校验密码成功不再直接签发token，而是返回一个短期有效的challenge token，
+// 客户端再提交challenge token和验证器App上的验证码（或恢复码）完成登录。
+
+// UserTOTP 用户的TOTP密钥，对应user_totp表
+type UserTOTP struct {
+	UserID      int64  `db:"user_id"`
+	Secret      string `db:"secret"`       // base32编码的密钥
+	Enabled     bool   `db:"enabled"`      // false表示已生成密钥，等待用户确认
+	LastCounter int64  `db:"last_counter"` // 最近一次使用的验证码所在的时间步
+}
+
+// TwoFactorSetup 开启两步验证时返回给用户的密钥
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`      // 无法扫码时手动输入验证器App的密钥
+	URI    string `json:"otpauth_uri"` // otpauth URI，前端生成二维码供验证器App扫描
+}
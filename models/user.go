@@ -5,8 +5,13 @@ package models
 // User 用户数据模型
 // 定义用户的基本信息结构，对应数据库中的用户表
 type User struct {
-	UserID   int64  `db:"user_id"`  // 用户ID，使用雪花算法生成的唯一标识
-	Username string `db:"username"` // 用户名，用于登录和显示
-	Password string `db:"password"` // 密码，存储加密后的密码哈希值
-	Token    string // JWT令牌，用于身份认证（不存储到数据库）
+	UserID        int64  `db:"user_id"`        // 用户ID，使用雪花算法生成的唯一标识
+	Username      string `db:"username"`       // 用户名，用于登录和显示
+	Password      string `db:"password"`       // 密码，存储加密后的密码哈希值
+	Email         string `db:"email"`          // 邮箱，可选，未设置时为空字符串
+	EmailVerified bool   `db:"email_verified"` // 邮箱是否已验证，只有验证过的邮箱可以找回密码
+	Token         string // JWT令牌（access token），用于身份认证（不存储到数据库）
+	RefreshToken  string // 用于换取新access token的refresh token（不存储到数据库）
+
+	ChallengeToken string // 开启两步验证的用户校验密码成功后返回的challenge token，此时不签发Token和RefreshToken
 }
@@ -0,0 +1,27 @@
+package models
+
+// VoteTargetType 可投票对象的类型，对应vote表的target_type字段
+// 新增可投票对象时在这里追加类型，并在dao/redis中注册对应的VoteTarget
+type VoteTargetType int8
+
+const (
+	VoteTargetPost VoteTargetType = 1 // 帖子
+)
+
+// VoteArchive 投票归档数据
+// 投票时间窗口结束后，Redis中的最终投票数会归档到vote_archive表
+type VoteArchive struct {
+	TargetType VoteTargetType `db:"target_type"` // 投票对象类型
+	TargetID   int64          `db:"target_id"`   // 投票对象ID
+	UpVotes    int64          `db:"up_votes"`    // 赞成票数
+	DownVotes  int64          `db:"down_votes"`  // 反对票数
+}
+
+// Vote 用户投票记录，对应vote表
+type Vote struct {
+	TargetType VoteTargetType `db:"target_type"` // 投票对象类型
+	TargetID   int64          `db:"target_id"`   // 投票对象ID
+	UserID     int64          `db:"user_id"`     // 投票用户ID
+	VoteType   int8           `db:"vote_type"`   // 投票值：1=赞成，-1=反对，0=取消投票
+	VoteTime   int64          `db:"vote_time"`   // 投票发生的毫秒时间戳
+}
@@ -1,56 +1,99 @@
 package jwt
 
 import (
+	"bluebell/setting"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
-	"github.com/spf13/viper"
-
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-var mySecret = []byte("夏天夏天悄悄过去")
+const defaultAccessTokenExpire = 30 * time.Minute // 未配置时access token的有效期
 
 // MyClaims 自定义声明结构体并内嵌jwt.StandardClaims
 // jwt包自带的jwt.StandardClaims只包含了官方字段
 // 我们这里需要额外记录一个username字段，所以要自定义结构体
 // 如果想要保存更多信息，都可以添加到这个结构体中
+// StandardClaims.Id 即jti，每个token唯一，用于吊销单个token
+// SessionID 即登录会话id，同一次登录后刷新得到的token共用一个会话id
+// Roles 即用户在签发时拥有的角色，格式见models.UserRole.String，普通用户为空
 type MyClaims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int64    `json:"user_id"`
+	Username  string   `json:"username"`
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
 	jwt.StandardClaims
 }
 
+// AccessTokenExpire access token的有效期，配置项auth.access_token_expire，单位分钟
+func AccessTokenExpire() time.Duration {
+	if cfg := setting.Conf; cfg != nil && cfg.AuthConfig != nil && cfg.AuthConfig.AccessTokenExpire > 0 {
+		return time.Duration(cfg.AuthConfig.AccessTokenExpire) * time.Minute
+	}
+	return defaultAccessTokenExpire
+}
+
 // GenToken 生成JWT
-func GenToken(userID int64, username string) (string, error) {
+// 参数 sessionID: token所属的登录会话id
+// 参数 roles: 用户的角色列表
+// 返回值 jti: token的唯一id，吊销token时使用
+func GenToken(userID int64, username, sessionID string, roles []string) (token, jti string, err error) {
+	if keySet == nil {
+		return "", "", ErrNoActiveKey
+	}
+	jti, err = newTokenID()
+	if err != nil {
+		return "", "", err
+	}
 	// 创建一个我们自己的声明的数据
 	c := MyClaims{
 		userID,
-		"username", // 自定义字段
+		username, // 自定义字段
+		sessionID,
+		roles,
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(
-				time.Duration(viper.GetInt("auth.jwt_expire")) * time.Hour).Unix(), // 过期时间
-			Issuer: "bluebell", // 签发人
+			Id:        jti,
+			ExpiresAt: time.Now().Add(AccessTokenExpire()).Unix(), // 过期时间
+			Issuer:    keySet.issuer,                              // 签发人
 		},
 	}
-	// 使用指定的签名方法创建签名对象
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
-	// 使用指定的secret签名并获得完整的编码后的字符串token
-	return token.SignedString(mySecret)
+	// 使用当前密钥的签名方法创建签名对象，头部写入kid，校验时据此找到密钥
+	key := keySet.active
+	t := jwt.NewWithClaims(key.Method, c)
+	t.Header["kid"] = key.Kid
+	// 使用当前密钥签名并获得完整的编码后的字符串token
+	token, err = t.SignedString(key.signKey)
+	return token, jti, err
 }
 
 // ParseToken 解析JWT
 func ParseToken(tokenString string) (*MyClaims, error) {
-	// 解析token
+	if keySet == nil {
+		return nil, ErrNoActiveKey
+	}
+	// 解析token，按头部的kid选择校验密钥
 	var mc = new(MyClaims)
-	token, err := jwt.ParseWithClaims(tokenString, mc, func(token *jwt.Token) (i interface{}, err error) {
-		return mySecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, mc, keySet.lookup)
 	if err != nil {
 		return nil, err
 	}
-	if token.Valid { // 校验token
-		return mc, nil
+	if !token.Valid { // 校验token
+		return nil, errors.New("invalid token")
+	}
+	// 只接受本服务签发的token，配置了issuer时校验iss
+	if keySet.issuer != "" && !mc.VerifyIssuer(keySet.issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	return mc, nil
+}
+
+// newTokenID 生成随机的token id
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return nil, errors.New("invalid token")
+	return hex.EncodeToString(b), nil
 }
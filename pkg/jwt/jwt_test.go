@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"bluebell/setting"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// writePEM 把私钥写入临时目录，返回文件路径
+func writePEM(t *testing.T, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey failed, err:%v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("os.WriteFile failed, err:%v", err)
+	}
+	return path
+}
+
+func TestGenAndParseToken(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys := []*setting.JWTKeyConfig{
+		{Kid: "hs", Alg: "HS256", Secret: testSecret + "hs"},
+		{Kid: "rs", Alg: "RS256", PrivateKeyFile: writePEM(t, "rsa.pem", rsaKey)},
+		{Kid: "ed", Alg: "EdDSA", PrivateKeyFile: writePEM(t, "ed.pem", edKey)},
+	}
+
+	for _, kid := range []string{"hs", "rs", "ed"} {
+		if err := Init(&setting.JWTConfig{Issuer: "bluebell", ActiveKid: kid, Keys: keys}); err != nil {
+			t.Fatalf("Init with active kid %s failed, err:%v", kid, err)
+		}
+		token, jti, err := GenToken(123, "q1mi", "sid", []string{"admin", "moderator:1"})
+		if err != nil {
+			t.Fatalf("%s: GenToken failed, err:%v", kid, err)
+		}
+		mc, err := ParseToken(token)
+		if err != nil {
+			t.Fatalf("%s: ParseToken failed, err:%v", kid, err)
+		}
+		if mc.UserID != 123 || mc.Username != "q1mi" || mc.SessionID != "sid" || mc.Id != jti || len(mc.Roles) != 2 {
+			t.Fatalf("%s: unexpected claims: %+v", kid, mc)
+		}
+	}
+
+	// 只有rs和ed的公钥会公开
+	if n := len(PublicKeys().Keys); n != 2 {
+		t.Fatalf("PublicKeys got %d keys, want 2", n)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := &setting.JWTKeyConfig{Kid: "old", Alg: "HS256", Secret: testSecret + "old"}
+	_ = Init(&setting.JWTConfig{ActiveKid: "old", Keys: []*setting.JWTKeyConfig{old}})
+	token, _, _ := GenToken(1, "a", "s", nil)
+
+	// 轮换后旧密钥签发的token仍然有效
+	_ = Init(&setting.JWTConfig{ActiveKid: "new", Keys: []*setting.JWTKeyConfig{
+		{Kid: "new", Alg: "HS256", Secret: testSecret + "new"}, old,
+	}})
+	if _, err := ParseToken(token); err != nil {
+		t.Fatalf("ParseToken signed by rotated key failed, err:%v", err)
+	}
+
+	// 旧密钥删除后不再有效
+	_ = Init(&setting.JWTConfig{ActiveKid: "new", Keys: []*setting.JWTKeyConfig{
+		{Kid: "new", Alg: "HS256", Secret: testSecret + "new"},
+	}})
+	if _, err := ParseToken(token); err == nil {
+		t.Fatal("ParseToken signed by removed key should fail")
+	}
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	_ = Init(&setting.JWTConfig{ActiveKid: "ed", Keys: []*setting.JWTKeyConfig{
+		{Kid: "ed", Alg: "EdDSA", PrivateKeyFile: writePEM(t, "ed.pem", edKey)},
+	}})
+
+	// 使用HS256伪造kid为ed的token，必须校验失败
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, MyClaims{UserID: 1})
+	forged.Header["kid"] = "ed"
+	token, _ := forged.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	if _, err := ParseToken(token); err == nil {
+		t.Fatal("ParseToken with mismatched algorithm should fail")
+	}
+}
+
+func TestHMACSecret(t *testing.T) {
+	cases := []struct {
+		secret string
+		ok     bool
+	}{
+		{"", false},
+		{"secret", false},
+		{"夏天夏天悄悄过去", false},
+		{testSecret, true},
+	}
+	for _, tc := range cases {
+		_, err := NewKeySet(&setting.JWTConfig{ActiveKid: "hs", Keys: []*setting.JWTKeyConfig{
+			{Kid: "hs", Alg: "HS256", Secret: tc.secret},
+		}})
+		if (err == nil) != tc.ok {
+			t.Fatalf("NewKeySet with secret %q got err:%v, want ok=%v", tc.secret, err, tc.ok)
+		}
+	}
+
+	// 没有配置secret时使用环境变量
+	t.Setenv("BLUEBELL_TEST_JWT_SECRET", testSecret)
+	if _, err := NewKeySet(&setting.JWTConfig{ActiveKid: "hs", Keys: []*setting.JWTKeyConfig{
+		{Kid: "hs", Alg: "HS256", SecretEnv: "BLUEBELL_TEST_JWT_SECRET"},
+	}}); err != nil {
+		t.Fatalf("NewKeySet with secret env failed, err:%v", err)
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	keys := []*setting.JWTKeyConfig{{Kid: "hs", Alg: "HS256", Secret: testSecret}}
+	_ = Init(&setting.JWTConfig{Issuer: "other", ActiveKid: "hs", Keys: keys})
+	token, _, _ := GenToken(1, "a", "s", nil)
+
+	// 同一个密钥、其他issuer签发的token不被接受
+	_ = Init(&setting.JWTConfig{Issuer: "bluebell", ActiveKid: "hs", Keys: keys})
+	if _, err := ParseToken(token); err == nil {
+		t.Fatal("ParseToken with other issuer should fail")
+	}
+	token, _, _ = GenToken(1, "a", "s", nil)
+	if _, err := ParseToken(token); err != nil {
+		t.Fatalf("ParseToken failed, err:%v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package jwt
+
+import (
+	"bluebell/setting"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 签名密钥
+// 密钥列表中的每个密钥都有唯一的kid，签发token时使用active_kid对应的密钥并把kid写入token头部，
+// 校验时按头部的kid找到对应的密钥。轮换密钥的步骤：
+//   1. 在列表中加入新密钥，把active_kid改为新密钥的kid
+//   2. 旧密钥保留在列表中（可以只保留公钥），用它签发的token在过期前仍然有效
+//   3. 旧token全部过期后，从列表中删除旧密钥
+// RS256和EdDSA密钥的公钥通过 /.well-known/jwks.json 公开，其他服务可以用它校验bluebell签发的token
+
+// minHMACSecretLen HS256密钥的最小长度，与签名结果的长度相同（RFC 7518 3.2）
+const minHMACSecretLen = 32
+
+// sampleSecrets 曾经公开在代码和示例配置中的密钥，任何人都可以用它们伪造token
+var sampleSecrets = map[string]bool{
+	"夏天夏天悄悄过去": true,
+}
+
+var (
+	ErrNoActiveKey = errors.New("jwt active key not found or has no private key")
+	ErrUnknownKid  = errors.New("jwt kid not found")
+)
+
+// Key 签名密钥
+type Key struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	signKey   interface{} // 签名使用的密钥，只用于校验的密钥为nil
+	verifyKey interface{} // 校验使用的密钥
+}
+
+// KeySet 密钥列表
+type KeySet struct {
+	issuer string
+	active *Key
+	keys   map[string]*Key
+}
+
+var keySet *KeySet
+
+// Init 根据配置加载签名密钥
+func Init(cfg *setting.JWTConfig) (err error) {
+	keySet, err = NewKeySet(cfg)
+	return
+}
+
+// NewKeySet 根据配置创建密钥列表
+func NewKeySet(cfg *setting.JWTConfig) (*KeySet, error) {
+	if cfg == nil {
+		return nil, errors.New("jwt config is empty")
+	}
+	ks := &KeySet{
+		issuer: cfg.Issuer,
+		keys:   make(map[string]*Key, len(cfg.Keys)),
+	}
+	for _, kc := range cfg.Keys {
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key %q failed: %w", kc.Kid, err)
+		}
+		if _, ok := ks.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate jwt kid: %q", k.Kid)
+		}
+		ks.keys[k.Kid] = k
+	}
+	ks.active = ks.keys[cfg.ActiveKid]
+	if ks.active == nil || ks.active.signKey == nil {
+		return nil, ErrNoActiveKey
+	}
+	return ks, nil
+}
+
+// lookup 按kid查找校验密钥，并确认token使用的算法与密钥一致，防止算法混淆攻击
+func (ks *KeySet) lookup(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+	return k.verifyKey, nil
+}
+
+// loadKey 加载单个密钥
+func loadKey(kc *setting.JWTKeyConfig) (k *Key, err error) {
+	if kc.Kid == "" {
+		return nil, errors.New("kid is empty")
+	}
+	k = &Key{Kid: kc.Kid}
+	switch kc.Alg {
+	case jwt.SigningMethodHS256.Alg():
+		k.Method = jwt.SigningMethodHS256
+		secret := fromEnv(kc.SecretEnv, kc.Secret)
+		if secret == "" {
+			return nil, fmt.Errorf("secret is empty, set it by env %s", kc.SecretEnv)
+		}
+		if sampleSecrets[secret] {
+			return nil, errors.New("secret is a public sample secret")
+		}
+		if len(secret) < minHMACSecretLen {
+			return nil, fmt.Errorf("secret is shorter than %d bytes", minHMACSecretLen)
+		}
+		k.signKey = []byte(secret)
+		k.verifyKey = k.signKey
+	case jwt.SigningMethodRS256.Alg():
+		k.Method = jwt.SigningMethodRS256
+		err = loadAsymmetricKey(k, kc,
+			func(b []byte) (crypto.PrivateKey, error) { return jwt.ParseRSAPrivateKeyFromPEM(b) },
+			func(b []byte) (crypto.PublicKey, error) { return jwt.ParseRSAPublicKeyFromPEM(b) },
+			func(priv crypto.PrivateKey) crypto.PublicKey { return &priv.(*rsa.PrivateKey).PublicKey })
+	case jwt.SigningMethodEdDSA.Alg():
+		k.Method = jwt.SigningMethodEdDSA
+		err = loadAsymmetricKey(k, kc,
+			jwt.ParseEdPrivateKeyFromPEM,
+			jwt.ParseEdPublicKeyFromPEM,
+			func(priv crypto.PrivateKey) crypto.PublicKey { return priv.(ed25519.PrivateKey).Public() })
+	default:
+		return nil, fmt.Errorf("unsupported alg: %q", kc.Alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// loadAsymmetricKey 加载RS256或EdDSA的私钥和公钥
+// 没有私钥的密钥只用于校验；没有配置公钥时从私钥推导
+func loadAsymmetricKey(k *Key, kc *setting.JWTKeyConfig,
+	parsePrivate func([]byte) (crypto.PrivateKey, error),
+	parsePublic func([]byte) (crypto.PublicKey, error),
+	publicOf func(crypto.PrivateKey) crypto.PublicKey,
+) error {
+	privPEM, err := readPEM(kc.PrivateKeyEnv, kc.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	if privPEM != nil {
+		priv, err := parsePrivate(privPEM)
+		if err != nil {
+			return err
+		}
+		k.signKey = priv
+		k.verifyKey = publicOf(priv)
+	}
+	if kc.PublicKeyFile != "" {
+		pubPEM, err := os.ReadFile(kc.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		if k.verifyKey, err = parsePublic(pubPEM); err != nil {
+			return err
+		}
+	}
+	if k.verifyKey == nil {
+		return errors.New("neither private key nor public key is configured")
+	}
+	return nil
+}
+
+// readPEM 优先从环境变量读取PEM，其次读取文件，都没有配置时返回nil
+func readPEM(env, file string) ([]byte, error) {
+	if v := fromEnv(env, ""); v != "" {
+		return []byte(v), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(file)
+}
+
+// fromEnv 环境变量有值时返回环境变量的值，否则返回默认值
+func fromEnv(name, def string) string {
+	if name != "" {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return def
+}
+
+// JWK 单个公钥，格式见RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA模数
+	E   string `json:"e,omitempty"`   // RSA指数
+	Crv string `json:"crv,omitempty"` // OKP曲线
+	X   string `json:"x,omitempty"`   // OKP公钥
+}
+
+// JWKS 公钥列表
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys 返回所有非对称密钥的公钥，HS256密钥不公开
+func PublicKeys() *JWKS {
+	set := &JWKS{Keys: make([]JWK, 0)}
+	if keySet == nil {
+		return set
+	}
+	for _, k := range keySet.keys {
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.Kid,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.Kid,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
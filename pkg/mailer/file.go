@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FileMailer 把邮件保存为目录下的.eml文件，可以用邮件客户端直接打开
+// 开发和测试环境使用，不需要真实的邮件服务器
+type FileMailer struct {
+	Dir  string // 保存邮件的目录，不存在时自动创建
+	From string
+}
+
+// Send 保存一封邮件，文件名为 发送时间-收件人.eml
+func (m *FileMailer) Send(msg *Message) error {
+	now := time.Now()
+	data, err := buildMessage(m.From, msg, now)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.NewReplacer("/", "_", "\\", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0644)
+}
+
+// LogMailer 只把邮件写入日志，没有配置邮件发送时的默认实现
+type LogMailer struct{}
+
+// Send 记录一封邮件
+func (LogMailer) Send(msg *Message) error {
+	zap.L().Info("mail not sent, log only",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
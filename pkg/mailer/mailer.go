@@ -0,0 +1,118 @@
+// Package mailer 提供邮件发送功能
+// 所有邮件都通过Mailer接口发送，实现由配置项mail.backend选择：
+//
+//	smtp 通过SMTP服务器发送，服务器支持STARTTLS时自动加密
+//	file 每封邮件保存为目录下的一个.eml文件，开发和测试环境使用，不需要邮件服务器
+//	log  只把邮件内容写入日志
+package mailer
+
+import (
+	"bluebell/setting"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BackendSMTP = "smtp"
+	BackendFile = "file"
+	BackendLog  = "log"
+)
+
+const defaultFrom = "bluebell <noreply@bluebell.local>"
+
+var ErrInvalidHeader = errors.New("邮件头包含换行符")
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string // 收件人地址
+	Subject string // 主题
+	Body    string // 正文，纯文本
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	// Send 发送一封邮件
+	Send(msg *Message) error
+}
+
+var current atomic.Value // Mailer，当前使用的实现
+
+func init() {
+	current.Store(holder{LogMailer{}})
+}
+
+// holder atomic.Value要求每次保存的具体类型相同
+type holder struct {
+	Mailer
+}
+
+// Init 根据配置选择邮件发送的实现，没有配置时只写日志
+func Init(cfg *setting.MailConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	from := cfg.MailFrom
+	if from == "" {
+		from = defaultFrom
+	}
+	switch cfg.MailBackend {
+	case BackendLog, "":
+		SetMailer(LogMailer{})
+	case BackendFile:
+		SetMailer(&FileMailer{Dir: cfg.MailFileDir, From: from})
+	case BackendSMTP:
+		SetMailer(&SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     from,
+		})
+	default:
+		return fmt.Errorf("unknown mail backend: %s", cfg.MailBackend)
+	}
+	return nil
+}
+
+// SetMailer 替换当前使用的邮件发送实现
+func SetMailer(m Mailer) {
+	current.Store(holder{m})
+}
+
+// Send 使用当前的实现发送邮件
+func Send(msg *Message) error {
+	return current.Load().(holder).Send(msg)
+}
+
+// buildMessage 生成RFC 5322格式的邮件，主题和正文都是UTF-8编码
+func buildMessage(from string, msg *Message, now time.Time) ([]byte, error) {
+	for _, h := range []string{from, msg.To, msg.Subject} {
+		// 邮件头中的换行符会被解释成新的邮件头
+		if strings.ContainsAny(h, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("\r\n")
+	// base64每行不超过76个字符
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes(), nil
+}
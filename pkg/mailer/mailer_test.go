@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg := &Message{To: "q1mi@example.com", Subject: "验证邮箱", Body: "点击链接完成验证"}
+	data, err := buildMessage("bluebell <noreply@example.com>", msg, time.Unix(0, 0).UTC())
+	if err != nil {
+		t.Fatalf("buildMessage failed, err:%v", err)
+	}
+	s := string(data)
+	for _, want := range []string{
+		"From: bluebell <noreply@example.com>\r\n",
+		"To: q1mi@example.com\r\n",
+		"Subject: =?UTF-8?b?6aqM6K+B6YKu566x?=\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\n" + base64.StdEncoding.EncodeToString([]byte(msg.Body)) + "\r\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("message missing %q:\n%s", want, s)
+		}
+	}
+
+	// 邮件头中不允许换行，避免注入其他邮件头
+	msg.To = "a@example.com\r\nBcc: b@example.com"
+	if _, err := buildMessage("bluebell <noreply@example.com>", msg, time.Now()); err != ErrInvalidHeader {
+		t.Fatalf("buildMessage with newline got err=%v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	SetMailer(&FileMailer{Dir: dir, From: defaultFrom})
+	defer SetMailer(LogMailer{})
+
+	if err := Send(&Message{To: "q1mi@example.com", Subject: "hello", Body: "world"}); err != nil {
+		t.Fatalf("Send failed, err:%v", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("ReadDir got %d files, err:%v", len(files), err)
+	}
+	if !strings.HasSuffix(files[0].Name(), "-q1mi@example.com.eml") {
+		t.Fatalf("unexpected file name %s", files[0].Name())
+	}
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer 通过SMTP服务器发送邮件
+// 使用net/smtp.SendMail，服务器支持STARTTLS时自动加密；配置了用户名时使用PLAIN认证
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string // 发件人，如 "bluebell <noreply@example.com>"
+}
+
+// Send 发送一封邮件
+func (m *SMTPMailer) Send(msg *Message) error {
+	data, err := buildMessage(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	// SMTP的MAIL FROM只需要邮箱地址部分
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, from.Address, []string{msg.To}, data)
+}
@@ -0,0 +1,409 @@
+// Package oidc 提供OpenID Connect客户端，用于第三方登录
+// 登录流程（授权码模式 + PKCE）：
+//  1. 生成state、nonce和PKCE的code_verifier，保存到服务端，把用户重定向到身份提供方的授权地址
+//  2. 用户登录后身份提供方带着code和state跳转回redirect_url
+//  3. 校验state后用code和code_verifier换取ID token
+//  4. 校验ID token的签名、issuer、audience、过期时间和nonce，得到用户在身份提供方的唯一标识sub
+//
+// 身份提供方的各接口地址通过 issuer + /.well-known/openid-configuration 自动发现，
+// 签名公钥从jwks_uri读取并缓存，遇到未知的kid时重新读取，身份提供方轮换密钥后不需要重启服务。
+package oidc
+
+import (
+	"bluebell/setting"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	httpTimeout     = 10 * time.Second // 请求身份提供方的超时时间
+	maxResponseSize = 1 << 20          // 身份提供方响应的最大长度
+	jwksMinInterval = time.Minute      // 两次重新读取公钥的最短间隔，防止伪造的kid导致频繁请求身份提供方
+)
+
+var (
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+	ErrUnknownKid     = errors.New("oidc: signing key not found")
+)
+
+// Metadata 身份提供方的配置信息，格式见OpenID Connect Discovery 1.0
+type Metadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Claims ID token中bluebell用到的声明
+type Claims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// Provider 一个OIDC身份提供方，可以在多个goroutine中并发使用
+type Provider struct {
+	Name   string
+	cfg    *setting.OIDCProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *Metadata              // 第一次使用时读取
+	keys        map[string]interface{} // kid -> 签名公钥
+	keysFetched time.Time
+}
+
+// NewProvider 根据配置创建身份提供方
+// 不会立即请求身份提供方，身份提供方暂时不可用时不影响服务启动
+func NewProvider(name string, cfg *setting.OIDCProviderConfig) (*Provider, error) {
+	if cfg == nil || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc provider %q: issuer, client_id and redirect_url are required", name)
+	}
+	return &Provider{
+		Name:   name,
+		cfg:    cfg,
+		client: &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// metadata 读取身份提供方的配置信息，成功后缓存
+func (p *Provider) metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	meta := new(Metadata)
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, meta); err != nil {
+		return nil, err
+	}
+	// issuer必须与配置完全一致，防止被引导到其他身份提供方
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch, expected %q got %q", p.cfg.Issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: incomplete provider metadata")
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// AuthCodeURL 生成把用户重定向到身份提供方登录的地址
+// 参数 state: 跳转回来时原样带回，用于关联本次登录请求并防止CSRF
+// 参数 nonce: 写入ID token，防止ID token被重放
+// 参数 verifier: PKCE的code_verifier，地址中只带它的sha256
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.scopes(), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", S256Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// scopes 申请的权限，openid总是在第一个
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, s := range p.cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// tokenResponse 令牌接口的响应
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange 用授权码换取ID token
+// 参数 verifier: 生成授权地址时使用的code_verifier
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (rawIDToken string, err error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	// 身份提供方只支持client_secret_post时把密钥放在表单中，否则使用默认的client_secret_basic
+	basic := len(meta.TokenEndpointAuthMethods) == 0
+	for _, m := range meta.TokenEndpointAuthMethods {
+		if m == "client_secret_basic" {
+			basic = true
+		}
+	}
+	if !basic {
+		form.Set("client_id", p.cfg.ClientID)
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	ret := new(tokenResponse)
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(ret); err != nil {
+		return "", fmt.Errorf("oidc: decode token response failed, status %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || ret.Error != "" {
+		return "", fmt.Errorf("oidc: token endpoint returned %d: %s %s", resp.StatusCode, ret.Error, ret.ErrorDescription)
+	}
+	if ret.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+	return ret.IDToken, nil
+}
+
+// VerifyIDToken 校验ID token并返回其中的声明
+// 参数 nonce: 生成授权地址时使用的nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	claims := new(Claims)
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// 密钥类型必须与token使用的算法一致
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("oidc: unexpected signing method %s for RSA key", token.Method.Alg())
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("oidc: unexpected signing method %s for EC key", token.Method.Alg())
+			}
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	case !claims.VerifyAudience(p.cfg.ClientID, true):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		// 有多个audience时azp必须是bluebell
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key 按kid查找签名公钥
+// 缓存中没有时重新读取公钥列表，两次读取至少间隔jwksMinInterval
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if !p.keysFetched.IsZero() && time.Since(p.keysFetched) < jwksMinInterval {
+		return nil, ErrUnknownKid
+	}
+	set := new(jsonWebKeySet)
+	if err := p.getJSON(ctx, meta.JWKSURI, set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// 不支持的密钥类型直接忽略
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKid
+}
+
+// lookup 在缓存中查找公钥，token头部没有kid时只有一个公钥才能使用
+func (p *Provider) lookup(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// getJSON 请求身份提供方的接口并解析JSON响应
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// jsonWebKey 单个公钥，格式见RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`   // RSA模数
+	E   string `json:"e"`   // RSA指数
+	Crv string `json:"crv"` // EC曲线
+	X   string `json:"x"`   // EC公钥x坐标
+	Y   string `json:"y"`   // EC公钥y坐标
+}
+
+// jsonWebKeySet 公钥列表
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// publicKey 解析RSA或EC公钥
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("oidc: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("oidc: EC point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("oidc: unsupported key type %q", k.Kty)
+}
+
+// decodeBigInt 解析base64url编码的大整数
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("oidc: empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// RandomString 生成32字节的随机字符串，用作state、nonce和code_verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256Challenge PKCE的code_challenge，即code_verifier的sha256，格式见RFC 7636
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
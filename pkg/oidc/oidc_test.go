@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"bluebell/setting"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testClientID     = "bluebell"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://127.0.0.1:8084/api/v1/oidc/mock/callback"
+)
+
+// mockProvider 本地的OIDC身份提供方，用户登录的步骤由测试直接调用login模拟
+type mockProvider struct {
+	*httptest.Server
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]url.Values // code -> 授权请求的参数
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	m := &mockProvider{codes: make(map[string]url.Values)}
+	m.rotate(t, "k1")
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Metadata{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "RSA",
+			Kid: m.kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != testClientID || secret != testClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		m.mu.Lock()
+		auth, ok := m.codes[r.PostFormValue("code")]
+		delete(m.codes, r.PostFormValue("code"))
+		m.mu.Unlock()
+		if !ok || r.PostFormValue("redirect_uri") != auth.Get("redirect_uri") ||
+			S256Challenge(r.PostFormValue("code_verifier")) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		idToken := m.sign(t, m.claims(auth.Get("nonce")))
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	return m
+}
+
+// rotate 更换签名密钥
+func (m *mockProvider) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed, err:%v", err)
+	}
+	m.mu.Lock()
+	m.key, m.kid = key, kid
+	m.mu.Unlock()
+}
+
+// login 模拟用户在授权地址登录成功，返回跳转回bluebell时带的code
+func (m *mockProvider) login(t *testing.T, authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("url.Parse failed, err:%v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID || q.Get("scope") != "openid email" {
+		t.Fatalf("unexpected auth url: %s", authURL)
+	}
+	m.mu.Lock()
+	m.codes["code-"+q.Get("state")] = q
+	m.mu.Unlock()
+	return "code-" + q.Get("state"), q.Get("state")
+}
+
+func (m *mockProvider) claims(nonce string) *Claims {
+	now := time.Now()
+	return &Claims{
+		Email:         "q1mi@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.URL,
+			Subject:   "10001",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func (m *mockProvider) sign(t *testing.T, c *Claims) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	token.Header["kid"] = m.kid
+	s, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatalf("SignedString failed, err:%v", err)
+	}
+	return s
+}
+
+func (m *mockProvider) provider(t *testing.T) *Provider {
+	p, err := NewProvider("mock", &setting.OIDCProviderConfig{
+		Issuer:       m.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider failed, err:%v", err)
+	}
+	return p
+}
+
+func TestLoginFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	ctx := context.Background()
+
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed, err:%v", err)
+	}
+	code, gotState := m.login(t, authURL)
+	if gotState != state {
+		t.Fatalf("state changed: %s", gotState)
+	}
+
+	// code_verifier不对时换不到token
+	if _, err := p.Exchange(ctx, code, "wrong"); err == nil {
+		t.Fatal("Exchange with wrong verifier should fail")
+	}
+	code, _ = m.login(t, authURL)
+	idToken, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange failed, err:%v", err)
+	}
+	// code只能使用一次
+	if _, err := p.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("Exchange with used code should fail")
+	}
+
+	claims, err := p.VerifyIDToken(ctx, idToken, nonce)
+	if err != nil {
+		t.Fatalf("VerifyIDToken failed, err:%v", err)
+	}
+	if claims.Subject != "10001" || claims.Email != "q1mi@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if _, err := p.VerifyIDToken(ctx, idToken, "other nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("VerifyIDToken with wrong nonce got %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := []struct {
+		name  string
+		token func() string
+	}{
+		{"wrong issuer", func() string {
+			c := m.claims("n")
+			c.Issuer = "https://evil.example.com"
+			return m.sign(t, c)
+		}},
+		{"wrong audience", func() string {
+			c := m.claims("n")
+			c.Audience = jwt.ClaimStrings{"other"}
+			return m.sign(t, c)
+		}},
+		{"multiple audiences without azp", func() string {
+			c := m.claims("n")
+			c.Audience = jwt.ClaimStrings{testClientID, "other"}
+			return m.sign(t, c)
+		}},
+		{"expired", func() string {
+			c := m.claims("n")
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return m.sign(t, c)
+		}},
+		{"missing exp", func() string {
+			c := m.claims("n")
+			c.ExpiresAt = nil
+			return m.sign(t, c)
+		}},
+		{"signed by other key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims("n"))
+			token.Header["kid"] = "k1"
+			s, _ := token.SignedString(otherKey)
+			return s
+		}},
+		{"hmac with public key", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, m.claims("n"))
+			token.Header["kid"] = "k1"
+			s, _ := token.SignedString(m.key.N.Bytes())
+			return s
+		}},
+	}
+	for _, tc := range cases {
+		if _, err := p.VerifyIDToken(context.Background(), tc.token(), "n"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: got %v, want ErrInvalidIDToken", tc.name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider(t)
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, m.sign(t, m.claims("n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken failed, err:%v", err)
+	}
+
+	// 身份提供方更换密钥后，距离上次读取公钥不足jwksMinInterval时不会重新读取
+	m.rotate(t, "k2")
+	token := m.sign(t, m.claims("n"))
+	if _, err := p.VerifyIDToken(ctx, token, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("VerifyIDToken got %v, want ErrInvalidIDToken", err)
+	}
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-jwksMinInterval)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, token, "n"); err != nil {
+		t.Fatalf("VerifyIDToken after rotation failed, err:%v", err)
+	}
+}
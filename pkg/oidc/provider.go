@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"bluebell/setting"
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// 已配置的身份提供方
+// 服务启动时根据配置项oidc.providers创建，修改身份提供方需要重启服务
+
+var ErrProviderNotFound = errors.New("oidc: provider not found")
+
+var providers atomic.Value // map[string]*Provider
+
+func init() {
+	providers.Store(map[string]*Provider{})
+}
+
+// Init 根据配置创建身份提供方，没有配置时不支持第三方登录
+func Init(cfg *setting.OIDCConfig) error {
+	m := make(map[string]*Provider)
+	if cfg != nil {
+		for name, pc := range cfg.OIDCProviders {
+			p, err := NewProvider(name, pc)
+			if err != nil {
+				return err
+			}
+			m[name] = p
+		}
+	}
+	SetProviders(m)
+	return nil
+}
+
+// SetProviders 替换当前的身份提供方
+func SetProviders(m map[string]*Provider) {
+	providers.Store(m)
+}
+
+// Get 按名称查找身份提供方
+func Get(name string) (*Provider, error) {
+	p, ok := providers.Load().(map[string]*Provider)[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// Names 所有身份提供方的名称，按字母顺序排列
+func Names() []string {
+	m := providers.Load().(map[string]*Provider)
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
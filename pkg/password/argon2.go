@@ -0,0 +1,94 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// argon2idHasher argon2id算法，哈希字符串使用PHC格式：
+// $argon2id$v=19$m=<内存KiB>,t=<迭代次数>,p=<并行度>$<base64盐>$<base64哈希>
+type argon2idHasher struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+func newArgon2idHasher() *argon2idHasher {
+	return &argon2idHasher{
+		memory:  64 * 1024,
+		time:    3,
+		threads: 2,
+		saltLen: 16,
+		keyLen:  32,
+	}
+}
+
+func (a *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.time, a.memory, a.threads, a.keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.memory, a.time, a.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a *argon2idHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a *argon2idHasher) NeedsRehash(encoded string) bool {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != a.memory || p.time != a.time || p.threads != a.threads ||
+		len(salt) != a.saltLen || uint32(len(key)) != a.keyLen
+}
+
+// decodeArgon2id 解析argon2id哈希字符串
+func decodeArgon2id(encoded string) (p *argon2idHasher, salt, key []byte, err error) {
+	// 按$分割后为：["", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash]
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+	p = new(argon2idHasher)
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,38 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// legacyMD5Secret 旧版本拼接在密码前面的固定字符串
+const legacyMD5Secret = "liwenzhou.com"
+
+// legacyMD5Hasher 旧版本的 md5(secret + password)
+// 只用于校验已有用户的密码，校验成功后总是需要重新哈希
+type legacyMD5Hasher struct{}
+
+func (legacyMD5Hasher) Hash(password string) (string, error) {
+	h := md5.New()
+	h.Write([]byte(legacyMD5Secret))
+	h.Write([]byte(password))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (l legacyMD5Hasher) Verify(password, encoded string) (bool, error) {
+	hash, _ := l.Hash(password)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(encoded)) == 1, nil
+}
+
+func (legacyMD5Hasher) Match(encoded string) bool {
+	if len(encoded) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (legacyMD5Hasher) NeedsRehash(string) bool {
+	return true
+}
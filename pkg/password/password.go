@@ -0,0 +1,81 @@
+// Package password 提供密码哈希和校验功能
+// 哈希结果是自描述的字符串，带有算法标识和参数，校验时根据哈希字符串自动选择算法：
+//
+//	bcrypt:   $2a$10$...
+//	argon2id: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//	md5:      32位十六进制字符串，旧版本使用的 md5(secret + password)，只用于校验，不再生成
+//
+// 新密码使用Init指定的算法生成；校验成功后如果哈希不是由当前算法和参数生成的，调用方应重新哈希并保存
+package password
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownHash      = errors.New("unknown password hash format")
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+)
+
+// Hasher 密码哈希算法
+type Hasher interface {
+	// Hash 生成密码的哈希字符串
+	Hash(password string) (string, error)
+	// Verify 校验密码与哈希字符串是否匹配
+	Verify(password, encoded string) (bool, error)
+	// Match 哈希字符串是否由该算法生成
+	Match(encoded string) bool
+	// NeedsRehash 哈希字符串的参数是否与当前参数不同
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	// hashers 所有可以校验的算法，按顺序匹配哈希字符串
+	hashers = []Hasher{
+		newBcryptHasher(),
+		newArgon2idHasher(),
+		legacyMD5Hasher{},
+	}
+	current = hashers[0] // 生成新哈希使用的算法，默认bcrypt
+)
+
+// Init 指定生成新哈希使用的算法，为空时使用bcrypt
+func Init(algorithm string) error {
+	switch algorithm {
+	case AlgorithmBcrypt, "":
+		current = hashers[0]
+	case AlgorithmArgon2id:
+		current = hashers[1]
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+	return nil
+}
+
+// Hash 使用当前算法生成密码的哈希字符串
+func Hash(password string) (string, error) {
+	return current.Hash(password)
+}
+
+// Verify 校验密码
+// 返回值 ok: 密码是否正确
+// 返回值 rehash: 密码正确但哈希不是由当前算法和参数生成的，调用方应使用Hash重新生成并保存
+func Verify(password, encoded string) (ok, rehash bool, err error) {
+	for _, h := range hashers {
+		if !h.Match(encoded) {
+			continue
+		}
+		ok, err = h.Verify(password, encoded)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, h != current || h.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
@@ -0,0 +1,61 @@
+package password
+
+import "testing"
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmBcrypt, AlgorithmArgon2id} {
+		if err := Init(algorithm); err != nil {
+			t.Fatalf("Init(%s) failed, err:%v", algorithm, err)
+		}
+		hash, err := Hash("123456")
+		if err != nil {
+			t.Fatalf("%s: Hash failed, err:%v", algorithm, err)
+		}
+		ok, rehash, err := Verify("123456", hash)
+		if err != nil || !ok || rehash {
+			t.Fatalf("%s: Verify correct password got ok=%v rehash=%v err=%v", algorithm, ok, rehash, err)
+		}
+		ok, _, err = Verify("654321", hash)
+		if err != nil || ok {
+			t.Fatalf("%s: Verify wrong password got ok=%v err=%v", algorithm, ok, err)
+		}
+	}
+	_ = Init(AlgorithmBcrypt)
+}
+
+func TestVerifyLegacyMD5(t *testing.T) {
+	_ = Init(AlgorithmBcrypt)
+	// md5("liwenzhou.com" + "123456")
+	legacy, _ := legacyMD5Hasher{}.Hash("123456")
+
+	ok, rehash, err := Verify("123456", legacy)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("Verify legacy hash got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	ok, _, err = Verify("654321", legacy)
+	if err != nil || ok {
+		t.Fatalf("Verify legacy hash with wrong password got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	// 切换算法后，旧算法生成的哈希仍然可以校验，但需要重新哈希
+	_ = Init(AlgorithmBcrypt)
+	hash, _ := Hash("123456")
+	_ = Init(AlgorithmArgon2id)
+	defer Init(AlgorithmBcrypt)
+
+	ok, rehash, err := Verify("123456", hash)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("Verify bcrypt hash with argon2id current got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	if err := Init("md5"); err == nil {
+		t.Fatal("Init(md5) should fail")
+	}
+	if _, _, err := Verify("123456", "plaintext"); err != ErrUnknownHash {
+		t.Fatalf("Verify unknown hash got err=%v", err)
+	}
+}
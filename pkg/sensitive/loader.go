@@ -0,0 +1,145 @@
+package sensitive
+
+import (
+	"bluebell/setting"
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// 词库文件
+// 每行一个敏感词，空行和以#开头的注释行忽略。
+// 与setting.Init使用viper.WatchConfig监听配置文件一样，这里监听词库文件，修改后自动重新加载，不需要重启服务。
+// 重新加载失败时继续使用旧的词库。
+
+// 处理命中敏感词的内容的方式，配置项sensitive.action
+const (
+	ActionReject = "reject" // 拒绝发布
+	ActionMask   = "mask"   // 敏感词替换为*后发布
+	ActionFlag   = "flag"   // 原样发布，同时加入举报处理队列由管理员审核
+)
+
+const reloadDelay = 200 * time.Millisecond // 文件最后一次变化后等待多久再重新加载
+
+var current atomic.Value // *Filter，当前使用的过滤器
+
+func init() {
+	current.Store(NewFilter(nil))
+}
+
+// Default 当前使用的过滤器
+func Default() *Filter {
+	return current.Load().(*Filter)
+}
+
+// FindAll 使用当前词库找出文本中所有命中的敏感词
+func FindAll(text string) []Match {
+	return Default().FindAll(text)
+}
+
+// Mask 使用当前词库把文本中的敏感词替换为*
+func Mask(text string) string {
+	return Default().Mask(text, '*')
+}
+
+// Init 加载词库文件并监听文件变化
+// 没有配置词库文件时不过滤任何内容
+// 返回值 stop: 停止监听的函数
+func Init(cfg *setting.SensitiveConfig) (stop func(), err error) {
+	if cfg == nil || cfg.WordFile == "" {
+		return func() {}, nil
+	}
+	if err = Load(cfg.WordFile); err != nil {
+		return nil, err
+	}
+	return Watch(cfg.WordFile)
+}
+
+// Load 从文件加载词库，替换当前使用的过滤器
+func Load(path string) error {
+	words, err := readWords(path)
+	if err != nil {
+		return err
+	}
+	f := NewFilter(words)
+	current.Store(f)
+	zap.L().Info("sensitive words loaded", zap.String("file", path), zap.Int("count", f.Len()))
+	return nil
+}
+
+// readWords 读取词库文件
+func readWords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// Watch 监听词库文件，文件修改后重新加载
+// 监听的是文件所在的目录，编辑器保存时先写临时文件再重命名的方式也能收到通知
+// 返回值 stop: 停止监听的函数
+func Watch(path string) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Clean(path)
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		// 一次保存可能产生多个写事件，且第一个事件时文件可能只写了一部分，
+		// 最后一个事件之后等待reloadDelay再加载
+		reload := time.NewTimer(reloadDelay)
+		reload.Stop()
+		defer reload.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				reload.Reset(reloadDelay)
+			case <-reload.C:
+				if err := Load(path); err != nil {
+					zap.L().Error("reload sensitive words failed, keep using the old ones",
+						zap.String("file", path), zap.Error(err))
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				zap.L().Error("watch sensitive word file failed", zap.String("file", path), zap.Error(err))
+			}
+		}
+	}()
+	return func() {
+		_ = watcher.Close()
+		<-exited
+	}, nil
+}
@@ -0,0 +1,166 @@
+package sensitive
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 敏感词过滤
+// 使用Aho-Corasick自动机，一次扫描文本即可找出所有敏感词，耗时与文本长度和命中数有关，与词库大小无关。
+// 匹配时忽略英文大小写，按rune处理，中文和英文混合的词也能正确匹配。
+
+// Match 文本中命中的一个敏感词
+type Match struct {
+	Word  string // 词库中的敏感词
+	Start int    // 在文本中的起始位置，单位为rune
+	End   int    // 在文本中的结束位置（不包含），单位为rune
+}
+
+// node 自动机节点
+type node struct {
+	children map[rune]*node
+	fail     *node // 失配时跳转的节点：当前节点对应字符串的最长真后缀节点
+	output   *node // fail链上最近的敏感词结尾节点，用于找出以当前位置结尾的所有敏感词
+	word     string
+	length   int // 敏感词的rune长度，不是敏感词结尾时为0
+}
+
+// Filter 敏感词过滤器，创建后只读，可以在多个goroutine中并发使用
+type Filter struct {
+	root  *node
+	count int
+}
+
+// NewFilter 根据敏感词列表创建过滤器，空字符串和重复的词会被忽略
+func NewFilter(words []string) *Filter {
+	f := &Filter{root: &node{children: make(map[rune]*node)}}
+	for _, w := range words {
+		f.add(w)
+	}
+	f.build()
+	return f
+}
+
+// add 把敏感词加入字典树
+func (f *Filter) add(word string) {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return
+	}
+	n := f.root
+	length := 0
+	for _, r := range word {
+		r = unicode.ToLower(r)
+		child, ok := n.children[r]
+		if !ok {
+			child = &node{children: make(map[rune]*node)}
+			n.children[r] = child
+		}
+		n = child
+		length++
+	}
+	if n.length == 0 {
+		f.count++
+	}
+	n.word = word
+	n.length = length
+}
+
+// build 按广度优先顺序计算每个节点的fail和output指针
+func (f *Filter) build() {
+	queue := make([]*node, 0, len(f.root.children))
+	for _, child := range f.root.children {
+		child.fail = f.root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for r, child := range n.children {
+			fail := n.fail
+			for fail != nil && fail.children[r] == nil {
+				fail = fail.fail
+			}
+			if fail == nil {
+				child.fail = f.root
+			} else {
+				child.fail = fail.children[r]
+			}
+			if child.fail.length > 0 {
+				child.output = child.fail
+			} else {
+				child.output = child.fail.output
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// Len 词库中的敏感词数量
+func (f *Filter) Len() int {
+	return f.count
+}
+
+// FindAll 找出文本中所有命中的敏感词，包括互相重叠的，按结束位置排序
+func (f *Filter) FindAll(text string) []Match {
+	var matches []Match
+	f.scan(text, func(m Match) bool {
+		matches = append(matches, m)
+		return true
+	})
+	return matches
+}
+
+// Contains 文本中是否包含敏感词，命中第一个敏感词时立即返回
+func (f *Filter) Contains(text string) bool {
+	found := false
+	f.scan(text, func(Match) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// Mask 把文本中命中的敏感词的每个字符替换为mask，如 "赌博" -> "**"
+func (f *Filter) Mask(text string, mask rune) string {
+	matches := f.FindAll(text)
+	if len(matches) == 0 {
+		return text
+	}
+	runes := []rune(text)
+	for _, m := range matches {
+		for i := m.Start; i < m.End; i++ {
+			runes[i] = mask
+		}
+	}
+	return string(runes)
+}
+
+// scan 扫描文本，每命中一个敏感词调用一次fn，fn返回false时停止扫描
+func (f *Filter) scan(text string, fn func(Match) bool) {
+	if f == nil || f.count == 0 {
+		return
+	}
+	n := f.root
+	pos := 0
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		for n != f.root && n.children[r] == nil {
+			n = n.fail
+		}
+		if child, ok := n.children[r]; ok {
+			n = child
+		}
+		pos++
+		// 当前节点本身以及output链上的节点都是以当前位置结尾的敏感词
+		out := n
+		if out.length == 0 {
+			out = n.output
+		}
+		for ; out != nil; out = out.output {
+			if !fn(Match{Word: out.word, Start: pos - out.length, End: pos}) {
+				return
+			}
+		}
+	}
+}
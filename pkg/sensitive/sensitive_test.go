@@ -0,0 +1,80 @@
+package sensitive
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindAllOverlapping(t *testing.T) {
+	f := NewFilter([]string{"he", "she", "his", "hers", ""})
+	if f.Len() != 4 {
+		t.Fatalf("Len got %d, want 4", f.Len())
+	}
+	got := f.FindAll("ushers")
+	want := []Match{
+		{Word: "she", Start: 1, End: 4},
+		{Word: "he", Start: 2, End: 4},
+		{Word: "hers", Start: 2, End: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAll got %+v, want %+v", got, want)
+	}
+	if !f.Contains("hello world") || f.Contains("abc") {
+		t.Fatalf("Contains got wrong result")
+	}
+}
+
+func TestMask(t *testing.T) {
+	f := NewFilter([]string{"赌博", "Casino"})
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"网上赌博网站", "网上**网站"},
+		{"online CASINO 赌博", "online ****** **"},
+		{"正常内容", "正常内容"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := f.Mask(c.text, '*'); got != c.want {
+			t.Errorf("Mask(%q) got %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestLoadAndWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "words.txt")
+	if err := os.WriteFile(path, []byte("# 注释\n\n赌博\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err != nil {
+		t.Fatalf("Load failed, err:%v", err)
+	}
+	defer current.Store(NewFilter(nil))
+	if Default().Len() != 1 || len(FindAll("赌博")) != 1 {
+		t.Fatalf("Load got %d words", Default().Len())
+	}
+
+	stop, err := Watch(path)
+	if err != nil {
+		t.Fatalf("Watch failed, err:%v", err)
+	}
+	defer stop()
+	if err := os.WriteFile(path, []byte("赌博\n毒品\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for Default().Len() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("word file not reloaded, got %d words", Default().Len())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := Mask("毒品"); got != "**" {
+		t.Fatalf("Mask after reload got %q", got)
+	}
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238附录B的SHA1测试向量，密钥为ASCII的"12345678901234567890"，8位验证码
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		if got := hotp(key, uint64(c.unix/Period), 8); got != c.want {
+			t.Errorf("hotp at %d got %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestCodeAndValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatalf("Code failed, err:%v", err)
+	}
+	// 8位向量07081804的后6位
+	if code != "081804" {
+		t.Fatalf("Code got %s, want 081804", code)
+	}
+
+	counter, ok := Validate(secret, code, now.Add(Period*time.Second), 1)
+	if !ok || counter != Counter(now) {
+		t.Fatalf("Validate with one step skew got counter=%d ok=%v", counter, ok)
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period*time.Second), 1); ok {
+		t.Fatalf("Validate out of skew should fail")
+	}
+	if _, ok := Validate(secret, "000000", now, 1); ok {
+		t.Fatalf("Validate wrong code should fail")
+	}
+	// 密钥不区分大小写，可以带空格
+	if _, ok := Validate(strings.ToLower(secret[:8])+" "+secret[8:], code, now, 0); !ok {
+		t.Fatalf("Validate lowercase secret with spaces should pass")
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret failed, err:%v", err)
+	}
+	if len(secret) != 32 {
+		t.Fatalf("secret length got %d, want 32", len(secret))
+	}
+	uri := URI("bluebell", "q1mi", secret)
+	want := "otpauth://totp/bluebell:q1mi?algorithm=SHA1&digits=6&issuer=bluebell&period=30&secret=" + secret
+	if uri != want {
+		t.Fatalf("URI got %s, want %s", uri, want)
+	}
+	if _, err := Code("not base32!", time.Now()); err != ErrInvalidSecret {
+		t.Fatalf("Code with invalid secret got err=%v", err)
+	}
+}
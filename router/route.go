@@ -6,8 +6,8 @@ import (
 	"bluebell/controller"  // 导入控制器包，处理具体的业务逻辑
 	"bluebell/logger"      // 导入日志包，用于记录应用日志
 	"bluebell/middlewares" // 导入中间件包，提供认证等功能
+	"bluebell/models"      // 导入数据模型，使用角色和权限定义
 	"net/http"             // 导入HTTP包，提供HTTP状态码等常量
-	"time"                 // 导入time包，用于时间处理
 
 	ginSwagger "github.com/swaggo/gin-swagger"   // 导入Swagger文档生成器
 	"github.com/swaggo/gin-swagger/swaggerFiles" // 导入Swagger静态文件处理器
@@ -33,28 +33,45 @@ func SetupRouter(mode string) *gin.Engine {
 	// 注册全局中间件
 	// GinLogger(): 记录HTTP请求日志
 	// GinRecovery(true): 从panic中恢复，避免程序崩溃
-	// RateLimitMiddleware: 基于令牌桶算法的限流中间件
-	// 参数：每100ms填充一个令牌，令牌桶容量为100
-	// 这意味着：QPS限制为10，突发处理能力为100
-	r.Use(logger.GinLogger(), logger.GinRecovery(true), middlewares.RateLimitMiddleware(100*time.Millisecond, 100))
+	// RateLimitGroup: 基于令牌桶算法的限流中间件，QPS和突发处理能力由配置项rate_limit.groups.global决定
+	// 下面的/api/v1和管理员接口另外有各自的令牌桶
+	// 注册、登录、发帖、投票等操作另外按用户和IP限流，见RateLimitAction
+	r.Use(logger.GinLogger(), logger.GinRecovery(true), middlewares.RateLimitGroup(middlewares.RateLimitGroupGlobal))
 
 	// 健康检查接口 - 用于检测服务是否正常运行
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(http.StatusOK, "pong")
 	})
 
+	// JWKS接口 - 公开token签名公钥，其他服务可以用它校验bluebell签发的token
+	r.GET("/.well-known/jwks.json", controller.JWKSHandler)
+
 	// Swagger API文档接口 - 提供API文档访问
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// 创建API v1版本的路由组
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", middlewares.RateLimitGroup(middlewares.RateLimitGroupAPI))
 
 	// ==================== 无需认证的公开接口 ====================
 
-	// 用户注册接口
-	v1.POST("/signup", controller.SignUpHandler)
-	// 用户登录接口
-	v1.POST("/login", controller.LoginHandler)
+	// 用户注册接口（按IP限流）
+	v1.POST("/signup", middlewares.RateLimitAction(middlewares.RateLimitSignup), controller.SignUpHandler)
+	// 用户登录接口（按IP限流）
+	v1.POST("/login", middlewares.RateLimitAction(middlewares.RateLimitLogin), controller.LoginHandler)
+	// 两步验证登录接口，提交登录时返回的challenge token和验证码（按IP限流）
+	v1.POST("/login/2fa", middlewares.RateLimitAction(middlewares.RateLimitLogin), controller.LoginTwoFactorHandler)
+	// 第三方登录接口，重定向到身份提供方的登录页面（按IP限流）
+	v1.GET("/oidc/:provider/authorize", middlewares.RateLimitAction(middlewares.RateLimitLogin), controller.OIDCAuthorizeHandler)
+	// 第三方登录回调接口，身份提供方登录后跳转回来，返回与登录接口相同的token（按IP限流）
+	v1.GET("/oidc/:provider/callback", middlewares.RateLimitAction(middlewares.RateLimitLogin), controller.OIDCCallbackHandler)
+	// 验证邮箱接口，对应验证邮件中的链接
+	v1.GET("/email/verify", controller.VerifyEmailHandler)
+	// 忘记密码接口，向已验证的邮箱发送重置密码的链接（按IP限流）
+	v1.POST("/password/forgot", middlewares.RateLimitAction(middlewares.RateLimitPasswordReset), controller.ForgotPasswordHandler)
+	// 重置密码接口，使用重置密码邮件中的token设置新密码
+	v1.POST("/password/reset", controller.ResetPasswordHandler)
+	// 刷新token接口，使用refresh token换取新的access token和refresh token
+	v1.POST("/refresh", controller.RefreshTokenHandler)
 
 	// 获取帖子列表接口（支持按时间排序）
 	v1.GET("/posts2", controller.GetPostListHandler2)
@@ -66,6 +83,29 @@ func SetupRouter(mode string) *gin.Engine {
 	v1.GET("/community/:id", controller.CommunityDetailHandler)
 	// 获取指定帖子详情接口
 	v1.GET("/post/:id", controller.GetPostDetailHandler)
+	// 获取指定帖子的评论列表接口（树形结构）
+	v1.GET("/post/:id/comments", controller.GetCommentListHandler)
+
+	// ==================== 支持JWT和API key认证的接口 ====================
+	// 机器人和第三方集成使用 Authorization: ApiKey <key> 访问，API key需要拥有接口对应的权限范围
+	// 注册在v1.Use(JWTAuthMiddleware())之前，由APIKeyAuthMiddleware完成认证
+
+	// 创建新帖子接口（需要登录，按用户和IP限流）
+	v1.POST("/post", middlewares.APIKeyAuthMiddleware(models.APIKeyScopePost), middlewares.RateLimitAction(middlewares.RateLimitPost), controller.CreatePostHandler)
+	// 编辑帖子接口（仅作者本人）
+	v1.PUT("/post/:id", middlewares.APIKeyAuthMiddleware(models.APIKeyScopePost), controller.UpdatePostHandler)
+	// 删除帖子接口（仅作者本人，软删除）
+	v1.DELETE("/post/:id", middlewares.APIKeyAuthMiddleware(models.APIKeyScopePost), controller.DeletePostHandler)
+	// 发表评论接口（需要登录），通过parent_id回复其他评论
+	v1.POST("/post/:id/comments", middlewares.APIKeyAuthMiddleware(models.APIKeyScopePost), controller.CreateCommentHandler)
+
+	// 投票接口（需要登录，按用户和IP限流）
+	v1.POST("/vote", middlewares.APIKeyAuthMiddleware(models.APIKeyScopeVote), middlewares.RateLimitAction(middlewares.RateLimitVote), controller.PostVoteController)
+
+	// 版主查看社区的禁言列表和管理日志，API key需要read权限范围，同时用户需要拥有对应的权限
+	modRead := v1.Group("/community/:id/mod", middlewares.APIKeyAuthMiddleware(models.APIKeyScopeRead))
+	modRead.GET("/bans", middlewares.RequirePermission(models.PermissionBanUser, middlewares.CommunityParam("id")), controller.GetCommunityBanListHandler)
+	modRead.GET("/logs", middlewares.RequirePermission(models.PermissionViewModLog, middlewares.CommunityParam("id")), controller.GetModLogListHandler)
 
 	// ==================== 需要JWT认证的接口 ====================
 
@@ -74,11 +114,66 @@ func SetupRouter(mode string) *gin.Engine {
 	v1.Use(middlewares.JWTAuthMiddleware()) // 应用JWT认证中间件
 
 	{
-		// 创建新帖子接口（需要登录）
-		v1.POST("/post", controller.CreatePostHandler)
-
-		// 投票接口（需要登录）
-		v1.POST("/vote", controller.PostVoteController)
+		// 退出登录接口，吊销当前的access token和refresh token
+		v1.POST("/logout", controller.LogoutHandler)
+
+		// 开启两步验证，生成密钥并返回otpauth URI
+		v1.POST("/2fa/setup", controller.SetupTwoFactorHandler)
+		// 提交验证码确认开启两步验证，返回一次性恢复码
+		v1.POST("/2fa/confirm", controller.ConfirmTwoFactorHandler)
+		// 关闭两步验证，需要提交验证码或恢复码
+		v1.DELETE("/2fa", controller.DisableTwoFactorHandler)
+		// 重新发送邮箱验证邮件
+		v1.POST("/email/verify/resend", controller.ResendVerifyEmailHandler)
+		// 绑定第三方账号，返回身份提供方的登录地址，登录后跳转回回调接口完成绑定
+		v1.POST("/oidc/:provider/link", controller.OIDCLinkHandler)
+
+		// 个人API key管理：创建、查看和吊销，完整的key只在创建时返回一次
+		v1.POST("/apikeys", controller.CreateAPIKeyHandler)
+		v1.GET("/apikeys", controller.GetAPIKeyListHandler)
+		v1.DELETE("/apikeys/:id", controller.RevokeAPIKeyHandler)
+
+		// 举报接口（需要登录），同一用户对同一内容只能举报一次
+		v1.POST("/report", controller.CreateReportHandler)
+
+		// 社区管理接口（需要是该社区的版主，或者全局管理员）
+		// 路径中的:id为社区id，RequirePermission按它校验操作人在该社区的权限
+		mod := v1.Group("/community/:id/mod")
+		modPost := mod.Group("/post/:pid", middlewares.RequirePermission(models.PermissionModeratePost, middlewares.CommunityParam("id")))
+		// 移除帖子
+		modPost.POST("/remove", controller.RemovePostHandler)
+		// 锁定帖子，锁定后不允许投票
+		modPost.POST("/lock", controller.LockPostHandler)
+		// 解锁帖子
+		modPost.DELETE("/lock", controller.UnlockPostHandler)
+		// 置顶帖子
+		modPost.POST("/pin", controller.PinPostHandler)
+		// 取消置顶
+		modPost.DELETE("/pin", controller.UnpinPostHandler)
+		modBan := mod.Group("/bans", middlewares.RequirePermission(models.PermissionBanUser, middlewares.CommunityParam("id")))
+		// 禁止用户在社区发帖
+		modBan.POST("", controller.BanUserHandler)
+		// 解除禁言
+		modBan.DELETE("/:uid", controller.UnbanUserHandler)
+
+		// 管理员接口（需要拥有全局admin角色，配置文件admin.user_ids中的用户始终是管理员）
+		admin := v1.Group("/admin", middlewares.RequireRole(models.RoleAdmin), middlewares.RateLimitGroup(middlewares.RateLimitGroupAdmin))
+		// 查看最近一次MySQL与Redis的对账结果
+		admin.GET("/reconcile", middlewares.RequirePermission(models.PermissionReconcile), controller.GetReconcileReportHandler)
+		// 立即执行一次对账
+		admin.POST("/reconcile", middlewares.RequirePermission(models.PermissionReconcile), controller.ReconcileHandler)
+		// 查看用户的角色
+		admin.GET("/users/:id/roles", middlewares.RequirePermission(models.PermissionManageRole), controller.GetUserRolesHandler)
+		// 授予用户角色
+		admin.POST("/roles", middlewares.RequirePermission(models.PermissionManageRole), controller.GrantRoleHandler)
+		// 收回用户角色
+		admin.DELETE("/roles", middlewares.RequirePermission(models.PermissionManageRole), controller.RevokeRoleHandler)
+		// 查看被举报的内容，默认按未处理的举报数从多到少排序
+		admin.GET("/reports", middlewares.RequirePermission(models.PermissionHandleReport), controller.GetReportListHandler)
+		// 举报成立，移除被举报的内容
+		admin.POST("/reports/:id/resolve", middlewares.RequirePermission(models.PermissionHandleReport), controller.ResolveReportHandler)
+		// 举报不成立，恢复自动隐藏的内容
+		admin.POST("/reports/:id/dismiss", middlewares.RequirePermission(models.PermissionHandleReport), controller.DismissReportHandler)
 	}
 
 	// 注册性能分析工具的路由
@@ -2,6 +2,8 @@ package setting
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -17,9 +19,101 @@ type AppConfig struct {
 	MachineID int64  `mapstructure:"machine_id"`
 	Port      int    `mapstructure:"port"`
 
+	*AuthConfig  `mapstructure:"auth"`
+	*JWTConfig   `mapstructure:"jwt"`
 	*LogConfig   `mapstructure:"log"`
 	*MySQLConfig `mapstructure:"mysql"`
 	*RedisConfig `mapstructure:"redis"`
+	*VoteConfig  `mapstructure:"vote"`
+
+	*VoteQueueConfig `mapstructure:"vote_queue"`
+	*ReconcileConfig `mapstructure:"reconcile"`
+	*AdminConfig     `mapstructure:"admin"`
+	*OutboxConfig    `mapstructure:"outbox"`
+
+	*ModerationConfig `mapstructure:"moderation"`
+	*ReportConfig     `mapstructure:"report"`
+	*SensitiveConfig  `mapstructure:"sensitive"`
+	*LoginGuardConfig `mapstructure:"login_guard"`
+	*TwoFactorConfig  `mapstructure:"two_factor"`
+	*MailConfig       `mapstructure:"mail"`
+	*OIDCConfig       `mapstructure:"oidc"`
+	*APIKeyConfig     `mapstructure:"api_key"`
+}
+
+type AuthConfig struct {
+	AccessTokenExpire  int    `mapstructure:"access_token_expire"`  // access token有效期，单位分钟
+	RefreshTokenExpire int    `mapstructure:"refresh_token_expire"` // refresh token有效期，单位小时
+	PasswordHasher     string `mapstructure:"password_hasher"`      // 新密码使用的哈希算法：bcrypt 或 argon2id
+	SingleSession      bool   `mapstructure:"single_session"`       // 单会话模式，新设备登录后之前登录的设备下线
+}
+
+type LoginGuardConfig struct {
+	UserMaxAttempts int64 `mapstructure:"user_max_attempts"` // 同一用户名连续失败多少次之后开始锁定，0表示不按用户名锁定
+	IPMaxAttempts   int64 `mapstructure:"ip_max_attempts"`   // 同一IP连续失败多少次之后开始锁定，0表示不按IP锁定
+	BaseLockout     int   `mapstructure:"base_lockout"`      // 第一次锁定的时长，之后每失败一次翻倍，单位秒
+	MaxLockout      int   `mapstructure:"max_lockout"`       // 最长锁定时长，单位秒
+	LoginFailWindow int   `mapstructure:"window"`            // 失败次数的保留时间，超过该时间没有失败时重新计数，单位秒
+	UniformError    bool  `mapstructure:"uniform_error"`     // 用户名不存在和密码错误返回相同的错误，防止探测用户名是否存在
+}
+
+type TwoFactorConfig struct {
+	TwoFactorIssuer string `mapstructure:"issuer"`           // 显示在验证器App中的服务名称
+	ChallengeExpire int    `mapstructure:"challenge_expire"` // 校验密码成功后提交验证码的期限，单位秒
+	RecoveryCodes   int    `mapstructure:"recovery_codes"`   // 开启两步验证时生成的恢复码数量
+}
+
+type MailConfig struct {
+	MailBackend         string `mapstructure:"backend"`       // 邮件发送的实现：smtp、file（保存为.eml文件）或 log（只写日志）
+	MailFrom            string `mapstructure:"from"`          // 发件人，如 "bluebell <noreply@example.com>"
+	SMTPHost            string `mapstructure:"smtp_host"`     // SMTP服务器地址
+	SMTPPort            int    `mapstructure:"smtp_port"`     // SMTP服务器端口
+	SMTPUsername        string `mapstructure:"smtp_username"` // SMTP用户名，为空时不认证
+	SMTPPassword        string `mapstructure:"smtp_password"` // SMTP密码，建议通过环境变量BLUEBELL_MAIL_SMTP_PASSWORD配置
+	MailFileDir         string `mapstructure:"file_dir"`      // backend为file时保存邮件的目录
+	EmailVerifyURL      string `mapstructure:"verify_url"`    // 邮箱验证链接，{token}替换为验证token
+	PasswordResetURL    string `mapstructure:"reset_url"`     // 重置密码链接，{token}替换为重置token
+	EmailVerifyExpire   int    `mapstructure:"verify_expire"` // 邮箱验证链接的有效期，单位秒
+	PasswordResetExpire int    `mapstructure:"reset_expire"`  // 重置密码链接的有效期，单位秒
+}
+
+type OIDCConfig struct {
+	OIDCStateExpire int                            `mapstructure:"state_expire"` // 跳转到身份提供方登录后返回的期限，单位秒
+	OIDCProviders   map[string]*OIDCProviderConfig `mapstructure:"providers"`    // 第三方登录的身份提供方，key为登录接口路径中的名称，如google
+}
+
+// OIDCProviderConfig 单个OIDC身份提供方
+// client_secret建议通过环境变量配置，如 BLUEBELL_OIDC_PROVIDERS_GOOGLE_CLIENT_SECRET
+type OIDCProviderConfig struct {
+	Issuer       string   `mapstructure:"issuer"`        // 身份提供方的issuer，从 issuer + /.well-known/openid-configuration 读取各接口地址
+	ClientID     string   `mapstructure:"client_id"`     // 在身份提供方注册的应用id
+	ClientSecret string   `mapstructure:"client_secret"` // 在身份提供方注册的应用密钥
+	RedirectURL  string   `mapstructure:"redirect_url"`  // 登录后跳转回bluebell的地址，即 /api/v1/oidc/<名称>/callback
+	Scopes       []string `mapstructure:"scopes"`        // 申请的权限，openid总是包含在内
+}
+
+type APIKeyConfig struct {
+	APIKeyMaxPerUser int `mapstructure:"max_per_user"`       // 每个用户最多拥有的有效API key数量
+	LastUsedInterval int `mapstructure:"last_used_interval"` // 同一个API key多久更新一次最近使用时间，单位秒
+}
+
+type JWTConfig struct {
+	Issuer    string          `mapstructure:"issuer"`     // 签发人
+	ActiveKid string          `mapstructure:"active_kid"` // 签发新token使用的密钥id
+	Keys      []*JWTKeyConfig `mapstructure:"keys"`       // 密钥列表，轮换后旧密钥保留在列表中，直到用它签发的token全部过期
+}
+
+// JWTKeyConfig 单个签名密钥
+// HS256使用secret；RS256和EdDSA使用PEM格式的私钥和公钥，只有公钥的密钥只用于校验
+// *_env字段是环境变量名，环境变量有值时覆盖对应的配置，避免把密钥写在配置文件中
+type JWTKeyConfig struct {
+	Kid            string `mapstructure:"kid"`              // 密钥id，写入token头部的kid
+	Alg            string `mapstructure:"alg"`              // 签名算法：HS256、RS256、EdDSA
+	Secret         string `mapstructure:"secret"`           // HS256密钥
+	SecretEnv      string `mapstructure:"secret_env"`       // 保存HS256密钥的环境变量名
+	PrivateKeyFile string `mapstructure:"private_key_file"` // PEM格式的私钥文件
+	PrivateKeyEnv  string `mapstructure:"private_key_env"`  // 保存PEM格式私钥的环境变量名
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // PEM格式的公钥文件，为空时从私钥推导
 }
 
 type MySQLConfig struct {
@@ -41,6 +135,73 @@ type RedisConfig struct {
 	MinIdleConns int    `mapstructure:"min_idle_conns"`
 }
 
+type VoteConfig struct {
+	ArchiveInterval  int   `mapstructure:"archive_interval"`   // 投票归档任务的执行间隔，单位秒
+	ArchiveBatchSize int64 `mapstructure:"archive_batch_size"` // 投票归档任务每批处理的对象数量
+}
+
+type VoteQueueConfig struct {
+	Backend       string `mapstructure:"backend"`        // 队列实现：memory（进程内通道）或 stream（Redis Streams）
+	BatchSize     int64  `mapstructure:"batch_size"`     // 每批写入MySQL的消息数量
+	FlushInterval int    `mapstructure:"flush_interval"` // 批量写入的最长间隔，单位秒
+	StreamGroup   string `mapstructure:"stream_group"`   // stream消费者组名称，默认bluebell
+	StreamMaxLen  int64  `mapstructure:"stream_max_len"` // stream保留的最大消息数量，0表示不限制，超过时未确认的消息也会被裁剪
+	ReclaimIdle   int    `mapstructure:"reclaim_idle"`   // 未确认的消息空闲多久后被重新认领，单位秒，默认且最小30
+	MaxRetries    int64  `mapstructure:"max_retries"`    // 消息最多投递次数，单独写入失败达到后转入死信stream，MySQL不可用时不计入，默认且最小5
+}
+
+type OutboxConfig struct {
+	PollInterval     int   `mapstructure:"poll_interval"`  // 轮询待处理事件的间隔，单位秒
+	OutboxBatchSize  int64 `mapstructure:"batch_size"`     // 每次读取的事件数量
+	OutboxMaxRetries int64 `mapstructure:"max_retries"`    // 事件最多失败次数，超过后不再自动重试
+	RetryBackoff     int   `mapstructure:"retry_backoff"`  // 第一次重试的等待时间，之后每次翻倍，单位秒
+	MaxBackoff       int   `mapstructure:"max_backoff"`    // 重试等待时间的上限，单位秒
+	RetentionDays    int   `mapstructure:"retention_days"` // 已处理事件的保留天数
+}
+
+type ReconcileConfig struct {
+	ReconcileInterval  int   `mapstructure:"interval"`   // 对账任务的执行间隔，单位秒
+	ReconcileBatchSize int64 `mapstructure:"batch_size"` // 对账任务每批检查的帖子数量
+	ReconcileRepair    bool  `mapstructure:"repair"`     // 是否修复发现的问题，为false时只记录
+}
+
+type ModerationConfig struct {
+	MaxPinned int `mapstructure:"max_pinned"` // 每个社区最多置顶的帖子数
+}
+
+type ReportConfig struct {
+	HideThreshold int64 `mapstructure:"hide_threshold"` // 未处理的举报数达到该值时自动隐藏帖子，0表示不自动隐藏
+}
+
+type SensitiveConfig struct {
+	WordFile string `mapstructure:"word_file"` // 敏感词词库文件，每行一个词，为空时不过滤
+	Action   string `mapstructure:"action"`    // 命中敏感词时的处理方式：reject（拒绝）、mask（替换为*）、flag（发布并加入举报队列）
+}
+
+// RateLimitConfig 限流配置，不在Conf中，通过RateLimit()读取
+// 每个请求都要读取限流配置，修改配置文件时不能直接写入正在使用的map，
+// 而是解析一份新的配置整体替换，读取方每个请求只调用一次RateLimit()，使用同一份快照
+type RateLimitConfig struct {
+	RateLimitBackend string                      `mapstructure:"backend"` // 路由组限流的实现：memory（每个实例独立计数）或 redis（所有实例共享）
+	RateLimitGroups  map[string]*RateLimitBucket `mapstructure:"groups"`  // 各路由组的令牌桶，key为路由组名，如global、api、admin
+	RateLimitActions map[string]*RateLimitPolicy `mapstructure:"actions"` // 各操作的限流策略，key为操作名，如signup、login、post、vote
+}
+
+type RateLimitBucket struct {
+	Rate  float64 `mapstructure:"rate"`  // 每秒生成的令牌数，即平均QPS
+	Burst int64   `mapstructure:"burst"` // 令牌桶容量，即允许的突发请求数
+}
+
+type RateLimitPolicy struct {
+	Window int   `mapstructure:"window"` // 统计窗口，单位秒
+	User   int64 `mapstructure:"user"`   // 每个用户在窗口内最多请求的次数，0表示不按用户限制
+	IP     int64 `mapstructure:"ip"`     // 每个IP在窗口内最多请求的次数，0表示不按IP限制
+}
+
+type AdminConfig struct {
+	UserIDs []int64 `mapstructure:"user_ids"` // 始终拥有admin角色的用户id列表
+}
+
 type LogConfig struct {
 	Level      string `mapstructure:"level"`
 	Filename   string `mapstructure:"filename"`
@@ -68,6 +229,11 @@ func Init(filePath string) (err error) {
 
 	viper.SetConfigFile(filePath)
 
+	// 环境变量覆盖配置文件，环境变量名为 BLUEBELL_ + 配置项路径，如 BLUEBELL_MYSQL_PASSWORD、BLUEBELL_JWT_ACTIVE_KID
+	viper.SetEnvPrefix("bluebell")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
 	err = viper.ReadInConfig() // 读取配置信息
 	if err != nil {
 		// 读取配置信息失败
@@ -79,6 +245,7 @@ func Init(filePath string) (err error) {
 	if err := viper.Unmarshal(Conf); err != nil {
 		fmt.Printf("viper.Unmarshal failed, err:%v\n", err)
 	}
+	reloadRateLimit()
 
 	viper.WatchConfig()
 	viper.OnConfigChange(func(in fsnotify.Event) {
@@ -86,6 +253,34 @@ func Init(filePath string) (err error) {
 		if err := viper.Unmarshal(Conf); err != nil {
 			fmt.Printf("viper.Unmarshal failed, err:%v\n", err)
 		}
+		reloadRateLimit()
 	})
 	return
 }
+
+var rateLimitConf atomic.Value // *RateLimitConfig;当前的限流配置
+
+// RateLimit 返回当前的限流配置，返回值只读，未配置时返回空的配置
+func RateLimit() *RateLimitConfig {
+	if cfg, ok := rateLimitConf.Load().(*RateLimitConfig); ok {
+		return cfg
+	}
+	return new(RateLimitConfig)
+}
+
+// SetRateLimit 整体替换限流配置
+func SetRateLimit(cfg *RateLimitConfig) {
+	rateLimitConf.Store(cfg)
+}
+
+// reloadRateLimit 重新解析限流配置
+// 单独解析一份新的配置整体替换，不修改正在被请求读取的map；
+// 这样配置文件中删除的路由组和操作也会随之消失
+func reloadRateLimit() {
+	cfg := new(RateLimitConfig)
+	if err := viper.UnmarshalKey("rate_limit", cfg); err != nil {
+		fmt.Printf("viper.UnmarshalKey rate_limit failed, err:%v\n", err)
+		return
+	}
+	SetRateLimit(cfg)
+}
@@ -4,7 +4,7 @@ create table user
         primary key,
     user_id     bigint                              not null,
     username    varchar(64)                         not null,
-    password    varchar(64)                         not null,
+    password    varchar(255)                        not null,
     email       varchar(64)                         null,
     gender      tinyint   default 0                 not null,
     create_time timestamp default CURRENT_TIMESTAMP null,
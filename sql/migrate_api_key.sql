@@ -0,0 +1,19 @@
+-- 新增个人API key表，不需要迁移数据
+CREATE TABLE IF NOT EXISTS bluebell.api_key (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `key_id` bigint(20) NOT NULL COMMENT 'API key id',
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `name` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '名称',
+    `key_prefix` varchar(16) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'key前缀',
+    `key_hash` char(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'key的sha256',
+    `scopes` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '权限范围',
+    `expire_time` timestamp NULL DEFAULT NULL COMMENT '过期时间',
+    `last_used_time` timestamp NULL DEFAULT NULL COMMENT '最近使用时间',
+    `last_used_ip` varchar(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '最近使用的IP',
+    `revoke_time` timestamp NULL DEFAULT NULL COMMENT '吊销时间',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_key_id` (`key_id`),
+    UNIQUE KEY `uk_key_hash` (`key_hash`),
+    KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
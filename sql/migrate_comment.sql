@@ -0,0 +1,15 @@
+-- 新增评论表，已有数据不需要迁移
+
+CREATE TABLE IF NOT EXISTS bluebell.comment (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `comment_id` bigint(20) NOT NULL COMMENT '评论id',
+    `post_id` bigint(20) NOT NULL COMMENT '所属帖子id',
+    `parent_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '父评论id',
+    `author_id` bigint(20) NOT NULL COMMENT '评论者的用户id',
+    `content` varchar(1024) COLLATE utf8mb4_general_ci NOT NULL COMMENT '内容',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `idx_comment_id` (`comment_id`),
+    KEY `idx_post_id` (`post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
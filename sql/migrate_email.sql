@@ -0,0 +1,12 @@
+-- 用户表新增邮箱验证状态，只有验证过的邮箱唯一
+-- 之前注册时没有保存邮箱，空字符串统一改为NULL
+-- 未验证的邮箱可以被多个用户填写，不占用唯一索引；verified_email只在邮箱已验证时等于email，
+-- 由它的唯一索引保证同一邮箱只能被一个用户验证，已有的邮箱都是未验证的，不会冲突
+UPDATE bluebell.user SET email = NULL WHERE email = '';
+
+ALTER TABLE bluebell.user
+    ADD COLUMN `email_verified` tinyint(4) NOT NULL DEFAULT '0' AFTER `email`,
+    ADD COLUMN `verified_email` varchar(64) COLLATE utf8mb4_general_ci
+        GENERATED ALWAYS AS (IF(`email_verified` = 1, `email`, NULL)) VIRTUAL AFTER `email_verified`,
+    ADD KEY `idx_email` (`email`) USING BTREE,
+    ADD UNIQUE KEY `idx_verified_email` (`verified_email`) USING BTREE;
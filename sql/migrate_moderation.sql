@@ -0,0 +1,37 @@
+-- 新增社区管理相关的表：置顶、禁言和管理日志，已有数据不需要迁移
+-- post表的status字段新增取值2，表示被版主移除，字段定义不变
+
+CREATE TABLE IF NOT EXISTS bluebell.community_pin (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',
+    `post_id` bigint(20) NOT NULL COMMENT '帖子id',
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '置顶时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_post_id` (`post_id`),
+    KEY `idx_community_id` (`community_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS bluebell.community_ban (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',
+    `reason` varchar(256) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '原因',
+    `expire_time` timestamp NULL DEFAULT NULL COMMENT '到期时间',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_community_user` (`community_id`, `user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS bluebell.mod_log (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',
+    `action` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '操作类型',
+    `target_id` bigint(20) NOT NULL COMMENT '操作对象id',
+    `reason` varchar(256) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '原因',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '操作时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_community_id` (`community_id`, `id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
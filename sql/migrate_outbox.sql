@@ -0,0 +1,16 @@
+-- 新增outbox事件表，发帖时帖子和事件在同一个事务中写入，由转发任务应用到Redis，已有数据不需要迁移
+
+CREATE TABLE IF NOT EXISTS bluebell.outbox (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `event_type` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '事件类型',
+    `aggregate_id` bigint(20) NOT NULL COMMENT '业务对象ID',
+    `payload` text COLLATE utf8mb4_general_ci NOT NULL COMMENT '事件内容',
+    `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '事件状态',
+    `retry_count` int(11) NOT NULL DEFAULT '0' COMMENT '重试次数',
+    `next_retry_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次处理时间',
+    `last_error` varchar(512) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '最近一次错误',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_status_next_retry` (`status`, `next_retry_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
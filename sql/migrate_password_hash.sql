@@ -0,0 +1,3 @@
+-- 加宽user表的password字段，容纳bcrypt/argon2id的哈希字符串
+-- 已有的md5哈希不需要处理，用户下次登录成功后会自动用新算法重新哈希
+ALTER TABLE bluebell.user MODIFY COLUMN password varchar(255) COLLATE utf8mb4_general_ci NOT NULL;
@@ -0,0 +1,13 @@
+-- 新增帖子锁定表，持久化版主锁定帖子的状态
+-- 之前锁定状态只保存在Redis的bluebell:post:locked集合中，升级后对这些帖子再执行一次锁定即可写入本表，
+-- Redis中的状态不变；写入之前不要执行cmd/rebuild，它按本表重建post:locked，不在本表中的帖子会被解锁
+
+CREATE TABLE IF NOT EXISTS bluebell.post_lock (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `community_id` bigint(20) NOT NULL COMMENT '社区id',
+    `post_id` bigint(20) NOT NULL COMMENT '帖子id',
+    `operator_id` bigint(20) NOT NULL COMMENT '操作人id',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '锁定时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_post_id` (`post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,28 @@
+-- 将旧版本的post_vote表迁移到通用的vote表
+-- target_type = 1 表示帖子，对应models.VoteTargetPost
+-- 执行后再执行sql/migrate_vote_time.sql添加vote_time字段
+
+CREATE TABLE IF NOT EXISTS bluebell.vote (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `target_type` tinyint(4) NOT NULL COMMENT '投票对象类型',
+    `target_id` bigint(20) NOT NULL COMMENT '投票对象ID',
+    `user_id` bigint(20) NOT NULL COMMENT '用户ID',
+    `vote_type` tinyint(4) NOT NULL DEFAULT '1' COMMENT '投票类型',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_target_user` (`target_type`, `target_id`, `user_id`) COMMENT '防止重复投票'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- 按sql目录中的文件新建的数据库没有post_vote表，只创建vote表，跳过数据迁移
+SET @has_post_vote = (SELECT COUNT(*) FROM information_schema.tables
+    WHERE table_schema = 'bluebell' AND table_name = 'post_vote');
+SET @copy_post_vote = IF(@has_post_vote > 0,
+    'INSERT INTO bluebell.vote (target_type, target_id, user_id, vote_type, create_time)
+    SELECT 1, post_id, user_id, vote_type, create_time FROM bluebell.post_vote
+    ON DUPLICATE KEY UPDATE vote_type = VALUES(vote_type)',
+    'DO 0');
+PREPARE copy_post_vote FROM @copy_post_vote;
+EXECUTE copy_post_vote;
+DEALLOCATE PREPARE copy_post_vote;
+
+DROP TABLE IF EXISTS bluebell.post_vote;
@@ -0,0 +1,30 @@
+-- 新增用户举报相关的表，已有数据不需要迁移
+-- post表的status字段新增取值3，表示被举报次数过多自动隐藏，字段定义不变
+
+CREATE TABLE IF NOT EXISTS bluebell.report_target (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `target_type` tinyint(4) NOT NULL COMMENT '被举报对象类型',
+    `target_id` bigint(20) NOT NULL COMMENT '被举报对象ID',
+    `community_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '所属社区',
+    `report_count` int(11) NOT NULL DEFAULT '0' COMMENT '未处理的举报数',
+    `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '处理状态',
+    `handler_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '处理人id',
+    `handle_time` timestamp NULL DEFAULT NULL COMMENT '处理时间',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_target` (`target_type`, `target_id`),
+    KEY `idx_status_count` (`status`, `report_count`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS bluebell.report (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `report_target_id` bigint(20) NOT NULL COMMENT '被举报对象记录id',
+    `reporter_id` bigint(20) NOT NULL COMMENT '举报人id',
+    `reason` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '举报原因',
+    `detail` varchar(512) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '补充说明',
+    `handled` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否已处理',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '举报时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_target_reporter` (`report_target_id`, `reporter_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
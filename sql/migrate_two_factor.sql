@@ -0,0 +1,22 @@
+-- 新增两步验证表和恢复码表，已有的用户默认没有开启两步验证，不需要迁移数据
+CREATE TABLE IF NOT EXISTS bluebell.user_totp (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `secret` varchar(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT 'TOTP密钥',
+    `enabled` tinyint(4) NOT NULL DEFAULT '0' COMMENT '是否已开启',
+    `last_counter` bigint(20) NOT NULL DEFAULT '0' COMMENT '最近使用的时间步',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    `update_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS bluebell.user_recovery_code (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `code_hash` char(64) COLLATE utf8mb4_general_ci NOT NULL COMMENT '恢复码的sha256',
+    `used_time` timestamp NULL DEFAULT NULL COMMENT '使用时间',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_user_code` (`user_id`, `code_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,12 @@
+-- 新增第三方账号表，已有的用户默认没有绑定第三方账号，不需要迁移数据
+CREATE TABLE IF NOT EXISTS bluebell.user_identity (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `provider` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '身份提供方',
+    `subject` varchar(255) COLLATE utf8mb4_general_ci NOT NULL COMMENT '身份提供方的用户标识',
+    `email` varchar(64) COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' COMMENT '身份提供方返回的邮箱',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '绑定时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_provider_subject` (`provider`, `subject`),
+    UNIQUE KEY `uk_user_provider` (`user_id`, `provider`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,11 @@
+-- 新增用户角色表，已有的用户都是普通用户，不需要迁移数据
+-- 管理员可以先配置在admin.user_ids中，登录后通过 /api/v1/admin/roles 接口授予角色
+CREATE TABLE IF NOT EXISTS bluebell.user_role (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `user_id` bigint(20) NOT NULL COMMENT '用户id',
+    `role` varchar(32) COLLATE utf8mb4_general_ci NOT NULL COMMENT '角色',
+    `community_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '社区id',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_user_role` (`user_id`, `role`, `community_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,13 @@
+-- 新增投票归档表，保存投票时间窗口结束后的最终投票数，已有数据不需要迁移
+-- 尚未过期的投票仍然在Redis中，归档任务会在它们过期后自动写入本表
+
+CREATE TABLE IF NOT EXISTS bluebell.vote_archive (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `target_type` tinyint(4) NOT NULL COMMENT '投票对象类型',
+    `target_id` bigint(20) NOT NULL COMMENT '投票对象ID',
+    `up_votes` int(11) NOT NULL DEFAULT '0' COMMENT '赞成票数',
+    `down_votes` int(11) NOT NULL DEFAULT '0' COMMENT '反对票数',
+    `create_time` timestamp NULL DEFAULT CURRENT_TIMESTAMP COMMENT '归档时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_target` (`target_type`, `target_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,3 @@
+-- vote表新增vote_time字段，记录投票发生的毫秒时间戳
+-- 投票队列写入时只用更新的投票覆盖已有记录，已有记录的vote_time为0，会被任何新的投票覆盖
+ALTER TABLE bluebell.vote ADD COLUMN `vote_time` bigint(20) NOT NULL DEFAULT '0' COMMENT '投票时间' AFTER `vote_type`;